@@ -5,14 +5,21 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/armatrix/claude-agent-sdk-go/hook"
 	"github.com/armatrix/claude-agent-sdk-go/internal/budget"
 	"github.com/armatrix/claude-agent-sdk-go/internal/config"
 	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
 	"github.com/armatrix/claude-agent-sdk-go/internal/hookrunner"
+	"github.com/armatrix/claude-agent-sdk-go/internal/schema"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
 	"github.com/armatrix/claude-agent-sdk-go/permission"
 )
 
@@ -25,6 +32,11 @@ type Agent struct {
 
 	closeOnce sync.Once
 	closeErr  error
+
+	// batchBudgets holds the WithBudget limit of the agent's batches, per
+	// budget they draw from (nil for none); see batchBudget.
+	batchMu      sync.Mutex
+	batchBudgets map[*Budget]*Budget
 }
 
 // NewAgent creates a new Agent with the given options.
@@ -37,20 +49,28 @@ func NewAgent(opts ...AgentOption) *Agent {
 	}
 
 	resolved := resolveOptions(opts)
+	logger := resolved.logger
+	if logger == nil {
+		logger = discardLogger
+	}
 
 	// Apply settings overrides from JSON config files
 	// User-explicit options take precedence over file-based settings
 	if len(resolved.settingSources) > 0 {
-		settings, err := config.LoadSettings(resolved.settingSources...)
+		settings, err := config.LoadSettingsLogged(logger, resolved.settingSources...)
 		if err == nil {
 			applySettings(&resolved, settings, &userSet)
+		} else {
+			logger.Warn("ignoring settings files", "error", err)
 		}
 	}
 
 	// Load skills and prepend to system prompt
 	if len(resolved.skillDirs) > 0 {
-		skills, err := config.LoadSkills(resolved.skillDirs...)
-		if err == nil && len(skills) > 0 {
+		skills, err := config.LoadSkillsLogged(logger, resolved.skillDirs...)
+		if err != nil {
+			logger.Warn("ignoring skills", "error", err)
+		} else if len(skills) > 0 {
 			skillsPrompt := config.FormatSkillsPrompt(skills)
 			resolved.systemPrompt = skillsPrompt + resolved.systemPrompt
 		}
@@ -107,99 +127,225 @@ func (a *Agent) Tools() *ToolRegistry {
 }
 
 // Run starts a single-shot agent execution with a new session.
-// Returns an AgentStream for iterating over events.
+// Returns an AgentStream for iterating over events. The session ends with
+// the run: WithOnSessionClose callbacks run before the stream is closed.
 func (a *Agent) Run(ctx context.Context, prompt string) *AgentStream {
-	return a.RunWithSession(ctx, NewSession(), prompt)
+	session := NewSession()
+	return a.runWithSession(ctx, session, prompt, nil, func() {
+		if err := a.closeSession(context.WithoutCancel(ctx), session.ID); err != nil {
+			a.Logger().Warn("session resources not released", LogKeySessionID, session.ID, "error", err)
+		}
+	})
+}
+
+// closeSession runs the WithOnSessionClose callbacks for sessionID.
+func (a *Agent) closeSession(ctx context.Context, sessionID string) error {
+	var errs []error
+	for _, fn := range a.opts.onSessionClose {
+		errs = append(errs, fn(ctx, sessionID))
+	}
+	return errors.Join(errs...)
 }
 
 // RunWithSession starts an agent execution using an existing session.
 // The session's message history is preserved and extended.
 func (a *Agent) RunWithSession(ctx context.Context, session *Session, prompt string) *AgentStream {
-	// Inject workDir, env, and sandbox into context for tool execution
-	if a.opts.workDir != "" {
-		ctx = WithContextWorkDir(ctx, a.opts.workDir)
+	return a.runWithSession(ctx, session, prompt, nil, nil)
+}
+
+// runSettings are the options a Client can change between queries.
+type runSettings struct {
+	model             anthropic.Model
+	maxThinkingTokens int64
+	permissionMode    permission.Mode
+}
+
+// settings returns the agent's configured runSettings.
+func (a *Agent) settings() runSettings {
+	return runSettings{
+		model:             a.opts.model,
+		maxThinkingTokens: a.opts.maxThinkingTokens,
+		permissionMode:    a.opts.permissionMode,
+	}
+}
+
+// runWithSession runs with a copy of the agent's options taken at the
+// start, overridden by settings if non-nil. onDone, if non-nil, is called
+// when the run has ended, before the stream is closed.
+func (a *Agent) runWithSession(ctx context.Context, session *Session, prompt string, settings *runSettings, onDone func()) *AgentStream {
+	opts := a.opts
+	if settings != nil {
+		opts.model = settings.model
+		opts.maxThinkingTokens = settings.maxThinkingTokens
+		opts.permissionMode = settings.permissionMode
+	}
+
+	// Output that cannot be validated must not be returned as valid, so a
+	// bad schema fails the run before the model is called.
+	var outputValidator *schema.Validator
+	if opts.outputFormat != nil {
+		v, err := opts.outputFormat.validator()
+		if err != nil {
+			if onDone != nil {
+				onDone()
+			}
+			return errorStream(err, session)
+		}
+		outputValidator = v
+	}
+
+	// Inject session, workDir, env, and sandbox into context for tool execution
+	ctx = WithContextSessionID(ctx, session.ID)
+	if opts.workDir != "" {
+		ctx = WithContextWorkDir(ctx, opts.workDir)
+	}
+	if len(opts.env) > 0 {
+		ctx = WithContextEnv(ctx, opts.env)
 	}
-	if len(a.opts.env) > 0 {
-		ctx = WithContextEnv(ctx, a.opts.env)
+	if opts.sandbox != nil {
+		ctx = WithContextSandbox(ctx, opts.sandbox)
 	}
-	if a.opts.sandbox != nil {
-		ctx = WithContextSandbox(ctx, a.opts.sandbox)
+	if opts.metrics != nil {
+		ctx = WithContextMetrics(ctx, opts.metrics)
 	}
+	runMetrics := ContextMetrics(ctx)
+	ctx, logger := a.runLogger(ctx, session.ID, GenerateID(PrefixRun))
 
 	// Build hook runner once (reused for UserPromptSubmit and engine loop)
 	var hookRunner *hookrunner.Runner
-	if len(a.opts.hookMatchers) > 0 {
-		runner, err := hookrunner.New(a.opts.hookMatchers)
+	if len(opts.hookMatchers) > 0 {
+		runner, err := hookrunner.New(opts.hookMatchers)
 		if err == nil {
 			hookRunner = runner
+		} else {
+			logger.Warn("hooks disabled for run", "error", err)
 		}
 	}
 
 	// Fire UserPromptSubmit hook before appending user message
 	if hookRunner != nil {
-		_, _ = hookRunner.RunUserPromptSubmit(ctx, session.ID, prompt)
+		if _, err := hookRunner.RunUserPromptSubmit(ctx, session.ID, prompt); err != nil {
+			runMetrics.Add(metrics.HookFailures, 1, metrics.L(metrics.LabelEvent, string(hook.UserPromptSubmit)))
+			logger.Warn("hook failed", "event", string(hook.UserPromptSubmit), "error", err)
+		}
 	}
 
 	// Append user prompt to session
 	session.Messages = append(session.Messages,
 		anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)))
 
-	eventCh := make(chan Event, a.opts.streamBufferSize)
+	eventCh := make(chan Event, opts.streamBufferSize)
 	stream := newStream(eventCh, session)
+	stream.ctx = ctx
+	ctx, stream.cancel = context.WithCancel(ctx)
+	stream.abandoned = make(chan struct{})
+
+	// Root span of the run; API call and tool spans nest under it, and runs
+	// started by tools (subagents) join the same trace through ctx.
+	tracer := a.tracer(ctx)
+	ctx, runSpan := a.startRunSpan(ctx, tracer, session.ID, opts.model)
+
+	// Native structured output requires the beta endpoint.
+	nativeOutput := opts.outputFormat != nil && opts.outputFormat.native()
 
 	// Choose streamer based on compaction strategy and beta flags
 	var streamer engine.MessageStreamer
 	compactCfg := engine.CompactConfig{
 		Strategy:          engine.CompactServer,
-		TriggerTokens:     a.opts.compact.TriggerTokens,
-		PauseAfterCompact: a.opts.compact.PauseAfterCompact,
-		Instructions:      a.opts.compact.Instructions,
+		TriggerTokens:     opts.compact.TriggerTokens,
+		PauseAfterCompact: opts.compact.PauseAfterCompact,
+		Instructions:      opts.compact.Instructions,
 	}
 	switch {
-	case a.opts.compact.Strategy == CompactServer && len(a.opts.betas) > 0:
-		streamer = engine.NewCompactStreamerWithBetas(a.apiClient, compactCfg, a.opts.betas)
-	case a.opts.compact.Strategy == CompactServer:
+	case opts.provider != nil:
+		streamer = opts.provider
+	case opts.compact.Strategy == CompactServer && len(opts.betas) > 0:
+		streamer = engine.NewCompactStreamerWithBetas(a.apiClient, compactCfg, opts.betas)
+	case opts.compact.Strategy == CompactServer:
 		streamer = engine.NewCompactStreamer(a.apiClient, compactCfg)
-	case len(a.opts.betas) > 0:
-		streamer = engine.NewBetaStreamer(a.apiClient, a.opts.betas)
+	case len(opts.betas) > 0 || nativeOutput:
+		streamer = engine.NewBetaStreamer(a.apiClient, opts.betas)
 	default:
 		streamer = engine.NewMessageStreamer(&a.apiClient.Messages)
 	}
 
+	sink := &channelSink{
+		ch:           eventCh,
+		ctx:          ctx,
+		abandoned:    stream.abandoned,
+		overflow:     opts.streamOverflow,
+		session:      session,
+		span:         runSpan,
+		store:        opts.sessionStore,
+		autoSave:     opts.autoSave,
+		saveInterval: opts.autoSaveInterval,
+		pricing:      pricingAdapter(opts.pricing),
+	}
+	if model := opts.autoTitleModel; model != "" {
+		sink.titler = func(session *Session) *titleCall {
+			return startTitle(ctx, streamer, model, session)
+		}
+	}
+
 	cfg := engine.LoopConfig{
 		Streamer:          streamer,
 		Tools:             &toolExecutorAdapter{registry: a.tools},
-		Model:             a.opts.model,
-		FallbackModel:     a.opts.fallbackModel,
-		MaxTokens:         a.opts.maxOutputTokens,
-		MaxTurns:          a.opts.maxTurns,
-		MaxThinkingTokens: a.opts.maxThinkingTokens,
-		Betas:             a.opts.betas,
+		Model:             opts.model,
+		FallbackModel:     opts.fallbackModel,
+		MaxTokens:         opts.maxOutputTokens,
+		MaxTurns:          opts.maxTurns,
+		MaxThinkingTokens: opts.maxThinkingTokens,
+		Betas:             opts.betas,
 		Messages:          &session.Messages,
 		SessionID:         session.ID,
-		Sink:              &channelSink{ch: eventCh},
+		Sink:              sink,
+		Pricing:           pricingAdapter(opts.pricing),
+		Tracer:            tracer,
+		ProviderName:      a.providerName(),
+		Metrics:           runMetrics,
+		Logger:            logger,
+		RedactToolIO:      opts.redactToolIO,
 	}
 
 	// Wire system prompt
-	if a.opts.systemPrompt != "" {
+	if opts.systemPrompt != "" {
 		cfg.SystemPrompt = []anthropic.TextBlockParam{
-			{Text: a.opts.systemPrompt},
+			{Text: opts.systemPrompt},
 		}
 	}
 
-	// Wire budget tracker
-	if !a.opts.maxBudget.IsZero() {
-		tracker := budget.NewBudgetTracker(a.opts.maxBudget, budget.DefaultPricing)
-		cfg.Budget = &budgetAdapter{tracker: tracker}
+	// Wire checkpoints before the budget, so calls it refuses record none.
+	if opts.checkpointer != nil {
+		cfg.Tools = &checkpointToolExecutor{ToolExecutor: cfg.Tools, checkpointer: opts.checkpointer, session: session, logger: logger}
+	}
+
+	// Wire budget: shared across runs via WithSharedBudget or the parent
+	// tool call's context, otherwise a fresh per-run limit.
+	if runBudget := a.runBudget(ctx); runBudget != nil {
+		cfg.Budget = &budgetAdapter{tracker: runBudget.tracker, pricing: pricingAdapter(opts.pricing)}
+		if policy := opts.budgetPolicy; policy != nil {
+			cfg.BudgetPolicy = policy.engineConfig()
+		}
+		cfg.Tools = &budgetToolExecutor{ToolExecutor: cfg.Tools, budget: runBudget, policy: opts.budgetPolicy}
 	}
 
 	// Wire structured output
-	if a.opts.outputFormat != nil {
-		format := *a.opts.outputFormat
-		cfg.OutputToolName = format.Name
-		cfg.OutputToolInjector = func(params *anthropic.MessageNewParams) {
-			injectOutputTool(params, format)
+	if opts.outputFormat != nil {
+		format := *opts.outputFormat
+		if format.native() {
+			if outputSchema, err := schema.ToStrictMap(format.Schema); err == nil {
+				cfg.OutputFormat = outputSchema
+			} else {
+				logger.Warn("output schema not sent to the model", "error", err)
+			}
+		} else {
+			cfg.OutputToolName = format.Name
+			cfg.OutputToolInjector = func(params *anthropic.MessageNewParams) {
+				injectOutputTool(params, format)
+			}
 		}
+		cfg.OutputValidator = outputValidator.Validate
+		cfg.MaxOutputRetries = format.maxRetries()
 	}
 
 	// Wire hooks (reuse runner built above)
@@ -208,13 +354,26 @@ func (a *Agent) RunWithSession(ctx context.Context, session *Session, prompt str
 	}
 
 	// Wire permissions
-	if a.opts.permissionMode != permission.ModeDefault || a.opts.permissionFunc != nil || len(a.opts.permissionRules) > 0 {
-		checker := permission.NewCheckerWithRules(a.opts.permissionMode, a.opts.permissionRules, a.opts.permissionFunc)
+	if opts.permissionMode != permission.ModeDefault || opts.permissionFunc != nil || len(opts.permissionRules) > 0 {
+		checker := permission.NewCheckerWithRules(opts.permissionMode, opts.permissionRules, opts.permissionFunc)
 		cfg.Permission = &permissionAdapter{checker: checker}
 	}
 
 	go func() {
 		engine.RunLoop(ctx, cfg)
+		if call := sink.title; call != nil {
+			<-call.done
+			cost := engine.RecordCall(runMetrics, cfg.Budget, cfg.Pricing, call.model, call.usage, call.elapsed, call.err)
+			if call.err != nil {
+				logger.Warn("session title not generated", "error", call.err)
+			}
+			sink.finishTitle(call, cost)
+		}
+		runSpan.End()
+		stream.cancel()
+		if onDone != nil {
+			onDone()
+		}
 		close(eventCh)
 	}()
 
@@ -287,18 +446,222 @@ func extractTextFromBlocks(blocks []anthropic.ContentBlockParamUnion) string {
 // channelSink implements internal/agent.EventSink by sending events to a channel.
 type channelSink struct {
 	ch chan Event
+	// ctx is the run's context; its error is the cause of a cancelled run.
+	// Sends give up once it ends or abandoned is closed.
+	ctx       context.Context
+	abandoned <-chan struct{}
+	overflow  OverflowPolicy
+	// pending holds coalesced deltas not yet sent.
+	pending strings.Builder
+
+	// session, if set, receives the usage and cost of each response, and
+	// the run's totals on result.
+	session *Session
+	// counted is what the responses so far added to the session's metadata,
+	// which the totals on result replace.
+	counted SessionMeta
+	// pricing estimates the cost of each response before the run's totals.
+	pricing pricingAdapter
+	// model is the model that served the most recent response.
+	model anthropic.Model
+	// span, if set, is the run's root span and receives its totals on result.
+	span trace.Span
+
+	// store, if set, receives the session as autoSave says, at most once
+	// per saveInterval before the end of the run.
+	store        SessionStore
+	autoSave     AutoSavePolicy
+	saveInterval time.Duration
+	lastSave     time.Time
+	// dirty reports that the session changed since it was last saved.
+	dirty bool
+	// titler, if set, starts titling the session at the end of a
+	// successful run, and title is the call it started.
+	titler func(*Session) *titleCall
+	title  *titleCall
+}
+
+// send delivers e after any coalesced deltas, so they keep their order.
+func (s *channelSink) send(e Event) {
+	if s.pending.Len() > 0 {
+		delta := &StreamEvent{Delta: s.pending.String()}
+		s.pending.Reset()
+		s.deliver(delta)
+	}
+	s.deliver(e)
+}
+
+// deliver waits for room in the buffer until the run's context ends or
+// the stream is abandoned, in which case e is dropped.
+func (s *channelSink) deliver(e Event) {
+	select {
+	case s.ch <- e:
+		return
+	default:
+	}
+	var done <-chan struct{}
+	if s.ctx != nil {
+		done = s.ctx.Done()
+	}
+	select {
+	case s.ch <- e:
+	case <-done:
+	case <-s.abandoned:
+	}
+}
+
+// trySend delivers e only if the buffer has room.
+func (s *channelSink) trySend(e Event) bool {
+	select {
+	case s.ch <- e:
+		return true
+	default:
+		return false
+	}
 }
 
 func (s *channelSink) OnSystem(sessionID string, model anthropic.Model) {
-	s.ch <- &SystemEvent{SessionID: sessionID, Model: model}
+	s.send(&SystemEvent{SessionID: sessionID, Model: model})
 }
 
 func (s *channelSink) OnStream(delta string) {
-	s.ch <- &StreamEvent{Delta: delta}
+	switch s.overflow {
+	case OverflowDropDeltas:
+		s.trySend(&StreamEvent{Delta: delta})
+	case OverflowCoalesceDeltas:
+		s.pending.WriteString(delta)
+		if s.trySend(&StreamEvent{Delta: s.pending.String()}) {
+			s.pending.Reset()
+		}
+	default:
+		s.send(&StreamEvent{Delta: delta})
+	}
 }
 
 func (s *channelSink) OnAssistant(msg anthropic.Message) {
-	s.ch <- &AssistantEvent{Message: msg}
+	if msg.Model != "" {
+		s.model = msg.Model
+	}
+	if s.session != nil {
+		s.session.RecordResponse(msg)
+		s.countResponse(msg)
+	}
+	s.send(&AssistantEvent{Message: msg})
+	s.save(false)
+}
+
+func (s *channelSink) OnUser(msg anthropic.MessageParam) {
+	if s.session != nil {
+		s.session.UpdatedAt = time.Now()
+		s.dirty = true
+	}
+	s.send(&UserEvent{Message: msg})
+	s.save(false)
+}
+
+// countResponse adds the usage and estimated cost of msg to the session's
+// metadata, so a save before the end of the run includes them.
+func (s *channelSink) countResponse(msg anthropic.Message) {
+	var added SessionMeta
+	added.NumTurns = 1
+	added.TotalTokens = Usage{
+		InputTokens:              msg.Usage.InputTokens,
+		OutputTokens:             msg.Usage.OutputTokens,
+		CacheReadInputTokens:     msg.Usage.CacheReadInputTokens,
+		CacheCreationInputTokens: msg.Usage.CacheCreationInputTokens,
+	}
+	added.TotalCost = s.pricing.Cost(s.model, engine.BudgetUsage{
+		InputTokens:   int(msg.Usage.InputTokens),
+		OutputTokens:  int(msg.Usage.OutputTokens),
+		CacheRead:     int(msg.Usage.CacheReadInputTokens),
+		CacheCreation: int(msg.Usage.CacheCreationInputTokens),
+	})
+
+	addMeta(&s.counted, added)
+	addMeta(&s.session.Metadata, added)
+	if s.model != "" {
+		s.session.Metadata.Model = s.model
+	}
+	s.session.UpdatedAt = time.Now()
+	s.dirty = true
+}
+
+// addMeta adds the counters of delta to meta.
+func addMeta(meta *SessionMeta, delta SessionMeta) {
+	meta.TotalCost = meta.TotalCost.Add(delta.TotalCost)
+	meta.TotalTokens.InputTokens += delta.TotalTokens.InputTokens
+	meta.TotalTokens.OutputTokens += delta.TotalTokens.OutputTokens
+	meta.TotalTokens.CacheReadInputTokens += delta.TotalTokens.CacheReadInputTokens
+	meta.TotalTokens.CacheCreationInputTokens += delta.TotalTokens.CacheCreationInputTokens
+	meta.NumTurns += delta.NumTurns
+}
+
+// finishTitle sets the title generated by call, if any, and adds the
+// usage and cost of the call to the session's metadata, saving it again.
+func (s *channelSink) finishTitle(call *titleCall, cost decimal.Decimal) {
+	addMeta(&s.session.Metadata, SessionMeta{
+		TotalCost: cost,
+		TotalTokens: Usage{
+			InputTokens:              call.usage.InputTokens,
+			OutputTokens:             call.usage.OutputTokens,
+			CacheReadInputTokens:     call.usage.CacheReadInputTokens,
+			CacheCreationInputTokens: call.usage.CacheCreationInputTokens,
+		},
+	})
+	if call.title != "" {
+		s.session.Metadata.Title = call.title
+	}
+	s.session.UpdatedAt = time.Now()
+	s.dirty = true
+	s.save(true)
+}
+
+// save saves the session if it changed and the auto-save policy calls for
+// it. Unless final, saves are skipped within saveInterval of the last
+// one. A failed save is reported as a SessionSaveErrorEvent.
+func (s *channelSink) save(final bool) {
+	if s.store == nil || s.session == nil || !s.dirty {
+		return
+	}
+	switch s.autoSave {
+	case AutoSaveManual:
+		return
+	case AutoSaveEndOfRun:
+		if !final {
+			return
+		}
+	}
+	if !final && s.saveInterval > 0 && time.Since(s.lastSave) < s.saveInterval {
+		return
+	}
+
+	// Save even when the run was cancelled, so its last turns are kept.
+	ctx := context.Background()
+	if s.ctx != nil {
+		ctx = context.WithoutCancel(s.ctx)
+	}
+	s.dirty = false
+	s.lastSave = time.Now()
+	if err := s.store.Save(ctx, s.session); err != nil {
+		s.send(&SessionSaveErrorEvent{SessionID: s.session.ID, Err: err})
+	}
+}
+
+func (s *channelSink) OnBudgetWarning(info engine.BudgetWarningInfo) {
+	s.send(&BudgetWarningEvent{
+		Threshold:    info.Threshold,
+		UsedFraction: info.UsedFraction,
+		WrapUp:       info.WrapUp,
+		Model:        info.Model,
+	})
+}
+
+func (s *channelSink) OnHistoryRepair(r engine.HistoryRepair) {
+	if s.session != nil {
+		s.session.UpdatedAt = time.Now()
+		s.dirty = true
+	}
+	s.send(&HistoryRepairEvent{Kind: HistoryRepairKind(r.Kind), MessageIndex: r.MessageIndex, ToolUseID: r.ToolUseID})
 }
 
 func (s *channelSink) OnCompact(info engine.CompactInfo) {
@@ -306,39 +669,77 @@ func (s *channelSink) OnCompact(info engine.CompactInfo) {
 	if info.Strategy == engine.CompactServer {
 		strategy = CompactServer
 	}
-	s.ch <- &CompactEvent{Strategy: strategy}
+	s.send(&CompactEvent{Strategy: strategy})
 }
 
 func (s *channelSink) OnResult(info engine.ResultInfo) {
 	result := extractResultText(info)
+	if s.span != nil {
+		recordRunResult(s.span, info)
+	}
 
 	var modelUsage map[string]ModelUsage
 	if len(info.ModelUsage) > 0 {
 		modelUsage = make(map[string]ModelUsage, len(info.ModelUsage))
 		for model, mu := range info.ModelUsage {
 			modelUsage[model] = ModelUsage{
-				InputTokens:  mu.InputTokens,
-				OutputTokens: mu.OutputTokens,
+				InputTokens:              mu.InputTokens,
+				OutputTokens:             mu.OutputTokens,
+				CacheReadInputTokens:     mu.CacheReadInputTokens,
+				CacheCreationInputTokens: mu.CacheCreationInputTokens,
+				TotalCost:                mu.TotalCost,
 			}
 		}
 	}
 
-	s.ch <- &ResultEvent{
-		Subtype:   info.Subtype,
-		SessionID: info.SessionID,
-		IsError:   info.IsError,
-		NumTurns:  info.NumTurns,
-		Usage: Usage{
-			InputTokens:              info.InputTokens,
-			OutputTokens:             info.OutputTokens,
-			CacheReadInputTokens:     info.CacheReadInputTokens,
-			CacheCreationInputTokens: info.CacheCreationInputTokens,
-		},
-		ModelUsage: modelUsage,
-		DurationMs: info.DurationMs,
-		Result:     result,
-		Errors:     info.Errors,
+	usage := Usage{
+		InputTokens:              info.InputTokens,
+		OutputTokens:             info.OutputTokens,
+		CacheReadInputTokens:     info.CacheReadInputTokens,
+		CacheCreationInputTokens: info.CacheCreationInputTokens,
+	}
+
+	// Replace the per-response counts with the run's totals before the
+	// result is observable, so callers that save on ResultEvent persist
+	// them.
+	if s.session != nil {
+		meta := &s.session.Metadata
+		meta.TotalCost = meta.TotalCost.Add(info.TotalCost.Sub(s.counted.TotalCost))
+		meta.TotalTokens.InputTokens += usage.InputTokens - s.counted.TotalTokens.InputTokens
+		meta.TotalTokens.OutputTokens += usage.OutputTokens - s.counted.TotalTokens.OutputTokens
+		meta.TotalTokens.CacheReadInputTokens += usage.CacheReadInputTokens - s.counted.TotalTokens.CacheReadInputTokens
+		meta.TotalTokens.CacheCreationInputTokens += usage.CacheCreationInputTokens - s.counted.TotalTokens.CacheCreationInputTokens
+		meta.NumTurns += info.NumTurns - s.counted.NumTurns
+		s.counted = SessionMeta{}
+		if s.model != "" {
+			meta.Model = s.model
+		}
+		if s.titler != nil && meta.Title == "" && !info.IsError {
+			s.title = s.titler(s.session)
+		}
+		s.session.UpdatedAt = time.Now()
+		s.dirty = true
+		s.save(true)
+	}
+
+	event := &ResultEvent{
+		Subtype:          info.Subtype,
+		SessionID:        info.SessionID,
+		IsError:          info.IsError,
+		NumTurns:         info.NumTurns,
+		TotalCost:        info.TotalCost,
+		Usage:            usage,
+		ModelUsage:       modelUsage,
+		DurationMs:       info.DurationMs,
+		DurationAPIMs:    info.DurationAPIMs,
+		Result:           result,
+		Errors:           info.Errors,
+		StructuredOutput: info.StructuredOutput,
 	}
+	if info.IsError && s.ctx != nil {
+		event.cause = s.ctx.Err()
+	}
+	s.send(event)
 }
 
 func extractResultText(info engine.ResultInfo) string {
@@ -348,24 +749,53 @@ func extractResultText(info engine.ResultInfo) string {
 	return ""
 }
 
+// pricingAdapter prices usage with a per-model pricing table to implement
+// engine.CostCalculator. Unknown models cost zero.
+type pricingAdapter map[anthropic.Model]budget.ModelPricing
+
+func (p pricingAdapter) Cost(model anthropic.Model, usage engine.BudgetUsage) decimal.Decimal {
+	pricing, ok := p[model]
+	if !ok {
+		return decimal.Zero
+	}
+	return pricing.Cost(budget.Usage{
+		InputTokens:              usage.InputTokens,
+		OutputTokens:             usage.OutputTokens,
+		CacheReadInputTokens:     usage.CacheRead,
+		CacheCreationInputTokens: usage.CacheCreation,
+	})
+}
+
 // budgetAdapter wraps budget.BudgetTracker to implement engine.BudgetChecker.
+// When pricing is set, usage is priced with the agent's pricing rather than
+// the tracker's, so a budget shared across agents stays accurate.
 type budgetAdapter struct {
 	tracker *budget.BudgetTracker
+	pricing pricingAdapter
 }
 
 func (b *budgetAdapter) RecordUsage(model anthropic.Model, usage engine.BudgetUsage) {
-	b.tracker.RecordUsage(model, budget.Usage{
+	u := budget.Usage{
 		InputTokens:              usage.InputTokens,
 		OutputTokens:             usage.OutputTokens,
 		CacheReadInputTokens:     usage.CacheRead,
 		CacheCreationInputTokens: usage.CacheCreation,
-	})
+	}
+	if b.pricing != nil {
+		b.tracker.RecordCost(u, b.pricing.Cost(model, usage))
+		return
+	}
+	b.tracker.RecordUsage(model, u)
 }
 
 func (b *budgetAdapter) Exhausted() bool {
 	return b.tracker.Exhausted()
 }
 
+func (b *budgetAdapter) UsedFraction() float64 {
+	return b.tracker.UsedFraction()
+}
+
 // hookRunnerAdapter wraps hookrunner.Runner to implement engine.HookRunner.
 type hookRunnerAdapter struct {
 	runner *hookrunner.Runner
@@ -163,6 +163,77 @@ func TestChannelSink_OnResult_WithErrors(t *testing.T) {
 	assert.Equal(t, "error: stream error: connection reset", rEvt.Result)
 }
 
+func TestChannelSink_OnResult_StructuredOutput(t *testing.T) {
+	ch := make(chan Event, 1)
+	sink := &channelSink{ch: ch}
+
+	sink.OnResult(engine.ResultInfo{
+		Subtype:          "success",
+		StructuredOutput: json.RawMessage(`{"name":"Alice"}`),
+	})
+
+	rEvt, ok := (<-ch).(*ResultEvent)
+	require.True(t, ok)
+	assert.JSONEq(t, `{"name":"Alice"}`, string(rEvt.StructuredOutput))
+}
+
+func TestChannelSink_OnResult_CostAndTiming(t *testing.T) {
+	ch := make(chan Event, 1)
+	sink := &channelSink{ch: ch}
+
+	sink.OnResult(engine.ResultInfo{
+		Subtype:       "success",
+		DurationMs:    900,
+		DurationAPIMs: 700,
+		TotalCost:     decimal.NewFromFloat(0.25),
+		ModelUsage: map[string]engine.PerModelUsage{
+			"m": {InputTokens: 10, OutputTokens: 5, CacheReadInputTokens: 3, TotalCost: decimal.NewFromFloat(0.25)},
+		},
+	})
+
+	rEvt := (<-ch).(*ResultEvent)
+	assert.Equal(t, int64(700), rEvt.DurationAPIMs)
+	assert.True(t, decimal.NewFromFloat(0.25).Equal(rEvt.TotalCost))
+	assert.True(t, decimal.NewFromFloat(0.25).Equal(rEvt.ModelUsage["m"].TotalCost))
+	assert.Equal(t, int64(3), rEvt.ModelUsage["m"].CacheReadInputTokens)
+}
+
+func TestChannelSink_AccumulatesSessionMeta(t *testing.T) {
+	ch := make(chan Event, 4)
+	session := NewSession()
+	sink := &channelSink{ch: ch, session: session}
+
+	sink.OnAssistant(anthropic.Message{Model: anthropic.ModelClaudeSonnet4_5})
+	for range 2 {
+		sink.OnResult(engine.ResultInfo{
+			Subtype:      "success",
+			NumTurns:     2,
+			InputTokens:  100,
+			OutputTokens: 10,
+			TotalCost:    decimal.NewFromFloat(0.5),
+		})
+	}
+
+	meta := session.Metadata
+	assert.True(t, decimal.NewFromInt(1).Equal(meta.TotalCost), "got %s", meta.TotalCost)
+	assert.Equal(t, int64(200), meta.TotalTokens.InputTokens)
+	assert.Equal(t, int64(20), meta.TotalTokens.OutputTokens)
+	assert.Equal(t, 4, meta.NumTurns)
+	assert.Equal(t, anthropic.ModelClaudeSonnet4_5, meta.Model)
+}
+
+// --- pricingAdapter ---
+
+func TestPricingAdapter_Cost(t *testing.T) {
+	p := pricingAdapter(budget.DefaultPricing)
+
+	// 1000 * $5/MTok + 500 * $25/MTok = $0.0175
+	cost := p.Cost(anthropic.ModelClaudeOpus4_6, engine.BudgetUsage{InputTokens: 1000, OutputTokens: 500})
+	assert.True(t, decimal.NewFromFloat(0.0175).Equal(cost), "got %s", cost)
+
+	assert.True(t, p.Cost("unknown-model", engine.BudgetUsage{InputTokens: 1000}).IsZero())
+}
+
 // --- budgetAdapter ---
 
 func TestBudgetAdapter_RecordUsage(t *testing.T) {
@@ -450,6 +521,27 @@ func TestWithHooks_StoresMatchers(t *testing.T) {
 	assert.Equal(t, hook.PostToolUse, opts.hookMatchers[1].Event)
 }
 
+func TestWithHooks_Replaces(t *testing.T) {
+	opts := resolveOptions([]AgentOption{
+		WithHooks(hook.Matcher{Event: hook.PreToolUse}),
+		WithHooks(hook.Matcher{Event: hook.PostToolUse}),
+	})
+
+	require.Len(t, opts.hookMatchers, 1)
+	assert.Equal(t, hook.PostToolUse, opts.hookMatchers[0].Event)
+}
+
+func TestWithAdditionalHooks_Appends(t *testing.T) {
+	opts := resolveOptions([]AgentOption{
+		WithHooks(hook.Matcher{Event: hook.PreToolUse}),
+		WithAdditionalHooks(hook.Matcher{Event: hook.PermissionRequest}),
+	})
+
+	require.Len(t, opts.hookMatchers, 2)
+	assert.Equal(t, hook.PreToolUse, opts.hookMatchers[0].Event)
+	assert.Equal(t, hook.PermissionRequest, opts.hookMatchers[1].Event)
+}
+
 func TestWithPermissionMode_StoresMode(t *testing.T) {
 	opts := resolveOptions([]AgentOption{WithPermissionMode(permission.ModePlan)})
 	assert.Equal(t, permission.ModePlan, opts.permissionMode)
@@ -550,3 +642,21 @@ func (s *stubTool) Execute(ctx context.Context, input stubInput) (*ToolResult, e
 	return TextResult("echo: " + input.Text), nil
 }
 
+
+func TestAgent_Run_ClosesSession(t *testing.T) {
+	closed := make(chan string, 1)
+	a := NewAgent(WithProvider(&scriptedProvider{responses: []string{textResponse("hello")}}),
+		WithOnSessionClose(func(_ context.Context, id string) error {
+			closed <- id
+			return nil
+		}))
+
+	result, err := a.Run(context.Background(), "hi").Result()
+	require.NoError(t, err)
+	select {
+	case id := <-closed:
+		assert.Equal(t, result.SessionID, id)
+	default:
+		t.Fatal("session not closed before the stream ended")
+	}
+}
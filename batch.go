@@ -0,0 +1,507 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/shopspring/decimal"
+
+	"github.com/armatrix/claude-agent-sdk-go/internal/budget"
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
+	"github.com/armatrix/claude-agent-sdk-go/internal/schema"
+)
+
+// BatchItem is a single independent prompt submitted through RunBatch.
+type BatchItem struct {
+	// CustomID identifies the item in the results. It must be unique within
+	// the batch and match ^[a-zA-Z0-9_-]{1,64}$.
+	CustomID string
+	Prompt   string
+}
+
+// BatchResultStatus is the outcome of a single batch item.
+type BatchResultStatus string
+
+const (
+	BatchSucceeded BatchResultStatus = "succeeded"
+	BatchErrored   BatchResultStatus = "errored"
+	BatchCanceled  BatchResultStatus = "canceled"
+	BatchExpired   BatchResultStatus = "expired"
+)
+
+// BatchResult is the outcome of a single batch item.
+type BatchResult struct {
+	CustomID string
+	Status   BatchResultStatus
+
+	// Message is the model's response. Nil unless Status is BatchSucceeded.
+	Message *anthropic.Message
+
+	// Text is the concatenated text content of Message.
+	Text string
+
+	// StructuredOutput holds the schema-validated output when the agent is
+	// configured with WithOutputFormat. Nil if the output failed validation,
+	// in which case Errors lists the violations.
+	StructuredOutput json.RawMessage
+
+	Usage     Usage
+	TotalCost decimal.Decimal // Includes the batch discount
+	Errors    []string
+}
+
+// BatchTracker persists the id of an in-flight batch so a restarted process
+// can re-attach to it instead of submitting the same work again.
+type BatchTracker interface {
+	Save(ctx context.Context, key string, batch TrackedBatch) error
+	// Load returns the batch tracked under key, or a zero TrackedBatch if
+	// none is tracked.
+	Load(ctx context.Context, key string) (TrackedBatch, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// TrackedBatch is the record a BatchTracker keeps for an in-flight batch.
+type TrackedBatch struct {
+	ID string `json:"id"`
+	// Digest is a hash of the submitted requests. RunBatch only re-attaches
+	// to a batch whose digest matches the requests it would submit.
+	Digest string `json:"digest"`
+}
+
+// BatchOption configures a single RunBatch call.
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
+	tracker         BatchTracker
+	key             string
+}
+
+// WithBatchPollInterval sets the initial and maximum delay between status
+// polls. The delay doubles after every poll until it reaches max.
+func WithBatchPollInterval(initial, max time.Duration) BatchOption {
+	return func(o *batchOptions) {
+		o.pollInterval = initial
+		o.maxPollInterval = max
+	}
+}
+
+// WithBatchTracker records the batch id in t while the batch is in flight.
+// If t already tracks a batch for the same key, RunBatch re-attaches to it,
+// or fails with ErrBatchMismatch if that batch has different requests.
+func WithBatchTracker(t BatchTracker) BatchOption {
+	return func(o *batchOptions) { o.tracker = t }
+}
+
+// WithBatchKey sets the key under which the batch id is tracked. By default
+// the key is derived from the requests, so the same items submitted with the
+// same model, system prompt, tools and output format share a key.
+func WithBatchKey(key string) BatchOption {
+	return func(o *batchOptions) { o.key = key }
+}
+
+var customIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// RunBatch submits items through the Message Batches API using the agent's
+// model, system prompt, tools and output format, waits for the batch to end,
+// and returns one result per custom id.
+//
+// Each item is a single model call: tool_use blocks in a response are
+// returned as-is and are not executed. Batches are billed at a discount and
+// may take up to 24 hours to complete; pass WithBatchTracker to survive
+// process restarts. Their cost counts against the agent's budget, and a
+// batch is not submitted once the budget is exhausted. WithBudget limits
+// the cost of all the agent's batches together.
+//
+// Batches go to the Anthropic API with the agent's betas; RunBatch fails
+// with ErrBatchProvider if the agent uses a custom provider, and with
+// ErrOutputSchema if its output schema cannot be validated against.
+func (a *Agent) RunBatch(ctx context.Context, items []BatchItem, opts ...BatchOption) (map[string]*BatchResult, error) {
+	if a.opts.provider != nil {
+		return nil, ErrBatchProvider
+	}
+	requests, err := a.batchRequests(items)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := batchDigest(requests)
+	if err != nil {
+		return nil, err
+	}
+	o := resolveBatchOptions(opts)
+	if o.key == "" {
+		o.key = "batch-" + digest[:16]
+	}
+
+	b := a.batchBudget(ctx)
+	var batchID string
+	if o.tracker != nil {
+		tracked, err := o.tracker.Load(ctx, o.key)
+		if err != nil {
+			return nil, fmt.Errorf("load tracked batch: %w", err)
+		}
+		if tracked.ID != "" && tracked.Digest != digest {
+			return nil, fmt.Errorf("%w: batch %s tracked under %q", ErrBatchMismatch, tracked.ID, o.key)
+		}
+		batchID = tracked.ID
+	}
+
+	if batchID == "" {
+		if b != nil && b.Exhausted() {
+			return nil, ErrBudgetExhausted
+		}
+		batch, err := a.apiClient.Messages.Batches.New(ctx, anthropic.MessageBatchNewParams{Requests: requests}, a.batchRequestOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("create batch: %w", err)
+		}
+		batchID = batch.ID
+		if o.tracker != nil {
+			if err := o.tracker.Save(ctx, o.key, TrackedBatch{ID: batchID, Digest: digest}); err != nil {
+				return nil, fmt.Errorf("track batch %s: %w", batchID, err)
+			}
+		}
+	}
+
+	results, err := a.collectBatch(ctx, batchID, o, b)
+	if err != nil {
+		return nil, err
+	}
+	if o.tracker != nil {
+		if err := o.tracker.Delete(ctx, o.key); err != nil {
+			a.Logger().Warn("batch tracker entry not deleted", "batch_id", batchID, "error", err)
+		}
+	}
+	return results, nil
+}
+
+// AttachBatch waits for an already submitted batch to end and returns its
+// results. Use it to re-attach to a batch id recorded by a previous process.
+// Like RunBatch, it fails with ErrBatchProvider with a custom provider.
+func (a *Agent) AttachBatch(ctx context.Context, batchID string, opts ...BatchOption) (map[string]*BatchResult, error) {
+	if a.opts.provider != nil {
+		return nil, ErrBatchProvider
+	}
+	return a.collectBatch(ctx, batchID, resolveBatchOptions(opts), a.batchBudget(ctx))
+}
+
+// batchRequestOptions sends the agent's betas with every batch request.
+func (a *Agent) batchRequestOptions() []option.RequestOption {
+	opts := make([]option.RequestOption, len(a.opts.betas))
+	for i, beta := range a.opts.betas {
+		opts[i] = option.WithHeaderAdd("anthropic-beta", beta)
+	}
+	return opts
+}
+
+func resolveBatchOptions(opts []BatchOption) batchOptions {
+	o := batchOptions{
+		pollInterval:    DefaultBatchPollInterval,
+		maxPollInterval: DefaultBatchMaxPollInterval,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	if o.maxPollInterval < o.pollInterval {
+		o.maxPollInterval = o.pollInterval
+	}
+	return o
+}
+
+// batchRequests validates items and builds one request per item.
+func (a *Agent) batchRequests(items []BatchItem) ([]anthropic.MessageBatchNewParamsRequest, error) {
+	if len(items) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if a.opts.outputFormat != nil {
+		if _, err := a.opts.outputFormat.validator(); err != nil {
+			return nil, err
+		}
+	}
+	requests := make([]anthropic.MessageBatchNewParamsRequest, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if !customIDPattern.MatchString(item.CustomID) {
+			return nil, fmt.Errorf("agent: invalid batch custom id %q", item.CustomID)
+		}
+		if seen[item.CustomID] {
+			return nil, fmt.Errorf("agent: duplicate batch custom id %q", item.CustomID)
+		}
+		seen[item.CustomID] = true
+		requests = append(requests, anthropic.MessageBatchNewParamsRequest{
+			CustomID: item.CustomID,
+			Params:   a.batchRequestParams(item.Prompt),
+		})
+	}
+	return requests, nil
+}
+
+// batchDigest hashes the requests, including every request parameter,
+// independently of their order.
+func batchDigest(requests []anthropic.MessageBatchNewParamsRequest) (string, error) {
+	lines := make([]string, len(requests))
+	for i, req := range requests {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return "", fmt.Errorf("encode batch request %s: %w", req.CustomID, err)
+		}
+		lines[i] = string(data)
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// batchRequestParams builds the per-item request from the agent's configuration.
+func (a *Agent) batchRequestParams(prompt string) anthropic.MessageBatchNewParamsRequestParams {
+	params := anthropic.MessageNewParams{
+		Model:     a.opts.model,
+		MaxTokens: int64(a.opts.maxOutputTokens),
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(prompt))},
+	}
+	if a.opts.maxThinkingTokens > 0 {
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(a.opts.maxThinkingTokens)
+		if minRequired := a.opts.maxThinkingTokens + 16384; params.MaxTokens < minRequired {
+			params.MaxTokens = minRequired
+		}
+	}
+	if a.opts.systemPrompt != "" {
+		params.System = []anthropic.TextBlockParam{{Text: a.opts.systemPrompt}}
+	}
+	if tools := a.tools.ListForAPI(); len(tools) > 0 {
+		params.Tools = tools
+	}
+	if a.opts.outputFormat != nil {
+		format := *a.opts.outputFormat
+		if format.native() {
+			if outputSchema, err := schema.ToStrictMap(format.Schema); err == nil {
+				params.OutputConfig.Format = anthropic.JSONOutputFormatParam{Schema: outputSchema}
+			} else {
+				a.Logger().Warn("output schema not sent to the model", "error", err)
+			}
+		} else {
+			injectOutputTool(&params, format)
+		}
+	}
+
+	return anthropic.MessageBatchNewParamsRequestParams{
+		Model:        params.Model,
+		MaxTokens:    params.MaxTokens,
+		Messages:     params.Messages,
+		System:       params.System,
+		Thinking:     params.Thinking,
+		Tools:        params.Tools,
+		ToolChoice:   params.ToolChoice,
+		OutputConfig: params.OutputConfig,
+	}
+}
+
+// collectBatch polls until the batch has ended, then streams its results
+// and records their cost in b, which may be nil.
+func (a *Agent) collectBatch(ctx context.Context, batchID string, o batchOptions, b *Budget) (map[string]*BatchResult, error) {
+	var validator *schema.Validator
+	if a.opts.outputFormat != nil {
+		v, err := a.opts.outputFormat.validator()
+		if err != nil {
+			return nil, err
+		}
+		validator = v
+	}
+	reqOpts := a.batchRequestOptions()
+	delay := o.pollInterval
+	for {
+		batch, err := a.apiClient.Messages.Batches.Get(ctx, batchID, reqOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("get batch %s: %w", batchID, err)
+		}
+		if batch.ProcessingStatus == anthropic.MessageBatchProcessingStatusEnded {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, o.maxPollInterval)
+	}
+
+	stream := a.apiClient.Messages.Batches.ResultsStreaming(ctx, batchID, reqOpts...)
+	defer stream.Close()
+
+	results := make(map[string]*BatchResult)
+	for stream.Next() {
+		resp := stream.Current()
+		results[resp.CustomID] = a.batchResult(resp, validator)
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("read batch %s results: %w", batchID, err)
+	}
+	a.recordBatch(ctx, results, b)
+	return results, nil
+}
+
+// recordBatch counts the usage and discounted cost of the succeeded results
+// against b and in the agent's metrics, as runs count their calls.
+func (a *Agent) recordBatch(ctx context.Context, results map[string]*BatchResult, b *Budget) {
+	m := a.opts.metrics
+	if m == nil {
+		m = ContextMetrics(ctx)
+	}
+	for _, r := range results {
+		if r.Message == nil {
+			continue
+		}
+		engine.RecordUsage(m, r.Message.Model, r.Message.Usage, r.TotalCost)
+		if b != nil {
+			b.tracker.RecordCost(budget.Usage{
+				InputTokens:              int(r.Usage.InputTokens),
+				OutputTokens:             int(r.Usage.OutputTokens),
+				CacheReadInputTokens:     int(r.Usage.CacheReadInputTokens),
+				CacheCreationInputTokens: int(r.Usage.CacheCreationInputTokens),
+			}, r.TotalCost)
+		}
+	}
+}
+
+// batchResult converts one line of the results file into a BatchResult.
+func (a *Agent) batchResult(resp anthropic.MessageBatchIndividualResponse, validator *schema.Validator) *BatchResult {
+	r := &BatchResult{
+		CustomID:  resp.CustomID,
+		Status:    BatchResultStatus(resp.Result.Type),
+		TotalCost: decimal.Zero,
+	}
+	if r.Status != BatchSucceeded {
+		if msg := resp.Result.Error.Error.Message; msg != "" {
+			r.Errors = []string{msg}
+		}
+		return r
+	}
+
+	msg := resp.Result.Message
+	r.Message = &msg
+	r.Text = finalMessageText(msg)
+	r.Usage = Usage{
+		InputTokens:              msg.Usage.InputTokens,
+		OutputTokens:             msg.Usage.OutputTokens,
+		CacheReadInputTokens:     msg.Usage.CacheReadInputTokens,
+		CacheCreationInputTokens: msg.Usage.CacheCreationInputTokens,
+	}
+	if pricing, ok := a.opts.pricing[msg.Model]; ok {
+		r.TotalCost = pricing.Cost(budget.Usage{
+			InputTokens:              int(msg.Usage.InputTokens),
+			OutputTokens:             int(msg.Usage.OutputTokens),
+			CacheReadInputTokens:     int(msg.Usage.CacheReadInputTokens),
+			CacheCreationInputTokens: int(msg.Usage.CacheCreationInputTokens),
+		}).Mul(budget.BatchDiscount)
+	}
+
+	if a.opts.outputFormat != nil {
+		r.StructuredOutput, r.Errors = a.batchStructuredOutput(msg, validator)
+	}
+	return r
+}
+
+// batchStructuredOutput extracts and validates the structured output of a
+// batch response. Batches are single-shot, so invalid output is reported
+// rather than repaired.
+func (a *Agent) batchStructuredOutput(msg anthropic.Message, validator *schema.Validator) (json.RawMessage, []string) {
+	format := *a.opts.outputFormat
+	var (
+		output json.RawMessage
+		err    error
+	)
+	if format.native() {
+		output, err = ExtractNativeStructuredOutput(msg)
+	} else {
+		output, err = ExtractStructuredOutput(msg, format.Name)
+	}
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	if violations := validator.Validate(output); len(violations) > 0 {
+		return nil, violations
+	}
+	return output, nil
+}
+
+// finalMessageText concatenates the text blocks of a response.
+func finalMessageText(msg anthropic.Message) string {
+	var sb strings.Builder
+	for _, block := range msg.Content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	return sb.String()
+}
+
+// FileBatchTracker tracks in-flight batch ids as small files in a directory.
+type FileBatchTracker struct {
+	dir string
+}
+
+var _ BatchTracker = (*FileBatchTracker)(nil)
+
+// NewFileBatchTracker creates a FileBatchTracker that stores ids in dir.
+// The directory is created if it does not exist.
+func NewFileBatchTracker(dir string) (*FileBatchTracker, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create batch tracker dir: %w", err)
+	}
+	return &FileBatchTracker{dir: dir}, nil
+}
+
+// path returns the file of key, named after a hash of it so that any two
+// keys have different files on any file system.
+func (f *FileBatchTracker) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:])+".batch")
+}
+
+// Save records batch under key.
+func (f *FileBatchTracker) Save(_ context.Context, key string, batch TrackedBatch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path(key), data, 0o644)
+}
+
+// Load returns the batch tracked under key, or a zero TrackedBatch if none.
+func (f *FileBatchTracker) Load(_ context.Context, key string) (TrackedBatch, error) {
+	var batch TrackedBatch
+	data, err := os.ReadFile(f.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return batch, nil
+	}
+	if err != nil {
+		return batch, err
+	}
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return batch, fmt.Errorf("decode tracked batch %s: %w", key, err)
+	}
+	return batch, nil
+}
+
+// Delete stops tracking key. Deleting an untracked key is not an error.
+func (f *FileBatchTracker) Delete(_ context.Context, key string) error {
+	err := os.Remove(f.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,417 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics/promtext"
+)
+
+// fakeBatchAPI emulates the Message Batches endpoints. Each batch reports
+// in_progress for pendingPolls status checks before it ends.
+type fakeBatchAPI struct {
+	mu           sync.Mutex
+	pendingPolls int
+	created      int
+	polls        map[string]int
+	requests     []json.RawMessage
+	results      []string
+	// betas holds the anthropic-beta headers of each request.
+	betas []string
+}
+
+func newFakeBatchAPI(t *testing.T, pendingPolls int, results ...string) (*fakeBatchAPI, *httptest.Server) {
+	t.Helper()
+	f := &fakeBatchAPI{pendingPolls: pendingPolls, polls: map[string]int{}, results: results}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeBatchAPI) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.betas = append(f.betas, strings.Join(r.Header.Values("anthropic-beta"), ","))
+	path := strings.TrimPrefix(r.URL.Path, "/v1/messages/batches")
+	switch {
+	case r.Method == http.MethodPost && path == "":
+		var body struct {
+			Requests []json.RawMessage `json:"requests"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.requests = append(f.requests, body.Requests...)
+		f.created++
+		id := fmt.Sprintf("msgbatch_%d", f.created)
+		writeBatch(w, id, "in_progress")
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/results"):
+		w.Header().Set("Content-Type", "application/x-jsonl")
+		for _, line := range f.results {
+			fmt.Fprintln(w, line)
+		}
+	case r.Method == http.MethodGet:
+		id := strings.TrimPrefix(path, "/")
+		f.polls[id]++
+		status := "in_progress"
+		if f.polls[id] > f.pendingPolls {
+			status = "ended"
+		}
+		writeBatch(w, id, status)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeBatch(w http.ResponseWriter, id, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"id":%q,"type":"message_batch","processing_status":%q,"request_counts":{"processing":0,"succeeded":0,"errored":0,"canceled":0,"expired":0},"created_at":"2026-01-01T00:00:00Z","expires_at":"2026-01-02T00:00:00Z"}`, id, status)
+}
+
+func succeededLine(customID, model, text string, in, out int) string {
+	return fmt.Sprintf(`{"custom_id":%q,"result":{"type":"succeeded","message":{"id":"msg_1","type":"message","role":"assistant","model":%q,"content":[{"type":"text","text":%q}],"stop_reason":"end_turn","usage":{"input_tokens":%d,"output_tokens":%d}}}}`,
+		customID, model, text, in, out)
+}
+
+func newBatchTestAgent(srv *httptest.Server, opts ...AgentOption) *Agent {
+	opts = append([]AgentOption{
+		WithClientOptions(option.WithBaseURL(srv.URL), option.WithAPIKey("test-key")),
+	}, opts...)
+	return NewAgent(opts...)
+}
+
+var fastPoll = WithBatchPollInterval(time.Millisecond, 5*time.Millisecond)
+
+func TestRunBatch_CollectsResultsPerCustomID(t *testing.T) {
+	api, srv := newFakeBatchAPI(t, 2,
+		succeededLine("a", string(anthropic.ModelClaudeSonnet4_5), "positive", 1000, 100),
+		`{"custom_id":"b","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"prompt too long"}}}}`,
+		`{"custom_id":"c","result":{"type":"expired"}}`,
+	)
+	a := newBatchTestAgent(srv,
+		WithModel(anthropic.ModelClaudeSonnet4_5),
+		WithSystemPrompt("Classify sentiment."),
+	)
+
+	results, err := a.RunBatch(context.Background(), []BatchItem{
+		{CustomID: "a", Prompt: "great"},
+		{CustomID: "b", Prompt: "long"},
+		{CustomID: "c", Prompt: "late"},
+	}, fastPoll)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	ok := results["a"]
+	assert.Equal(t, BatchSucceeded, ok.Status)
+	assert.Equal(t, "positive", ok.Text)
+	assert.Equal(t, int64(1000), ok.Usage.InputTokens)
+	assert.Equal(t, int64(100), ok.Usage.OutputTokens)
+	// (1000 * $3 + 100 * $15) / MTok = $0.0045, halved by the batch discount
+	assert.True(t, decimal.NewFromFloat(0.00225).Equal(ok.TotalCost), "got %s", ok.TotalCost)
+
+	assert.Equal(t, BatchErrored, results["b"].Status)
+	assert.Equal(t, []string{"prompt too long"}, results["b"].Errors)
+	assert.Equal(t, BatchExpired, results["c"].Status)
+	assert.Nil(t, results["c"].Message)
+
+	require.Len(t, api.requests, 3)
+	var req struct {
+		CustomID string `json:"custom_id"`
+		Params   struct {
+			Model  string `json:"model"`
+			System []struct {
+				Text string `json:"text"`
+			} `json:"system"`
+			Messages []json.RawMessage `json:"messages"`
+		} `json:"params"`
+	}
+	require.NoError(t, json.Unmarshal(api.requests[0], &req))
+	assert.Equal(t, "a", req.CustomID)
+	assert.Equal(t, string(anthropic.ModelClaudeSonnet4_5), req.Params.Model)
+	require.Len(t, req.Params.System, 1)
+	assert.Equal(t, "Classify sentiment.", req.Params.System[0].Text)
+	assert.Len(t, req.Params.Messages, 1)
+	assert.Equal(t, 3, api.polls["msgbatch_1"])
+}
+
+func TestRunBatch_StructuredOutput(t *testing.T) {
+	_, srv := newFakeBatchAPI(t, 0,
+		`{"custom_id":"ok","result":{"type":"succeeded","message":{"id":"m","type":"message","role":"assistant","model":"x","content":[{"type":"tool_use","id":"t1","name":"out","input":{"name":"Ann","score":3}}],"stop_reason":"tool_use","usage":{"input_tokens":1,"output_tokens":1}}}}`,
+		`{"custom_id":"bad","result":{"type":"succeeded","message":{"id":"m","type":"message","role":"assistant","model":"x","content":[{"type":"tool_use","id":"t1","name":"out","input":{"name":"Ann"}}],"stop_reason":"tool_use","usage":{"input_tokens":1,"output_tokens":1}}}}`,
+	)
+	a := newBatchTestAgent(srv, WithOutputFormatType[testOutputStruct]("out"))
+
+	results, err := a.RunBatch(context.Background(), []BatchItem{
+		{CustomID: "ok", Prompt: "x"},
+		{CustomID: "bad", Prompt: "y"},
+	}, fastPoll)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"name":"Ann","score":3}`, string(results["ok"].StructuredOutput))
+	assert.Empty(t, results["ok"].Errors)
+	assert.Nil(t, results["bad"].StructuredOutput)
+	assert.Contains(t, results["bad"].Errors, `$: missing required property "score"`)
+	assert.True(t, results["ok"].TotalCost.IsZero(), "unknown model has no price")
+}
+
+func TestRunBatch_ResumesTrackedBatch(t *testing.T) {
+	api, srv := newFakeBatchAPI(t, 1000, succeededLine("a", "x", "done", 1, 1))
+	a := newBatchTestAgent(srv)
+
+	tracker, err := NewFileBatchTracker(t.TempDir())
+	require.NoError(t, err)
+	items := []BatchItem{{CustomID: "a", Prompt: "p"}}
+
+	// Simulate a process that stopped after submitting the batch.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err = a.RunBatch(ctx, items, fastPoll, WithBatchTracker(tracker), WithBatchKey("nightly"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	api.mu.Lock()
+	require.Equal(t, 1, api.created)
+	api.pendingPolls = 0
+	api.polls = map[string]int{}
+	api.mu.Unlock()
+
+	results, err := a.RunBatch(context.Background(), items, fastPoll,
+		WithBatchTracker(tracker), WithBatchKey("nightly"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, api.created, "should re-attach instead of resubmitting")
+	assert.Equal(t, 1, api.polls["msgbatch_1"])
+	assert.Equal(t, "done", results["a"].Text)
+
+	tracked, err := tracker.Load(context.Background(), "nightly")
+	require.NoError(t, err)
+	assert.Empty(t, tracked.ID, "tracking should be cleared once results are collected")
+}
+
+func TestRunBatch_TrackedBatchWithDifferentRequests(t *testing.T) {
+	api, srv := newFakeBatchAPI(t, 0)
+	tracker, err := NewFileBatchTracker(t.TempDir())
+	require.NoError(t, err)
+	items := []BatchItem{{CustomID: "a", Prompt: "p"}}
+
+	requests, err := newBatchTestAgent(srv).batchRequests(items)
+	require.NoError(t, err)
+	digest, err := batchDigest(requests)
+	require.NoError(t, err)
+	require.NoError(t, tracker.Save(context.Background(), "nightly", TrackedBatch{ID: "msgbatch_prev", Digest: digest}))
+
+	// Same custom ids, different system prompt.
+	a := newBatchTestAgent(srv, WithSystemPrompt("Be terse."))
+	_, err = a.RunBatch(context.Background(), items, fastPoll,
+		WithBatchTracker(tracker), WithBatchKey("nightly"))
+	require.ErrorIs(t, err, ErrBatchMismatch)
+	assert.Equal(t, 0, api.created)
+	assert.Empty(t, api.polls)
+}
+
+func TestRunBatch_TracksWhileInFlight(t *testing.T) {
+	_, srv := newFakeBatchAPI(t, 1000)
+	a := newBatchTestAgent(srv)
+
+	tracker, err := NewFileBatchTracker(t.TempDir())
+	require.NoError(t, err)
+	items := []BatchItem{{CustomID: "a", Prompt: "p"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err = a.RunBatch(ctx, items, fastPoll, WithBatchTracker(tracker))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	requests, err := a.batchRequests(items)
+	require.NoError(t, err)
+	digest, err := batchDigest(requests)
+	require.NoError(t, err)
+	tracked, err := tracker.Load(context.Background(), "batch-"+digest[:16])
+	require.NoError(t, err)
+	assert.Equal(t, TrackedBatch{ID: "msgbatch_1", Digest: digest}, tracked)
+}
+
+func TestRunBatch_InvalidItems(t *testing.T) {
+	a := NewAgent()
+
+	_, err := a.RunBatch(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrEmptyBatch)
+
+	_, err = a.RunBatch(context.Background(), []BatchItem{{CustomID: "a b"}})
+	assert.ErrorContains(t, err, "invalid batch custom id")
+
+	_, err = a.RunBatch(context.Background(), []BatchItem{{CustomID: "a"}, {CustomID: "a"}})
+	assert.ErrorContains(t, err, "duplicate batch custom id")
+}
+
+func TestBatchDigest(t *testing.T) {
+	digest := func(a *Agent, items ...BatchItem) string {
+		t.Helper()
+		requests, err := a.batchRequests(items)
+		require.NoError(t, err)
+		d, err := batchDigest(requests)
+		require.NoError(t, err)
+		return d
+	}
+	a := NewAgent()
+	base := digest(a, BatchItem{CustomID: "a", Prompt: "x"}, BatchItem{CustomID: "b", Prompt: "y"})
+
+	assert.Equal(t, base, digest(a, BatchItem{CustomID: "b", Prompt: "y"}, BatchItem{CustomID: "a", Prompt: "x"}))
+	assert.NotEqual(t, base, digest(a, BatchItem{CustomID: "a", Prompt: "x"}))
+	assert.NotEqual(t, base, digest(a, BatchItem{CustomID: "a", Prompt: "x"}, BatchItem{CustomID: "b", Prompt: "z"}))
+	withTool := NewAgent()
+	RegisterTool(withTool.Tools(), &stubTool{name: "echo", desc: "echo tool"})
+	for name, other := range map[string]*Agent{
+		"model":  NewAgent(WithModel(anthropic.ModelClaudeSonnet4_5)),
+		"system": NewAgent(WithSystemPrompt("Be terse.")),
+		"tools":  withTool,
+		"schema": NewAgent(WithOutputFormatType[testOutputStruct]("out")),
+	} {
+		assert.NotEqual(t, base, digest(other, BatchItem{CustomID: "a", Prompt: "x"}, BatchItem{CustomID: "b", Prompt: "y"}), name)
+	}
+}
+
+func TestRunBatch_SendsBetas(t *testing.T) {
+	api, srv := newFakeBatchAPI(t, 1, succeededLine("a", "x", "done", 1, 1))
+	a := newBatchTestAgent(srv, WithBetas("beta-a", "beta-b"))
+
+	_, err := a.RunBatch(context.Background(), []BatchItem{{CustomID: "a", Prompt: "x"}}, fastPoll)
+	require.NoError(t, err)
+
+	// Submit, two polls and the results.
+	assert.Equal(t, []string{"beta-a,beta-b", "beta-a,beta-b", "beta-a,beta-b", "beta-a,beta-b"}, api.betas)
+}
+
+func TestRunBatch_RecordsCost(t *testing.T) {
+	_, srv := newFakeBatchAPI(t, 0,
+		succeededLine("a", string(anthropic.ModelClaudeSonnet4_5), "one", 1000, 100),
+		succeededLine("b", string(anthropic.ModelClaudeSonnet4_5), "two", 1000, 100),
+	)
+	reg := promtext.New()
+	shared := NewBudget(decimal.NewFromInt(1))
+	a := newBatchTestAgent(srv, WithModel(anthropic.ModelClaudeSonnet4_5), WithSharedBudget(shared), WithMetrics(reg))
+
+	_, err := a.RunBatch(context.Background(), []BatchItem{{CustomID: "a", Prompt: "x"}, {CustomID: "b", Prompt: "y"}}, fastPoll)
+	require.NoError(t, err)
+
+	assert.True(t, decimal.NewFromFloat(0.0045).Equal(shared.Spent()), "got %s", shared.Spent())
+	out := exposition(t, reg)
+	assert.Contains(t, out, `agent_tokens_total{model="claude-sonnet-4-5",type="input"} 2000`)
+	assert.Contains(t, out, `agent_cost_usd_total{model="claude-sonnet-4-5"} 0.0045`)
+}
+
+func TestRunBatch_ExhaustedBudget(t *testing.T) {
+	api, srv := newFakeBatchAPI(t, 0)
+	shared := NewBudget(decimal.NewFromFloat(0.01))
+	require.ErrorIs(t, shared.Charge(decimal.NewFromFloat(0.01)), ErrBudgetExhausted)
+	a := newBatchTestAgent(srv, WithSharedBudget(shared))
+
+	_, err := a.RunBatch(context.Background(), []BatchItem{{CustomID: "a", Prompt: "x"}}, fastPoll)
+	assert.ErrorIs(t, err, ErrBudgetExhausted)
+	assert.Zero(t, api.created)
+}
+
+func TestRunBatch_CustomProvider(t *testing.T) {
+	a := NewAgent(WithProvider(&scriptedProvider{}))
+
+	_, err := a.RunBatch(context.Background(), []BatchItem{{CustomID: "a", Prompt: "x"}})
+	assert.ErrorIs(t, err, ErrBatchProvider)
+	_, err = a.AttachBatch(context.Background(), "msgbatch_1")
+	assert.ErrorIs(t, err, ErrBatchProvider)
+}
+
+func TestRunBatch_InvalidOutputSchema(t *testing.T) {
+	api, srv := newFakeBatchAPI(t, 0, succeededLine("a", "x", `{"home":{}}`, 1, 1))
+	a := newBatchTestAgent(srv, WithOutputFormat(danglingRefFormat()))
+
+	_, err := a.RunBatch(context.Background(), []BatchItem{{CustomID: "a", Prompt: "x"}}, fastPoll)
+	assert.ErrorIs(t, err, ErrOutputSchema)
+	assert.Zero(t, api.created)
+
+	_, err = a.AttachBatch(context.Background(), "msgbatch_1", fastPoll)
+	assert.ErrorIs(t, err, ErrOutputSchema)
+	assert.Empty(t, api.polls)
+}
+
+func TestRunBatch_WithBudgetSpansBatches(t *testing.T) {
+	api, srv := newFakeBatchAPI(t, 0, succeededLine("a", string(anthropic.ModelClaudeSonnet4_5), "one", 1000, 100))
+	// The first batch costs $0.00225, more than the budget.
+	a := newBatchTestAgent(srv, WithModel(anthropic.ModelClaudeSonnet4_5), WithBudget(decimal.NewFromFloat(0.002)))
+
+	_, err := a.RunBatch(context.Background(), []BatchItem{{CustomID: "a", Prompt: "x"}}, fastPoll)
+	require.NoError(t, err)
+	_, err = a.RunBatch(context.Background(), []BatchItem{{CustomID: "b", Prompt: "y"}}, fastPoll)
+	assert.ErrorIs(t, err, ErrBudgetExhausted)
+	assert.Equal(t, 1, api.created)
+
+	// Within a shared budget, the limit applies the same way.
+	shared := NewBudget(decimal.Zero)
+	a = newBatchTestAgent(srv, WithModel(anthropic.ModelClaudeSonnet4_5), WithBudget(decimal.NewFromFloat(0.002)), WithSharedBudget(shared))
+	_, err = a.RunBatch(context.Background(), []BatchItem{{CustomID: "a", Prompt: "x"}}, fastPoll)
+	require.NoError(t, err)
+	_, err = a.RunBatch(context.Background(), []BatchItem{{CustomID: "b", Prompt: "y"}}, fastPoll)
+	assert.ErrorIs(t, err, ErrBudgetExhausted)
+	assert.True(t, decimal.NewFromFloat(0.00225).Equal(shared.Spent()), "got %s", shared.Spent())
+}
+
+func TestFileBatchTracker_KeysDoNotCollide(t *testing.T) {
+	tracker, err := NewFileBatchTracker(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, tracker.Save(ctx, "a/x", TrackedBatch{ID: "msgbatch_a"}))
+	require.NoError(t, tracker.Save(ctx, "b/x", TrackedBatch{ID: "msgbatch_b"}))
+	require.NoError(t, tracker.Save(ctx, "../x", TrackedBatch{ID: "msgbatch_c"}))
+
+	for key, id := range map[string]string{"a/x": "msgbatch_a", "b/x": "msgbatch_b", "../x": "msgbatch_c"} {
+		got, err := tracker.Load(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, id, got.ID, key)
+	}
+}
+
+func TestRunBatch_NativeOutputClosesReferencedObjects(t *testing.T) {
+	api, srv := newFakeBatchAPI(t, 0, succeededLine("a", "x", `{"home":{"city":"Paris"}}`, 1, 1))
+	a := newBatchTestAgent(srv, WithOutputFormat(OutputFormat{
+		Name: "out",
+		Mode: OutputModeNative,
+		Schema: anthropic.ToolInputSchemaParam{
+			Properties: map[string]any{"home": map[string]any{"$ref": "#/$defs/address"}},
+			Required:   []string{"home"},
+			ExtraFields: map[string]any{"$defs": map[string]any{"address": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+				"required":   []string{"city"},
+			}}},
+		},
+	}))
+
+	results, err := a.RunBatch(context.Background(), []BatchItem{{CustomID: "a", Prompt: "x"}}, fastPoll)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"home":{"city":"Paris"}}`, string(results["a"].StructuredOutput))
+
+	require.Len(t, api.requests, 1)
+	var req struct {
+		Params struct {
+			OutputConfig struct {
+				Format struct {
+					Schema struct {
+						Defs map[string]map[string]any `json:"$defs"`
+					} `json:"schema"`
+				} `json:"format"`
+			} `json:"output_config"`
+		} `json:"params"`
+	}
+	require.NoError(t, json.Unmarshal(api.requests[0], &req))
+	assert.Equal(t, false, req.Params.OutputConfig.Format.Schema.Defs["address"]["additionalProperties"])
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+
+	"github.com/armatrix/claude-agent-sdk-go/internal/budget"
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
+)
+
+// Budget is a spending limit in USD that can be shared by many runs.
+// Pass the same Budget to several agents with WithSharedBudget, and carve out
+// capped sub-budgets with Child: spending on a child also counts against its
+// parent, so a root budget caps the whole tree of forks, subagents and team
+// members. It is safe for concurrent use.
+type Budget struct {
+	tracker *budget.BudgetTracker
+}
+
+// NewBudget creates a Budget limited to maxUSD. Zero means unlimited, which
+// is still useful as a root for capped children and for tracking spend.
+func NewBudget(maxUSD decimal.Decimal) *Budget {
+	return &Budget{tracker: budget.NewBudgetTracker(maxUSD, budget.DefaultPricing)}
+}
+
+// Child creates a sub-budget limited to maxUSD (zero = only the parent's
+// limit applies) whose spending also counts against b.
+func (b *Budget) Child(maxUSD decimal.Decimal) *Budget {
+	return &Budget{tracker: b.tracker.Child(maxUSD)}
+}
+
+// Spent returns the total cost recorded on this budget and its children.
+func (b *Budget) Spent() decimal.Decimal { return b.tracker.TotalCost() }
+
+// Remaining returns how much may still be spent, considering all ancestors.
+func (b *Budget) Remaining() decimal.Decimal { return b.tracker.Remaining() }
+
+// Exhausted reports whether this budget or any ancestor has been used up.
+func (b *Budget) Exhausted() bool { return b.tracker.Exhausted() }
+
+// UsedFraction returns the share of the most constrained limit in the chain
+// already spent. Returns 0 when no limit applies.
+func (b *Budget) UsedFraction() float64 { return b.tracker.UsedFraction() }
+
+// Charge records a cost incurred outside model calls, such as a paid external
+// API used by a tool. It returns ErrBudgetExhausted if the budget is used up
+// after the charge.
+func (b *Budget) Charge(cost decimal.Decimal) error {
+	b.tracker.RecordCost(budget.Usage{}, cost)
+	if b.tracker.Exhausted() {
+		return ErrBudgetExhausted
+	}
+	return nil
+}
+
+// BudgetPolicy configures graduated responses as a run consumes its budget.
+// Fractions are shares of the budget in (0, 1]; zero disables a step.
+type BudgetPolicy struct {
+	// Thresholds emit a BudgetWarningEvent when crossed (e.g. 0.5, 0.8).
+	Thresholds []float64
+
+	// WrapUpAt appends WrapUpNote (or a default note) to the system prompt,
+	// telling the model to finish up.
+	WrapUpAt   float64
+	WrapUpNote string
+
+	// DowngradeAt switches subsequent requests to DowngradeModel.
+	DowngradeAt    float64
+	DowngradeModel anthropic.Model
+
+	// MaxToolCallCost caps what a single tool call may spend, e.g. on a
+	// subagent it spawns or via Budget.Charge. Zero means no ceiling.
+	MaxToolCallCost decimal.Decimal
+
+	// ToolCostCeilings overrides MaxToolCallCost for specific tools.
+	ToolCostCeilings map[string]decimal.Decimal
+}
+
+// toolCeiling returns the cost ceiling for a call to the named tool.
+func (p *BudgetPolicy) toolCeiling(name string) decimal.Decimal {
+	if ceiling, ok := p.ToolCostCeilings[name]; ok {
+		return ceiling
+	}
+	return p.MaxToolCallCost
+}
+
+// hasToolCeilings reports whether any tool call is capped.
+func (p *BudgetPolicy) hasToolCeilings() bool {
+	return !p.MaxToolCallCost.IsZero() || len(p.ToolCostCeilings) > 0
+}
+
+// engineConfig converts the policy into the engine's threshold policy.
+func (p *BudgetPolicy) engineConfig() *engine.BudgetPolicy {
+	return &engine.BudgetPolicy{
+		Thresholds:     p.Thresholds,
+		WrapUpAt:       p.WrapUpAt,
+		WrapUpNote:     p.WrapUpNote,
+		DowngradeAt:    p.DowngradeAt,
+		DowngradeModel: p.DowngradeModel,
+	}
+}
+
+// runBudget resolves the budget a run draws from. A budget carried by ctx
+// (set while a parent's tool call is executing) takes precedence over the
+// agent's shared budget; WithBudget then caps the run within it. Returns nil
+// when no budget applies.
+func (a *Agent) runBudget(ctx context.Context) *Budget {
+	base := ContextBudget(ctx)
+	if base == nil {
+		base = a.opts.sharedBudget
+	}
+	switch {
+	case base != nil && !a.opts.maxBudget.IsZero():
+		return base.Child(a.opts.maxBudget)
+	case base != nil:
+		return base
+	case !a.opts.maxBudget.IsZero():
+		return NewBudget(a.opts.maxBudget)
+	case a.opts.budgetPolicy != nil && a.opts.budgetPolicy.hasToolCeilings():
+		// Tool ceilings need a root to carve sub-budgets from.
+		return NewBudget(decimal.Zero)
+	default:
+		return nil
+	}
+}
+
+// batchBudget resolves the budget a batch draws from, as runBudget does for
+// a run. Batches are not runs, so WithBudget caps all the agent's batches
+// together, within each budget they draw from, rather than each batch.
+func (a *Agent) batchBudget(ctx context.Context) *Budget {
+	base := ContextBudget(ctx)
+	if base == nil {
+		base = a.opts.sharedBudget
+	}
+	if a.opts.maxBudget.IsZero() {
+		return base
+	}
+
+	a.batchMu.Lock()
+	defer a.batchMu.Unlock()
+	if b, ok := a.batchBudgets[base]; ok {
+		return b
+	}
+	b := NewBudget(a.opts.maxBudget)
+	if base != nil {
+		b = base.Child(a.opts.maxBudget)
+	}
+	if a.batchBudgets == nil {
+		a.batchBudgets = make(map[*Budget]*Budget)
+	}
+	a.batchBudgets[base] = b
+	return b
+}
+
+// SharedBudget returns the budget set with WithSharedBudget, or nil.
+func (a *Agent) SharedBudget() *Budget {
+	return a.opts.sharedBudget
+}
+
+// budgetToolExecutor scopes each tool call to a sub-budget so that any runs
+// the tool starts (e.g. subagents) draw from, and are capped within, the
+// calling run's budget.
+type budgetToolExecutor struct {
+	engine.ToolExecutor
+	budget *Budget
+	policy *BudgetPolicy
+}
+
+func (t *budgetToolExecutor) Execute(ctx context.Context, name string, input json.RawMessage) (string, bool, error) {
+	callBudget := t.budget
+	if t.policy != nil {
+		if ceiling := t.policy.toolCeiling(name); !ceiling.IsZero() {
+			callBudget = t.budget.Child(ceiling)
+		}
+	}
+	if callBudget.Exhausted() {
+		return fmt.Sprintf("tool %s not run: budget exhausted", name), true, nil
+	}
+	return t.ToolExecutor.Execute(WithContextBudget(ctx, callBudget), name, input)
+}
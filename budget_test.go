@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
+)
+
+func TestBudget_Charge(t *testing.T) {
+	b := NewBudget(decimal.NewFromFloat(1))
+	require.NoError(t, b.Charge(decimal.NewFromFloat(0.4)))
+	assert.InDelta(t, 0.4, b.UsedFraction(), 1e-9)
+	assert.True(t, decimal.NewFromFloat(0.6).Equal(b.Remaining()))
+
+	assert.ErrorIs(t, b.Charge(decimal.NewFromFloat(0.6)), ErrBudgetExhausted)
+	assert.True(t, b.Exhausted())
+}
+
+func TestBudget_ChildCapsAndRollsUp(t *testing.T) {
+	root := NewBudget(decimal.NewFromFloat(10))
+	child := root.Child(decimal.NewFromFloat(1))
+
+	assert.ErrorIs(t, child.Charge(decimal.NewFromFloat(1)), ErrBudgetExhausted)
+	assert.False(t, root.Exhausted())
+	assert.True(t, decimal.NewFromFloat(1).Equal(root.Spent()))
+}
+
+func TestRunBudget_Resolution(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Nil(t, NewAgent().runBudget(ctx))
+
+	perRun := NewAgent(WithBudget(decimal.NewFromFloat(2))).runBudget(ctx)
+	require.NotNil(t, perRun)
+	assert.True(t, decimal.NewFromFloat(2).Equal(perRun.Remaining()))
+
+	shared := NewBudget(decimal.NewFromFloat(5))
+	assert.Same(t, shared, NewAgent(WithSharedBudget(shared)).runBudget(ctx))
+
+	capped := NewAgent(WithSharedBudget(shared), WithBudget(decimal.NewFromFloat(1))).runBudget(ctx)
+	require.NoError(t, capped.Charge(decimal.NewFromFloat(0.5)))
+	assert.True(t, decimal.NewFromFloat(0.5).Equal(shared.Spent()), "capped run should roll up into the shared budget")
+
+	fromTool := shared.Child(decimal.NewFromFloat(0.1))
+	assert.Same(t, fromTool, NewAgent().runBudget(WithContextBudget(ctx, fromTool)),
+		"a budget from the calling tool's context takes precedence")
+
+	ceilingsOnly := NewAgent(WithBudgetPolicy(BudgetPolicy{MaxToolCallCost: decimal.NewFromFloat(1)})).runBudget(ctx)
+	require.NotNil(t, ceilingsOnly)
+	assert.False(t, ceilingsOnly.Exhausted())
+}
+
+// budgetChargingTool charges the context budget and reports what it saw.
+type budgetChargingTool struct {
+	cost   decimal.Decimal
+	budget *Budget
+	err    error
+}
+
+func (c *budgetChargingTool) Execute(ctx context.Context, _ string, _ json.RawMessage) (string, bool, error) {
+	c.budget = ContextBudget(ctx)
+	c.err = c.budget.Charge(c.cost)
+	return "ok", false, nil
+}
+
+func (c *budgetChargingTool) ListForAPI() []anthropic.ToolUnionParam { return nil }
+
+func TestBudgetToolExecutor_PerCallCeiling(t *testing.T) {
+	root := NewBudget(decimal.NewFromFloat(10))
+	tool := &budgetChargingTool{cost: decimal.NewFromFloat(2)}
+	exec := &budgetToolExecutor{
+		ToolExecutor: tool,
+		budget:       root,
+		policy: &BudgetPolicy{
+			MaxToolCallCost:  decimal.NewFromFloat(1),
+			ToolCostCeilings: map[string]decimal.Decimal{"Expensive": decimal.NewFromFloat(5)},
+		},
+	}
+
+	_, _, err := exec.Execute(context.Background(), "Cheap", nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, tool.err, ErrBudgetExhausted, "call exceeded the default ceiling")
+	assert.NotSame(t, root, tool.budget)
+
+	_, _, err = exec.Execute(context.Background(), "Expensive", nil)
+	require.NoError(t, err)
+	assert.NoError(t, tool.err, "per-tool ceiling overrides the default")
+	assert.True(t, decimal.NewFromFloat(4).Equal(root.Spent()))
+}
+
+func TestBudgetToolExecutor_ExhaustedSkipsTool(t *testing.T) {
+	root := NewBudget(decimal.NewFromFloat(1))
+	require.ErrorIs(t, root.Charge(decimal.NewFromFloat(1)), ErrBudgetExhausted)
+	tool := &budgetChargingTool{}
+	exec := &budgetToolExecutor{ToolExecutor: tool, budget: root}
+
+	text, isError, err := exec.Execute(context.Background(), "Bash", nil)
+	require.NoError(t, err)
+	assert.True(t, isError)
+	assert.Contains(t, text, "budget exhausted")
+	assert.Nil(t, tool.budget, "tool should not run")
+}
+
+func TestRun_ExhaustedParentBudgetSkipsModel(t *testing.T) {
+	parent := NewBudget(decimal.NewFromFloat(1))
+	require.ErrorIs(t, parent.Charge(decimal.NewFromFloat(1)), ErrBudgetExhausted)
+
+	for name, opts := range map[string][]AgentOption{
+		"shared": {WithSharedBudget(parent)},
+		"capped": {WithSharedBudget(parent), WithBudget(decimal.NewFromFloat(5))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := &scriptedProvider{responses: []string{textResponse("too expensive")}}
+			a := NewAgent(append([]AgentOption{WithProvider(p), WithModel("test-model")}, opts...)...)
+
+			result, err := a.Run(context.Background(), "go").Result()
+			assert.ErrorIs(t, err, ErrBudgetExhausted)
+			require.NotNil(t, result)
+			assert.Equal(t, "error_max_budget_usd", result.Subtype)
+			assert.Len(t, p.responses, 1, "the model should not be called")
+		})
+	}
+}
+
+func TestChannelSink_OnBudgetWarning(t *testing.T) {
+	ch := make(chan Event, 1)
+	sink := &channelSink{ch: ch}
+
+	sink.OnBudgetWarning(engine.BudgetWarningInfo{
+		Threshold:    0.8,
+		UsedFraction: 0.83,
+		WrapUp:       true,
+		Model:        anthropic.ModelClaudeHaiku4_5,
+	})
+
+	evt, ok := (<-ch).(*BudgetWarningEvent)
+	require.True(t, ok)
+	assert.Equal(t, EventBudgetWarning, evt.Type())
+	assert.Equal(t, 0.8, evt.Threshold)
+	assert.True(t, evt.WrapUp)
+	assert.Equal(t, anthropic.ModelClaudeHaiku4_5, evt.Model)
+}
@@ -0,0 +1,216 @@
+package checkpoint
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Status is how a file changed.
+type Status int
+
+const (
+	Unchanged Status = iota
+	Added
+	Deleted
+	Modified
+	// ModeChanged is a file whose content is the same but not its mode.
+	ModeChanged
+)
+
+// String returns the status's name.
+func (s Status) String() string {
+	switch s {
+	case Added:
+		return "added"
+	case Deleted:
+		return "deleted"
+	case Modified:
+		return "modified"
+	case ModeChanged:
+		return "mode changed"
+	default:
+		return "unchanged"
+	}
+}
+
+// FileDiff is the change of a file between a checkpoint and now.
+type FileDiff struct {
+	Path   string
+	Status Status
+	Before FileState
+	After  FileState
+}
+
+func newFileDiff(path string, before, after FileState) FileDiff {
+	d := FileDiff{Path: path, Before: before, After: after}
+	switch {
+	case !before.Exists && after.Exists:
+		d.Status = Added
+	case before.Exists && !after.Exists:
+		d.Status = Deleted
+	case !before.Exists:
+		d.Status = Unchanged
+	case !bytes.Equal(before.Content, after.Content):
+		d.Status = Modified
+	case before.Mode != after.Mode:
+		d.Status = ModeChanged
+	}
+	return d
+}
+
+// diffContext is the number of unchanged lines around the changes of a
+// hunk.
+const diffContext = 3
+
+// maxDiffCells bounds the size of the table comparing two files line by
+// line; larger files are shown as replaced entirely.
+const maxDiffCells = 4 << 20
+
+// Unified returns the change in the unified diff format.
+func (d FileDiff) Unified() string {
+	var b strings.Builder
+	from, to := "a/"+d.Path, "b/"+d.Path
+	if !d.Before.Exists {
+		from = "/dev/null"
+	}
+	if !d.After.Exists {
+		to = "/dev/null"
+	}
+	if d.Before.Exists && d.After.Exists && d.Before.Mode != d.After.Mode {
+		fmt.Fprintf(&b, "old mode %o\nnew mode %o\n", d.Before.Mode, d.After.Mode)
+	}
+	if bytes.Equal(d.Before.Content, d.After.Content) {
+		return b.String()
+	}
+	if bytes.IndexByte(d.Before.Content, 0) >= 0 || bytes.IndexByte(d.After.Content, 0) >= 0 {
+		fmt.Fprintf(&b, "Binary files %s and %s differ\n", from, to)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+	ops := diffLines(splitLines(d.Before.Content), splitLines(d.After.Content))
+	writeHunks(&b, ops)
+	return b.String()
+}
+
+// splitLines splits text into lines, each with its line break.
+func splitLines(text []byte) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOp is one line of a diff: kept (' '), removed ('-') or added ('+').
+// a and b are the numbers of lines of each side before it.
+type lineOp struct {
+	kind byte
+	line string
+	a, b int
+}
+
+// diffLines returns the operations turning a into b, keeping a longest
+// common subsequence of lines.
+func diffLines(a, b []string) []lineOp {
+	var ops []lineOp
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for i, line := range a {
+			ops = append(ops, lineOp{kind: '-', line: line, a: i, b: 0})
+		}
+		for j, line := range b {
+			ops = append(ops, lineOp{kind: '+', line: line, a: len(a), b: j})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, lineOp{kind: ' ', line: a[i], a: i, b: j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, lineOp{kind: '-', line: a[i], a: i, b: j})
+			i++
+		default:
+			ops = append(ops, lineOp{kind: '+', line: b[j], a: i, b: j})
+			j++
+		}
+	}
+	return ops
+}
+
+// writeHunks writes the changes of ops with diffContext lines around them,
+// merging changes close enough to share their context.
+func writeHunks(b *strings.Builder, ops []lineOp) {
+	for start := 0; start < len(ops); {
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			return
+		}
+		// Extend the hunk while the next change is within twice the
+		// context of the last one.
+		last := first
+		for k := first + 1; k < len(ops) && k-last <= 2*diffContext; k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			}
+		}
+		from := max(first-diffContext, start)
+		to := min(last+diffContext+1, len(ops))
+
+		var aLen, bLen int
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(ops[from].a, aLen), hunkRange(ops[from].b, bLen))
+		for _, op := range ops[from:to] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+}
+
+// hunkRange formats the range of a hunk on one side, which starts after
+// line n.
+func hunkRange(n, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", n)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", n+1)
+	}
+	return fmt.Sprintf("%d,%d", n+1, length)
+}
@@ -0,0 +1,68 @@
+package checkpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func file(content string) FileState {
+	return FileState{Exists: true, Content: []byte(content), Mode: 0o644}
+}
+
+func TestFileDiff_Unified(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	d := newFileDiff("f.txt", file(before), file(after))
+	assert.Equal(t, Modified, d.Status)
+	assert.Equal(t, `--- a/f.txt
++++ b/f.txt
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`, d.Unified())
+}
+
+func TestFileDiff_UnifiedMergesNearbyChanges(t *testing.T) {
+	d := newFileDiff("f.txt", file("1\n2\n3\n4\n5\n"), file("1\nX\n3\n4\nY\n"))
+	assert.Equal(t, `--- a/f.txt
++++ b/f.txt
+@@ -1,5 +1,5 @@
+ 1
+-2
++X
+ 3
+ 4
+-5
++Y
+`, d.Unified())
+}
+
+func TestFileDiff_UnifiedAddedDeletedAndMode(t *testing.T) {
+	added := newFileDiff("new.txt", FileState{}, file("x"))
+	assert.Equal(t, Added, added.Status)
+	assert.Equal(t, "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+x\n\\ No newline at end of file\n", added.Unified())
+
+	deleted := newFileDiff("old.txt", file("x\n"), FileState{})
+	assert.Equal(t, Deleted, deleted.Status)
+	assert.Equal(t, "--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-x\n", deleted.Unified())
+
+	exec := file("x\n")
+	exec.Mode = 0o755
+	mode := newFileDiff("run.sh", file("x\n"), exec)
+	assert.Equal(t, ModeChanged, mode.Status)
+	assert.Equal(t, "old mode 644\nnew mode 755\n", mode.Unified())
+	assert.Equal(t, "mode changed", mode.Status.String())
+
+	binary := newFileDiff("b.bin", file("a\x00"), file("b\x00"))
+	assert.Equal(t, "Binary files a/b.bin and b/b.bin differ\n", binary.Unified())
+}
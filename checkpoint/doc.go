@@ -0,0 +1,13 @@
+// Package checkpoint records the state of files before tools change them,
+// so the changes can be reviewed and undone.
+//
+// [Tracker] keeps the original state of each file it is told about and
+// rewinds them all at once. A [Checkpointer] keeps one checkpoint per tool
+// call instead, to diff or rewind to any of them; [History] is the
+// in-memory implementation agents use with agent.WithFileCheckpointing.
+//
+// [GitShadow] checkpoints the whole working directory in a shadow git
+// repository kept outside it, so changes made by shell commands are
+// rewound too. [ForWorkDir] uses it when git is installed and falls back
+// to a History otherwise.
+package checkpoint
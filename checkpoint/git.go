@@ -0,0 +1,436 @@
+package checkpoint
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrGitNotFound is returned by NewGitShadow when git is not installed.
+var ErrGitNotFound = errors.New("checkpoint: git not found")
+
+// Defaults of GitShadow.
+const (
+	DefaultMaxFileSize = 10 << 20
+	DefaultMaxFiles    = 20000
+)
+
+// DefaultMutatingTools are the tools GitShadow snapshots the workspace
+// before by default.
+var DefaultMutatingTools = []string{"Bash", "Write", "Edit", "NotebookEdit"}
+
+// checkpointRef is the branch of the shadow repository holding the
+// snapshots.
+const checkpointRef = "refs/heads/checkpoints"
+
+// GitShadow is a Checkpointer snapshotting a whole workspace before each
+// call of a tool that may change it, including changes made by commands
+// run through Bash. Snapshots are commits in a shadow git repository: its
+// GIT_DIR is kept apart from the workspace, so a repository the workspace
+// may be is never touched.
+//
+// Files ignored by the workspace's .gitignore files and files larger than
+// the size limit are neither snapshotted nor restored.
+type GitShadow struct {
+	git         string
+	workDir     string
+	gitDir      string
+	maxFileSize int64
+	maxFiles    int
+	tools       []string
+	logger      *slog.Logger
+
+	mu          sync.Mutex
+	checkpoints []gitCheckpoint
+}
+
+type gitCheckpoint struct {
+	Checkpoint
+	commit string
+}
+
+var _ Checkpointer = (*GitShadow)(nil)
+
+// GitOption configures a GitShadow.
+type GitOption func(*GitShadow)
+
+// WithGitDir sets the shadow repository's directory. Default: a directory
+// named after the workspace in the user's cache directory.
+func WithGitDir(dir string) GitOption {
+	return func(g *GitShadow) { g.gitDir = dir }
+}
+
+// WithMaxFileSize sets the size of the largest file snapshotted. Default:
+// DefaultMaxFileSize.
+func WithMaxFileSize(n int64) GitOption {
+	return func(g *GitShadow) { g.maxFileSize = n }
+}
+
+// WithMaxFiles sets how many files a workspace may hold for a snapshot to
+// be taken. Default: DefaultMaxFiles.
+func WithMaxFiles(n int) GitOption {
+	return func(g *GitShadow) { g.maxFiles = n }
+}
+
+// WithMutatingTools sets the tools calls of which are snapshotted.
+// Default: DefaultMutatingTools.
+func WithMutatingTools(names ...string) GitOption {
+	return func(g *GitShadow) { g.tools = names }
+}
+
+// WithGitLogger logs the errors List recovers from, and why ForWorkDir
+// falls back to a History, to l.
+func WithGitLogger(l *slog.Logger) GitOption {
+	return func(g *GitShadow) {
+		if l != nil {
+			g.logger = l
+		}
+	}
+}
+
+// NewGitShadow creates a GitShadow of workDir, initializing its shadow
+// repository if needed. It fails with ErrGitNotFound without git.
+func NewGitShadow(workDir string, opts ...GitOption) (*GitShadow, error) {
+	g := newGitShadow(opts)
+	if err := g.open(workDir); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ForWorkDir returns a GitShadow of workDir or, if one cannot be created
+// because git is missing or fails, a History, logging why.
+func ForWorkDir(workDir string, opts ...GitOption) Checkpointer {
+	g := newGitShadow(opts)
+	if err := g.open(workDir); err != nil {
+		g.logger.Warn("workspace checkpoints unavailable, checkpointing written files only", "error", err)
+		return NewHistory()
+	}
+	return g
+}
+
+func newGitShadow(opts []GitOption) *GitShadow {
+	g := &GitShadow{
+		maxFileSize: DefaultMaxFileSize,
+		maxFiles:    DefaultMaxFiles,
+		tools:       DefaultMutatingTools,
+		logger:      slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// open finds git and the shadow repository of workDir, creating it if
+// needed.
+func (g *GitShadow) open(workDir string) error {
+	abs, err := filepath.Abs(workDir)
+	if err != nil {
+		return fmt.Errorf("checkpoint: resolve %s: %w", workDir, err)
+	}
+	g.workDir = abs
+	if g.git, err = exec.LookPath("git"); err != nil {
+		return fmt.Errorf("%w: %w", ErrGitNotFound, err)
+	}
+	if g.gitDir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			cache = os.TempDir()
+		}
+		sum := sha256.Sum256([]byte(abs))
+		g.gitDir = filepath.Join(cache, "claude-agent-sdk-go", "checkpoints", hex.EncodeToString(sum[:8]))
+	}
+	if _, err := os.Stat(filepath.Join(g.gitDir, "HEAD")); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(g.gitDir, 0o700); err != nil {
+			return fmt.Errorf("checkpoint: create shadow repository: %w", err)
+		}
+		if _, err := g.run(nil, "init", "--quiet"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GitDir returns the shadow repository's directory.
+func (g *GitShadow) GitDir() string {
+	return g.gitDir
+}
+
+// Begin snapshots the workspace if cp's tool may change it. The snapshot
+// covers every file, so the returned Recorder is nil.
+func (g *GitShadow) Begin(cp Checkpoint) (Recorder, error) {
+	if !slices.Contains(g.tools, cp.Tool) {
+		return nil, nil
+	}
+	if cp.CreatedAt.IsZero() {
+		cp.CreatedAt = time.Now()
+	}
+	cp.Paths = nil
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tree, err := g.stage()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"commit-tree", tree, "-m", cp.Tool + " " + cp.ID}
+	if parent, err := g.run(nil, "rev-parse", "--verify", "--quiet", checkpointRef); err == nil {
+		args = append(args, "-p", strings.TrimSpace(string(parent)))
+	}
+	out, err := g.run(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	commit := strings.TrimSpace(string(out))
+	if _, err := g.run(nil, "update-ref", checkpointRef, commit); err != nil {
+		return nil, err
+	}
+	g.checkpoints = append(g.checkpoints, gitCheckpoint{Checkpoint: cp, commit: commit})
+	return nil, nil
+}
+
+// List returns the checkpoints, oldest first. The Paths of each are the
+// files changed between it and the next checkpoint, or the workspace's
+// current state for the last one.
+func (g *GitShadow) List() []Checkpoint {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	list := make([]Checkpoint, len(g.checkpoints))
+	for i, cp := range g.checkpoints {
+		list[i] = cp.Checkpoint
+		var changes []rawChange
+		var err error
+		if i+1 < len(g.checkpoints) {
+			changes, err = g.changes("diff-tree", "-r", cp.commit, g.checkpoints[i+1].commit)
+		} else if _, err = g.stage(); err == nil {
+			changes, err = g.changes("diff-index", "--cached", cp.commit)
+		}
+		if err != nil {
+			g.logger.Warn("cannot list checkpoint changes", "checkpoint", cp.ID, "error", err)
+			continue
+		}
+		for _, c := range changes {
+			list[i].Paths = append(list[i].Paths, filepath.Join(g.workDir, c.path))
+		}
+	}
+	return list
+}
+
+// Rewind restores the workspace to its snapshot at checkpoint id: files
+// are restored with their content and executable bit, and files created
+// since are removed. Ignored and oversized files are left alone.
+func (g *GitShadow) Rewind(id string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	i := g.find(id)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownCheckpoint, id)
+	}
+	commit := g.checkpoints[i].commit
+	if _, err := g.stage(); err != nil {
+		return err
+	}
+	added, err := g.changes("diff-index", "--cached", "--diff-filter=A", commit)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range added {
+		if err := os.Remove(filepath.Join(g.workDir, c.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("checkpoint: rewind %s: %w", c.path, err))
+		}
+	}
+	if _, err := g.run(nil, "read-tree", commit); err != nil {
+		return err
+	}
+	if _, err := g.run(nil, "checkout-index", "--all", "--force"); err != nil {
+		return err
+	}
+	if _, err := g.run(nil, "update-ref", checkpointRef, commit); err != nil {
+		return err
+	}
+	g.checkpoints = g.checkpoints[:i]
+	return errors.Join(errs...)
+}
+
+// Diff returns the changes made to the workspace since checkpoint id.
+func (g *GitShadow) Diff(id string) ([]FileDiff, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	i := g.find(id)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCheckpoint, id)
+	}
+	if _, err := g.stage(); err != nil {
+		return nil, err
+	}
+	changes, err := g.changes("diff-index", "--cached", g.checkpoints[i].commit)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []FileDiff
+	for _, c := range changes {
+		before, err := g.blobState(c.oldMode, c.oldBlob)
+		if err != nil {
+			return nil, err
+		}
+		after, err := g.blobState(c.newMode, c.newBlob)
+		if err != nil {
+			return nil, err
+		}
+		if d := newFileDiff(filepath.Join(g.workDir, c.path), before, after); d.Status != Unchanged {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, nil
+}
+
+func (g *GitShadow) find(id string) int {
+	return slices.IndexFunc(g.checkpoints, func(cp gitCheckpoint) bool { return cp.ID == id })
+}
+
+// stage brings the shadow index up to date with the workspace and returns
+// its tree. Files over the size limit are left out.
+func (g *GitShadow) stage() (string, error) {
+	out, err := g.run(nil, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return "", err
+	}
+	paths := splitNul(out)
+	if len(paths) > g.maxFiles {
+		return "", fmt.Errorf("checkpoint: workspace has over %d files", g.maxFiles)
+	}
+	var add, drop bytes.Buffer
+	for _, path := range paths {
+		if strings.HasSuffix(path, "/") {
+			// A nested repository, which git would store as a link.
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(g.workDir, path))
+		if err == nil && info.Mode().IsRegular() && info.Size() > g.maxFileSize {
+			drop.WriteString(path + "\x00")
+			continue
+		}
+		add.WriteString(path + "\x00")
+	}
+	if add.Len() > 0 {
+		if _, err := g.run(&add, "add", "--all", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+			return "", err
+		}
+	}
+	if drop.Len() > 0 {
+		if _, err := g.run(&drop, "rm", "--cached", "--quiet", "--ignore-unmatch", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+			return "", err
+		}
+	}
+	tree, err := g.run(nil, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(tree)), nil
+}
+
+// rawChange is one line of git's raw diff format.
+type rawChange struct {
+	oldMode, newMode string
+	oldBlob, newBlob string
+	path             string
+}
+
+// changes runs a git diff command in the raw format.
+func (g *GitShadow) changes(args ...string) ([]rawChange, error) {
+	// args[0] is the command; its options go before its revisions.
+	full := append([]string{args[0], "--raw", "-z", "--no-renames", "--no-abbrev"}, args[1:]...)
+	out, err := g.run(nil, full...)
+	if err != nil {
+		return nil, err
+	}
+	fields := splitNul(out)
+	var changes []rawChange
+	for i := 0; i+1 < len(fields); i += 2 {
+		// :oldmode newmode oldblob newblob status
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) < 5 {
+			return nil, fmt.Errorf("checkpoint: unexpected git output %q", fields[i])
+		}
+		changes = append(changes, rawChange{
+			oldMode: meta[0], newMode: meta[1],
+			oldBlob: meta[2], newBlob: meta[3],
+			path: fields[i+1],
+		})
+	}
+	return changes, nil
+}
+
+// blobState returns the state of a file stored as blob with git's mode.
+func (g *GitShadow) blobState(mode, blob string) (FileState, error) {
+	if strings.Trim(mode, "0") == "" {
+		return FileState{}, nil
+	}
+	content, err := g.run(nil, "cat-file", "blob", blob)
+	if err != nil {
+		return FileState{}, err
+	}
+	perm := fs.FileMode(0o644)
+	if m, err := strconv.ParseUint(mode, 8, 32); err == nil && m&0o111 != 0 {
+		perm = 0o755
+	}
+	return FileState{Exists: true, Content: content, Mode: perm}, nil
+}
+
+// run runs git on the shadow repository with the workspace as its work
+// tree.
+func (g *GitShadow) run(stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command(g.git, append([]string{
+		"-c", "core.autocrlf=false",
+		"-c", "core.quotepath=false",
+		"-c", "core.fsmonitor=false",
+		"-c", "gc.auto=0",
+		"-c", "commit.gpgsign=false",
+	}, args...)...)
+	cmd.Dir = g.workDir
+	cmd.Env = append(os.Environ(),
+		"GIT_DIR="+g.gitDir,
+		"GIT_WORK_TREE="+g.workDir,
+		"GIT_INDEX_FILE="+filepath.Join(g.gitDir, "index"),
+		"GIT_LITERAL_PATHSPECS=1",
+		"GIT_AUTHOR_NAME=agent", "GIT_AUTHOR_EMAIL=agent@localhost",
+		"GIT_COMMITTER_NAME=agent", "GIT_COMMITTER_EMAIL=agent@localhost",
+	)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint: git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func splitNul(out []byte) []string {
+	var fields []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
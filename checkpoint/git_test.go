@@ -0,0 +1,150 @@
+package checkpoint
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newShadow(t *testing.T, opts ...GitOption) (*GitShadow, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	work := t.TempDir()
+	g, err := NewGitShadow(work, append([]GitOption{WithGitDir(filepath.Join(t.TempDir(), "shadow"))}, opts...)...)
+	require.NoError(t, err)
+	return g, work
+}
+
+func writeFile(t *testing.T, path, content string, mode os.FileMode) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), mode))
+	require.NoError(t, os.Chmod(path, mode))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestGitShadow_RewindRestoresWorkspace(t *testing.T) {
+	g, work := newShadow(t)
+	writeFile(t, filepath.Join(work, "main.go"), "package main\n", 0o644)
+	writeFile(t, filepath.Join(work, "run.sh"), "#!/bin/sh\n", 0o755)
+	writeFile(t, filepath.Join(work, "gone.txt"), "bye\n", 0o644)
+
+	r, err := g.Begin(Checkpoint{ID: "toolu_1", Tool: "Bash"})
+	require.NoError(t, err)
+	assert.Nil(t, r)
+
+	// What a shell command might do.
+	writeFile(t, filepath.Join(work, "main.go"), "package main\n\nfunc main() {}\n", 0o644)
+	writeFile(t, filepath.Join(work, "gen", "out.go"), "package gen\n", 0o644)
+	require.NoError(t, os.Remove(filepath.Join(work, "gone.txt")))
+	require.NoError(t, os.Chmod(filepath.Join(work, "run.sh"), 0o644))
+
+	_, err = g.Begin(Checkpoint{ID: "toolu_2", Tool: "Write"})
+	require.NoError(t, err)
+	writeFile(t, filepath.Join(work, "main.go"), "changed again\n", 0o644)
+
+	list := g.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "toolu_1", list[0].ID)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(work, "main.go"), filepath.Join(work, "gen", "out.go"),
+		filepath.Join(work, "gone.txt"), filepath.Join(work, "run.sh"),
+	}, list[0].Paths)
+	assert.Equal(t, []string{filepath.Join(work, "main.go")}, list[1].Paths)
+
+	diffs, err := g.Diff("toolu_1")
+	require.NoError(t, err)
+	statuses := map[string]Status{}
+	for _, d := range diffs {
+		statuses[filepath.Base(d.Path)] = d.Status
+	}
+	assert.Equal(t, map[string]Status{"main.go": Modified, "out.go": Added, "gone.txt": Deleted, "run.sh": ModeChanged}, statuses)
+
+	require.NoError(t, g.Rewind("toolu_2"))
+	assert.Equal(t, "package main\n\nfunc main() {}\n", readFile(t, filepath.Join(work, "main.go")))
+	assert.Len(t, g.List(), 1)
+
+	require.NoError(t, g.Rewind("toolu_1"))
+	assert.Equal(t, "package main\n", readFile(t, filepath.Join(work, "main.go")))
+	assert.Equal(t, "bye\n", readFile(t, filepath.Join(work, "gone.txt")))
+	assert.NoFileExists(t, filepath.Join(work, "gen", "out.go"))
+	info, err := os.Stat(filepath.Join(work, "run.sh"))
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode().Perm()&0o100, "executable bit restored")
+	assert.Empty(t, g.List())
+
+	assert.ErrorIs(t, g.Rewind("toolu_1"), ErrUnknownCheckpoint)
+}
+
+func TestGitShadow_LeavesUserRepositoryAlone(t *testing.T) {
+	g, work := newShadow(t)
+	cmd := exec.Command("git", "init", "--quiet", work)
+	require.NoError(t, cmd.Run())
+	writeFile(t, filepath.Join(work, "a.txt"), "a\n", 0o644)
+
+	_, err := g.Begin(Checkpoint{ID: "toolu_1", Tool: "Edit"})
+	require.NoError(t, err)
+
+	out, err := exec.Command("git", "-C", work, "status", "--porcelain").Output()
+	require.NoError(t, err)
+	assert.Equal(t, "?? a.txt\n", string(out), "the user's index is untouched")
+	assert.NoDirExists(t, filepath.Join(work, ".git", "refs", "heads", "checkpoints"))
+}
+
+func TestGitShadow_SkipsIgnoredAndLargeFiles(t *testing.T) {
+	g, work := newShadow(t, WithMaxFileSize(10))
+	writeFile(t, filepath.Join(work, ".gitignore"), "build/\n", 0o644)
+	writeFile(t, filepath.Join(work, "build", "bin"), "binary\n", 0o644)
+	writeFile(t, filepath.Join(work, "big.txt"), "more than ten bytes\n", 0o644)
+	writeFile(t, filepath.Join(work, "small"), "ok\n", 0o644)
+
+	_, err := g.Begin(Checkpoint{ID: "toolu_1", Tool: "Bash"})
+	require.NoError(t, err)
+	writeFile(t, filepath.Join(work, "build", "bin"), "rebuilt\n", 0o644)
+	writeFile(t, filepath.Join(work, "big.txt"), "still more than ten bytes\n", 0o644)
+	writeFile(t, filepath.Join(work, "small"), "ko\n", 0o644)
+
+	diffs, err := g.Diff("toolu_1")
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, filepath.Join(work, "small"), diffs[0].Path)
+
+	require.NoError(t, g.Rewind("toolu_1"))
+	assert.Equal(t, "ok\n", readFile(t, filepath.Join(work, "small")))
+	assert.Equal(t, "rebuilt\n", readFile(t, filepath.Join(work, "build", "bin")))
+	assert.Equal(t, "still more than ten bytes\n", readFile(t, filepath.Join(work, "big.txt")))
+}
+
+func TestGitShadow_OnlyMutatingTools(t *testing.T) {
+	g, _ := newShadow(t, WithMaxFiles(1))
+	_, err := g.Begin(Checkpoint{ID: "toolu_1", Tool: "Read"})
+	require.NoError(t, err)
+	assert.Empty(t, g.List())
+}
+
+func TestGitShadow_MaxFiles(t *testing.T) {
+	g, work := newShadow(t, WithMaxFiles(1))
+	writeFile(t, filepath.Join(work, "a"), "a", 0o644)
+	writeFile(t, filepath.Join(work, "b"), "b", 0o644)
+	_, err := g.Begin(Checkpoint{ID: "toolu_1", Tool: "Bash"})
+	assert.ErrorContains(t, err, "over 1 files")
+}
+
+func TestForWorkDir_FallsBackWithoutGit(t *testing.T) {
+	t.Setenv("PATH", "")
+	_, err := NewGitShadow(t.TempDir())
+	assert.ErrorIs(t, err, ErrGitNotFound)
+	assert.IsType(t, &History{}, ForWorkDir(t.TempDir()))
+}
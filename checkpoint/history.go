@@ -0,0 +1,240 @@
+package checkpoint
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrUnknownCheckpoint is returned for a checkpoint ID a Checkpointer does
+// not hold.
+var ErrUnknownCheckpoint = errors.New("checkpoint: unknown checkpoint")
+
+// Checkpoint describes the state of the files before one tool call.
+type Checkpoint struct {
+	// ID is the ID of the tool use that made the checkpoint.
+	ID string
+	// Tool is the name of the tool called.
+	Tool      string
+	SessionID string
+	// MessageIndex is the index in the session of the assistant message
+	// calling the tool. Rewinding the conversation to before it rewinds
+	// the files to this checkpoint.
+	MessageIndex int
+	CreatedAt    time.Time
+	// Paths are the files the tool call changed: those it recorded before
+	// changing them, or those a workspace checkpointer found changed.
+	Paths []string
+}
+
+// Recorder records the state of a file before a tool changes it.
+// *Tracker is a Recorder.
+type Recorder interface {
+	RecordWrite(path string) error
+}
+
+// Checkpointer keeps checkpoints of the files tools change, to list, diff
+// and restore them. Checkpoints are ordered by creation, and rewinding to
+// one undoes it and every later one.
+type Checkpointer interface {
+	// Begin starts the checkpoint of a tool call. Tools changing files
+	// report them to the returned Recorder, which may be nil if the
+	// checkpointer does not track single files.
+	Begin(cp Checkpoint) (Recorder, error)
+	// List returns the checkpoints, oldest first.
+	List() []Checkpoint
+	// Rewind restores the files to their state at checkpoint id and
+	// discards it and the later checkpoints.
+	Rewind(id string) error
+	// Diff returns the changes made to files since checkpoint id.
+	Diff(id string) ([]FileDiff, error)
+}
+
+// FileState is the content and mode of a file, or its absence.
+type FileState struct {
+	Exists  bool
+	Content []byte
+	Mode    fs.FileMode
+}
+
+// readState returns the current state of path.
+func readState(path string) (FileState, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return FileState{}, nil
+	}
+	if err != nil {
+		return FileState{}, err
+	}
+	if info.IsDir() {
+		return FileState{}, fmt.Errorf("%s is a directory", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FileState{}, err
+	}
+	return FileState{Exists: true, Content: data, Mode: info.Mode().Perm()}, nil
+}
+
+// restore makes path match the state.
+func (s FileState) restore(path string) error {
+	if !s.Exists {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, s.Content, s.Mode); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file.
+	return os.Chmod(path, s.Mode)
+}
+
+// History is an in-memory Checkpointer keeping the content of each file a
+// tool call records before it is changed. Checkpoints of tool calls that
+// record no file are not kept.
+type History struct {
+	mu          sync.Mutex
+	checkpoints []*historyEntry
+}
+
+type historyEntry struct {
+	Checkpoint
+	// before holds the state of each of Paths when first recorded.
+	before map[string]FileState
+}
+
+var _ Checkpointer = (*History)(nil)
+
+// NewHistory creates an empty History.
+func NewHistory() *History {
+	return &History{}
+}
+
+// Begin returns a Recorder adding the files it records to checkpoint cp.
+func (h *History) Begin(cp Checkpoint) (Recorder, error) {
+	if cp.CreatedAt.IsZero() {
+		cp.CreatedAt = time.Now()
+	}
+	cp.Paths = nil
+	return &historyRecorder{history: h, entry: &historyEntry{Checkpoint: cp, before: make(map[string]FileState)}}, nil
+}
+
+type historyRecorder struct {
+	history *History
+	entry   *historyEntry
+}
+
+// RecordWrite records the state of path unless the checkpoint already
+// holds it.
+func (r *historyRecorder) RecordWrite(path string) error {
+	h := r.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := r.entry.before[path]; ok {
+		return nil
+	}
+	state, err := readState(path)
+	if err != nil {
+		return fmt.Errorf("checkpoint: cannot read %s: %w", path, err)
+	}
+	r.entry.before[path] = state
+	r.entry.Paths = append(r.entry.Paths, path)
+	if len(r.entry.Paths) == 1 {
+		h.checkpoints = append(h.checkpoints, r.entry)
+	}
+	return nil
+}
+
+// List returns the checkpoints, oldest first.
+func (h *History) List() []Checkpoint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]Checkpoint, len(h.checkpoints))
+	for i, e := range h.checkpoints {
+		list[i] = e.Checkpoint
+		list[i].Paths = slices.Clone(e.Paths)
+	}
+	return list
+}
+
+// Rewind restores every file recorded at or after checkpoint id to its
+// state before it, and discards those checkpoints. Files created since
+// are removed; deleted files are restored, with their mode.
+func (h *History) Rewind(id string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i, before, err := h.since(id)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, path := range sortedPaths(before) {
+		if err := before[path].restore(path); err != nil {
+			errs = append(errs, fmt.Errorf("checkpoint: rewind %s: %w", path, err))
+		}
+	}
+	h.checkpoints = h.checkpoints[:i]
+	return errors.Join(errs...)
+}
+
+// Diff compares the files recorded at or after checkpoint id with their
+// state before it.
+func (h *History) Diff(id string) ([]FileDiff, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, before, err := h.since(id)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []FileDiff
+	for _, path := range sortedPaths(before) {
+		after, err := readState(path)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint: cannot read %s: %w", path, err)
+		}
+		if d := newFileDiff(path, before[path], after); d.Status != Unchanged {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, nil
+}
+
+// since returns the position of checkpoint id and the earliest recorded
+// state of each file recorded from it on.
+func (h *History) since(id string) (int, map[string]FileState, error) {
+	i := slices.IndexFunc(h.checkpoints, func(e *historyEntry) bool { return e.ID == id })
+	if i < 0 {
+		return 0, nil, fmt.Errorf("%w: %s", ErrUnknownCheckpoint, id)
+	}
+	before := make(map[string]FileState)
+	for _, e := range h.checkpoints[i:] {
+		for _, path := range e.Paths {
+			if _, ok := before[path]; !ok {
+				before[path] = e.before[path]
+			}
+		}
+	}
+	return i, before, nil
+}
+
+func sortedPaths(states map[string]FileState) []string {
+	paths := make([]string, 0, len(states))
+	for path := range states {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
@@ -0,0 +1,100 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func begin(t *testing.T, h *History, id string) Recorder {
+	t.Helper()
+	r, err := h.Begin(Checkpoint{ID: id, Tool: "Write"})
+	require.NoError(t, err)
+	return r
+}
+
+func TestHistory_RewindRestoresEachKindOfChange(t *testing.T) {
+	dir := t.TempDir()
+	modified := filepath.Join(dir, "modified.txt")
+	created := filepath.Join(dir, "sub", "created.txt")
+	deleted := filepath.Join(dir, "deleted.txt")
+	chmodded := filepath.Join(dir, "script.sh")
+	require.NoError(t, os.WriteFile(modified, []byte("v1"), 0o644))
+	require.NoError(t, os.WriteFile(deleted, []byte("keep me"), 0o600))
+	require.NoError(t, os.WriteFile(chmodded, []byte("#!/bin/sh"), 0o644))
+
+	h := NewHistory()
+	r := begin(t, h, "toolu_1")
+	for _, path := range []string{modified, created, deleted, chmodded} {
+		require.NoError(t, r.RecordWrite(path))
+	}
+	require.NoError(t, os.WriteFile(modified, []byte("v2"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Dir(created), 0o755))
+	require.NoError(t, os.WriteFile(created, []byte("new"), 0o644))
+	require.NoError(t, os.Remove(deleted))
+	require.NoError(t, os.Chmod(chmodded, 0o755))
+
+	diffs, err := h.Diff("toolu_1")
+	require.NoError(t, err)
+	statuses := map[string]Status{}
+	for _, d := range diffs {
+		statuses[d.Path] = d.Status
+	}
+	assert.Equal(t, map[string]Status{modified: Modified, created: Added, deleted: Deleted, chmodded: ModeChanged}, statuses)
+
+	require.NoError(t, h.Rewind("toolu_1"))
+	data, err := os.ReadFile(modified)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+	assert.NoFileExists(t, created)
+	info, err := os.Stat(deleted)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	info, err = os.Stat(chmodded)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+	assert.Empty(t, h.List())
+}
+
+func TestHistory_RewindToMiddleCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	h := NewHistory()
+
+	for i, content := range []string{"one", "two", "three"} {
+		r := begin(t, h, []string{"a", "b", "c"}[i])
+		require.NoError(t, r.RecordWrite(path))
+		require.NoError(t, r.RecordWrite(path), "recording twice keeps the first state")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	// A call recording nothing makes no checkpoint.
+	begin(t, h, "d")
+
+	list := h.List()
+	require.Len(t, list, 3)
+	assert.Equal(t, []string{path}, list[1].Paths)
+	assert.False(t, list[0].CreatedAt.IsZero())
+
+	require.NoError(t, h.Rewind("b"))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "one", string(data))
+	assert.Len(t, h.List(), 1)
+
+	assert.ErrorIs(t, h.Rewind("c"), ErrUnknownCheckpoint)
+	_, err = h.Diff("missing")
+	assert.ErrorIs(t, err, ErrUnknownCheckpoint)
+}
+
+func TestHistory_DiffOmitsRestoredFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	require.NoError(t, os.WriteFile(path, []byte("same"), 0o644))
+	h := NewHistory()
+	require.NoError(t, begin(t, h, "a").RecordWrite(path))
+
+	diffs, err := h.Diff("a")
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
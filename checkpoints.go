@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/armatrix/claude-agent-sdk-go/checkpoint"
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
+)
+
+// checkpointToolExecutor begins a checkpoint before each tool call and
+// passes its recorder to the tool through the context.
+type checkpointToolExecutor struct {
+	engine.ToolExecutor
+	checkpointer checkpoint.Checkpointer
+	// session is the run's session. Tools run on the loop's goroutine,
+	// after the assistant message calling them is appended.
+	session *Session
+	logger  *slog.Logger
+}
+
+func (t *checkpointToolExecutor) Execute(ctx context.Context, name string, input json.RawMessage) (string, bool, error) {
+	id := ContextToolUseID(ctx)
+	if id == "" {
+		id = GenerateID("call")
+	}
+	recorder, err := t.checkpointer.Begin(checkpoint.Checkpoint{
+		ID:           id,
+		Tool:         name,
+		SessionID:    t.session.ID,
+		MessageIndex: len(t.session.Messages) - 1,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		t.logger.Warn("tool call not checkpointed", LogKeyTool, name, "error", err)
+	} else if recorder != nil {
+		ctx = WithContextCheckpoint(ctx, recorder)
+	}
+	return t.ToolExecutor.Execute(ctx, name, input)
+}
+
+// Checkpoints returns the file checkpoints of the client's agent, oldest
+// first. They cover the tool calls of every session the agent runs, since
+// those share the files.
+func (c *Client) Checkpoints() []checkpoint.Checkpoint {
+	if c.agent.opts.checkpointer == nil {
+		return nil
+	}
+	return c.agent.opts.checkpointer.List()
+}
+
+// RewindFiles restores the files changed by tool calls to their state at
+// checkpoint id, undoing it and every later checkpoint. It waits for a
+// running query to end, or returns ctx's error when ctx ends first; called
+// from a hook or tool of that query, it waits until ctx ends. The
+// conversation is unchanged; see RewindTo.
+func (c *Client) RewindFiles(ctx context.Context, id string) error {
+	if c.agent.opts.checkpointer == nil {
+		return ErrNoCheckpointer
+	}
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() { <-c.slot }()
+	return c.agent.opts.checkpointer.Rewind(id)
+}
+
+// DiffSince returns the changes tool calls made to files since checkpoint
+// id.
+func (c *Client) DiffSince(id string) ([]checkpoint.FileDiff, error) {
+	if c.agent.opts.checkpointer == nil {
+		return nil, ErrNoCheckpointer
+	}
+	return c.agent.opts.checkpointer.Diff(id)
+}
+
+// rewindFilesTo rewinds the files to the first checkpoint made at or after
+// message index of session, if any. A fork shares its first BranchPoint
+// messages with its parent, whose tool calls were checkpointed under the
+// parent's id, so the checkpoints of the session's ancestors count up to
+// where it branched off; ancestors are loaded from the store. The caller
+// holds the slot.
+func (c *Client) rewindFilesTo(ctx context.Context, session *Session, index int) error {
+	checkpointer := c.agent.opts.checkpointer
+	if checkpointer == nil {
+		return nil
+	}
+
+	// shared maps each session on the line to the number of leading
+	// messages it shares with session.
+	shared := map[string]int{session.ID: math.MaxInt}
+	end := math.MaxInt
+	for s := session; s.Metadata.ParentID != "" && index < s.Metadata.BranchPoint; {
+		end = min(end, s.Metadata.BranchPoint)
+		shared[s.Metadata.ParentID] = end
+		if c.store == nil {
+			break
+		}
+		parent, err := c.store.Load(ctx, s.Metadata.ParentID)
+		if errors.Is(err, ErrSessionNotFound) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("load parent session: %w", err)
+		}
+		s = parent
+	}
+
+	for _, cp := range checkpointer.List() {
+		if end, ok := shared[cp.SessionID]; ok && cp.MessageIndex >= index && cp.MessageIndex < end {
+			return checkpointer.Rewind(cp.ID)
+		}
+	}
+	return nil
+}
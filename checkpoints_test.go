@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/armatrix/claude-agent-sdk-go/checkpoint"
+)
+
+// appendFileTool appends a line to path, recording it first as the
+// built-in write tools do.
+func appendFileTool(t *testing.T, r *ToolRegistry, path string) {
+	r.RegisterRaw("Append", "Append a line", anthropic.ToolInputSchemaParam{},
+		func(ctx context.Context, _ json.RawMessage) (*ToolResult, error) {
+			assert.NotEmpty(t, ContextToolUseID(ctx))
+			if recorder := ContextCheckpoint(ctx); recorder != nil {
+				require.NoError(t, recorder.RecordWrite(path))
+			}
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+			require.NoError(t, err)
+			defer f.Close()
+			_, err = f.WriteString("line\n")
+			require.NoError(t, err)
+			return TextResult("appended"), nil
+		})
+}
+
+func TestClient_FileCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	provider := &scriptedProvider{responses: []string{
+		toolUseResponse("toolu_1", "Append"), textResponse("one"),
+		toolUseResponse("toolu_2", "Append"), textResponse("two"),
+	}}
+	c := NewClient(WithProvider(provider), WithFileCheckpointing())
+	appendFileTool(t, c.Agent().Tools(), path)
+
+	for _, prompt := range []string{"first", "second"} {
+		stream := c.Query(context.Background(), prompt)
+		for stream.Next() {
+		}
+		require.NoError(t, stream.Err())
+	}
+
+	cps := c.Checkpoints()
+	require.Len(t, cps, 2)
+	assert.Equal(t, "toolu_1", cps[0].ID)
+	assert.Equal(t, "Append", cps[0].Tool)
+	assert.Equal(t, c.Session().ID, cps[0].SessionID)
+	assert.Equal(t, 1, cps[0].MessageIndex)
+	assert.Equal(t, 5, cps[1].MessageIndex)
+	assert.Equal(t, []string{path}, cps[1].Paths)
+
+	diffs, err := c.DiffSince("toolu_2")
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, checkpoint.Modified, diffs[0].Status)
+	assert.Equal(t, "line\n", string(diffs[0].Before.Content))
+
+	require.NoError(t, c.RewindFiles(context.Background(), "toolu_2"))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "line\n", string(data))
+	assert.Len(t, c.Checkpoints(), 1)
+
+	// Rewinding the conversation to before the first prompt's tool call
+	// removes the file it created.
+	require.NoError(t, c.RewindTo(context.Background(), 0))
+	assert.NoFileExists(t, path)
+	assert.Empty(t, c.Checkpoints())
+	assert.Empty(t, c.Session().Messages)
+}
+
+func TestClient_RewindToFollowsForks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	provider := &scriptedProvider{responses: []string{
+		toolUseResponse("toolu_1", "Append"), textResponse("one"),
+		toolUseResponse("toolu_2", "Append"), textResponse("two"),
+		toolUseResponse("toolu_3", "Append"), textResponse("three"),
+	}}
+	store := &recordingStore{sessions: make(map[string]*Session)}
+	c := NewClient(WithProvider(provider), WithFileCheckpointing(), WithSessionStore(store))
+	appendFileTool(t, c.Agent().Tools(), path)
+	query := func(prompt string) {
+		t.Helper()
+		require.NoError(t, c.Query(context.Background(), prompt).Wait())
+	}
+
+	query("first")
+	query("second")
+	root := c.Session()
+
+	// Retry the second prompt on a branch, then branch off that branch.
+	require.NoError(t, c.RewindTo(context.Background(), 4))
+	query("second again")
+	require.NoError(t, c.RewindTo(context.Background(), 4))
+	leaf := c.Session()
+	require.NotEqual(t, root.ID, leaf.Metadata.ParentID)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "line\n", string(data))
+
+	// The first prompt's tool call was checkpointed in the root session,
+	// two forks up.
+	require.Len(t, c.Checkpoints(), 1)
+	assert.Equal(t, root.ID, c.Checkpoints()[0].SessionID)
+	require.NoError(t, c.RewindTo(context.Background(), 0))
+	assert.NoFileExists(t, path)
+	assert.Empty(t, c.Checkpoints())
+}
+
+func TestClient_FileCheckpointsDisabled(t *testing.T) {
+	c := NewClient()
+	assert.Nil(t, c.Checkpoints())
+	assert.ErrorIs(t, c.RewindFiles(context.Background(), "toolu_1"), ErrNoCheckpointer)
+	_, err := c.DiffSince("toolu_1")
+	assert.ErrorIs(t, err, ErrNoCheckpointer)
+	require.NoError(t, c.RewindTo(context.Background(), 0))
+}
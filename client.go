@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -9,23 +10,49 @@ import (
 	"github.com/armatrix/claude-agent-sdk-go/permission"
 )
 
+// QueryPolicy decides what a Client does with a query started while
+// another query is running.
+type QueryPolicy int
+
+const (
+	// QueryQueue makes Query wait for the running query to end. This is the
+	// default. A caller that waits must not be the one that has to read the
+	// running query's stream.
+	QueryQueue QueryPolicy = iota
+	// QueryReject makes Query return a stream whose Err is
+	// ErrQueryInProgress.
+	QueryReject
+)
+
 // Client is a stateful session container that wraps an Agent.
 // It maintains conversation history across multiple Query calls.
+//
+// A Client is safe for concurrent use. Its queries run one at a time, each
+// with the model, thinking budget and permission mode set when it started.
 type Client struct {
-	agent   *Agent
-	session *Session
-	store   SessionStore
+	agent  *Agent
+	store  SessionStore
+	policy QueryPolicy
 
-	mu     sync.Mutex
-	cancel context.CancelFunc // cancel for current Query
+	// slot holds a token while a query runs.
+	slot chan struct{}
+
+	mu       sync.Mutex
+	session  *Session
+	settings runSettings
+	cancel   context.CancelFunc // cancel for the running Query
 }
 
 // NewClient creates a new Client with its own Agent configured by the given options.
 func NewClient(opts ...AgentOption) *Client {
 	resolved := resolveOptions(opts)
+	a := NewAgent(opts...)
 	c := &Client{
-		agent:   NewAgent(opts...),
-		session: NewSession(),
+		agent:    a,
+		session:  NewSession(),
+		settings: a.settings(),
+		policy:   resolved.queryPolicy,
+		slot:     make(chan struct{}, 1),
 	}
 	if resolved.sessionStore != nil {
 		c.store = resolved.sessionStore
@@ -35,13 +62,34 @@ func NewClient(opts ...AgentOption) *Client {
 
 // Query sends a prompt to the agent within the client's ongoing session.
 // The session history is automatically maintained across calls.
+//
+// If a query is already running, Query waits for it to end, or with
+// QueryReject returns a stream failing with ErrQueryInProgress. A query
+// that ends waiting returns a stream failing with ctx's error.
 func (c *Client) Query(ctx context.Context, prompt string) *AgentStream {
+	if c.policy == QueryReject {
+		select {
+		case c.slot <- struct{}{}:
+		default:
+			return errorStream(ErrQueryInProgress, c.Session())
+		}
+	} else if err := c.acquire(ctx); err != nil {
+		return errorStream(err, c.Session())
+	}
+
 	c.mu.Lock()
 	ctx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
+	session, settings := c.session, c.settings
 	c.mu.Unlock()
 
-	return c.agent.RunWithSession(ctx, c.session, prompt)
+	return c.agent.runWithSession(ctx, session, prompt, &settings, func() {
+		c.mu.Lock()
+		c.cancel = nil
+		c.mu.Unlock()
+		cancel()
+		<-c.slot
+	})
 }
 
 // Interrupt cancels the currently running Query, if any.
@@ -70,24 +118,56 @@ func (c *Client) Resume(ctx context.Context, sessionID string) error {
 	return nil
 }
 
-// Fork creates a new Client that shares the same Agent but has a cloned session.
+// acquire takes the slot, waiting for a running query to end or for ctx
+// to end. Calling it from a hook or tool of the client's running query, or
+// while holding back that query's events, deadlocks until ctx ends, so the
+// methods using it must not be called there with a context that never
+// ends.
+func (c *Client) acquire(ctx context.Context) error {
+	select {
+	case c.slot <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Fork creates a new Client that shares the same Agent but has a cloned
+// session and its own copy of the runtime settings. It waits for a running
+// query to end, so the clone holds its complete exchange; calling it from
+// a hook or tool of that query deadlocks. Use ForkContext to bound the
+// wait.
+// Forks draw from the same shared budget (see WithSharedBudget) as the parent.
 func (c *Client) Fork() *Client {
-	c.mu.Lock()
-	cloned := c.session.Clone()
-	c.mu.Unlock()
+	forked, _ := c.ForkContext(context.Background())
+	return forked
+}
 
-	return &Client{
-		agent:   c.agent,
-		session: cloned,
-		store:   c.store,
+// ForkContext is like Fork, but stops waiting for a running query and
+// returns ctx's error when ctx ends.
+func (c *Client) ForkContext(ctx context.Context) (*Client, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
 	}
+	defer func() { <-c.slot }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &Client{
+		agent:    c.agent,
+		session:  c.session.Clone(),
+		settings: c.settings,
+		store:    c.store,
+		policy:   c.policy,
+		slot:     make(chan struct{}, 1),
+	}, nil
 }
 
-// SetModel updates the agent's model for subsequent queries.
+// SetModel updates the model for subsequent queries.
 func (c *Client) SetModel(model anthropic.Model) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.agent.opts.model = model
+	c.settings.model = model
 }
 
 // SetMaxThinkingTokens updates the thinking token budget for subsequent queries.
@@ -95,7 +175,7 @@ func (c *Client) SetModel(model anthropic.Model) {
 func (c *Client) SetMaxThinkingTokens(n int64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.agent.opts.maxThinkingTokens = n
+	c.settings.maxThinkingTokens = n
 }
 
 // InterruptAndContinue cancels the current Query but preserves the session.
@@ -103,27 +183,46 @@ func (c *Client) SetMaxThinkingTokens(n int64) {
 // This is semantically equivalent to Interrupt — included for API parity with
 // the official TS/Python SDKs.
 func (c *Client) InterruptAndContinue() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.cancel != nil {
-		c.cancel()
-		c.cancel = nil
-	}
+	c.Interrupt()
 }
 
 // SetPermissionMode updates the permission mode for subsequent queries.
 func (c *Client) SetPermissionMode(mode permission.Mode) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.agent.opts.permissionMode = mode
+	c.settings.permissionMode = mode
+}
+
+// Model returns the model subsequent queries use.
+func (c *Client) Model() anthropic.Model {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.settings.model
+}
+
+// PermissionMode returns the permission mode subsequent queries use.
+func (c *Client) PermissionMode() permission.Mode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.settings.permissionMode
 }
 
 // ContinueLatest loads the most recently updated session from the store.
-// Requires a SessionStore that implements SessionLister.
+// Requires a SessionStore that implements SessionIndex or SessionLister.
 func (c *Client) ContinueLatest(ctx context.Context) error {
 	if c.store == nil {
 		return errNoStore
 	}
+	if index, ok := c.store.(SessionIndex); ok {
+		page, err := index.ListSummaries(ctx, SessionQuery{Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(page.Sessions) == 0 {
+			return ErrNoSessions
+		}
+		return c.Resume(ctx, page.Sessions[0].ID)
+	}
 	lister, ok := c.store.(SessionLister)
 	if !ok {
 		return ErrStoreNotListable
@@ -150,6 +249,8 @@ func (c *Client) ContinueLatest(ctx context.Context) error {
 
 // Session returns the client's current session.
 func (c *Client) Session() *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.session
 }
 
@@ -158,12 +259,20 @@ func (c *Client) Agent() *Agent {
 	return c.agent
 }
 
-// Close persists the session (if a store is configured) and releases resources.
+// Close interrupts a running query, waits for it to end, persists the
+// session (if a store is configured), and runs the WithOnSessionClose
+// callbacks for it. Calling it from a hook or tool of the running query
+// deadlocks, as the query cannot end before the call returns.
 func (c *Client) Close() error {
+	c.Interrupt()
+	c.slot <- struct{}{}
+	defer func() { <-c.slot }()
+	ctx := context.Background()
+	var err error
 	if c.store != nil {
-		return c.store.Save(context.Background(), c.session)
+		err = c.store.Save(ctx, c.Session())
 	}
-	return nil
+	return errors.Join(err, c.agent.closeSession(ctx, c.Session().ID))
 }
 
 var errNoStore = ErrNoSessionStore
@@ -2,12 +2,15 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -62,23 +65,25 @@ func TestClient_Agent(t *testing.T) {
 
 func TestClient_SetModel(t *testing.T) {
 	c := NewClient(WithModel(anthropic.ModelClaudeOpus4_6))
-	assert.Equal(t, anthropic.ModelClaudeOpus4_6, c.Agent().Model())
+	assert.Equal(t, anthropic.ModelClaudeOpus4_6, c.Model())
 
 	c.SetModel(anthropic.ModelClaudeSonnet4_5)
-	assert.Equal(t, anthropic.ModelClaudeSonnet4_5, c.Agent().Model())
+	assert.Equal(t, anthropic.ModelClaudeSonnet4_5, c.Model())
+	// The agent, shared with forks, is left alone.
+	assert.Equal(t, anthropic.ModelClaudeOpus4_6, c.Agent().Model())
 }
 
 // --- SetMaxThinkingTokens ---
 
 func TestClient_SetMaxThinkingTokens(t *testing.T) {
 	c := NewClient()
-	assert.Equal(t, int64(0), c.Agent().Options().maxThinkingTokens)
+	assert.Equal(t, int64(0), c.settings.maxThinkingTokens)
 
 	c.SetMaxThinkingTokens(10000)
-	assert.Equal(t, int64(10000), c.Agent().Options().maxThinkingTokens)
+	assert.Equal(t, int64(10000), c.settings.maxThinkingTokens)
 
 	c.SetMaxThinkingTokens(0) // disable
-	assert.Equal(t, int64(0), c.Agent().Options().maxThinkingTokens)
+	assert.Equal(t, int64(0), c.settings.maxThinkingTokens)
 }
 
 // --- Fork ---
@@ -121,6 +126,27 @@ func TestClient_Fork_SharesStore(t *testing.T) {
 	assert.Same(t, c.store, forked.store)
 }
 
+func TestClient_Fork_BranchLeavesCostWithParent(t *testing.T) {
+	c := NewClient()
+	c.session.Messages = append(c.session.Messages,
+		anthropic.NewUserMessage(anthropic.NewTextBlock("hello")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("hi")))
+	c.session.Metadata.TotalCost = decimal.NewFromFloat(0.5)
+	c.session.Metadata.TotalTokens = Usage{InputTokens: 100, OutputTokens: 10}
+	c.session.Metadata.NumTurns = 1
+
+	forked, err := c.ForkContext(context.Background())
+	require.NoError(t, err)
+
+	meta := forked.session.Metadata
+	assert.Equal(t, c.session.ID, meta.ParentID)
+	assert.Equal(t, 2, meta.BranchPoint)
+	total := c.session.Metadata.TotalCost.Add(meta.TotalCost)
+	assert.True(t, total.Equal(decimal.NewFromFloat(0.5)), "the tree's cost counts the shared turn once, got %s", total)
+	assert.Equal(t, Usage{}, meta.TotalTokens)
+	assert.Equal(t, 0, meta.NumTurns)
+}
+
 // --- Resume ---
 
 func TestClient_Resume_LoadsSession(t *testing.T) {
@@ -187,6 +213,21 @@ func TestClient_Close_StoreError(t *testing.T) {
 	assert.Contains(t, err.Error(), "disk full")
 }
 
+func TestClient_Close_RunsSessionCloseCallbacks(t *testing.T) {
+	var closed []string
+	c := NewClient(WithProvider(&scriptedProvider{responses: []string{textResponse("hello")}}),
+		WithOnSessionClose(func(_ context.Context, id string) error {
+			closed = append(closed, id)
+			return errors.New("shell stuck")
+		}))
+	require.NoError(t, c.Query(context.Background(), "hi").Wait())
+	assert.Empty(t, closed, "a query does not end the client's session")
+
+	err := c.Close()
+	assert.ErrorContains(t, err, "shell stuck")
+	assert.Equal(t, []string{c.Session().ID}, closed)
+}
+
 // --- Interrupt ---
 
 func TestClient_Interrupt_NilCancel(t *testing.T) {
@@ -241,7 +282,7 @@ func TestClient_InterruptAndContinue_NilCancel(t *testing.T) {
 func TestClient_SetPermissionMode(t *testing.T) {
 	c := NewClient()
 	c.SetPermissionMode(permission.ModeBypassPermissions)
-	assert.Equal(t, permission.ModeBypassPermissions, c.Agent().Options().permissionMode)
+	assert.Equal(t, permission.ModeBypassPermissions, c.PermissionMode())
 }
 
 // --- Concurrent safety ---
@@ -267,7 +308,7 @@ func TestClient_ConcurrentSetModel(t *testing.T) {
 	wg.Wait()
 
 	// Should not panic and model should be one of the valid models
-	model := c.Agent().Model()
+	model := c.Model()
 	assert.Contains(t, models, model)
 }
 
@@ -393,3 +434,157 @@ func TestClient_ContinueLatest_NoSessions(t *testing.T) {
 	err := c.ContinueLatest(context.Background())
 	assert.ErrorIs(t, err, ErrNoSessions)
 }
+
+// --- Query serialization ---
+
+// gatedProvider serves scripted responses, each after a value on gate, and
+// records the model and message count of every request.
+type gatedProvider struct {
+	scriptedProvider
+	gate    chan struct{}
+	started chan struct{}
+
+	mu       sync.Mutex
+	models   []anthropic.Model
+	messages []int
+}
+
+func newGatedProvider(responses ...string) *gatedProvider {
+	return &gatedProvider{
+		scriptedProvider: scriptedProvider{responses: responses},
+		gate:             make(chan struct{}),
+		started:          make(chan struct{}, 8),
+	}
+}
+
+func (p *gatedProvider) NewStreaming(ctx context.Context, params anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	p.mu.Lock()
+	p.models = append(p.models, params.Model)
+	p.messages = append(p.messages, len(params.Messages))
+	p.mu.Unlock()
+	p.started <- struct{}{}
+	select {
+	case <-p.gate:
+	case <-ctx.Done():
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, ctx.Err())
+	}
+	return p.scriptedProvider.NewStreaming(ctx, params)
+}
+
+func TestClient_Query_QueuesAndSnapshotsSettings(t *testing.T) {
+	p := newGatedProvider(textResponse("Paris"), textResponse("Berlin"))
+	c := NewClient(WithProvider(p), WithModel("model-a"))
+
+	first := c.Query(context.Background(), "Capital of France?")
+	<-p.started
+	// Applies to the next query only.
+	c.SetModel("model-b")
+
+	second := make(chan *AgentStream)
+	go func() { second <- c.Query(context.Background(), "And Germany?") }()
+	select {
+	case <-second:
+		t.Fatal("second query started while the first was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.gate <- struct{}{}
+	require.NoError(t, first.Wait())
+	stream := <-second
+	<-p.started
+	p.gate <- struct{}{}
+	require.NoError(t, stream.Wait())
+
+	assert.Equal(t, []anthropic.Model{"model-a", "model-b"}, p.models)
+	assert.Equal(t, []int{1, 3}, p.messages)
+}
+
+func TestClient_Query_RejectPolicy(t *testing.T) {
+	p := newGatedProvider(textResponse("Paris"))
+	c := NewClient(WithProvider(p), WithModel("test-model"), WithQueryPolicy(QueryReject))
+
+	first := c.Query(context.Background(), "Capital of France?")
+	<-p.started
+
+	assert.ErrorIs(t, c.Query(context.Background(), "And Germany?").Wait(), ErrQueryInProgress)
+
+	p.gate <- struct{}{}
+	require.NoError(t, first.Wait())
+	assert.Len(t, c.Session().Messages, 2)
+}
+
+func TestClient_Interrupt_CancelsRunningQuery(t *testing.T) {
+	p := newGatedProvider()
+	c := NewClient(WithProvider(p), WithModel("test-model"))
+
+	stream := c.Query(context.Background(), "Think forever")
+	<-p.started
+	c.Interrupt()
+
+	assert.ErrorIs(t, stream.Wait(), context.Canceled)
+}
+
+func TestClient_Query_RepairsInterruptedSession(t *testing.T) {
+	// A crash between the tool use and its result was saved like this.
+	store := &recordingStore{sessions: make(map[string]*Session)}
+	saved := NewSession()
+	saved.ID = "crashed"
+	saved.Messages = []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Clean up")),
+		anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("toolu_1", map[string]any{}, "Bash")),
+	}
+	store.sessions[saved.ID] = saved
+
+	p := newGatedProvider(textResponse("OK"))
+	close(p.gate)
+	c := NewClient(WithProvider(p), WithModel("test-model"), WithSessionStore(store))
+	require.NoError(t, c.Resume(context.Background(), "crashed"))
+
+	stream := c.Query(context.Background(), "Try again")
+	var repairs []*HistoryRepairEvent
+	for stream.Next() {
+		if e, ok := stream.Current().(*HistoryRepairEvent); ok {
+			repairs = append(repairs, e)
+		}
+	}
+	require.NoError(t, stream.Err())
+
+	assert.Equal(t, []*HistoryRepairEvent{{Kind: RepairInterruptedToolUse, MessageIndex: 2, ToolUseID: "toolu_1"}}, repairs)
+	assert.Equal(t, []int{3}, p.messages, "the result and the prompt are one message")
+	msgs := store.sessions["crashed"].Messages
+	require.Len(t, msgs, 4)
+	assert.Equal(t, "toolu_1", msgs[2].Content[0].OfToolResult.ToolUseID)
+	assert.Equal(t, "Try again", msgs[2].Content[1].OfText.Text)
+}
+
+func TestClient_Fork_IndependentSettings(t *testing.T) {
+	c := NewClient(WithModel("model-a"))
+	forked := c.Fork()
+	forked.SetModel("model-b")
+	forked.SetPermissionMode(permission.ModePlan)
+
+	assert.Equal(t, anthropic.Model("model-a"), c.Model())
+	assert.Equal(t, permission.ModeDefault, c.PermissionMode())
+	assert.Equal(t, anthropic.Model("model-b"), forked.Model())
+}
+
+func TestClient_SlotUsersStopWithContext(t *testing.T) {
+	p := newGatedProvider(textResponse("done"))
+	c := NewClient(WithProvider(p), WithModel("test-model"), WithFileCheckpointing())
+	stream := c.Query(context.Background(), "hi")
+	<-p.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	forked, err := c.ForkContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, forked)
+	assert.ErrorIs(t, c.RewindTo(ctx, 0), context.DeadlineExceeded)
+	assert.ErrorIs(t, c.RewindFiles(ctx, "toolu_1"), context.DeadlineExceeded)
+
+	close(p.gate)
+	require.NoError(t, stream.Wait())
+	forked, err = c.ForkContext(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, forked.Session().Messages, 2)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/mcp"
+	"github.com/armatrix/claude-agent-sdk-go/permission"
+	"github.com/armatrix/claude-agent-sdk-go/session"
+	"github.com/armatrix/claude-agent-sdk-go/tools"
+)
+
+// Output and input formats.
+const (
+	formatText       = "text"
+	formatJSON       = "json"
+	formatStreamJSON = "stream-json"
+)
+
+// permissionModes maps --permission-mode values to permission modes.
+var permissionModes = map[string]permission.Mode{
+	"default":           permission.ModeDefault,
+	"acceptEdits":       permission.ModeAcceptEdits,
+	"bypassPermissions": permission.ModeBypassPermissions,
+	"plan":              permission.ModePlan,
+}
+
+// config holds the parsed command line.
+type config struct {
+	model           string
+	fallbackModel   string
+	systemPrompt    string
+	allowedTools    listFlag
+	disallowedTools listFlag
+	permissionMode  string
+	mcpConfig       string
+	settings        listFlag
+	maxTurns        int
+	maxBudgetUSD    string
+	resume          string
+	continueLatest  bool
+	sessionDir      string
+	outputFormat    string
+	inputFormat     string
+	includePartial  bool
+
+	// prompt is the positional arguments joined by spaces.
+	prompt string
+}
+
+// listFlag is a repeatable flag whose values may also be separated by
+// commas or spaces, like the CLI's --allowedTools "Read Grep". Separators
+// inside parentheses, as in "Bash(git log:*)", are kept.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	depth, start := 0, 0
+	for i, r := range v + "," {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',', ' ':
+			if depth == 0 {
+				if i > start {
+					*l = append(*l, v[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+	return nil
+}
+
+// parseFlags parses args (without the program name). Flag errors and usage
+// go to stderr.
+func parseFlags(args []string, stderr io.Writer) (*config, error) {
+	cfg := &config{}
+	fs := flag.NewFlagSet("claude-agent", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: claude-agent [flags] [prompt]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Runs an agent on prompt, or on standard input when no prompt is given.")
+		fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+
+	fs.Bool("p", false, "print mode; accepted for compatibility, the command is always non-interactive")
+	fs.Bool("print", false, "same as -p")
+	fs.StringVar(&cfg.model, "model", "", "model to use")
+	fs.StringVar(&cfg.fallbackModel, "fallback-model", "", "model to retry with when the model is overloaded")
+	fs.StringVar(&cfg.systemPrompt, "system-prompt", "", "system prompt")
+	fs.Var(&cfg.allowedTools, "allowed-tools", "tool patterns to allow without asking (repeatable, comma or space separated)")
+	fs.Var(&cfg.allowedTools, "allowedTools", "same as -allowed-tools")
+	fs.Var(&cfg.disallowedTools, "disallowed-tools", "tool patterns to deny (repeatable, comma or space separated)")
+	fs.Var(&cfg.disallowedTools, "disallowedTools", "same as -disallowed-tools")
+	fs.StringVar(&cfg.permissionMode, "permission-mode", "default", "permission mode: default, acceptEdits, bypassPermissions or plan")
+	fs.StringVar(&cfg.mcpConfig, "mcp-config", "", "JSON file of MCP servers to connect to")
+	fs.Var(&cfg.settings, "settings", "JSON settings files to load, in increasing precedence (repeatable)")
+	fs.IntVar(&cfg.maxTurns, "max-turns", 0, "maximum number of agent turns (0 for the default)")
+	fs.StringVar(&cfg.maxBudgetUSD, "max-budget-usd", "", "stop when the run has cost this many US dollars")
+	fs.StringVar(&cfg.resume, "resume", "", "resume the session with this ID")
+	fs.StringVar(&cfg.resume, "r", "", "same as -resume")
+	fs.BoolVar(&cfg.continueLatest, "continue", false, "continue the most recent session")
+	fs.BoolVar(&cfg.continueLatest, "c", false, "same as -continue")
+	fs.StringVar(&cfg.sessionDir, "session-dir", defaultSessionDir(), "directory sessions are saved to and resumed from")
+	fs.StringVar(&cfg.outputFormat, "output-format", formatText, "output format: text, json or stream-json")
+	fs.StringVar(&cfg.inputFormat, "input-format", formatText, "input format: text, or stream-json to read user messages from standard input")
+	fs.BoolVar(&cfg.includePartial, "include-partial-messages", false, "with stream-json output, include text deltas as stream_event messages")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.prompt = strings.Join(fs.Args(), " ")
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintf(stderr, "claude-agent: %s\n", err)
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *config) validate() error {
+	switch c.outputFormat {
+	case formatText, formatJSON, formatStreamJSON:
+	default:
+		return fmt.Errorf("unknown output format %q", c.outputFormat)
+	}
+	switch c.inputFormat {
+	case formatText:
+	case formatStreamJSON:
+		if c.prompt != "" {
+			return errors.New("a prompt argument cannot be combined with stream-json input")
+		}
+	default:
+		return fmt.Errorf("unknown input format %q", c.inputFormat)
+	}
+	if _, ok := permissionModes[c.permissionMode]; !ok {
+		return fmt.Errorf("unknown permission mode %q", c.permissionMode)
+	}
+	if c.maxBudgetUSD != "" {
+		if d, err := decimal.NewFromString(c.maxBudgetUSD); err != nil || !d.IsPositive() {
+			return fmt.Errorf("invalid budget %q", c.maxBudgetUSD)
+		}
+	}
+	if c.resume != "" && c.continueLatest {
+		return errors.New("-resume and -continue are mutually exclusive")
+	}
+	return nil
+}
+
+// agentOptions translates the configuration into agent options. The
+// built-in tools are always registered; permissions decide what runs.
+func (c *config) agentOptions() ([]agent.AgentOption, error) {
+	store, err := session.NewFileStore(c.sessionDir)
+	if err != nil {
+		return nil, err
+	}
+	opts := []agent.AgentOption{
+		agent.WithSessionStore(store),
+		agent.WithPermissionMode(permissionModes[c.permissionMode]),
+		agent.WithOnInit(func(a *agent.Agent) { tools.RegisterAll(a.Tools()) }),
+	}
+	if wd, err := os.Getwd(); err == nil {
+		opts = append(opts, agent.WithWorkDir(wd))
+	}
+	if len(c.settings) > 0 {
+		opts = append(opts, agent.WithSettingSources(c.settings...))
+	}
+	if c.model != "" {
+		opts = append(opts, agent.WithModel(anthropic.Model(c.model)))
+	}
+	if c.fallbackModel != "" {
+		opts = append(opts, agent.WithFallbackModel(anthropic.Model(c.fallbackModel)))
+	}
+	if c.systemPrompt != "" {
+		opts = append(opts, agent.WithSystemPrompt(c.systemPrompt))
+	}
+	if len(c.allowedTools) > 0 {
+		opts = append(opts, agent.WithAllowedTools(c.allowedTools...))
+	}
+	if len(c.disallowedTools) > 0 {
+		opts = append(opts, agent.WithDisallowedTools(c.disallowedTools...))
+	}
+	if c.maxTurns > 0 {
+		opts = append(opts, agent.WithMaxTurns(c.maxTurns))
+	}
+	if c.maxBudgetUSD != "" {
+		opts = append(opts, agent.WithBudget(decimal.RequireFromString(c.maxBudgetUSD)))
+	}
+	if c.mcpConfig != "" {
+		servers, err := mcp.LoadConfigFile(c.mcpConfig)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mcp.WithServers(servers))
+	}
+	return opts, nil
+}
+
+// defaultSessionDir is ~/.claude-agent/sessions, or a relative directory
+// when the home directory is unknown.
+func defaultSessionDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".claude-agent", "sessions")
+	}
+	return filepath.Join(home, ".claude-agent", "sessions")
+}
@@ -0,0 +1,209 @@
+// Command claude-agent runs an agent non-interactively, for scripts and
+// services that drive it over standard input and output the way they drive
+// the Claude Code CLI in print mode.
+//
+//	claude-agent --model claude-sonnet-4-5 "Summarize README.md"
+//	claude-agent --output-format stream-json --max-budget-usd 0.50 < prompt.txt
+//	producer | claude-agent --input-format stream-json --output-format stream-json
+//
+// With --output-format text the final response is printed; json prints the
+// result message; stream-json prints every message as newline-delimited
+// JSON (see agent.NDJSONWriter). With --input-format stream-json each line
+// of standard input is a user message, e.g.
+// {"type":"user","message":{"role":"user","content":"Next question"}},
+// and runs as a new turn of the same session.
+//
+// Sessions are saved to --session-dir, so a later invocation can pick one
+// up with --resume ID or --continue.
+//
+// The exit status reflects the subtype of the last result:
+//
+//	0  success
+//	1  error_during_execution, or an error before a result
+//	2  invalid command line
+//	3  error_max_turns
+//	4  error_max_budget_usd
+//	5  error_max_structured_output_retries
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// Exit statuses.
+const (
+	exitSuccess          = 0
+	exitError            = 1
+	exitUsage            = 2
+	exitMaxTurns         = 3
+	exitMaxBudget        = 4
+	exitStructuredOutput = 5
+)
+
+// resultExitCodes maps result subtypes to exit statuses.
+var resultExitCodes = map[string]int{
+	"success":                             exitSuccess,
+	"error_during_execution":              exitError,
+	"error_max_turns":                     exitMaxTurns,
+	"error_max_budget_usd":                exitMaxBudget,
+	"error_max_structured_output_retries": exitStructuredOutput,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command and returns its exit status.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, extra ...agent.AgentOption) int {
+	cfg, err := parseFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitSuccess
+	}
+	if err != nil {
+		return exitUsage
+	}
+
+	opts, err := cfg.agentOptions()
+	if err != nil {
+		fmt.Fprintf(stderr, "claude-agent: %s\n", err)
+		return exitError
+	}
+	client := agent.NewClient(append(opts, extra...)...)
+	defer func() {
+		if err := client.Close(); err != nil {
+			fmt.Fprintf(stderr, "claude-agent: save session: %s\n", err)
+		}
+		_ = client.Agent().Close()
+	}()
+
+	switch {
+	case cfg.resume != "":
+		err = client.Resume(ctx, cfg.resume)
+	case cfg.continueLatest:
+		err = client.ContinueLatest(ctx)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "claude-agent: %s\n", err)
+		return exitError
+	}
+
+	out := newOutput(cfg, stdout, stderr)
+	var last *agent.ResultEvent
+	for prompt, err := range prompts(cfg, stdin) {
+		if err != nil {
+			fmt.Fprintf(stderr, "claude-agent: %s\n", err)
+			return exitError
+		}
+		result, err := out.run(client.Query(ctx, prompt))
+		if err != nil {
+			fmt.Fprintf(stderr, "claude-agent: %s\n", err)
+			return exitError
+		}
+		last = result
+	}
+
+	if last == nil {
+		fmt.Fprintln(stderr, "claude-agent: no result")
+		return exitError
+	}
+	if code, ok := resultExitCodes[last.Subtype]; ok {
+		return code
+	}
+	return exitError
+}
+
+// prompts yields the prompts to run: the prompt argument or all of stdin
+// for text input, one per user message for stream-json input.
+func prompts(cfg *config, stdin io.Reader) func(yield func(string, error) bool) {
+	return func(yield func(string, error) bool) {
+		if cfg.inputFormat != formatStreamJSON {
+			prompt := cfg.prompt
+			if prompt == "" {
+				data, err := io.ReadAll(stdin)
+				if err != nil {
+					yield("", fmt.Errorf("read prompt: %w", err))
+					return
+				}
+				prompt = strings.TrimSpace(string(data))
+			}
+			if prompt == "" {
+				yield("", errors.New("no prompt given"))
+				return
+			}
+			yield(prompt, nil)
+			return
+		}
+
+		r := bufio.NewReader(stdin)
+		for {
+			line, err := r.ReadBytes('\n')
+			if len(strings.TrimSpace(string(line))) > 0 {
+				prompt, perr := userMessageText(line)
+				if !yield(prompt, perr) || perr != nil {
+					return
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield("", fmt.Errorf("read input: %w", err))
+				return
+			}
+		}
+	}
+}
+
+// userMessageText returns the text of a stream-json user message, whose
+// content is either a string or an array of content blocks.
+func userMessageText(line []byte) (string, error) {
+	var msg struct {
+		Type    string `json:"type"`
+		Message struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return "", fmt.Errorf("decode input message: %w", err)
+	}
+	if msg.Type != "user" {
+		return "", fmt.Errorf("input message has type %q, want \"user\"", msg.Type)
+	}
+
+	var text string
+	if err := json.Unmarshal(msg.Message.Content, &text); err == nil {
+		return text, nil
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(msg.Message.Content, &blocks); err != nil {
+		return "", fmt.Errorf("decode input message content: %w", err)
+	}
+	var parts []string
+	for _, b := range blocks {
+		if b.Type == "text" {
+			parts = append(parts, b.Text)
+		}
+	}
+	if len(parts) == 0 {
+		return "", errors.New("input message has no text")
+	}
+	return strings.Join(parts, "\n"), nil
+}
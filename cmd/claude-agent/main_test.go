@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// scriptedProvider replays canned SSE responses and records how many
+// messages each request carried.
+type scriptedProvider struct {
+	mu        sync.Mutex
+	responses []string
+	requests  []int
+}
+
+func (p *scriptedProvider) NewStreaming(_ context.Context, params anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, len(params.Messages))
+	if len(p.responses) == 0 {
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, fmt.Errorf("no scripted response"))
+	}
+	body := p.responses[0]
+	p.responses = p.responses[1:]
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}
+	return ssestream.NewStream[anthropic.MessageStreamEventUnion](ssestream.NewDecoder(resp), nil)
+}
+
+func sseEvents(events ...string) string {
+	var sb strings.Builder
+	for _, e := range events {
+		var head struct{ Type string }
+		_ = json.Unmarshal([]byte(e), &head)
+		fmt.Fprintf(&sb, "event: %s\ndata: %s\n\n", head.Type, e)
+	}
+	return sb.String()
+}
+
+func textResponse(text string) string {
+	return sseEvents(
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"test-model","content":[],"stop_reason":null,"usage":{"input_tokens":10,"output_tokens":0}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`, text),
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	)
+}
+
+func toolUseResponse() string {
+	return sseEvents(
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"test-model","content":[],"stop_reason":null,"usage":{"input_tokens":10,"output_tokens":0}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"Glob","input":{}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"pattern\":\"*.none\"}"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	)
+}
+
+type invocation struct {
+	code           int
+	stdout, stderr string
+}
+
+func invoke(t *testing.T, p *scriptedProvider, stdin string, args ...string) invocation {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr,
+		agent.WithProvider(p), agent.WithModel("test-model"))
+	return invocation{code: code, stdout: stdout.String(), stderr: stderr.String()}
+}
+
+func TestRun_TextOutput(t *testing.T) {
+	p := &scriptedProvider{responses: []string{textResponse("Paris")}}
+	got := invoke(t, p, "", "--session-dir", t.TempDir(), "Capital of France?")
+
+	assert.Equal(t, exitSuccess, got.code, got.stderr)
+	assert.Equal(t, "Paris\n", got.stdout)
+}
+
+func TestRun_PromptFromStdin(t *testing.T) {
+	p := &scriptedProvider{responses: []string{textResponse("Paris")}}
+	got := invoke(t, p, "Capital of France?\n", "-p", "--session-dir", t.TempDir())
+
+	assert.Equal(t, exitSuccess, got.code, got.stderr)
+	assert.Equal(t, "Paris\n", got.stdout)
+}
+
+func TestRun_JSONOutput(t *testing.T) {
+	p := &scriptedProvider{responses: []string{textResponse("Paris")}}
+	got := invoke(t, p, "", "--session-dir", t.TempDir(), "--output-format", "json", "Capital of France?")
+
+	require.Equal(t, exitSuccess, got.code, got.stderr)
+	var result map[string]any
+	require.NoError(t, json.Unmarshal([]byte(got.stdout), &result))
+	assert.Equal(t, "result", result["type"])
+	assert.Equal(t, "success", result["subtype"])
+	assert.Equal(t, "Paris", result["result"])
+}
+
+func TestRun_StreamJSONOutput(t *testing.T) {
+	p := &scriptedProvider{responses: []string{textResponse("Paris")}}
+	got := invoke(t, p, "", "--session-dir", t.TempDir(), "--output-format", "stream-json", "Capital of France?")
+	require.Equal(t, exitSuccess, got.code, got.stderr)
+
+	var types []string
+	r := agent.NewNDJSONReader(strings.NewReader(got.stdout))
+	for {
+		e, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, string(e.Type()))
+		if result, ok := e.(*agent.ResultEvent); ok {
+			assert.Equal(t, "Paris", result.Result)
+		}
+	}
+	// Text deltas are left out without --include-partial-messages.
+	assert.Equal(t, []string{"system", "assistant", "result"}, types)
+
+	p = &scriptedProvider{responses: []string{textResponse("Paris")}}
+	got = invoke(t, p, "", "--session-dir", t.TempDir(), "--output-format", "stream-json", "--include-partial-messages", "Capital of France?")
+	assert.Contains(t, got.stdout, `"type":"stream_event"`)
+}
+
+func TestRun_StreamJSONInput_RunsTurnsInOneSession(t *testing.T) {
+	p := &scriptedProvider{responses: []string{textResponse("Paris"), textResponse("Berlin")}}
+	stdin := `{"type":"user","message":{"role":"user","content":"Capital of France?"}}` + "\n" +
+		`{"type":"user","message":{"role":"user","content":[{"type":"text","text":"And Germany?"}]}}` + "\n"
+	got := invoke(t, p, stdin, "--session-dir", t.TempDir(), "--input-format", "stream-json", "--output-format", "stream-json")
+
+	require.Equal(t, exitSuccess, got.code, got.stderr)
+	assert.Equal(t, 2, strings.Count(got.stdout, `"type":"result"`))
+	// The second turn carries the first exchange.
+	assert.Equal(t, []int{1, 3}, p.requests)
+}
+
+func TestRun_ContinueResumesLatestSession(t *testing.T) {
+	dir := t.TempDir()
+	first := invoke(t, &scriptedProvider{responses: []string{textResponse("Paris")}}, "", "--session-dir", dir, "Capital of France?")
+	require.Equal(t, exitSuccess, first.code, first.stderr)
+
+	p := &scriptedProvider{responses: []string{textResponse("Berlin")}}
+	got := invoke(t, p, "", "--session-dir", dir, "-c", "And Germany?")
+	require.Equal(t, exitSuccess, got.code, got.stderr)
+	assert.Equal(t, []int{3}, p.requests)
+}
+
+func TestRun_ExitCodeReflectsResultSubtype(t *testing.T) {
+	p := &scriptedProvider{responses: []string{toolUseResponse(), toolUseResponse()}}
+	got := invoke(t, p, "", "--session-dir", t.TempDir(), "--max-turns", "1", "--permission-mode", "bypassPermissions", "Find files")
+
+	assert.Equal(t, exitMaxTurns, got.code)
+	assert.Contains(t, got.stderr, "error_max_turns")
+	assert.Empty(t, got.stdout)
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--output-format", "yaml", "hi"},
+		{"--input-format", "stream-json", "hi"},
+		{"--permission-mode", "yolo", "hi"},
+		{"--max-budget-usd", "-1", "hi"},
+		{"--resume", "sess_1", "--continue", "hi"},
+		{"--no-such-flag"},
+	} {
+		got := invoke(t, &scriptedProvider{}, "", append([]string{"--session-dir", t.TempDir()}, args...)...)
+		assert.Equal(t, exitUsage, got.code, "%v", args)
+	}
+}
+
+func TestRun_ResumeUnknownSession(t *testing.T) {
+	got := invoke(t, &scriptedProvider{}, "", "--session-dir", t.TempDir(), "--resume", "sess_missing", "hi")
+	assert.Equal(t, exitError, got.code)
+	assert.NotEmpty(t, got.stderr)
+}
+
+func TestListFlag(t *testing.T) {
+	var l listFlag
+	require.NoError(t, l.Set("Read Grep"))
+	require.NoError(t, l.Set("mcp__*,Bash(git log:*)"))
+	assert.Equal(t, listFlag{"Read", "Grep", "mcp__*", "Bash(git log:*)"}, l)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// output renders runs in the configured output format.
+type output struct {
+	format         string
+	includePartial bool
+	stdout, stderr io.Writer
+	ndjson         *agent.NDJSONWriter
+}
+
+func newOutput(cfg *config, stdout, stderr io.Writer) *output {
+	return &output{
+		format:         cfg.outputFormat,
+		includePartial: cfg.includePartial,
+		stdout:         stdout,
+		stderr:         stderr,
+		ndjson:         agent.NewNDJSONWriter(stdout),
+	}
+}
+
+// run renders one run and returns its result. The result's Result field
+// is set to the final response text, as the CLI reports it.
+func (o *output) run(stream *agent.AgentStream) (*agent.ResultEvent, error) {
+	var (
+		text     string
+		result   *agent.ResultEvent
+		writeErr error
+	)
+	for stream.Next() {
+		switch e := stream.Current().(type) {
+		case *agent.AssistantEvent:
+			text = responseText(e.Message.Content)
+		case *agent.ResultEvent:
+			if !e.IsError && e.Result == "" {
+				e.Result = text
+			}
+			result = e
+		}
+		if o.format == formatStreamJSON && writeErr == nil {
+			if _, partial := stream.Current().(*agent.StreamEvent); !partial || o.includePartial {
+				writeErr = o.ndjson.Write(stream.Current())
+			}
+		}
+	}
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	// An error result is reported through the exit status, not as an error.
+	if result == nil {
+		return nil, fmt.Errorf("run ended without a result")
+	}
+
+	switch o.format {
+	case formatJSON:
+		return result, o.ndjson.Write(result)
+	case formatText:
+		if result.IsError {
+			fmt.Fprintf(o.stderr, "claude-agent: %s: %s\n", result.Subtype, strings.Join(result.Errors, "; "))
+			return result, nil
+		}
+		_, err := fmt.Fprintln(o.stdout, result.Result)
+		return result, err
+	}
+	return result, nil
+}
+
+// responseText concatenates the text blocks of a response.
+func responseText(content []anthropic.ContentBlockUnion) string {
+	var sb strings.Builder
+	for _, block := range content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	return sb.String()
+}
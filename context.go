@@ -1,6 +1,12 @@
 package agent
 
-import "context"
+import (
+	"context"
+
+	"github.com/armatrix/claude-agent-sdk-go/checkpoint"
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
+)
 
 type contextKey int
 
@@ -8,6 +14,11 @@ const (
 	ctxKeyWorkDir contextKey = iota
 	ctxKeyEnv
 	ctxKeySandbox
+	ctxKeyBudget
+	ctxKeyMetrics
+	ctxKeyLogger
+	ctxKeyCheckpoint
+	ctxKeySessionID
 )
 
 // WithContextWorkDir returns a context with the working directory set.
@@ -48,3 +59,71 @@ func ContextSandbox(ctx context.Context) *SandboxConfig {
 	}
 	return nil
 }
+
+// WithContextBudget returns a context carrying the budget that runs started
+// from it should draw from.
+func WithContextBudget(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, ctxKeyBudget, b)
+}
+
+// ContextBudget returns the budget from context, or nil. Inside a tool call
+// this is the calling run's budget, capped by any per-tool-call ceiling.
+func ContextBudget(ctx context.Context) *Budget {
+	if v, ok := ctx.Value(ctxKeyBudget).(*Budget); ok {
+		return v
+	}
+	return nil
+}
+
+// WithContextMetrics returns a context carrying the metrics that runs and
+// tool calls started from it record into.
+func WithContextMetrics(ctx context.Context, m metrics.Metrics) context.Context {
+	return context.WithValue(ctx, ctxKeyMetrics, m)
+}
+
+// ContextMetrics returns the metrics from context, or metrics.Nop. Inside a
+// tool call this is the calling run's metrics.
+func ContextMetrics(ctx context.Context) metrics.Metrics {
+	if v, ok := ctx.Value(ctxKeyMetrics).(metrics.Metrics); ok {
+		return v
+	}
+	return metrics.Nop
+}
+
+// ContextToolUseID returns the ID of the tool use a tool is executing, or
+// empty string outside a tool call.
+func ContextToolUseID(ctx context.Context) string {
+	return engine.ToolUseID(ctx)
+}
+
+// WithContextCheckpoint returns a context carrying the recorder tools
+// report files to before changing them.
+func WithContextCheckpoint(ctx context.Context, r checkpoint.Recorder) context.Context {
+	return context.WithValue(ctx, ctxKeyCheckpoint, r)
+}
+
+// ContextCheckpoint returns the checkpoint recorder from context, or nil.
+// Inside a tool call of an agent with WithCheckpointer it records into the
+// call's checkpoint.
+func ContextCheckpoint(ctx context.Context) checkpoint.Recorder {
+	if v, ok := ctx.Value(ctxKeyCheckpoint).(checkpoint.Recorder); ok {
+		return v
+	}
+	return nil
+}
+
+// WithContextSessionID returns a context carrying the ID of the session a
+// run belongs to.
+func WithContextSessionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeySessionID, id)
+}
+
+// ContextSessionID returns the session ID from context, or empty string.
+// Inside a tool call this is the calling run's session, so tools keeping
+// state across calls can keep it apart for concurrent sessions.
+func ContextSessionID(ctx context.Context) string {
+	if v, ok := ctx.Value(ctxKeySessionID).(string); ok {
+		return v
+	}
+	return ""
+}
@@ -2,9 +2,12 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
+	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWithContextWorkDir(t *testing.T) {
@@ -35,3 +38,27 @@ func TestContextWorkDir_Chained(t *testing.T) {
 	assert.Equal(t, "/a", ContextWorkDir(ctx))
 	assert.Equal(t, "V", ContextEnv(ctx)["K"])
 }
+
+func TestWithContextSessionID(t *testing.T) {
+	ctx := WithContextSessionID(context.Background(), "sess_1")
+	assert.Equal(t, "sess_1", ContextSessionID(ctx))
+	assert.Equal(t, "", ContextSessionID(context.Background()))
+}
+
+func TestContextSessionID_InToolCall(t *testing.T) {
+	provider := &scriptedProvider{responses: []string{toolUseResponse("toolu_1", "Probe"), textResponse("done")}}
+	c := NewClient(WithProvider(provider))
+	var got string
+	c.Agent().Tools().RegisterRaw("Probe", "Report the session", anthropic.ToolInputSchemaParam{},
+		func(ctx context.Context, _ json.RawMessage) (*ToolResult, error) {
+			got = ContextSessionID(ctx)
+			return TextResult("ok"), nil
+		})
+
+	stream := c.Query(context.Background(), "probe")
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+	assert.Equal(t, c.Session().ID, got)
+	assert.NotEmpty(t, got)
+}
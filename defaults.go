@@ -1,6 +1,10 @@
 package agent
 
-import "github.com/anthropics/anthropic-sdk-go"
+import (
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
 
 // Model and context window defaults.
 var (
@@ -40,4 +44,22 @@ const (
 	// above which the ToolSearch meta-tool replaces the full tool list.
 	// 0.1 means 10% of the context window.
 	DefaultToolSearchThreshold = 0.1
+
+	// DefaultAutoSaveInterval is the shortest time between two saves of a
+	// session during a run with AutoSaveEveryTurn.
+	DefaultAutoSaveInterval = time.Second
+
+	// DefaultSessionPageSize is the page size of SessionIndex listings.
+	DefaultSessionPageSize = 50
+
+	// DefaultStructuredOutputRetries is how many times the model may re-submit
+	// structured output that fails schema validation before the run errors.
+	DefaultStructuredOutputRetries = 2
+
+	// DefaultBatchPollInterval is the initial delay between batch status polls.
+	DefaultBatchPollInterval = 5 * time.Second
+
+	// DefaultBatchMaxPollInterval caps the exponential backoff between batch
+	// status polls.
+	DefaultBatchMaxPollInterval = 2 * time.Minute
 )
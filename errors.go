@@ -1,6 +1,9 @@
 package agent
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 // Sentinel errors returned by the agent loop and client operations.
 var (
@@ -10,4 +13,63 @@ var (
 	ErrNoSessionStore  = errors.New("agent: no session store configured")
 	ErrStoreNotListable = errors.New("agent: session store does not support listing")
 	ErrNoSessions      = errors.New("agent: no sessions found")
+	ErrSessionNotFound = errors.New("agent: session not found")
+	ErrQueryInProgress = errors.New("agent: client query already in progress")
+	ErrInvalidRewindPoint = errors.New("agent: invalid rewind point")
+	ErrMessageNotFound = errors.New("agent: message not found")
+	ErrStoreNoMessageIDs = errors.New("agent: session store does not identify messages")
+	ErrNoCheckpointer  = errors.New("agent: no checkpointer configured")
+	ErrEmptyBatch      = errors.New("agent: batch has no items")
+	ErrBatchMismatch   = errors.New("agent: tracked batch was submitted with different requests")
+	ErrBatchProvider   = errors.New("agent: batches need the Anthropic API, not a custom provider")
+	ErrOutputSchema    = errors.New("agent: invalid output schema")
+	ErrUnknownEvent    = errors.New("agent: unknown event type")
+	ErrEventVersion    = errors.New("agent: unsupported event encoding version")
 )
+
+// Sentinel errors for result subtypes other than those above.
+var (
+	ErrStructuredOutputRetries = errors.New("agent: structured output retries exhausted")
+	ErrExecution               = errors.New("agent: error during execution")
+	ErrNoStructuredOutput      = errors.New("agent: run produced no structured output")
+)
+
+// resultSentinels maps error result subtypes to their sentinel errors.
+var resultSentinels = map[string]error{
+	"error_max_turns":                     ErrMaxTurns,
+	"error_max_budget_usd":                ErrBudgetExhausted,
+	"error_max_structured_output_retries": ErrStructuredOutputRetries,
+	"error_during_execution":              ErrExecution,
+}
+
+// ResultError reports a run that ended with an error result. It wraps the
+// sentinel for its subtype, such as ErrMaxTurns or ErrBudgetExhausted, and
+// for a cancelled run also the context's error, so errors.Is matches either.
+type ResultError struct {
+	Subtype string
+	Errors  []string
+
+	cause error
+}
+
+func (e *ResultError) Error() string {
+	msg := ErrExecution.Error()
+	if sentinel, ok := resultSentinels[e.Subtype]; ok {
+		msg = sentinel.Error()
+	}
+	if len(e.Errors) > 0 {
+		msg += ": " + strings.Join(e.Errors, "; ")
+	}
+	return msg
+}
+
+func (e *ResultError) Unwrap() []error {
+	errs := []error{ErrExecution}
+	if sentinel, ok := resultSentinels[e.Subtype]; ok {
+		errs[0] = sentinel
+	}
+	if e.cause != nil {
+		errs = append(errs, e.cause)
+	}
+	return errs
+}
@@ -1,8 +1,12 @@
 package agent
 
 import (
+	"encoding/json"
+
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/shopspring/decimal"
+
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
 )
 
 // EventType identifies the kind of event emitted by an AgentStream.
@@ -15,6 +19,10 @@ const (
 	EventStream    EventType = "stream"
 	EventResult    EventType = "result"
 	EventCompact   EventType = "compact"
+
+	EventBudgetWarning    EventType = "budget_warning"
+	EventSessionSaveError EventType = "session_save_error"
+	EventHistoryRepair    EventType = "history_repair"
 )
 
 // Event is the interface implemented by all events emitted through AgentStream.
@@ -37,6 +45,15 @@ type AssistantEvent struct {
 
 func (e *AssistantEvent) Type() EventType { return EventAssistant }
 
+// UserEvent is emitted when the run adds a user message to the conversation
+// after the prompt: the results of the tools the model called, or the
+// corrections sent back for invalid structured output.
+type UserEvent struct {
+	Message anthropic.MessageParam
+}
+
+func (e *UserEvent) Type() EventType { return EventUser }
+
 // StreamEvent is emitted for streaming text deltas as they arrive.
 type StreamEvent struct {
 	Delta string
@@ -54,15 +71,18 @@ type Usage struct {
 
 // ModelUsage tracks per-model token breakdown.
 type ModelUsage struct {
-	InputTokens  int64
-	OutputTokens int64
-	TotalCost    decimal.Decimal
+	InputTokens              int64
+	OutputTokens             int64
+	CacheReadInputTokens     int64
+	CacheCreationInputTokens int64
+	TotalCost                decimal.Decimal
 }
 
 // ResultEvent is emitted once at the end of a run with summary information.
 type ResultEvent struct {
 	// Subtype indicates the outcome: "success", "error_max_turns",
-	// "error_max_budget_usd", or "error_during_execution".
+	// "error_max_budget_usd", "error_max_structured_output_retries",
+	// or "error_during_execution".
 	Subtype       string
 	SessionID     string
 	DurationMs    int64
@@ -74,10 +94,25 @@ type ResultEvent struct {
 	ModelUsage    map[string]ModelUsage
 	Result        string
 	Errors        []string
+
+	// StructuredOutput holds the schema-validated structured output when the
+	// agent is configured with WithOutputFormat. Nil otherwise.
+	StructuredOutput json.RawMessage
+
+	// cause is the context error of a cancelled run.
+	cause error
 }
 
 func (e *ResultEvent) Type() EventType { return EventResult }
 
+// Err returns a *ResultError for an error result, or nil on success.
+func (e *ResultEvent) Err() error {
+	if !e.IsError {
+		return nil
+	}
+	return &ResultError{Subtype: e.Subtype, Errors: e.Errors, cause: e.cause}
+}
+
 // CompactEvent is emitted when context compaction occurs.
 type CompactEvent struct {
 	Strategy          CompactStrategy
@@ -88,3 +123,59 @@ type CompactEvent struct {
 }
 
 func (e *CompactEvent) Type() EventType { return EventCompact }
+
+// BudgetWarningEvent is emitted when a run crosses a BudgetPolicy threshold.
+type BudgetWarningEvent struct {
+	Threshold    float64
+	UsedFraction float64
+
+	// WrapUp reports that the model was told to wrap up at this threshold.
+	WrapUp bool
+
+	// Model is the cheaper model switched to at this threshold; empty if the
+	// model was not changed.
+	Model anthropic.Model
+}
+
+func (e *BudgetWarningEvent) Type() EventType { return EventBudgetWarning }
+
+// SessionSaveErrorEvent is emitted when a run fails to save its session.
+// The run goes on, and later saves may succeed.
+type SessionSaveErrorEvent struct {
+	SessionID string
+	Err       error
+}
+
+func (e *SessionSaveErrorEvent) Type() EventType { return EventSessionSaveError }
+
+// HistoryRepairKind identifies a change made to repair a session's
+// history.
+type HistoryRepairKind string
+
+const (
+	// RepairInterruptedToolUse is a tool use that had no result, answered
+	// with an error result saying it was interrupted.
+	RepairInterruptedToolUse HistoryRepairKind = HistoryRepairKind(engine.RepairInterruptedToolUse)
+	// RepairOrphanToolResult is a tool result dropped because the message
+	// before it has no tool use with its ID.
+	RepairOrphanToolResult HistoryRepairKind = HistoryRepairKind(engine.RepairOrphanToolResult)
+	// RepairMergedMessages is a message merged into the one before it,
+	// which had the same role.
+	RepairMergedMessages HistoryRepairKind = HistoryRepairKind(engine.RepairMergedMessages)
+)
+
+// HistoryRepairEvent is emitted for each change made to the session's
+// history before an API call to make it valid again, as needed after a
+// run was interrupted between a tool use and its result, or after a
+// crash. The repaired history replaces the session's.
+type HistoryRepairEvent struct {
+	Kind HistoryRepairKind
+	// MessageIndex locates the message changed, or the one following a
+	// message removed, in the history as repaired up to this change.
+	MessageIndex int
+	// ToolUseID is the ID of the tool use answered or of the result
+	// dropped.
+	ToolUseID string
+}
+
+func (e *HistoryRepairEvent) Type() EventType { return EventHistoryRepair }
@@ -0,0 +1,532 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+)
+
+// WireVersion is the version of the JSON event encoding, written to every
+// encoded event as "version". It changes only on incompatible changes;
+// new fields may be added within a version.
+const WireVersion = 1
+
+// The encoding follows the message shapes of the Claude Code CLI's
+// stream-json output, so tooling written for it can read agent output:
+//
+//	{"type":"system","subtype":"init","session_id":...,"model":...}
+//	{"type":"stream_event","event":{"type":"content_block_delta","delta":{"type":"text_delta","text":...}}}
+//	{"type":"assistant","message":{...API message...}}
+//	{"type":"user","message":{"role":"user","content":[...tool results...]}}
+//	{"type":"system","subtype":"compact_boundary","compact_metadata":{...}}
+//	{"type":"system","subtype":"budget_warning",...}
+//	{"type":"system","subtype":"session_save_error","error":...}
+//	{"type":"system","subtype":"history_repair","kind":...,"message_index":...}
+//	{"type":"result","subtype":"success","total_cost_usd":...,"usage":{...},"modelUsage":{...}}
+const (
+	wireTypeSystem    = "system"
+	wireTypeAssistant = "assistant"
+	wireTypeUser      = "user"
+	wireTypeStream    = "stream_event"
+	wireTypeResult    = "result"
+
+	wireSubtypeInit          = "init"
+	wireSubtypeCompact       = "compact_boundary"
+	wireSubtypeBudgetWarning = "budget_warning"
+	wireSubtypeSaveError     = "session_save_error"
+	wireSubtypeRepair        = "history_repair"
+)
+
+// wireHeader holds the fields shared by every encoded event.
+type wireHeader struct {
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype,omitempty"`
+	Version   int    `json:"version"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+type wireInit struct {
+	wireHeader
+	Model string `json:"model"`
+}
+
+type wireAssistant struct {
+	wireHeader
+	Message         wireMessage `json:"message"`
+	ParentToolUseID *string     `json:"parent_tool_use_id"`
+}
+
+// wireMessage is an API response message. anthropic.Message does not
+// marshal back to the API shape, so it is rebuilt from its parts.
+type wireMessage struct {
+	ID           string                             `json:"id"`
+	Type         string                             `json:"type"`
+	Role         string                             `json:"role"`
+	Model        string                             `json:"model"`
+	Content      []anthropic.ContentBlockParamUnion `json:"content"`
+	StopReason   *string                            `json:"stop_reason"`
+	StopSequence *string                            `json:"stop_sequence"`
+	Usage        wireUsage                          `json:"usage"`
+}
+
+type wireUser struct {
+	wireHeader
+	Message         anthropic.MessageParam `json:"message"`
+	ParentToolUseID *string                `json:"parent_tool_use_id"`
+}
+
+type wireStream struct {
+	wireHeader
+	Event           wireStreamDelta `json:"event"`
+	ParentToolUseID *string         `json:"parent_tool_use_id"`
+}
+
+type wireStreamDelta struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+}
+
+type wireCompact struct {
+	wireHeader
+	Metadata wireCompactMetadata `json:"compact_metadata"`
+}
+
+type wireCompactMetadata struct {
+	Trigger           string `json:"trigger"`
+	Strategy          string `json:"strategy"`
+	PreTokens         int    `json:"pre_tokens"`
+	PostTokens        int    `json:"post_tokens"`
+	MessagesRemoved   int    `json:"messages_removed"`
+	MessagesRemaining int    `json:"messages_remaining"`
+}
+
+type wireBudgetWarning struct {
+	wireHeader
+	Threshold    float64 `json:"threshold"`
+	UsedFraction float64 `json:"used_fraction"`
+	WrapUp       bool    `json:"wrap_up"`
+	Model        string  `json:"model,omitempty"`
+}
+
+type wireSaveError struct {
+	wireHeader
+	Error string `json:"error"`
+}
+
+type wireRepair struct {
+	wireHeader
+	Kind         string `json:"kind"`
+	MessageIndex int    `json:"message_index"`
+	ToolUseID    string `json:"tool_use_id,omitempty"`
+}
+
+type wireResult struct {
+	wireHeader
+	IsError          bool                      `json:"is_error"`
+	DurationMs       int64                     `json:"duration_ms"`
+	DurationAPIMs    int64                     `json:"duration_api_ms"`
+	NumTurns         int                       `json:"num_turns"`
+	Result           string                    `json:"result"`
+	TotalCostUSD     json.Number               `json:"total_cost_usd"`
+	Usage            wireUsage                 `json:"usage"`
+	ModelUsage       map[string]wireModelUsage `json:"modelUsage,omitempty"`
+	Errors           []string                  `json:"errors,omitempty"`
+	StructuredOutput json.RawMessage           `json:"structured_output,omitempty"`
+}
+
+type wireUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+type wireModelUsage struct {
+	InputTokens              int64       `json:"inputTokens"`
+	OutputTokens             int64       `json:"outputTokens"`
+	CacheReadInputTokens     int64       `json:"cacheReadInputTokens"`
+	CacheCreationInputTokens int64       `json:"cacheCreationInputTokens"`
+	CostUSD                  json.Number `json:"costUSD"`
+}
+
+// compactStrategyNames maps compaction strategies to their wire names.
+var compactStrategyNames = map[CompactStrategy]string{
+	CompactServer:   "server",
+	CompactDisabled: "disabled",
+}
+
+// MarshalEvent encodes e as a single-line JSON object with a "type"
+// discriminator, in the shape of the Claude Code CLI's stream-json output.
+func MarshalEvent(e Event) ([]byte, error) {
+	return marshalEvent(e, "")
+}
+
+// marshalEvent encodes e, filling in sessionID on events that do not carry
+// their own.
+func marshalEvent(e Event, sessionID string) ([]byte, error) {
+	header := func(typ, subtype string) wireHeader {
+		return wireHeader{Type: typ, Subtype: subtype, Version: WireVersion, SessionID: sessionID}
+	}
+
+	var v any
+	switch e := e.(type) {
+	case *SystemEvent:
+		h := header(wireTypeSystem, wireSubtypeInit)
+		h.SessionID = e.SessionID
+		v = wireInit{wireHeader: h, Model: string(e.Model)}
+	case *AssistantEvent:
+		v = wireAssistant{wireHeader: header(wireTypeAssistant, ""), Message: toWireMessage(e.Message)}
+	case *UserEvent:
+		v = wireUser{wireHeader: header(wireTypeUser, ""), Message: e.Message}
+	case *StreamEvent:
+		w := wireStream{wireHeader: header(wireTypeStream, "")}
+		w.Event.Type = "content_block_delta"
+		w.Event.Delta.Type = "text_delta"
+		w.Event.Delta.Text = e.Delta
+		v = w
+	case *CompactEvent:
+		v = wireCompact{wireHeader: header(wireTypeSystem, wireSubtypeCompact), Metadata: wireCompactMetadata{
+			Trigger:           "auto",
+			Strategy:          compactStrategyNames[e.Strategy],
+			PreTokens:         e.TokensBefore,
+			PostTokens:        e.TokensAfter,
+			MessagesRemoved:   e.MessagesRemoved,
+			MessagesRemaining: e.MessagesRemaining,
+		}}
+	case *BudgetWarningEvent:
+		v = wireBudgetWarning{
+			wireHeader:   header(wireTypeSystem, wireSubtypeBudgetWarning),
+			Threshold:    e.Threshold,
+			UsedFraction: e.UsedFraction,
+			WrapUp:       e.WrapUp,
+			Model:        string(e.Model),
+		}
+	case *SessionSaveErrorEvent:
+		h := header(wireTypeSystem, wireSubtypeSaveError)
+		if e.SessionID != "" {
+			h.SessionID = e.SessionID
+		}
+		v = wireSaveError{wireHeader: h, Error: e.Err.Error()}
+	case *HistoryRepairEvent:
+		v = wireRepair{
+			wireHeader:   header(wireTypeSystem, wireSubtypeRepair),
+			Kind:         string(e.Kind),
+			MessageIndex: e.MessageIndex,
+			ToolUseID:    e.ToolUseID,
+		}
+	case *ResultEvent:
+		h := header(wireTypeResult, e.Subtype)
+		if e.SessionID != "" {
+			h.SessionID = e.SessionID
+		}
+		v = toWireResult(h, e)
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnknownEvent, e)
+	}
+	return json.Marshal(v)
+}
+
+func toWireMessage(msg anthropic.Message) wireMessage {
+	w := wireMessage{
+		ID:      msg.ID,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   string(msg.Model),
+		Content: msg.ToParam().Content,
+		Usage: wireUsage{
+			InputTokens:              msg.Usage.InputTokens,
+			OutputTokens:             msg.Usage.OutputTokens,
+			CacheCreationInputTokens: msg.Usage.CacheCreationInputTokens,
+			CacheReadInputTokens:     msg.Usage.CacheReadInputTokens,
+		},
+	}
+	if w.Content == nil {
+		w.Content = []anthropic.ContentBlockParamUnion{}
+	}
+	if msg.StopReason != "" {
+		reason := string(msg.StopReason)
+		w.StopReason = &reason
+	}
+	if msg.StopSequence != "" {
+		w.StopSequence = &msg.StopSequence
+	}
+	return w
+}
+
+func toWireResult(h wireHeader, e *ResultEvent) wireResult {
+	w := wireResult{
+		wireHeader:    h,
+		IsError:       e.IsError,
+		DurationMs:    e.DurationMs,
+		DurationAPIMs: e.DurationAPIMs,
+		NumTurns:      e.NumTurns,
+		Result:        e.Result,
+		TotalCostUSD:  json.Number(e.TotalCost.String()),
+		Usage: wireUsage{
+			InputTokens:              e.Usage.InputTokens,
+			OutputTokens:             e.Usage.OutputTokens,
+			CacheCreationInputTokens: e.Usage.CacheCreationInputTokens,
+			CacheReadInputTokens:     e.Usage.CacheReadInputTokens,
+		},
+		Errors:           e.Errors,
+		StructuredOutput: e.StructuredOutput,
+	}
+	if len(e.ModelUsage) > 0 {
+		w.ModelUsage = make(map[string]wireModelUsage, len(e.ModelUsage))
+		for model, mu := range e.ModelUsage {
+			w.ModelUsage[model] = wireModelUsage{
+				InputTokens:              mu.InputTokens,
+				OutputTokens:             mu.OutputTokens,
+				CacheReadInputTokens:     mu.CacheReadInputTokens,
+				CacheCreationInputTokens: mu.CacheCreationInputTokens,
+				CostUSD:                  json.Number(mu.TotalCost.String()),
+			}
+		}
+	}
+	return w
+}
+
+// UnmarshalEvent decodes an event encoded by MarshalEvent. It also reads
+// the Claude Code CLI's stream-json messages of the same types, which carry
+// no version. It returns an error wrapping ErrUnknownEvent for types it does
+// not know, which callers reading mixed output may skip, and one wrapping
+// ErrEventVersion for events encoded by a newer, incompatible version.
+func UnmarshalEvent(data []byte) (Event, error) {
+	var h wireHeader
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("agent: decode event: %w", err)
+	}
+	if h.Version > WireVersion {
+		return nil, fmt.Errorf("%w: %d", ErrEventVersion, h.Version)
+	}
+
+	switch {
+	case h.Type == wireTypeSystem && h.Subtype == wireSubtypeInit:
+		var w wireInit
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("agent: decode system event: %w", err)
+		}
+		return &SystemEvent{SessionID: w.SessionID, Model: anthropic.Model(w.Model)}, nil
+
+	case h.Type == wireTypeSystem && h.Subtype == wireSubtypeCompact:
+		var w wireCompact
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("agent: decode compact event: %w", err)
+		}
+		e := &CompactEvent{
+			TokensBefore:      w.Metadata.PreTokens,
+			TokensAfter:       w.Metadata.PostTokens,
+			MessagesRemoved:   w.Metadata.MessagesRemoved,
+			MessagesRemaining: w.Metadata.MessagesRemaining,
+		}
+		for strategy, name := range compactStrategyNames {
+			if name == w.Metadata.Strategy {
+				e.Strategy = strategy
+			}
+		}
+		return e, nil
+
+	case h.Type == wireTypeSystem && h.Subtype == wireSubtypeBudgetWarning:
+		var w wireBudgetWarning
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("agent: decode budget warning event: %w", err)
+		}
+		return &BudgetWarningEvent{
+			Threshold:    w.Threshold,
+			UsedFraction: w.UsedFraction,
+			WrapUp:       w.WrapUp,
+			Model:        anthropic.Model(w.Model),
+		}, nil
+
+	case h.Type == wireTypeSystem && h.Subtype == wireSubtypeSaveError:
+		var w wireSaveError
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("agent: decode session save error event: %w", err)
+		}
+		return &SessionSaveErrorEvent{SessionID: w.SessionID, Err: errors.New(w.Error)}, nil
+
+	case h.Type == wireTypeSystem && h.Subtype == wireSubtypeRepair:
+		var w wireRepair
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("agent: decode history repair event: %w", err)
+		}
+		return &HistoryRepairEvent{Kind: HistoryRepairKind(w.Kind), MessageIndex: w.MessageIndex, ToolUseID: w.ToolUseID}, nil
+
+	case h.Type == wireTypeAssistant:
+		var w struct {
+			Message anthropic.Message `json:"message"`
+		}
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("agent: decode assistant event: %w", err)
+		}
+		return &AssistantEvent{Message: w.Message}, nil
+
+	case h.Type == wireTypeUser:
+		var w struct {
+			Message anthropic.MessageParam `json:"message"`
+		}
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("agent: decode user event: %w", err)
+		}
+		return &UserEvent{Message: w.Message}, nil
+
+	case h.Type == wireTypeStream:
+		var w wireStream
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("agent: decode stream event: %w", err)
+		}
+		// Only text deltas have an Event; other partial message events
+		// of the CLI's output are not represented.
+		if w.Event.Type != "content_block_delta" || w.Event.Delta.Type != "text_delta" {
+			return nil, fmt.Errorf("%w: stream_event %s", ErrUnknownEvent, w.Event.Type)
+		}
+		return &StreamEvent{Delta: w.Event.Delta.Text}, nil
+
+	case h.Type == wireTypeResult:
+		return unmarshalResult(data)
+	}
+
+	if h.Subtype != "" {
+		return nil, fmt.Errorf("%w: %s/%s", ErrUnknownEvent, h.Type, h.Subtype)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownEvent, h.Type)
+}
+
+func unmarshalResult(data []byte) (Event, error) {
+	var w wireResult
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("agent: decode result event: %w", err)
+	}
+	e := &ResultEvent{
+		Subtype:       w.Subtype,
+		SessionID:     w.SessionID,
+		DurationMs:    w.DurationMs,
+		DurationAPIMs: w.DurationAPIMs,
+		IsError:       w.IsError,
+		NumTurns:      w.NumTurns,
+		Result:        w.Result,
+		Usage: Usage{
+			InputTokens:              w.Usage.InputTokens,
+			OutputTokens:             w.Usage.OutputTokens,
+			CacheReadInputTokens:     w.Usage.CacheReadInputTokens,
+			CacheCreationInputTokens: w.Usage.CacheCreationInputTokens,
+		},
+		Errors:           w.Errors,
+		StructuredOutput: w.StructuredOutput,
+	}
+	var err error
+	if e.TotalCost, err = decodeCost(w.TotalCostUSD); err != nil {
+		return nil, fmt.Errorf("agent: decode result event: total_cost_usd: %w", err)
+	}
+	if len(w.ModelUsage) > 0 {
+		e.ModelUsage = make(map[string]ModelUsage, len(w.ModelUsage))
+		for model, mu := range w.ModelUsage {
+			cost, err := decodeCost(mu.CostUSD)
+			if err != nil {
+				return nil, fmt.Errorf("agent: decode result event: modelUsage %s: %w", model, err)
+			}
+			e.ModelUsage[model] = ModelUsage{
+				InputTokens:              mu.InputTokens,
+				OutputTokens:             mu.OutputTokens,
+				CacheReadInputTokens:     mu.CacheReadInputTokens,
+				CacheCreationInputTokens: mu.CacheCreationInputTokens,
+				TotalCost:                cost,
+			}
+		}
+	}
+	return e, nil
+}
+
+func decodeCost(n json.Number) (decimal.Decimal, error) {
+	if n == "" {
+		return decimal.Zero, nil
+	}
+	return decimal.NewFromString(string(n))
+}
+
+// NDJSONWriter writes events as newline-delimited JSON, one MarshalEvent
+// object per line. Events that carry no session ID are stamped with the one
+// of the last SystemEvent written. It is safe for concurrent use.
+type NDJSONWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	sessionID string
+}
+
+// NewNDJSONWriter returns a writer encoding events to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{w: w}
+}
+
+// Write encodes e as one line.
+func (w *NDJSONWriter) Write(e Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if sys, ok := e.(*SystemEvent); ok {
+		w.sessionID = sys.SessionID
+	}
+	data, err := marshalEvent(e, w.sessionID)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteStream writes every event of s until it is exhausted and returns
+// the first write error, or else the stream's error. After a write error
+// the remaining events are drained without being written, so the run is
+// not blocked.
+func (w *NDJSONWriter) WriteStream(s *AgentStream) error {
+	var writeErr error
+	for s.Next() {
+		if writeErr == nil {
+			writeErr = w.Write(s.Current())
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return s.Err()
+}
+
+// NDJSONReader decodes events from newline-delimited JSON, such as the
+// output of NDJSONWriter or of the Claude Code CLI with
+// --output-format stream-json.
+type NDJSONReader struct {
+	r *bufio.Reader
+}
+
+// NewNDJSONReader returns a reader decoding events from r.
+func NewNDJSONReader(r io.Reader) *NDJSONReader {
+	return &NDJSONReader{r: bufio.NewReader(r)}
+}
+
+// Read decodes the next event. Blank lines are skipped. It returns io.EOF
+// after the last event. A line that cannot be decoded yields an error
+// (see UnmarshalEvent) but does not stop the reader: the next call reads
+// the following line.
+func (r *NDJSONReader) Read() (Event, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			return UnmarshalEvent(line)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("agent: read event: %w", err)
+		}
+	}
+}
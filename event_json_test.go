@@ -0,0 +1,227 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assistantMessage(t *testing.T) anthropic.Message {
+	t.Helper()
+	var msg anthropic.Message
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id":"msg_1","type":"message","role":"assistant","model":"claude-opus-4-6",
+		"content":[{"type":"text","text":"Let me check."},{"type":"tool_use","id":"toolu_1","name":"Read","input":{"path":"go.mod"}}],
+		"stop_reason":"tool_use","stop_sequence":null,
+		"usage":{"input_tokens":12,"output_tokens":7,"cache_read_input_tokens":3}}`), &msg))
+	return msg
+}
+
+func TestMarshalEvent_WireShapes(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{"system", &SystemEvent{SessionID: "sess_1", Model: "claude-opus-4-6"},
+			`{"type":"system","subtype":"init","version":1,"session_id":"sess_1","model":"claude-opus-4-6"}`},
+		{"stream", &StreamEvent{Delta: "Hel"},
+			`{"type":"stream_event","version":1,"event":{"type":"content_block_delta","delta":{"type":"text_delta","text":"Hel"}},"parent_tool_use_id":null}`},
+		{"user", &UserEvent{Message: anthropic.NewUserMessage(anthropic.NewToolResultBlock("toolu_1", "module x", false))},
+			`{"type":"user","version":1,"message":{"content":[{"tool_use_id":"toolu_1","is_error":false,"content":[{"text":"module x","type":"text"}],"type":"tool_result"}],"role":"user"},"parent_tool_use_id":null}`},
+		{"compact", &CompactEvent{Strategy: CompactServer, TokensBefore: 1000, TokensAfter: 200},
+			`{"type":"system","subtype":"compact_boundary","version":1,"compact_metadata":{"trigger":"auto","strategy":"server","pre_tokens":1000,"post_tokens":200,"messages_removed":0,"messages_remaining":0}}`},
+		{"budget warning", &BudgetWarningEvent{Threshold: 0.8, UsedFraction: 0.82, WrapUp: true},
+			`{"type":"system","subtype":"budget_warning","version":1,"threshold":0.8,"used_fraction":0.82,"wrap_up":true}`},
+		{"session save error", &SessionSaveErrorEvent{SessionID: "sess_1", Err: errors.New("disk full")},
+			`{"type":"system","subtype":"session_save_error","version":1,"session_id":"sess_1","error":"disk full"}`},
+		{"history repair", &HistoryRepairEvent{Kind: RepairInterruptedToolUse, MessageIndex: 2, ToolUseID: "toolu_1"},
+			`{"type":"system","subtype":"history_repair","version":1,"kind":"interrupted_tool_use","message_index":2,"tool_use_id":"toolu_1"}`},
+		{"result", &ResultEvent{
+			Subtype: "success", SessionID: "sess_1", DurationMs: 1500, DurationAPIMs: 1200, NumTurns: 2,
+			TotalCost: decimal.RequireFromString("0.0123"),
+			Usage:     Usage{InputTokens: 12, OutputTokens: 7},
+			ModelUsage: map[string]ModelUsage{
+				"claude-opus-4-6": {InputTokens: 12, OutputTokens: 7, TotalCost: decimal.RequireFromString("0.0123")},
+			},
+		}, `{"type":"result","subtype":"success","version":1,"session_id":"sess_1","is_error":false,"duration_ms":1500,"duration_api_ms":1200,"num_turns":2,"result":"","total_cost_usd":0.0123,` +
+			`"usage":{"input_tokens":12,"output_tokens":7,"cache_creation_input_tokens":0,"cache_read_input_tokens":0},` +
+			`"modelUsage":{"claude-opus-4-6":{"inputTokens":12,"outputTokens":7,"cacheReadInputTokens":0,"cacheCreationInputTokens":0,"costUSD":0.0123}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalEvent(tt.event)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(data))
+		})
+	}
+}
+
+func TestMarshalEvent_AssistantUsesAPIMessageShape(t *testing.T) {
+	data, err := MarshalEvent(&AssistantEvent{Message: assistantMessage(t)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"assistant","version":1,"parent_tool_use_id":null,"message":{
+		"id":"msg_1","type":"message","role":"assistant","model":"claude-opus-4-6",
+		"content":[{"type":"text","text":"Let me check."},{"type":"tool_use","id":"toolu_1","name":"Read","input":{"path":"go.mod"}}],
+		"stop_reason":"tool_use","stop_sequence":null,
+		"usage":{"input_tokens":12,"output_tokens":7,"cache_creation_input_tokens":0,"cache_read_input_tokens":3}}}`, string(data))
+}
+
+func TestMarshalEvent_UnknownEvent(t *testing.T) {
+	_, err := MarshalEvent(nil)
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+}
+
+func TestUnmarshalEvent_RoundTrip(t *testing.T) {
+	events := []Event{
+		&SystemEvent{SessionID: "sess_1", Model: "claude-opus-4-6"},
+		&StreamEvent{Delta: "Hello"},
+		&UserEvent{Message: anthropic.NewUserMessage(anthropic.NewToolResultBlock("toolu_1", "boom", true))},
+		&CompactEvent{Strategy: CompactDisabled, TokensBefore: 10, TokensAfter: 5, MessagesRemoved: 2, MessagesRemaining: 3},
+		&BudgetWarningEvent{Threshold: 0.5, UsedFraction: 0.51, Model: anthropic.ModelClaudeHaiku4_5},
+		&SessionSaveErrorEvent{SessionID: "sess_1", Err: errors.New("disk full")},
+		&HistoryRepairEvent{Kind: RepairMergedMessages, MessageIndex: 4},
+		&ResultEvent{
+			Subtype: "error_max_turns", SessionID: "sess_1", IsError: true, NumTurns: 3,
+			TotalCost: decimal.RequireFromString("1.5"), Errors: []string{"max turns"},
+			Usage:            Usage{InputTokens: 1, OutputTokens: 2, CacheReadInputTokens: 3, CacheCreationInputTokens: 4},
+			ModelUsage:       map[string]ModelUsage{"m": {InputTokens: 1, TotalCost: decimal.RequireFromString("1.5")}},
+			StructuredOutput: json.RawMessage(`{"ok":true}`),
+		},
+	}
+	for _, e := range events {
+		t.Run(string(e.Type()), func(t *testing.T) {
+			data, err := MarshalEvent(e)
+			require.NoError(t, err)
+			got, err := UnmarshalEvent(data)
+			require.NoError(t, err)
+			again, err := MarshalEvent(got)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(data), string(again))
+		})
+	}
+
+	data, err := MarshalEvent(&AssistantEvent{Message: assistantMessage(t)})
+	require.NoError(t, err)
+	got, err := UnmarshalEvent(data)
+	require.NoError(t, err)
+	msg := got.(*AssistantEvent).Message
+	assert.Equal(t, "msg_1", msg.ID)
+	assert.Equal(t, anthropic.StopReasonToolUse, msg.StopReason)
+	require.Len(t, msg.Content, 2)
+	assert.Equal(t, "Read", msg.Content[1].Name)
+	assert.Equal(t, int64(3), msg.Usage.CacheReadInputTokens)
+}
+
+func TestUnmarshalEvent_ReadsCLIStreamJSON(t *testing.T) {
+	// Lines as printed by `claude -p --output-format stream-json --verbose`,
+	// abridged: they carry no version and extra fields are ignored.
+	lines := []string{
+		`{"type":"system","subtype":"init","cwd":"/src","session_id":"6f1c","tools":["Bash","Read"],"model":"claude-sonnet-4-5","permissionMode":"default","apiKeySource":"none"}`,
+		`{"type":"assistant","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"4"}],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":3,"output_tokens":1}},"parent_tool_use_id":null,"session_id":"6f1c"}`,
+		`{"type":"result","subtype":"success","is_error":false,"duration_ms":2176,"duration_api_ms":2045,"num_turns":1,"result":"4","session_id":"6f1c","total_cost_usd":0.0265817,"usage":{"input_tokens":3,"cache_creation_input_tokens":0,"cache_read_input_tokens":0,"output_tokens":1},"modelUsage":{"claude-sonnet-4-5":{"inputTokens":3,"outputTokens":1,"cacheReadInputTokens":0,"cacheCreationInputTokens":0,"webSearchRequests":0,"costUSD":0.0265817}},"permission_denials":[],"uuid":"a1"}`,
+	}
+
+	sys, err := UnmarshalEvent([]byte(lines[0]))
+	require.NoError(t, err)
+	assert.Equal(t, &SystemEvent{SessionID: "6f1c", Model: "claude-sonnet-4-5"}, sys)
+
+	asst, err := UnmarshalEvent([]byte(lines[1]))
+	require.NoError(t, err)
+	assert.Equal(t, "4", asst.(*AssistantEvent).Message.Content[0].Text)
+
+	res, err := UnmarshalEvent([]byte(lines[2]))
+	require.NoError(t, err)
+	result := res.(*ResultEvent)
+	assert.Equal(t, "4", result.Result)
+	assert.Equal(t, "0.0265817", result.TotalCost.String())
+	assert.Equal(t, "0.0265817", result.ModelUsage["claude-sonnet-4-5"].TotalCost.String())
+}
+
+func TestUnmarshalEvent_Errors(t *testing.T) {
+	_, err := UnmarshalEvent([]byte(`{"type":"system","subtype":"hook_response"}`))
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+
+	_, err = UnmarshalEvent([]byte(`{"type":"stream_event","event":{"type":"message_start"}}`))
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+
+	_, err = UnmarshalEvent([]byte(`{"type":"result","version":2}`))
+	assert.ErrorIs(t, err, ErrEventVersion)
+
+	_, err = UnmarshalEvent([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestNDJSONWriter_WriteStream(t *testing.T) {
+	ch := make(chan Event, 4)
+	ch <- &SystemEvent{SessionID: "sess_1", Model: "m"}
+	ch <- &StreamEvent{Delta: "Hi"}
+	ch <- &AssistantEvent{Message: assistantMessage(t)}
+	ch <- &ResultEvent{Subtype: "success", SessionID: "sess_1"}
+	close(ch)
+
+	var buf bytes.Buffer
+	require.NoError(t, NewNDJSONWriter(&buf).WriteStream(newStream(ch, NewSession())))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	for _, line := range lines {
+		// Every line carries the session, as in the CLI's output.
+		assert.Contains(t, line, `"session_id":"sess_1"`)
+	}
+
+	r := NewNDJSONReader(&buf)
+	var types []EventType
+	for {
+		e, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, e.Type())
+	}
+	assert.Equal(t, []EventType{EventSystem, EventStream, EventAssistant, EventResult}, types)
+}
+
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("broken pipe")
+}
+
+func TestNDJSONWriter_WriteStream_DrainsAfterWriteError(t *testing.T) {
+	ch := make(chan Event, 3)
+	ch <- &StreamEvent{Delta: "a"}
+	ch <- &StreamEvent{Delta: "b"}
+	ch <- &StreamEvent{Delta: "c"}
+	close(ch)
+
+	w := &failingWriter{}
+	err := NewNDJSONWriter(w).WriteStream(newStream(ch, NewSession()))
+	require.EqualError(t, err, "broken pipe")
+	assert.Equal(t, 1, w.writes)
+	assert.Empty(t, ch)
+}
+
+func TestNDJSONReader_SkipsBlankLinesAndContinuesAfterErrors(t *testing.T) {
+	r := NewNDJSONReader(strings.NewReader("\n" +
+		`{"type":"control_request"}` + "\n\n" +
+		`{"type":"stream_event","event":{"type":"content_block_delta","delta":{"type":"text_delta","text":"x"}}}`))
+
+	_, err := r.Read()
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+	e, err := r.Read()
+	require.NoError(t, err)
+	assert.Equal(t, &StreamEvent{Delta: "x"}, e)
+	_, err = r.Read()
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -18,6 +18,9 @@ type ModelPricing struct {
 
 var million = decimal.NewFromInt(1_000_000)
 
+// BatchDiscount is the price multiplier applied to Message Batches API requests.
+var BatchDiscount = decimal.NewFromFloat(0.5)
+
 // CostForInput calculates the input cost considering long context threshold and cache tokens.
 // inputTokens: non-cache input tokens billed at standard/long input rate.
 // cacheReadTokens: tokens read from cache, billed at cache read rate.
@@ -47,6 +50,13 @@ func (p ModelPricing) CostForOutput(outputTokens, totalInputTokens int) decimal.
 	return decimal.NewFromInt(int64(outputTokens)).Mul(rate).Div(million)
 }
 
+// Cost calculates the total cost of a single API call's usage.
+func (p ModelPricing) Cost(usage Usage) decimal.Decimal {
+	totalInput := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	inputCost := p.CostForInput(usage.InputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens, totalInput)
+	return inputCost.Add(p.CostForOutput(usage.OutputTokens, totalInput))
+}
+
 // DefaultPricing contains built-in pricing for Claude models (USD per million tokens).
 // Can be overridden via WithPricing() option.
 var DefaultPricing = map[anthropic.Model]ModelPricing{
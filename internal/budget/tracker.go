@@ -25,12 +25,15 @@ type UsageIteration struct {
 }
 
 // BudgetTracker tracks cumulative token usage and cost across API calls.
+// Trackers form a tree via Child: spending recorded on a child also counts
+// against every ancestor, so a root budget caps the whole tree.
 // It is safe for concurrent use.
 type BudgetTracker struct {
 	maxBudget  decimal.Decimal // 0 = unlimited
 	totalCost  decimal.Decimal
 	totalUsage Usage
 	pricing    map[anthropic.Model]ModelPricing
+	parent     *BudgetTracker
 	mu         sync.Mutex
 }
 
@@ -43,26 +46,38 @@ func NewBudgetTracker(maxBudget decimal.Decimal, pricing map[anthropic.Model]Mod
 	}
 }
 
+// Child creates a tracker limited to maxBudget (0 = no limit of its own) whose
+// spending also counts against b. The child shares b's pricing.
+func (b *BudgetTracker) Child(maxBudget decimal.Decimal) *BudgetTracker {
+	return &BudgetTracker{
+		maxBudget: maxBudget,
+		totalCost: decimal.Zero,
+		pricing:   b.pricing,
+		parent:    b,
+	}
+}
+
 // RecordUsage records token usage for a single API call and updates the cumulative cost.
 func (b *BudgetTracker) RecordUsage(model anthropic.Model, usage Usage) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	b.totalUsage.InputTokens += usage.InputTokens
-	b.totalUsage.OutputTokens += usage.OutputTokens
-	b.totalUsage.CacheReadInputTokens += usage.CacheReadInputTokens
-	b.totalUsage.CacheCreationInputTokens += usage.CacheCreationInputTokens
-
-	pricing, ok := b.pricing[model]
-	if !ok {
-		return // Unknown model — tokens counted but no cost added
+	cost := decimal.Zero // Unknown model — tokens counted but no cost added
+	if pricing, ok := b.pricing[model]; ok {
+		cost = pricing.Cost(usage)
 	}
+	b.RecordCost(usage, cost)
+}
 
-	totalInput := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
-	inputCost := pricing.CostForInput(usage.InputTokens, usage.CacheReadInputTokens, usage.CacheCreationInputTokens, totalInput)
-	outputCost := pricing.CostForOutput(usage.OutputTokens, totalInput)
-
-	b.totalCost = b.totalCost.Add(inputCost).Add(outputCost)
+// RecordCost records usage whose cost was computed by the caller, e.g. with
+// per-agent pricing. The cost also counts against all ancestors.
+func (b *BudgetTracker) RecordCost(usage Usage, cost decimal.Decimal) {
+	for t := b; t != nil; t = t.parent {
+		t.mu.Lock()
+		t.totalUsage.InputTokens += usage.InputTokens
+		t.totalUsage.OutputTokens += usage.OutputTokens
+		t.totalUsage.CacheReadInputTokens += usage.CacheReadInputTokens
+		t.totalUsage.CacheCreationInputTokens += usage.CacheCreationInputTokens
+		t.totalCost = t.totalCost.Add(cost)
+		t.mu.Unlock()
+	}
 }
 
 // RecordIterations records multiple usage iterations (e.g. compaction + message steps).
@@ -86,25 +101,45 @@ func (b *BudgetTracker) TotalUsage() Usage {
 	return b.totalUsage
 }
 
-// Remaining returns the remaining budget. If maxBudget is 0 (unlimited), returns MaxDecimal.
+// Remaining returns the remaining budget, taking ancestors into account.
+// If no tracker in the chain has a limit, returns MaxDecimal.
 func (b *BudgetTracker) Remaining() decimal.Decimal {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	if b.maxBudget.IsZero() {
-		return MaxDecimal
+	remaining := MaxDecimal
+	for t := b; t != nil; t = t.parent {
+		t.mu.Lock()
+		if !t.maxBudget.IsZero() {
+			remaining = decimal.Min(remaining, t.maxBudget.Sub(t.totalCost))
+		}
+		t.mu.Unlock()
 	}
-	return b.maxBudget.Sub(b.totalCost)
+	return remaining
 }
 
-// Exhausted returns true if the total cost has reached or exceeded maxBudget.
-// Always returns false if maxBudget is 0 (unlimited).
+// Exhausted returns true if the total cost has reached or exceeded maxBudget
+// on this tracker or any ancestor. Unlimited trackers are never exhausted.
 func (b *BudgetTracker) Exhausted() bool {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	for t := b; t != nil; t = t.parent {
+		t.mu.Lock()
+		exhausted := !t.maxBudget.IsZero() && t.totalCost.GreaterThanOrEqual(t.maxBudget)
+		t.mu.Unlock()
+		if exhausted {
+			return true
+		}
+	}
+	return false
+}
 
-	if b.maxBudget.IsZero() {
-		return false
+// UsedFraction returns the share of the budget already spent, in [0, ∞).
+// With ancestors, the most constrained tracker in the chain wins.
+// Returns 0 if no tracker in the chain has a limit.
+func (b *BudgetTracker) UsedFraction() float64 {
+	var used float64
+	for t := b; t != nil; t = t.parent {
+		t.mu.Lock()
+		if !t.maxBudget.IsZero() {
+			used = max(used, t.totalCost.Div(t.maxBudget).InexactFloat64())
+		}
+		t.mu.Unlock()
 	}
-	return b.totalCost.GreaterThanOrEqual(b.maxBudget)
+	return used
 }
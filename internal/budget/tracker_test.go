@@ -73,6 +73,17 @@ func TestCostForInput_HaikuNoLongContext(t *testing.T) {
 	assert.True(t, expected.Equal(cost), "expected %s, got %s", expected, cost)
 }
 
+func TestModelPricingCost(t *testing.T) {
+	p := DefaultPricing[anthropic.ModelClaudeSonnet4_5]
+
+	// input: 1000 * $3/MTok = $0.003
+	// cache read: 2000 * $0.3/MTok = $0.0006
+	// output: 100 * $15/MTok = $0.0015
+	cost := p.Cost(Usage{InputTokens: 1000, OutputTokens: 100, CacheReadInputTokens: 2000})
+	expected := decimal.NewFromFloat(0.0051)
+	assert.True(t, expected.Equal(cost), "expected %s, got %s", expected, cost)
+}
+
 func TestRecordUsage_StandardOpus(t *testing.T) {
 	bt := NewBudgetTracker(decimal.Zero, DefaultPricing)
 
@@ -295,3 +306,39 @@ func TestLongContextWithCache(t *testing.T) {
 		Add(decimal.NewFromFloat(0.1125))
 	assert.True(t, expected.Equal(bt.TotalCost()), "expected %s, got %s", expected, bt.TotalCost())
 }
+
+func TestChild_CountsAgainstParent(t *testing.T) {
+	parent := NewBudgetTracker(decimal.NewFromFloat(1.0), DefaultPricing)
+	child := parent.Child(decimal.Zero)
+
+	child.RecordCost(Usage{InputTokens: 10}, decimal.NewFromFloat(0.6))
+
+	assert.True(t, decimal.NewFromFloat(0.6).Equal(parent.TotalCost()))
+	assert.Equal(t, 10, parent.TotalUsage().InputTokens)
+	assert.InDelta(t, 0.6, child.UsedFraction(), 1e-9)
+	assert.False(t, child.Exhausted())
+
+	parent.RecordCost(Usage{}, decimal.NewFromFloat(0.4))
+	assert.True(t, child.Exhausted(), "exhausted parent should exhaust the child")
+	assert.True(t, decimal.NewFromFloat(0.6).Equal(child.TotalCost()), "parent spending is not attributed to the child")
+}
+
+func TestChild_OwnLimit(t *testing.T) {
+	parent := NewBudgetTracker(decimal.NewFromFloat(10.0), DefaultPricing)
+	child := parent.Child(decimal.NewFromFloat(1.0))
+
+	child.RecordCost(Usage{}, decimal.NewFromFloat(0.5))
+	assert.InDelta(t, 0.5, child.UsedFraction(), 1e-9)
+	assert.InDelta(t, 0.05, parent.UsedFraction(), 1e-9)
+	assert.True(t, decimal.NewFromFloat(0.5).Equal(child.Remaining()))
+
+	child.RecordCost(Usage{}, decimal.NewFromFloat(0.5))
+	assert.True(t, child.Exhausted())
+	assert.False(t, parent.Exhausted())
+}
+
+func TestUsedFraction_Unlimited(t *testing.T) {
+	bt := NewBudgetTracker(decimal.Zero, DefaultPricing)
+	bt.RecordCost(Usage{}, decimal.NewFromInt(100))
+	assert.Zero(t, bt.UsedFraction())
+}
@@ -3,6 +3,9 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
@@ -23,6 +26,13 @@ type Settings struct {
 // LoadSettings merges settings from multiple JSON file paths.
 // Later paths override earlier ones. Missing files are silently skipped.
 func LoadSettings(paths ...string) (*Settings, error) {
+	return LoadSettingsLogged(nil, paths...)
+}
+
+// LoadSettingsLogged is LoadSettings, logging JSON files that exist but
+// cannot be read or parsed to logger at warn level. A nil logger logs
+// nothing.
+func LoadSettingsLogged(logger *slog.Logger, paths ...string) (*Settings, error) {
 	merged := &Settings{
 		CustomSettings: make(map[string]any),
 	}
@@ -30,7 +40,12 @@ func LoadSettings(paths ...string) (*Settings, error) {
 	for _, path := range paths {
 		s, err := loadSettingsFile(path)
 		if err != nil {
-			continue // Skip missing or invalid files
+			// Skip missing or invalid files. Non-JSON sources such as
+			// CLAUDE.md are expected not to parse.
+			if logger != nil && !errors.Is(err, fs.ErrNotExist) && filepath.Ext(path) == ".json" {
+				logger.Warn("skipping unreadable settings file", "path", path, "error", err)
+			}
+			continue
 		}
 		mergeSettings(merged, s)
 	}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
@@ -66,6 +68,24 @@ func TestLoadSettings_InvalidJSON(t *testing.T) {
 	assert.Equal(t, "", result.Model) // Invalid file skipped
 }
 
+func TestLoadSettingsLogged_WarnsOnInvalidJSONOnly(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.json")
+	require.NoError(t, os.WriteFile(bad, []byte("not json"), 0o644))
+	claudeMD := filepath.Join(dir, "CLAUDE.md")
+	require.NoError(t, os.WriteFile(claudeMD, []byte("# Project"), 0o644))
+
+	var buf bytes.Buffer
+	_, err := LoadSettingsLogged(slog.New(slog.NewTextHandler(&buf, nil)),
+		bad, claudeMD, filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, `level=WARN msg="skipping unreadable settings file" path=`+bad)
+	assert.NotContains(t, out, "CLAUDE.md")
+	assert.NotContains(t, out, "missing.json")
+}
+
 func TestLoadSettings_CustomSettings(t *testing.T) {
 	dir := t.TempDir()
 
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -15,12 +18,26 @@ type Skill struct {
 // LoadSkills reads all .md files from the given directories and returns them
 // as skill definitions that can be injected into the system prompt.
 func LoadSkills(dirs ...string) ([]Skill, error) {
+	return LoadSkillsLogged(nil, dirs...)
+}
+
+// LoadSkillsLogged is LoadSkills, logging directories and skill files that
+// exist but cannot be read to logger at warn level. A nil logger logs
+// nothing.
+func LoadSkillsLogged(logger *slog.Logger, dirs ...string) ([]Skill, error) {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
 	var skills []Skill
 
 	for _, dir := range dirs {
-		dirSkills, err := loadSkillsFromDir(dir)
+		dirSkills, err := loadSkillsFromDir(dir, logger)
 		if err != nil {
-			continue // Skip missing directories
+			// Skip missing directories
+			if !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn("skipping unreadable skills directory", "path", dir, "error", err)
+			}
+			continue
 		}
 		skills = append(skills, dirSkills...)
 	}
@@ -49,7 +66,7 @@ func FormatSkillsPrompt(skills []Skill) string {
 	return sb.String()
 }
 
-func loadSkillsFromDir(dir string) ([]Skill, error) {
+func loadSkillsFromDir(dir string, logger *slog.Logger) ([]Skill, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
@@ -61,8 +78,10 @@ func loadSkillsFromDir(dir string) ([]Skill, error) {
 			continue
 		}
 
-		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		path := filepath.Join(dir, entry.Name())
+		content, err := os.ReadFile(path)
 		if err != nil {
+			logger.Warn("skipping unreadable skill file", "path", path, "error", err)
 			continue
 		}
 
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"bytes"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
@@ -44,6 +46,21 @@ func TestLoadSkills_MissingDirSkipped(t *testing.T) {
 	assert.Empty(t, skills)
 }
 
+func TestLoadSkillsLogged_WarnsOnUnreadableDir(t *testing.T) {
+	notDir := filepath.Join(t.TempDir(), "skills")
+	require.NoError(t, os.WriteFile(notDir, []byte("x"), 0o644))
+
+	var buf bytes.Buffer
+	skills, err := LoadSkillsLogged(slog.New(slog.NewTextHandler(&buf, nil)),
+		notDir, filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, skills)
+
+	out := buf.String()
+	assert.Contains(t, out, `level=WARN msg="skipping unreadable skills directory" path=`+notDir)
+	assert.NotContains(t, out, "missing")
+}
+
 func TestLoadSkills_MultipleDirs(t *testing.T) {
 	dir1 := t.TempDir()
 	dir2 := t.TempDir()
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"slices"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// DefaultWrapUpNote is the system note injected when BudgetPolicy.WrapUpAt is
+// reached and no custom note is configured.
+const DefaultWrapUpNote = "Budget notice: most of the budget for this task has been spent. " +
+	"Wrap up now: finish the current step, avoid starting new work, and give your final answer."
+
+// BudgetPolicy configures graduated responses as the budget is consumed.
+// Fractions are shares of the budget in (0, 1]; zero disables a step.
+type BudgetPolicy struct {
+	// Thresholds emit a budget warning when crossed (e.g. 0.5, 0.8).
+	Thresholds []float64
+
+	// WrapUpAt appends WrapUpNote to the system prompt once crossed.
+	WrapUpAt   float64
+	WrapUpNote string
+
+	// DowngradeAt switches subsequent requests to DowngradeModel once crossed.
+	DowngradeAt    float64
+	DowngradeModel anthropic.Model
+}
+
+// BudgetWarningInfo contains data for a budget warning event.
+type BudgetWarningInfo struct {
+	Threshold    float64
+	UsedFraction float64
+	WrapUp       bool            // The wrap-up note was injected at this threshold
+	Model        anthropic.Model // Model switched to at this threshold; empty if none
+}
+
+// budgetPolicyState tracks which thresholds of a BudgetPolicy have fired
+// during a run.
+type budgetPolicyState struct {
+	policy  *BudgetPolicy
+	levels  []float64 // Sorted, deduplicated thresholds including WrapUpAt and DowngradeAt
+	crossed int       // Number of levels already crossed
+	wrapUp  bool
+	model   anthropic.Model
+}
+
+func newBudgetPolicyState(p *BudgetPolicy) *budgetPolicyState {
+	levels := slices.Clone(p.Thresholds)
+	if p.WrapUpAt > 0 {
+		levels = append(levels, p.WrapUpAt)
+	}
+	if p.DowngradeAt > 0 && p.DowngradeModel != "" {
+		levels = append(levels, p.DowngradeAt)
+	}
+	levels = slices.DeleteFunc(levels, func(l float64) bool { return l <= 0 })
+	slices.Sort(levels)
+	return &budgetPolicyState{policy: p, levels: slices.Compact(levels)}
+}
+
+// advance returns a warning for every threshold crossed since the last call
+// and applies the wrap-up and downgrade steps they trigger.
+func (s *budgetPolicyState) advance(used float64) []BudgetWarningInfo {
+	var warnings []BudgetWarningInfo
+	for s.crossed < len(s.levels) && used >= s.levels[s.crossed] {
+		level := s.levels[s.crossed]
+		s.crossed++
+
+		info := BudgetWarningInfo{Threshold: level, UsedFraction: used}
+		if level == s.policy.WrapUpAt {
+			s.wrapUp = true
+			info.WrapUp = true
+		}
+		if level == s.policy.DowngradeAt && s.policy.DowngradeModel != "" {
+			s.model = s.policy.DowngradeModel
+			info.Model = s.model
+		}
+		warnings = append(warnings, info)
+	}
+	return warnings
+}
+
+// system returns the system prompt with the wrap-up note appended once the
+// wrap-up threshold has been crossed.
+func (s *budgetPolicyState) system(base []anthropic.TextBlockParam) []anthropic.TextBlockParam {
+	if !s.wrapUp {
+		return base
+	}
+	note := s.policy.WrapUpNote
+	if note == "" {
+		note = DefaultWrapUpNote
+	}
+	return append(slices.Clip(base), anthropic.TextBlockParam{Text: note})
+}
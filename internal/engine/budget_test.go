@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetPolicyState_CrossesMultipleLevelsAtOnce(t *testing.T) {
+	s := newBudgetPolicyState(&BudgetPolicy{
+		Thresholds:     []float64{0.8, 0.5, 0.5},
+		WrapUpAt:       0.8,
+		DowngradeAt:    0.9,
+		DowngradeModel: anthropic.ModelClaudeHaiku4_5,
+	})
+
+	assert.Empty(t, s.advance(0.4))
+
+	warnings := s.advance(0.85)
+	require.Len(t, warnings, 2, "duplicate and shared levels fire once")
+	assert.Equal(t, 0.5, warnings[0].Threshold)
+	assert.False(t, warnings[0].WrapUp)
+	assert.Equal(t, 0.8, warnings[1].Threshold)
+	assert.True(t, warnings[1].WrapUp)
+	assert.Empty(t, s.model)
+
+	warnings = s.advance(0.95)
+	require.Len(t, warnings, 1)
+	assert.Equal(t, anthropic.ModelClaudeHaiku4_5, warnings[0].Model)
+	assert.Empty(t, s.advance(1.0))
+}
+
+func TestBudgetPolicyState_System(t *testing.T) {
+	base := make([]anthropic.TextBlockParam, 1, 4)
+	base[0] = anthropic.TextBlockParam{Text: "base"}
+	s := newBudgetPolicyState(&BudgetPolicy{WrapUpAt: 0.5, WrapUpNote: "stop now"})
+
+	assert.Equal(t, base, s.system(base))
+
+	s.advance(0.5)
+	system := s.system(base)
+	require.Len(t, system, 2)
+	assert.Equal(t, "stop now", system[1].Text)
+	assert.Empty(t, base[:2][1].Text, "base prompt's backing array must not be modified")
+}
+
+func TestBudgetPolicyState_DowngradeWithoutModelIgnored(t *testing.T) {
+	s := newBudgetPolicyState(&BudgetPolicy{DowngradeAt: 0.5})
+	assert.Empty(t, s.advance(1.0))
+}
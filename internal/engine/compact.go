@@ -28,6 +28,12 @@ type CompactConfig struct {
 	Instructions      string
 }
 
+// Beta flags required by features the conversion layer enables on demand.
+const (
+	compactBeta           = "compact-2026-01-12"
+	structuredOutputsBeta = "structured-outputs-2025-11-13"
+)
+
 // compactAwareStreamer wraps an API client and injects compaction parameters
 // when using the Beta API. It converts BetaMessage stream events back to
 // standard MessageStreamEventUnion events so the loop stays unchanged.
@@ -128,8 +134,12 @@ func convertToBetaParams(params anthropic.MessageNewParams, compact CompactConfi
 		compactEdit.Instructions = anthropic.String(compact.Instructions)
 	}
 
-	// Merge compact beta with user-provided betas
-	betas := mergeBetas([]string{"compact-2026-01-12"}, userBetas)
+	// Merge compact beta (and structured outputs beta, if needed) with user-provided betas
+	internal := []string{compactBeta}
+	if hasOutputFormat(params) {
+		internal = append(internal, structuredOutputsBeta)
+	}
+	betas := mergeBetas(internal, userBetas)
 
 	betaParams := anthropic.BetaMessageNewParams{
 		Model:     params.Model,
@@ -163,6 +173,8 @@ func convertToBetaParams(params anthropic.MessageNewParams, compact CompactConfi
 		betaParams.Thinking = anthropic.BetaThinkingConfigParamOfEnabled(params.Thinking.OfEnabled.BudgetTokens)
 	}
 
+	applyOutputFormat(&betaParams, params)
+
 	return betaParams
 }
 
@@ -179,7 +191,11 @@ func convertToBetaParamsNoCompact(params anthropic.MessageNewParams, userBetas [
 		betaTools[i] = convertToolParam(tool)
 	}
 
-	betas := mergeBetas(nil, userBetas)
+	var internal []string
+	if hasOutputFormat(params) {
+		internal = append(internal, structuredOutputsBeta)
+	}
+	betas := mergeBetas(internal, userBetas)
 
 	betaParams := anthropic.BetaMessageNewParams{
 		Model:     params.Model,
@@ -206,9 +222,27 @@ func convertToBetaParamsNoCompact(params anthropic.MessageNewParams, userBetas [
 		betaParams.Thinking = anthropic.BetaThinkingConfigParamOfEnabled(params.Thinking.OfEnabled.BudgetTokens)
 	}
 
+	applyOutputFormat(&betaParams, params)
+
 	return betaParams
 }
 
+// hasOutputFormat reports whether the request asks for native structured output.
+func hasOutputFormat(params anthropic.MessageNewParams) bool {
+	return params.OutputConfig.Format.Schema != nil
+}
+
+// applyOutputFormat copies a native structured output schema onto the beta
+// request's output_format field.
+func applyOutputFormat(betaParams *anthropic.BetaMessageNewParams, params anthropic.MessageNewParams) {
+	if !hasOutputFormat(params) {
+		return
+	}
+	betaParams.OutputFormat = anthropic.BetaJSONOutputFormatParam{
+		Schema: params.OutputConfig.Format.Schema,
+	}
+}
+
 // mergeBetas combines internal and user betas, deduplicating entries.
 func mergeBetas(internal []string, user []string) []anthropic.AnthropicBeta {
 	seen := make(map[string]bool, len(internal)+len(user))
@@ -236,6 +236,38 @@ func TestConvertToBetaParamsNoCompact_WithThinking(t *testing.T) {
 	assert.Equal(t, int64(50000), beta.Thinking.OfEnabled.BudgetTokens)
 }
 
+func TestConvertToBetaParams_NativeOutputFormat(t *testing.T) {
+	schema := map[string]any{"type": "object", "properties": map[string]any{"name": map[string]any{"type": "string"}}}
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.ModelClaudeOpus4_6,
+		MaxTokens: 1024,
+		Messages: []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock("Hello")),
+		},
+	}
+	params.OutputConfig.Format = anthropic.JSONOutputFormatParam{Schema: schema}
+
+	beta := convertToBetaParams(params, CompactConfig{TriggerTokens: 100000}, nil)
+	assert.Equal(t, schema, beta.OutputFormat.Schema)
+	assert.Contains(t, beta.Betas, anthropic.AnthropicBeta(structuredOutputsBeta))
+	assert.Contains(t, beta.Betas, anthropic.AnthropicBeta(compactBeta))
+
+	beta = convertToBetaParamsNoCompact(params, nil)
+	assert.Equal(t, schema, beta.OutputFormat.Schema)
+	assert.Equal(t, []anthropic.AnthropicBeta{structuredOutputsBeta}, beta.Betas)
+}
+
+func TestConvertToBetaParams_NoOutputFormat_NoStructuredBeta(t *testing.T) {
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.ModelClaudeOpus4_6,
+		MaxTokens: 1024,
+	}
+
+	beta := convertToBetaParamsNoCompact(params, nil)
+	assert.Nil(t, beta.OutputFormat.Schema)
+	assert.Empty(t, beta.Betas)
+}
+
 // --- mergeBetas ---
 
 func TestMergeBetas_Empty(t *testing.T) {
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Log attribute keys shared by every package of the SDK.
+const (
+	LogKeySessionID = "session_id"
+	LogKeyRunID     = "run_id"
+	LogKeyTool      = "tool"
+	LogKeyMember    = "member"
+)
+
+// discardLogger drops every record.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// logger returns the configured logger, or one that discards everything.
+func (cfg *LoopConfig) logger() *slog.Logger {
+	if cfg.Logger != nil {
+		return cfg.Logger
+	}
+	return discardLogger
+}
+
+// logAPICall logs one model request at debug level.
+func logAPICall(cfg *LoopConfig, model anthropic.Model, elapsed time.Duration, err error) {
+	attrs := []any{"model", model, "duration", elapsed}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	cfg.logger().Debug("api request", attrs...)
+}
+
+// payload returns a tool input or output as a log attribute, reduced to its
+// size when RedactToolIO is set.
+func (cfg *LoopConfig) payload(key, value string) slog.Attr {
+	if cfg.RedactToolIO {
+		return slog.String(key, fmt.Sprintf("[redacted %d bytes]", len(value)))
+	}
+	return slog.String(key, value)
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// toolThenTextStreamer responds with one Echo tool call, then text. input
+// is embedded in an SSE JSON string, so its quotes must be escaped.
+func toolThenTextStreamer(input string) *mockStreamer {
+	return newMockStreamer(
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 100),
+			toolUseStart(0, "toolu_1", "Echo"),
+			inputJSONDelta(0, input),
+			blockStop(0),
+			messageDelta("tool_use", 10),
+			messageStop(),
+		),
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 100),
+			textBlockStart(0, ""),
+			textDelta(0, "Done"),
+			blockStop(0),
+			messageDelta("end_turn", 10),
+			messageStop(),
+		),
+	)
+}
+
+func runLogged(t *testing.T, cfg LoopConfig) string {
+	t.Helper()
+	var buf bytes.Buffer
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+	tools := newMockToolExecutor()
+	tools.Register("Echo", func(_ context.Context, input json.RawMessage) (string, bool, error) {
+		return "echo: " + string(input), false, nil
+	})
+	cfg.Tools = tools
+	cfg.Model = anthropic.ModelClaudeOpus4_6
+	cfg.MaxTokens = 1024
+	cfg.Messages = &messages
+	cfg.SessionID = "test-session"
+	cfg.Sink = &eventCollector{}
+	cfg.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	RunLoop(context.Background(), cfg)
+	return buf.String()
+}
+
+func TestRunLoop_LogsAPICallsAndToolCalls(t *testing.T) {
+	out := runLogged(t, LoopConfig{Streamer: toolThenTextStreamer(`{\"secret\":\"hunter2\"}`)})
+
+	assert.Equal(t, 2, bytes.Count([]byte(out), []byte(`msg="api request"`)))
+	assert.Contains(t, out, `level=DEBUG msg="tool call" tool=Echo`)
+	assert.Contains(t, out, `hunter2`)
+	assert.Contains(t, out, `is_error=false`)
+}
+
+func TestRunLoop_RedactsToolIO(t *testing.T) {
+	out := runLogged(t, LoopConfig{Streamer: toolThenTextStreamer(`{\"secret\":\"hunter2\"}`), RedactToolIO: true})
+
+	assert.Contains(t, out, `msg="tool call" tool=Echo input="[redacted 20 bytes]" output="[redacted 26 bytes]"`)
+	assert.NotContains(t, out, "hunter2")
+}
+
+func TestRunLoop_LogsHookFailuresAtWarn(t *testing.T) {
+	out := runLogged(t, LoopConfig{
+		Streamer: toolThenTextStreamer(`{}`),
+		Hooks:    &mockHookRunner{preToolErr: errors.New("hook crashed")},
+	})
+
+	assert.Contains(t, out, `level=WARN msg="hook failed" event=PreToolUse error="hook crashed"`)
+}
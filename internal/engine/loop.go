@@ -4,11 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
 )
 
 // MessageStreamer abstracts the Anthropic Messages API so the loop can be tested
@@ -43,8 +48,11 @@ type EventSink interface {
 	OnSystem(sessionID string, model anthropic.Model)
 	OnStream(delta string)
 	OnAssistant(msg anthropic.Message)
+	OnUser(msg anthropic.MessageParam)
 	OnResult(info ResultInfo)
 	OnCompact(info CompactInfo)
+	OnBudgetWarning(info BudgetWarningInfo)
+	OnHistoryRepair(repair HistoryRepair)
 }
 
 // BudgetUsage holds token counts for a single API call (used by BudgetChecker).
@@ -60,6 +68,14 @@ type BudgetUsage struct {
 type BudgetChecker interface {
 	RecordUsage(model anthropic.Model, usage BudgetUsage)
 	Exhausted() bool
+	// UsedFraction is the share of the budget spent so far (0 = unlimited).
+	UsedFraction() float64
+}
+
+// CostCalculator prices the token usage of a single API call.
+// Nil means costs are not reported.
+type CostCalculator interface {
+	Cost(model anthropic.Model, usage BudgetUsage) decimal.Decimal
 }
 
 // HookPreToolResult is the result of running pre-tool-use hooks.
@@ -100,8 +116,11 @@ type CompactInfo struct {
 
 // PerModelUsage tracks token usage for a single model.
 type PerModelUsage struct {
-	InputTokens  int64
-	OutputTokens int64
+	InputTokens              int64
+	OutputTokens             int64
+	CacheReadInputTokens     int64
+	CacheCreationInputTokens int64
+	TotalCost                decimal.Decimal
 }
 
 // ResultInfo contains the data for a result event.
@@ -111,12 +130,18 @@ type ResultInfo struct {
 	IsError                  bool
 	NumTurns                 int
 	DurationMs               int64
+	DurationAPIMs            int64
 	InputTokens              int64
 	OutputTokens             int64
 	CacheReadInputTokens     int64
 	CacheCreationInputTokens int64
+	TotalCost                decimal.Decimal
 	ModelUsage               map[string]PerModelUsage
 	Errors                   []string
+
+	// StructuredOutput is the validated input of the hidden structured output
+	// tool. Nil unless the run ended by producing structured output.
+	StructuredOutput json.RawMessage
 }
 
 // LoopConfig holds everything the agent loop needs to execute.
@@ -151,6 +176,13 @@ type LoopConfig struct {
 	// Budget tracks token/cost usage and enforces limits. Nil = no limit.
 	Budget BudgetChecker
 
+	// Pricing computes the cost reported on results. Nil = costs stay zero.
+	Pricing CostCalculator
+
+	// BudgetPolicy reacts to budget thresholds with warnings, a wrap-up note
+	// and a model downgrade. Requires Budget. Nil = no graduated policy.
+	BudgetPolicy *BudgetPolicy
+
 	// Hooks runs user-defined functions at key points. Nil = no hooks.
 	Hooks HookRunner
 
@@ -165,6 +197,39 @@ type LoopConfig struct {
 	// OutputToolInjector modifies API params to inject the structured output tool.
 	// Called before each API call when OutputToolName is set.
 	OutputToolInjector func(params *anthropic.MessageNewParams)
+
+	// OutputValidator checks the structured output tool input against its schema
+	// and returns the list of violations. Nil = output is accepted as-is.
+	OutputValidator func(input json.RawMessage) []string
+
+	// OutputFormat is a JSON Schema for native structured outputs. When non-nil,
+	// requests use constrained decoding via output_format (beta endpoint) and the
+	// final text of an end_turn response is taken as the structured output.
+	// Normal tools stay available because tool_choice is not forced.
+	OutputFormat map[string]any
+
+	// MaxOutputRetries is how many times the model may re-submit structured output
+	// after OutputValidator rejects it. 0 = fail on the first invalid output.
+	MaxOutputRetries int
+
+	// Tracer creates a span per API call and per tool execution, as children
+	// of the span in the context passed to RunLoop. Nil = no spans.
+	Tracer trace.Tracer
+
+	// ProviderName is reported as gen_ai.provider.name on API call spans.
+	// Empty means "anthropic".
+	ProviderName string
+
+	// Metrics records API latency, token usage, cost, retries, permission
+	// denials, hook failures, compactions and active runs. Nil = no metrics.
+	Metrics metrics.Metrics
+
+	// Logger receives API call and tool execution records at debug level and
+	// errors the loop recovers from at warn level. Nil = no logging.
+	Logger *slog.Logger
+
+	// RedactToolIO logs tool inputs and outputs as their size only.
+	RedactToolIO bool
 }
 
 // RunLoop is the core agent execution loop. It runs in the calling goroutine
@@ -174,39 +239,101 @@ func RunLoop(ctx context.Context, cfg LoopConfig) {
 	startTime := time.Now()
 	var inputTokens, outputTokens, cacheRead, cacheCreation int64
 	modelUsage := make(map[string]PerModelUsage)
+	totalCost := decimal.Zero
+	var apiDuration time.Duration
+
+	cfg.metrics().Add(metrics.ActiveRuns, 1)
+	defer cfg.metrics().Add(metrics.ActiveRuns, -1)
+
+	// newResult builds a ResultInfo carrying the run's accumulated usage,
+	// cost and timing. Any subtype other than "success" is an error.
+	newResult := func(subtype string, numTurns int, errs ...string) ResultInfo {
+		return ResultInfo{
+			Subtype:                  subtype,
+			SessionID:                cfg.SessionID,
+			IsError:                  subtype != "success",
+			NumTurns:                 numTurns,
+			DurationMs:               time.Since(startTime).Milliseconds(),
+			DurationAPIMs:            apiDuration.Milliseconds(),
+			InputTokens:              inputTokens,
+			OutputTokens:             outputTokens,
+			CacheReadInputTokens:     cacheRead,
+			CacheCreationInputTokens: cacheCreation,
+			TotalCost:                totalCost,
+			ModelUsage:               modelUsage,
+			Errors:                   errs,
+		}
+	}
 
 	// 1. Emit SystemEvent
 	cfg.Sink.OnSystem(cfg.SessionID, cfg.Model)
 
 	// SessionStart hook
 	if cfg.Hooks != nil {
-		_ = cfg.Hooks.RunSessionStart(ctx, cfg.SessionID)
+		_ = hookErr(&cfg, "SessionStart", cfg.Hooks.RunSessionStart(ctx, cfg.SessionID))
 	}
 
 	// SessionEnd hook — guaranteed to fire on every exit path
 	if cfg.Hooks != nil {
-		defer func() { _ = cfg.Hooks.RunSessionEnd(ctx, cfg.SessionID) }()
+		defer func() { _ = hookErr(&cfg, "SessionEnd", cfg.Hooks.RunSessionEnd(ctx, cfg.SessionID)) }()
 	}
 
 	turns := 0
+	outputRetries := 0
+	model := cfg.Model
+
+	var policy *budgetPolicyState
+	if cfg.Budget != nil && cfg.BudgetPolicy != nil {
+		policy = newBudgetPolicyState(cfg.BudgetPolicy)
+	}
+
+	// finishStructuredOutput emits the terminal result for a structured output
+	// attempt. It returns false when the output was rejected and the model may
+	// retry, in which case the caller appends the repair feedback.
+	finishStructuredOutput := func(output json.RawMessage, violations []string) bool {
+		info := newResult("success", turns+1)
+		switch {
+		case len(violations) == 0:
+			info.StructuredOutput = output
+		case outputRetries >= cfg.MaxOutputRetries:
+			info.Subtype = "error_max_structured_output_retries"
+			info.IsError = true
+			info.Errors = violations
+		default:
+			outputRetries++
+			return false
+		}
+		runStopHooks(ctx, cfg)
+		cfg.Sink.OnResult(info)
+		return true
+	}
 
 	for {
 		// Check context cancellation
 		if ctx.Err() != nil {
-			cfg.Sink.OnResult(ResultInfo{
-				Subtype:    "error_during_execution",
-				SessionID:  cfg.SessionID,
-				IsError:    true,
-				NumTurns:   turns,
-				DurationMs: time.Since(startTime).Milliseconds(),
-				ModelUsage: modelUsage,
-				Errors:     []string{ctx.Err().Error()},
-			})
+			cfg.Sink.OnResult(newResult("error_during_execution", turns, ctx.Err().Error()))
 			return
 		}
 
+		// A budget shared with a parent or with earlier runs may already be
+		// spent; don't start a call it can't pay for.
+		if cfg.Budget != nil && cfg.Budget.Exhausted() {
+			cfg.Sink.OnResult(newResult("error_max_budget_usd", turns, "budget exhausted"))
+			return
+		}
+
+		// A run interrupted between a tool use and its result, or a crash,
+		// leaves a history the API rejects. Repair it in place.
+		if repaired, repairs := RepairHistory(*cfg.Messages); len(repairs) > 0 {
+			*cfg.Messages = repaired
+			for _, r := range repairs {
+				cfg.logger().Warn("history repaired", "kind", string(r.Kind), "message", r.MessageIndex, "tool_use_id", r.ToolUseID)
+				cfg.Sink.OnHistoryRepair(r)
+			}
+		}
+
 		// Build API params — use current model (may switch to fallback on retry)
-		currentModel := cfg.Model
+		currentModel := model
 		params := anthropic.MessageNewParams{
 			Model:     currentModel,
 			MaxTokens: int64(cfg.MaxTokens),
@@ -227,6 +354,9 @@ func RunLoop(ctx context.Context, cfg LoopConfig) {
 		if len(cfg.SystemPrompt) > 0 {
 			params.System = cfg.SystemPrompt
 		}
+		if policy != nil {
+			params.System = policy.system(params.System)
+		}
 
 		// Add tools if any are registered
 		tools := cfg.Tools.ListForAPI()
@@ -239,93 +369,89 @@ func RunLoop(ctx context.Context, cfg LoopConfig) {
 			cfg.OutputToolInjector(&params)
 		}
 
+		// Request native structured output if configured
+		if cfg.OutputFormat != nil {
+			params.OutputConfig.Format = anthropic.JSONOutputFormatParam{Schema: cfg.OutputFormat}
+		}
+
 		// PreAPIRequest hook
 		if cfg.Hooks != nil {
-			_ = cfg.Hooks.RunPreAPIRequest(ctx, cfg.SessionID, string(cfg.Model), len(*cfg.Messages))
+			_ = hookErr(&cfg, "PreAPIRequest", cfg.Hooks.RunPreAPIRequest(ctx, cfg.SessionID, string(params.Model), len(*cfg.Messages)))
 		}
 
 		// Call the streaming API
-		stream := cfg.Streamer.NewStreaming(ctx, params)
+		apiCtx, apiSpan := startChatSpan(ctx, &cfg, params)
+		retries := 0
+		apiStart := time.Now()
+		stream := cfg.Streamer.NewStreaming(apiCtx, params)
 		msg := anthropic.Message{}
 
 		for stream.Next() {
 			event := stream.Current()
 			if err := msg.Accumulate(event); err != nil {
-				cfg.Sink.OnResult(ResultInfo{
-					Subtype:              "error_during_execution",
-					SessionID:            cfg.SessionID,
-					IsError:              true,
-					NumTurns:             turns,
-					DurationMs:           time.Since(startTime).Milliseconds(),
-					InputTokens:          inputTokens,
-					OutputTokens:         outputTokens,
-					CacheReadInputTokens: cacheRead,
-					ModelUsage:           modelUsage,
-					Errors:               []string{fmt.Sprintf("accumulate error: %s", err.Error())},
-				})
+				apiDuration += time.Since(apiStart)
+				recordAPICall(cfg.metrics(), currentModel, time.Since(apiStart), err)
+				endChatSpan(apiSpan, msg, retries, err)
+				cfg.Sink.OnResult(newResult("error_during_execution", turns, fmt.Sprintf("accumulate error: %s", err.Error())))
 				stream.Close()
 				return
 			}
+			accumulateDeltaUsage(&msg, event)
 
 			// Emit text deltas for streaming
 			if event.Type == "content_block_delta" && event.Delta.Type == "text_delta" && event.Delta.Text != "" {
 				cfg.Sink.OnStream(event.Delta.Text)
 			}
 		}
+		apiDuration += time.Since(apiStart)
+		recordAPICall(cfg.metrics(), currentModel, time.Since(apiStart), stream.Err())
+		logAPICall(&cfg, currentModel, time.Since(apiStart), stream.Err())
 
 		if err := stream.Err(); err != nil {
 			stream.Close()
 
 			// Retry with fallback model on overloaded/unavailable errors
 			if cfg.FallbackModel != "" && currentModel != cfg.FallbackModel && isRetryableError(err) {
+				cfg.metrics().Add(metrics.APIRetries, 1, metrics.L(metrics.LabelModel, string(currentModel)))
+				cfg.logger().Warn("model unavailable, retrying with fallback model",
+					"model", currentModel, "fallback_model", cfg.FallbackModel, "error", err)
 				currentModel = cfg.FallbackModel
 				params.Model = currentModel
 				msg = anthropic.Message{}
+				retries++
 
-				retryStream := cfg.Streamer.NewStreaming(ctx, params)
+				retryStart := time.Now()
+				retryStream := cfg.Streamer.NewStreaming(apiCtx, params)
 				for retryStream.Next() {
 					event := retryStream.Current()
-					_ = msg.Accumulate(event)
+					if err := msg.Accumulate(event); err != nil {
+						cfg.logger().Warn("skipping malformed fallback stream event", "event", event.Type, "error", err)
+					}
+					accumulateDeltaUsage(&msg, event)
 					if event.Type == "content_block_delta" && event.Delta.Type == "text_delta" && event.Delta.Text != "" {
 						cfg.Sink.OnStream(event.Delta.Text)
 					}
 				}
+				apiDuration += time.Since(retryStart)
+				recordAPICall(cfg.metrics(), currentModel, time.Since(retryStart), retryStream.Err())
+				logAPICall(&cfg, currentModel, time.Since(retryStart), retryStream.Err())
 				if retryErr := retryStream.Err(); retryErr != nil {
 					retryStream.Close()
-					cfg.Sink.OnResult(ResultInfo{
-						Subtype:              "error_during_execution",
-						SessionID:            cfg.SessionID,
-						IsError:              true,
-						NumTurns:             turns,
-						DurationMs:           time.Since(startTime).Milliseconds(),
-						InputTokens:          inputTokens,
-						OutputTokens:         outputTokens,
-						CacheReadInputTokens: cacheRead,
-						ModelUsage:           modelUsage,
-						Errors:               []string{fmt.Sprintf("fallback stream error: %s", retryErr.Error())},
-					})
+					endChatSpan(apiSpan, msg, retries, retryErr)
+					cfg.Sink.OnResult(newResult("error_during_execution", turns, fmt.Sprintf("fallback stream error: %s", retryErr.Error())))
 					return
 				}
 				retryStream.Close()
 				// Fall through to normal processing with the fallback response
 			} else {
-				cfg.Sink.OnResult(ResultInfo{
-					Subtype:              "error_during_execution",
-					SessionID:            cfg.SessionID,
-					IsError:              true,
-					NumTurns:             turns,
-					DurationMs:           time.Since(startTime).Milliseconds(),
-					InputTokens:          inputTokens,
-					OutputTokens:         outputTokens,
-					CacheReadInputTokens: cacheRead,
-					ModelUsage:           modelUsage,
-					Errors:               []string{fmt.Sprintf("stream error: %s", err.Error())},
-				})
+				endChatSpan(apiSpan, msg, retries, err)
+				cfg.Sink.OnResult(newResult("error_during_execution", turns, fmt.Sprintf("stream error: %s", err.Error())))
 				return
 			}
 		} else {
 			stream.Close()
 		}
+		endChatSpan(apiSpan, msg, retries, nil)
 
 		// Track usage (aggregate + per-model)
 		inputTokens += msg.Usage.InputTokens
@@ -333,134 +459,118 @@ func RunLoop(ctx context.Context, cfg LoopConfig) {
 		cacheRead += msg.Usage.CacheReadInputTokens
 		cacheCreation += msg.Usage.CacheCreationInputTokens
 
+		// Price the call at the model that actually served it, which may be
+		// the fallback model.
+		callUsage := BudgetUsage{
+			InputTokens:   int(msg.Usage.InputTokens),
+			OutputTokens:  int(msg.Usage.OutputTokens),
+			CacheRead:     int(msg.Usage.CacheReadInputTokens),
+			CacheCreation: int(msg.Usage.CacheCreationInputTokens),
+		}
 		modelKey := string(params.Model)
 		mu := modelUsage[modelKey]
 		mu.InputTokens += msg.Usage.InputTokens
 		mu.OutputTokens += msg.Usage.OutputTokens
+		mu.CacheReadInputTokens += msg.Usage.CacheReadInputTokens
+		mu.CacheCreationInputTokens += msg.Usage.CacheCreationInputTokens
+		callCost := decimal.Zero
+		if cfg.Pricing != nil {
+			callCost = cfg.Pricing.Cost(params.Model, callUsage)
+			mu.TotalCost = mu.TotalCost.Add(callCost)
+			totalCost = totalCost.Add(callCost)
+		}
 		modelUsage[modelKey] = mu
+		recordUsage(cfg.metrics(), params.Model, callUsage, callCost)
 
 		// PostAPIRequest hook
 		if cfg.Hooks != nil {
-			_ = cfg.Hooks.RunPostAPIRequest(ctx, cfg.SessionID, string(cfg.Model), msg.Usage.InputTokens, msg.Usage.OutputTokens)
+			_ = hookErr(&cfg, "PostAPIRequest", cfg.Hooks.RunPostAPIRequest(ctx, cfg.SessionID, string(params.Model), msg.Usage.InputTokens, msg.Usage.OutputTokens))
 		}
 
 		// Record budget usage if tracker is configured
 		if cfg.Budget != nil {
-			cfg.Budget.RecordUsage(cfg.Model, BudgetUsage{
-				InputTokens:  int(msg.Usage.InputTokens),
-				OutputTokens: int(msg.Usage.OutputTokens),
-				CacheRead:    int(msg.Usage.CacheReadInputTokens),
-				CacheCreation: int(msg.Usage.CacheCreationInputTokens),
-			})
+			cfg.Budget.RecordUsage(params.Model, callUsage)
 			if cfg.Budget.Exhausted() {
-				cfg.Sink.OnAssistant(msg)
 				*cfg.Messages = append(*cfg.Messages, msg.ToParam())
-				cfg.Sink.OnResult(ResultInfo{
-					Subtype:                  "error_max_budget_usd",
-					SessionID:                cfg.SessionID,
-					IsError:                  true,
-					NumTurns:                 turns + 1,
-					DurationMs:               time.Since(startTime).Milliseconds(),
-					InputTokens:              inputTokens,
-					OutputTokens:             outputTokens,
-					CacheReadInputTokens:     cacheRead,
-					CacheCreationInputTokens: cacheCreation,
-					ModelUsage:               modelUsage,
-					Errors:                   []string{"budget exhausted"},
-				})
+				cfg.Sink.OnAssistant(msg)
+				cfg.Sink.OnResult(newResult("error_max_budget_usd", turns+1, "budget exhausted"))
 				return
 			}
-		}
 
-		// Emit AssistantEvent
-		cfg.Sink.OnAssistant(msg)
+			// Apply graduated budget policy for subsequent requests
+			if policy != nil {
+				for _, warning := range policy.advance(cfg.Budget.UsedFraction()) {
+					cfg.Sink.OnBudgetWarning(warning)
+				}
+				if policy.model != "" {
+					model = policy.model
+				}
+			}
+		}
 
-		// Append assistant message to messages
+		// Append the assistant message before emitting it, so a sink that
+		// saves the session on AssistantEvent includes it.
 		*cfg.Messages = append(*cfg.Messages, msg.ToParam())
+		cfg.Sink.OnAssistant(msg)
 
 		// Check stop reason
 		switch msg.StopReason {
 		case anthropic.StopReasonEndTurn:
+			// Native structured output: the final text is the JSON document.
+			if cfg.OutputFormat != nil {
+				output := json.RawMessage(finalText(msg.Content))
+				violations := validateOutput(cfg, output)
+				if finishStructuredOutput(output, violations) {
+					return
+				}
+				appendUser(cfg, anthropic.NewUserMessage(anthropic.NewTextBlock(formatViolations(violations, "Respond again with corrected JSON."))))
+				break
+			}
+
 			runStopHooks(ctx, cfg)
-			cfg.Sink.OnResult(ResultInfo{
-				Subtype:                  "success",
-				SessionID:                cfg.SessionID,
-				NumTurns:                 turns + 1,
-				DurationMs:               time.Since(startTime).Milliseconds(),
-				InputTokens:              inputTokens,
-				OutputTokens:             outputTokens,
-				CacheReadInputTokens:     cacheRead,
-				CacheCreationInputTokens: cacheCreation,
-				ModelUsage:               modelUsage,
-			})
+			cfg.Sink.OnResult(newResult("success", turns+1))
 			return
 
 		case anthropic.StopReasonMaxTokens:
 			runStopHooks(ctx, cfg)
-			cfg.Sink.OnResult(ResultInfo{
-				Subtype:              "error_max_turns",
-				SessionID:            cfg.SessionID,
-				IsError:              true,
-				NumTurns:             turns + 1,
-				DurationMs:           time.Since(startTime).Milliseconds(),
-				InputTokens:          inputTokens,
-				OutputTokens:         outputTokens,
-				CacheReadInputTokens: cacheRead,
-				ModelUsage:           modelUsage,
-				Errors:               []string{"max_tokens reached"},
-			})
+			cfg.Sink.OnResult(newResult("error_max_turns", turns+1, "max_tokens reached"))
 			return
 
 		case anthropic.StopReasonToolUse:
 			// Check if this is a structured output response (hidden tool)
-			if cfg.OutputToolName != "" && hasOutputTool(msg.Content, cfg.OutputToolName) {
-				runStopHooks(ctx, cfg)
-				cfg.Sink.OnResult(ResultInfo{
-					Subtype:                  "success",
-					SessionID:                cfg.SessionID,
-					NumTurns:                 turns + 1,
-					DurationMs:               time.Since(startTime).Milliseconds(),
-					InputTokens:              inputTokens,
-					OutputTokens:             outputTokens,
-					CacheReadInputTokens:     cacheRead,
-					CacheCreationInputTokens: cacheCreation,
-					ModelUsage:               modelUsage,
-				})
-				return
+			if toolUseID, output, ok := findOutputTool(msg.Content, cfg.OutputToolName); ok {
+				violations := validateOutput(cfg, output)
+				if finishStructuredOutput(output, violations) {
+					return
+				}
+				// Send the violations back so the model can repair its output.
+				appendUser(cfg, anthropic.NewUserMessage(outputRetryResults(msg.Content, toolUseID, cfg.OutputToolName, violations)...))
+				break
 			}
 
 			// Process tool use blocks (with hooks + permissions)
 			toolResults := processToolUse(ctx, cfg, msg.Content)
 
 			// Append tool results as user message
-			*cfg.Messages = append(*cfg.Messages,
-				anthropic.NewUserMessage(toolResults...))
+			appendUser(cfg, anthropic.NewUserMessage(toolResults...))
 
 		case "compaction":
 			// Server-side compaction occurred. The API has already modified
 			// the message history. Emit compact event and continue the loop.
 			if cfg.Hooks != nil {
-				_ = cfg.Hooks.RunPreCompact(ctx, cfg.SessionID, "server")
+				_ = hookErr(&cfg, "PreCompact", cfg.Hooks.RunPreCompact(ctx, cfg.SessionID, "server"))
 			}
+			cfg.metrics().Add(metrics.Compactions, 1, metrics.L(metrics.LabelStrategy, "server"))
 			cfg.Sink.OnCompact(CompactInfo{Strategy: CompactServer})
 			if cfg.Hooks != nil {
-				_ = cfg.Hooks.RunPostCompact(ctx, cfg.SessionID, "server")
+				_ = hookErr(&cfg, "PostCompact", cfg.Hooks.RunPostCompact(ctx, cfg.SessionID, "server"))
 			}
 			// Continue the loop — the API will re-send with compacted context
 
 		default:
 			// Unknown stop reason, treat as end
 			runStopHooks(ctx, cfg)
-			cfg.Sink.OnResult(ResultInfo{
-				Subtype:              "success",
-				SessionID:            cfg.SessionID,
-				NumTurns:             turns + 1,
-				DurationMs:           time.Since(startTime).Milliseconds(),
-				InputTokens:          inputTokens,
-				OutputTokens:         outputTokens,
-				CacheReadInputTokens: cacheRead,
-				ModelUsage:           modelUsage,
-			})
+			cfg.Sink.OnResult(newResult("success", turns+1))
 			return
 		}
 
@@ -469,18 +579,7 @@ func RunLoop(ctx context.Context, cfg LoopConfig) {
 		// Check maxTurns
 		if cfg.MaxTurns > 0 && turns >= cfg.MaxTurns {
 			runStopHooks(ctx, cfg)
-			cfg.Sink.OnResult(ResultInfo{
-				Subtype:              "error_max_turns",
-				SessionID:            cfg.SessionID,
-				IsError:              true,
-				NumTurns:             turns,
-				DurationMs:           time.Since(startTime).Milliseconds(),
-				InputTokens:          inputTokens,
-				OutputTokens:         outputTokens,
-				CacheReadInputTokens: cacheRead,
-				ModelUsage:           modelUsage,
-				Errors:               []string{"max turns reached"},
-			})
+			cfg.Sink.OnResult(newResult("error_max_turns", turns, "max turns reached"))
 			return
 		}
 	}
@@ -489,10 +588,17 @@ func RunLoop(ctx context.Context, cfg LoopConfig) {
 // runStopHooks runs Stop hooks if a HookRunner is configured.
 func runStopHooks(ctx context.Context, cfg LoopConfig) {
 	if cfg.Hooks != nil {
-		_ = cfg.Hooks.RunStop(ctx, cfg.SessionID)
+		_ = hookErr(&cfg, "Stop", cfg.Hooks.RunStop(ctx, cfg.SessionID))
 	}
 }
 
+// appendUser appends a user message produced by the loop (tool results or
+// output corrections) to the conversation and emits it.
+func appendUser(cfg LoopConfig, msg anthropic.MessageParam) {
+	*cfg.Messages = append(*cfg.Messages, msg)
+	cfg.Sink.OnUser(msg)
+}
+
 // processToolUse executes each tool_use block with hook and permission integration.
 func processToolUse(ctx context.Context, cfg LoopConfig, content []anthropic.ContentBlockUnion) []anthropic.ContentBlockParamUnion {
 	var results []anthropic.ContentBlockParamUnion
@@ -503,110 +609,230 @@ func processToolUse(ctx context.Context, cfg LoopConfig, content []anthropic.Con
 		}
 
 		toolUse := block.AsToolUse()
-		toolInput := json.RawMessage(toolUse.Input)
+		toolCtx, span := startToolSpan(WithToolUseID(ctx, toolUse.ID), &cfg, toolUse)
+		var tt toolTrace
+		text, isError := executeToolUse(toolCtx, cfg, toolUse, &tt)
+		endToolSpan(span, &tt, isError)
+		cfg.logger().Debug("tool call", LogKeyTool, toolUse.Name,
+			cfg.payload("input", string(toolUse.Input)), cfg.payload("output", text),
+			"is_error", isError, "permission", tt.permission)
+
+		results = append(results, anthropic.NewToolResultBlock(toolUse.ID, text, isError))
+	}
 
-		// 1. Run PreToolUse hooks — may block or modify input
-		if cfg.Hooks != nil {
-			hookResult, err := cfg.Hooks.RunPreToolUse(ctx, cfg.SessionID, toolUse.Name, toolInput)
-			if err != nil {
-				results = append(results,
-					anthropic.NewToolResultBlock(toolUse.ID, fmt.Sprintf("hook error: %s", err.Error()), true))
-				continue
-			}
-			if hookResult != nil {
-				if hookResult.Block {
-					reason := hookResult.Reason
-					if reason == "" {
-						reason = "blocked by hook"
-					}
-					results = append(results,
-						anthropic.NewToolResultBlock(toolUse.ID, fmt.Sprintf("tool blocked: %s", reason), true))
-					continue
-				}
-				if hookResult.UpdatedInput != nil {
-					toolInput = hookResult.UpdatedInput
+	return results
+}
+
+type toolUseIDKey struct{}
+
+// WithToolUseID returns a context carrying the ID of the tool use being
+// executed.
+func WithToolUseID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, toolUseIDKey{}, id)
+}
+
+// ToolUseID returns the ID of the tool use being executed, or "".
+func ToolUseID(ctx context.Context) string {
+	id, _ := ctx.Value(toolUseIDKey{}).(string)
+	return id
+}
+
+// executeToolUse runs a single tool_use block through hooks, the permission
+// check and the tool itself, returning the tool_result content. It records
+// the permission decision, hook latency and errors on tt.
+func executeToolUse(ctx context.Context, cfg LoopConfig, toolUse anthropic.ToolUseBlock, tt *toolTrace) (string, bool) {
+	toolInput := json.RawMessage(toolUse.Input)
+
+	// 1. Run PreToolUse hooks — may block or modify input
+	if cfg.Hooks != nil {
+		var hookResult *HookPreToolResult
+		var err error
+		tt.timeHook(func() {
+			hookResult, err = cfg.Hooks.RunPreToolUse(ctx, cfg.SessionID, toolUse.Name, toolInput)
+			err = hookErr(&cfg, "PreToolUse", err)
+		})
+		if err != nil {
+			tt.err = err
+			return fmt.Sprintf("hook error: %s", err.Error()), true
+		}
+		if hookResult != nil {
+			if hookResult.Block {
+				reason := hookResult.Reason
+				if reason == "" {
+					reason = "blocked by hook"
 				}
+				return fmt.Sprintf("tool blocked: %s", reason), true
+			}
+			if hookResult.UpdatedInput != nil {
+				toolInput = hookResult.UpdatedInput
 			}
 		}
+	}
 
-		// 2. Permission check — may deny
-		if cfg.Permission != nil {
-			decision, err := cfg.Permission.Check(ctx, toolUse.Name, toolInput)
-			if err != nil {
-				results = append(results,
-					anthropic.NewToolResultBlock(toolUse.ID, fmt.Sprintf("permission error: %s", err.Error()), true))
-				continue
-			}
-			if decision == 1 { // Deny
-				results = append(results,
-					anthropic.NewToolResultBlock(toolUse.ID, "tool execution denied by permission policy", true))
-				continue
-			}
-			if decision == 2 { // Ask — fire PermissionRequest hook for a decision
-				if cfg.Hooks != nil {
-					hookResult, hookErr := cfg.Hooks.RunPermissionRequest(ctx, cfg.SessionID, toolUse.Name, toolInput)
-					if hookErr != nil {
-						results = append(results,
-							anthropic.NewToolResultBlock(toolUse.ID, fmt.Sprintf("permission hook error: %s", hookErr.Error()), true))
-						continue
-					}
-					if hookResult != nil && hookResult.Block {
-						reason := hookResult.Reason
-						if reason == "" {
-							reason = "blocked by permission hook"
-						}
-						results = append(results,
-							anthropic.NewToolResultBlock(toolUse.ID, fmt.Sprintf("permission denied: %s", reason), true))
-						continue
+	// 2. Permission check — may deny
+	if cfg.Permission != nil {
+		decision, err := cfg.Permission.Check(ctx, toolUse.Name, toolInput)
+		if err != nil {
+			tt.err = err
+			return fmt.Sprintf("permission error: %s", err.Error()), true
+		}
+		tt.permission = permissionDecisionName(decision)
+		if decision == 1 { // Deny
+			recordDenial(&cfg, toolUse.Name)
+			return "tool execution denied by permission policy", true
+		}
+		if decision == 2 { // Ask — fire PermissionRequest hook for a decision
+			if cfg.Hooks != nil {
+				var hookResult *HookPreToolResult
+				var permErr error
+				tt.timeHook(func() {
+					hookResult, permErr = cfg.Hooks.RunPermissionRequest(ctx, cfg.SessionID, toolUse.Name, toolInput)
+					permErr = hookErr(&cfg, "PermissionRequest", permErr)
+				})
+				if permErr != nil {
+					tt.err = permErr
+					return fmt.Sprintf("permission hook error: %s", permErr.Error()), true
+				}
+				if hookResult != nil && hookResult.Block {
+					reason := hookResult.Reason
+					if reason == "" {
+						reason = "blocked by permission hook"
 					}
+					recordDenial(&cfg, toolUse.Name)
+					return fmt.Sprintf("permission denied: %s", reason), true
 				}
-				// No hook or hook allowed — proceed with execution
 			}
+			// No hook or hook allowed — proceed with execution
 		}
+	}
 
-		// 3. Execute tool
-		text, isError, err := cfg.Tools.Execute(ctx, toolUse.Name, toolInput)
+	// 3. Execute tool
+	text, isError, err := cfg.Tools.Execute(ctx, toolUse.Name, toolInput)
 
-		if err != nil {
-			// Tool not found or other registry error
-			if cfg.Hooks != nil {
-				_ = cfg.Hooks.RunPostToolFailure(ctx, cfg.SessionID, toolUse.Name, toolInput, err)
-			}
-			results = append(results,
-				anthropic.NewToolResultBlock(toolUse.ID, fmt.Sprintf("error: %s", err.Error()), true))
-			continue
+	if err != nil {
+		// Tool not found or other registry error
+		tt.err = err
+		if cfg.Hooks != nil {
+			tt.timeHook(func() {
+				_ = hookErr(&cfg, "PostToolUseFailure", cfg.Hooks.RunPostToolFailure(ctx, cfg.SessionID, toolUse.Name, toolInput, err))
+			})
 		}
+		return fmt.Sprintf("error: %s", err.Error()), true
+	}
 
-		// 4. Run PostToolUse or PostToolFailure hooks
-		if cfg.Hooks != nil {
+	if cfg.Hooks != nil {
+		tt.timeHook(func() {
+			// 4. Run PostToolUse or PostToolFailure hooks
 			if isError {
-				_ = cfg.Hooks.RunPostToolFailure(ctx, cfg.SessionID, toolUse.Name, toolInput, fmt.Errorf("%s", text))
+				_ = hookErr(&cfg, "PostToolUseFailure", cfg.Hooks.RunPostToolFailure(ctx, cfg.SessionID, toolUse.Name, toolInput, fmt.Errorf("%s", text)))
 			} else {
-				_ = cfg.Hooks.RunPostToolUse(ctx, cfg.SessionID, toolUse.Name, toolInput, text)
+				_ = hookErr(&cfg, "PostToolUse", cfg.Hooks.RunPostToolUse(ctx, cfg.SessionID, toolUse.Name, toolInput, text))
 			}
+
+			// 5. Run ToolResult hook (fires for every tool execution regardless of success/failure)
+			_ = hookErr(&cfg, "ToolResult", cfg.Hooks.RunToolResult(ctx, cfg.SessionID, toolUse.Name, toolInput, text, isError))
+		})
+	}
+
+	return text, isError
+}
+
+// permissionDecisionName names a PermissionChecker decision for tracing.
+func permissionDecisionName(decision int) string {
+	switch decision {
+	case 0:
+		return "allow"
+	case 1:
+		return "deny"
+	default:
+		return "ask"
+	}
+}
+
+// findOutputTool returns the ID and input of the first tool_use block that
+// matches the hidden structured output tool name.
+func findOutputTool(content []anthropic.ContentBlockUnion, toolName string) (string, json.RawMessage, bool) {
+	if toolName == "" {
+		return "", nil, false
+	}
+	for _, block := range content {
+		if block.Type == "tool_use" && block.Name == toolName {
+			return block.ID, json.RawMessage(block.Input), true
 		}
+	}
+	return "", nil, false
+}
 
-		results = append(results,
-			anthropic.NewToolResultBlock(toolUse.ID, text, isError))
+// accumulateDeltaUsage applies the cumulative input token counts a
+// message_delta may carry, which Message.Accumulate ignores. Providers that
+// only learn usage at the end of a response report it this way.
+func accumulateDeltaUsage(msg *anthropic.Message, event anthropic.MessageStreamEventUnion) {
+	if event.Type != "message_delta" {
+		return
+	}
+	if event.Usage.InputTokens > 0 {
+		msg.Usage.InputTokens = event.Usage.InputTokens
+	}
+	if event.Usage.CacheReadInputTokens > 0 {
+		msg.Usage.CacheReadInputTokens = event.Usage.CacheReadInputTokens
+	}
+	if event.Usage.CacheCreationInputTokens > 0 {
+		msg.Usage.CacheCreationInputTokens = event.Usage.CacheCreationInputTokens
+	}
+}
 
-		// 5. Run ToolResult hook (fires for every tool execution regardless of success/failure)
-		if cfg.Hooks != nil {
-			_ = cfg.Hooks.RunToolResult(ctx, cfg.SessionID, toolUse.Name, toolInput, text, isError)
+// validateOutput runs the configured OutputValidator, if any.
+func validateOutput(cfg LoopConfig, output json.RawMessage) []string {
+	if cfg.OutputValidator == nil {
+		return nil
+	}
+	return cfg.OutputValidator(output)
+}
+
+// finalText returns the concatenated text blocks of an assistant message.
+func finalText(content []anthropic.ContentBlockUnion) string {
+	var sb strings.Builder
+	for _, block := range content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
 		}
 	}
+	return sb.String()
+}
 
-	return results
+// formatViolations renders schema violations as repair feedback for the model.
+func formatViolations(violations []string, instruction string) string {
+	var sb strings.Builder
+	sb.WriteString("Structured output does not match the required schema:\n")
+	for _, v := range violations {
+		sb.WriteString("- ")
+		sb.WriteString(v)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(instruction)
+	return sb.String()
 }
 
-// hasOutputTool checks if any tool_use block in the content matches the hidden
-// structured output tool name.
-func hasOutputTool(content []anthropic.ContentBlockUnion, toolName string) bool {
+// outputRetryResults builds error tool_results for a rejected structured output
+// turn. The output tool receives the schema violations; any other tool_use
+// blocks in the same message are answered without being executed so the
+// history stays valid.
+func outputRetryResults(content []anthropic.ContentBlockUnion, outputID, toolName string, violations []string) []anthropic.ContentBlockParamUnion {
+	feedback := formatViolations(violations, fmt.Sprintf("Call %s again with corrected input.", toolName))
+
+	var results []anthropic.ContentBlockParamUnion
 	for _, block := range content {
-		if block.Type == "tool_use" && block.AsToolUse().Name == toolName {
-			return true
+		if block.Type != "tool_use" {
+			continue
 		}
+		if block.ID == outputID {
+			results = append(results, anthropic.NewToolResultBlock(block.ID, feedback, true))
+			continue
+		}
+		results = append(results,
+			anthropic.NewToolResultBlock(block.ID, "tool not executed: structured output was rejected", true))
 	}
-	return false
+	return results
 }
 
 // isRetryableError returns true if the error indicates the model is overloaded
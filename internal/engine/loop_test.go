@@ -12,6 +12,7 @@ import (
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -88,8 +89,11 @@ type eventCollector struct {
 	}
 	streams  []string
 	assists  []anthropic.Message
+	users    []anthropic.MessageParam
 	results  []ResultInfo
 	compacts []CompactInfo
+	warnings []BudgetWarningInfo
+	repairs  []HistoryRepair
 }
 
 func (c *eventCollector) OnSystem(sessionID string, model anthropic.Model) {
@@ -113,6 +117,12 @@ func (c *eventCollector) OnAssistant(msg anthropic.Message) {
 	c.assists = append(c.assists, msg)
 }
 
+func (c *eventCollector) OnUser(msg anthropic.MessageParam) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users = append(c.users, msg)
+}
+
 func (c *eventCollector) OnResult(info ResultInfo) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -125,6 +135,18 @@ func (c *eventCollector) OnCompact(info CompactInfo) {
 	c.compacts = append(c.compacts, info)
 }
 
+func (c *eventCollector) OnBudgetWarning(info BudgetWarningInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, info)
+}
+
+func (c *eventCollector) OnHistoryRepair(r HistoryRepair) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.repairs = append(c.repairs, r)
+}
+
 // --- SSE helpers ---
 
 // buildSSE constructs an SSE-format string from event type/data pairs.
@@ -308,6 +330,10 @@ func TestRunLoop_ToolUseFlow(t *testing.T) {
 	// Two assistant events (tool_use + final text)
 	require.Len(t, collector.assists, 2)
 
+	// One user event carrying the tool result
+	require.Len(t, collector.users, 1)
+	assert.Equal(t, messages[2], collector.users[0])
+
 	// Final result is success
 	require.Len(t, collector.results, 1)
 	assert.Equal(t, "success", collector.results[0].Subtype)
@@ -690,6 +716,13 @@ func (m *mockBudgetChecker) Exhausted() bool {
 	return m.exhaustAfter > 0 && m.callCount >= m.exhaustAfter
 }
 
+func (m *mockBudgetChecker) UsedFraction() float64 {
+	if m.exhaustAfter == 0 {
+		return 0
+	}
+	return float64(m.callCount) / float64(m.exhaustAfter)
+}
+
 // mockHookRunner implements HookRunner for testing.
 type mockHookRunner struct {
 	preToolResult  *HookPreToolResult
@@ -951,6 +984,31 @@ func TestRunLoop_BudgetExhaustion(t *testing.T) {
 	assert.True(t, collector.results[0].IsError)
 }
 
+func TestRunLoop_BudgetExhaustedBeforeCall(t *testing.T) {
+	streamer := newMockStreamer()
+	collector := &eventCollector{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:  streamer,
+		Tools:     newMockToolExecutor(),
+		Model:     anthropic.ModelClaudeOpus4_6,
+		MaxTokens: 1024,
+		Messages:  &messages,
+		SessionID: "test-session",
+		Sink:      collector,
+		Budget:    &mockBudgetChecker{exhaustAfter: 1, callCount: 1},
+	})
+
+	assert.Equal(t, 0, streamer.callIdx, "the model should not be called")
+	require.Len(t, collector.results, 1)
+	assert.Equal(t, "error_max_budget_usd", collector.results[0].Subtype)
+	assert.Equal(t, 0, collector.results[0].NumTurns)
+	assert.Len(t, messages, 1)
+}
+
 func TestRunLoop_BudgetNil_NoPanic(t *testing.T) {
 	sse := buildSSE(
 		messageStart(anthropic.ModelClaudeOpus4_6, 10),
@@ -1234,6 +1292,187 @@ func TestRunLoop_StructuredOutput(t *testing.T) {
 	assert.Equal(t, "success", collector.results[0].Subtype)
 	assert.False(t, collector.results[0].IsError)
 	assert.Equal(t, 1, collector.results[0].NumTurns)
+	assert.JSONEq(t, `{"name":"Alice","age":30}`, string(collector.results[0].StructuredOutput))
+}
+
+func structuredOutputSSE(id, input string) string {
+	return buildSSE(
+		messageStart(anthropic.ModelClaudeOpus4_6, 10),
+		toolUseStart(0, id, "structured_output"),
+		inputJSONDelta(0, input),
+		blockStop(0),
+		messageDelta("tool_use", 20),
+		messageStop(),
+	)
+}
+
+func TestRunLoop_StructuredOutput_RepairsInvalidOutput(t *testing.T) {
+	streamer := newMockStreamer(
+		structuredOutputSSE("toolu_bad", `{\"name\":\"Alice\"}`),
+		structuredOutputSSE("toolu_good", `{\"name\":\"Alice\",\"age\":30}`),
+	)
+	collector := &eventCollector{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Give me structured data")),
+	}
+
+	var validated []string
+	cfg := LoopConfig{
+		Streamer:         streamer,
+		Tools:            newMockToolExecutor(),
+		Model:            anthropic.ModelClaudeOpus4_6,
+		MaxTokens:        1024,
+		Messages:         &messages,
+		SessionID:        "test-session",
+		Sink:             collector,
+		OutputToolName:   "structured_output",
+		MaxOutputRetries: 2,
+		OutputValidator: func(input json.RawMessage) []string {
+			validated = append(validated, string(input))
+			if !strings.Contains(string(input), "age") {
+				return []string{`$: missing required property "age"`}
+			}
+			return nil
+		},
+	}
+
+	RunLoop(context.Background(), cfg)
+
+	require.Len(t, validated, 2)
+	require.Len(t, collector.results, 1)
+	result := collector.results[0]
+	assert.Equal(t, "success", result.Subtype)
+	assert.Equal(t, 2, result.NumTurns)
+	assert.JSONEq(t, `{"name":"Alice","age":30}`, string(result.StructuredOutput))
+
+	// user, assistant(bad), user(tool_result error), assistant(good)
+	require.Len(t, messages, 4)
+	feedback := messages[2].Content[0].OfToolResult
+	require.NotNil(t, feedback)
+	assert.Equal(t, "toolu_bad", feedback.ToolUseID)
+	assert.True(t, feedback.IsError.Value)
+	assert.Contains(t, feedback.Content[0].OfText.Text, `missing required property "age"`)
+}
+
+func TestRunLoop_StructuredOutput_RetriesExhausted(t *testing.T) {
+	streamer := newMockStreamer(
+		structuredOutputSSE("toolu_1", `{}`),
+		structuredOutputSSE("toolu_2", `{}`),
+	)
+	collector := &eventCollector{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Give me structured data")),
+	}
+
+	cfg := LoopConfig{
+		Streamer:         streamer,
+		Tools:            newMockToolExecutor(),
+		Model:            anthropic.ModelClaudeOpus4_6,
+		MaxTokens:        1024,
+		Messages:         &messages,
+		SessionID:        "test-session",
+		Sink:             collector,
+		OutputToolName:   "structured_output",
+		MaxOutputRetries: 1,
+		OutputValidator: func(input json.RawMessage) []string {
+			return []string{"$: always wrong"}
+		},
+	}
+
+	RunLoop(context.Background(), cfg)
+
+	require.Len(t, collector.results, 1)
+	result := collector.results[0]
+	assert.Equal(t, "error_max_structured_output_retries", result.Subtype)
+	assert.True(t, result.IsError)
+	assert.Equal(t, []string{"$: always wrong"}, result.Errors)
+	assert.Nil(t, result.StructuredOutput)
+}
+
+func TestRunLoop_NativeOutputFormat(t *testing.T) {
+	sse := buildSSE(
+		messageStart(anthropic.ModelClaudeOpus4_6, 10),
+		textBlockStart(0, ""),
+		textDelta(0, `{\"name\":\"Alice\"}`),
+		blockStop(0),
+		messageDelta("end_turn", 20),
+		messageStop(),
+	)
+	streamer := &capturingStreamer{inner: newMockStreamer(sse)}
+	collector := &eventCollector{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Give me structured data")),
+	}
+	schema := map[string]any{"type": "object"}
+
+	cfg := LoopConfig{
+		Streamer:     streamer,
+		Tools:        newMockToolExecutor(),
+		Model:        anthropic.ModelClaudeOpus4_6,
+		MaxTokens:    1024,
+		Messages:     &messages,
+		SessionID:    "test-session",
+		Sink:         collector,
+		OutputFormat: schema,
+	}
+
+	RunLoop(context.Background(), cfg)
+
+	require.Len(t, streamer.params, 1)
+	assert.Equal(t, schema, streamer.params[0].OutputConfig.Format.Schema)
+	// tool_choice is not forced in native mode
+	assert.Nil(t, streamer.params[0].ToolChoice.OfTool)
+
+	require.Len(t, collector.results, 1)
+	assert.Equal(t, "success", collector.results[0].Subtype)
+	assert.JSONEq(t, `{"name":"Alice"}`, string(collector.results[0].StructuredOutput))
+}
+
+func TestRunLoop_NativeOutputFormat_RepairsInvalidText(t *testing.T) {
+	textResponse := func(text string) string {
+		return buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 10),
+			textBlockStart(0, ""),
+			textDelta(0, text),
+			blockStop(0),
+			messageDelta("end_turn", 20),
+			messageStop(),
+		)
+	}
+	streamer := newMockStreamer(textResponse("not json"), textResponse(`{\"ok\":true}`))
+	collector := &eventCollector{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Give me structured data")),
+	}
+
+	cfg := LoopConfig{
+		Streamer:         streamer,
+		Tools:            newMockToolExecutor(),
+		Model:            anthropic.ModelClaudeOpus4_6,
+		MaxTokens:        1024,
+		Messages:         &messages,
+		SessionID:        "test-session",
+		Sink:             collector,
+		OutputFormat:     map[string]any{"type": "object"},
+		MaxOutputRetries: 1,
+		OutputValidator: func(input json.RawMessage) []string {
+			if !json.Valid(input) {
+				return []string{"$: invalid JSON"}
+			}
+			return nil
+		},
+	}
+
+	RunLoop(context.Background(), cfg)
+
+	require.Len(t, collector.results, 1)
+	assert.Equal(t, "success", collector.results[0].Subtype)
+	assert.JSONEq(t, `{"ok":true}`, string(collector.results[0].StructuredOutput))
+
+	// user, assistant(bad), user(feedback), assistant(good)
+	require.Len(t, messages, 4)
+	assert.Equal(t, anthropic.MessageParamRoleUser, messages[2].Role)
+	assert.Contains(t, messages[2].Content[0].OfText.Text, "$: invalid JSON")
 }
 
 func TestRunLoop_CompactionStopReason(t *testing.T) {
@@ -1658,3 +1897,288 @@ func TestRunLoop_ThinkingTokens_MaxTokensAlreadyLarge(t *testing.T) {
 	// MaxTokens should stay as-is since 128000 >= 10000 + 16384
 	assert.Equal(t, int64(128000), p.MaxTokens)
 }
+
+// mockPricing prices every token at a flat per-model rate for testing.
+type mockPricing map[anthropic.Model]int64
+
+func (m mockPricing) Cost(model anthropic.Model, usage BudgetUsage) decimal.Decimal {
+	tokens := int64(usage.InputTokens + usage.OutputTokens + usage.CacheRead + usage.CacheCreation)
+	return decimal.NewFromInt(tokens * m[model])
+}
+
+// overloadedThenStreamer fails the first call with an overloaded error and
+// serves the given response afterwards, recording the requested models.
+type overloadedThenStreamer struct {
+	next   *mockStreamer
+	calls  int
+	models []anthropic.Model
+}
+
+func (s *overloadedThenStreamer) NewStreaming(ctx context.Context, params anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	s.calls++
+	s.models = append(s.models, params.Model)
+	if s.calls == 1 {
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, fmt.Errorf("overloaded_error"))
+	}
+	return s.next.NewStreaming(ctx, params)
+}
+
+func TestRunLoop_ReportsCost(t *testing.T) {
+	streamer := newMockStreamer(
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 100),
+			toolUseStart(0, "toolu_1", "Echo"),
+			inputJSONDelta(0, `{}`),
+			blockStop(0),
+			messageDelta("tool_use", 10),
+			messageStop(),
+		),
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 200),
+			textBlockStart(0, ""),
+			textDelta(0, "done"),
+			blockStop(0),
+			messageDelta("end_turn", 20),
+			messageStop(),
+		),
+	)
+	tools := newMockToolExecutor()
+	tools.Register("Echo", func(ctx context.Context, input json.RawMessage) (string, bool, error) {
+		return "ok", false, nil
+	})
+	collector := &eventCollector{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:  streamer,
+		Tools:     tools,
+		Model:     anthropic.ModelClaudeOpus4_6,
+		MaxTokens: 1024,
+		Messages:  &messages,
+		SessionID: "test-session",
+		Sink:      collector,
+		Pricing:   mockPricing{anthropic.ModelClaudeOpus4_6: 2},
+	})
+
+	require.Len(t, collector.results, 1)
+	result := collector.results[0]
+	assert.Equal(t, "success", result.Subtype)
+	assert.True(t, decimal.NewFromInt(660).Equal(result.TotalCost), "got %s", result.TotalCost)
+	mu := result.ModelUsage[string(anthropic.ModelClaudeOpus4_6)]
+	assert.True(t, result.TotalCost.Equal(mu.TotalCost))
+	assert.GreaterOrEqual(t, result.DurationMs, result.DurationAPIMs)
+}
+
+func TestRunLoop_PricesFallbackModel(t *testing.T) {
+	streamer := &overloadedThenStreamer{next: newMockStreamer(buildSSE(
+		messageStart(anthropic.ModelClaudeSonnet4_5, 100),
+		textBlockStart(0, ""),
+		textDelta(0, "OK"),
+		blockStop(0),
+		messageDelta("end_turn", 50),
+		messageStop(),
+	))}
+	collector := &eventCollector{}
+	budget := &recordingBudget{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:      streamer,
+		Tools:         newMockToolExecutor(),
+		Model:         anthropic.ModelClaudeOpus4_6,
+		FallbackModel: anthropic.ModelClaudeSonnet4_5,
+		MaxTokens:     1024,
+		Messages:      &messages,
+		SessionID:     "test-session",
+		Sink:          collector,
+		Budget:        budget,
+		Pricing: mockPricing{
+			anthropic.ModelClaudeOpus4_6:   10,
+			anthropic.ModelClaudeSonnet4_5: 1,
+		},
+	})
+
+	require.Len(t, collector.results, 1)
+	result := collector.results[0]
+	assert.Equal(t, "success", result.Subtype)
+	assert.Equal(t, []anthropic.Model{anthropic.ModelClaudeOpus4_6, anthropic.ModelClaudeSonnet4_5}, streamer.models)
+	assert.True(t, decimal.NewFromInt(150).Equal(result.TotalCost), "got %s", result.TotalCost)
+	assert.NotContains(t, result.ModelUsage, string(anthropic.ModelClaudeOpus4_6))
+	assert.Contains(t, result.ModelUsage, string(anthropic.ModelClaudeSonnet4_5))
+	assert.Equal(t, []anthropic.Model{anthropic.ModelClaudeSonnet4_5}, budget.models)
+}
+
+// recordingBudget records which models usage was attributed to.
+type recordingBudget struct {
+	models []anthropic.Model
+}
+
+func (r *recordingBudget) RecordUsage(model anthropic.Model, _ BudgetUsage) {
+	r.models = append(r.models, model)
+}
+
+func (r *recordingBudget) Exhausted() bool { return false }
+
+func (r *recordingBudget) UsedFraction() float64 { return 0 }
+
+func TestRunLoop_BudgetPolicy(t *testing.T) {
+	toolTurn := func(id string) string {
+		return buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 10),
+			toolUseStart(0, id, "Echo"),
+			inputJSONDelta(0, `{}`),
+			blockStop(0),
+			messageDelta("tool_use", 5),
+			messageStop(),
+		)
+	}
+	streamer := &capturingStreamer{inner: newMockStreamer(
+		toolTurn("toolu_1"),
+		toolTurn("toolu_2"),
+		toolTurn("toolu_3"),
+		buildSSE(
+			messageStart(anthropic.ModelClaudeHaiku4_5, 10),
+			textBlockStart(0, ""),
+			textDelta(0, "done"),
+			blockStop(0),
+			messageDelta("end_turn", 5),
+			messageStop(),
+		),
+	)}
+	tools := newMockToolExecutor()
+	tools.Register("Echo", func(ctx context.Context, input json.RawMessage) (string, bool, error) {
+		return "ok", false, nil
+	})
+	collector := &eventCollector{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	hooks := &mockHookRunner{}
+
+	// Each call spends a quarter of the budget.
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:     streamer,
+		Tools:        tools,
+		Model:        anthropic.ModelClaudeOpus4_6,
+		MaxTokens:    1024,
+		Messages:     &messages,
+		SystemPrompt: []anthropic.TextBlockParam{{Text: "base"}},
+		SessionID:    "test-session",
+		Sink:         collector,
+		Hooks:        hooks,
+		Budget:       &mockBudgetChecker{exhaustAfter: 4},
+		BudgetPolicy: &BudgetPolicy{
+			Thresholds:     []float64{0.25},
+			WrapUpAt:       0.5,
+			DowngradeAt:    0.75,
+			DowngradeModel: anthropic.ModelClaudeHaiku4_5,
+		},
+	})
+
+	require.Len(t, collector.warnings, 3)
+	assert.Equal(t, 0.25, collector.warnings[0].Threshold)
+	assert.True(t, collector.warnings[1].WrapUp)
+	assert.Equal(t, anthropic.ModelClaudeHaiku4_5, collector.warnings[2].Model)
+
+	require.Len(t, streamer.params, 4)
+	assert.Len(t, streamer.params[1].System, 1, "no note before the wrap-up threshold")
+	require.Len(t, streamer.params[2].System, 2)
+	assert.Equal(t, DefaultWrapUpNote, streamer.params[2].System[1].Text)
+	assert.Equal(t, anthropic.ModelClaudeOpus4_6, streamer.params[2].Model)
+	assert.Equal(t, anthropic.ModelClaudeHaiku4_5, streamer.params[3].Model)
+
+	// The API request hooks report the model actually called.
+	require.Len(t, hooks.preAPICalls, 4)
+	require.Len(t, hooks.postAPICalls, 4)
+	assert.Equal(t, string(anthropic.ModelClaudeOpus4_6), hooks.preAPICalls[2].Model)
+	assert.Equal(t, string(anthropic.ModelClaudeHaiku4_5), hooks.preAPICalls[3].Model)
+	assert.Equal(t, string(anthropic.ModelClaudeHaiku4_5), hooks.postAPICalls[3].Model)
+
+	require.Len(t, collector.results, 1)
+	assert.Equal(t, "error_max_budget_usd", collector.results[0].Subtype)
+}
+
+func TestRunLoop_InputUsageFromMessageDelta(t *testing.T) {
+	// Providers that learn usage only at the end of a response report input
+	// tokens on message_delta instead of message_start.
+	streamer := newMockStreamer(buildSSE(
+		messageStart("local-model", 0),
+		textBlockStart(0, ""),
+		textDelta(0, "hi"),
+		blockStop(0),
+		sseEvent{
+			Type: "message_delta",
+			Data: `{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"input_tokens":40,"cache_read_input_tokens":8,"output_tokens":3}}`,
+		},
+		messageStop(),
+	))
+	collector := &eventCollector{}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:  streamer,
+		Tools:     newMockToolExecutor(),
+		Model:     "local-model",
+		MaxTokens: 1024,
+		Messages:  &messages,
+		SessionID: "test-session",
+		Sink:      collector,
+	})
+
+	require.Len(t, collector.results, 1)
+	result := collector.results[0]
+	assert.Equal(t, int64(40), result.InputTokens)
+	assert.Equal(t, int64(8), result.CacheReadInputTokens)
+	assert.Equal(t, int64(3), result.OutputTokens)
+}
+
+func TestRunLoop_RepairsInterruptedHistory(t *testing.T) {
+	sse := buildSSE(
+		messageStart(anthropic.ModelClaudeOpus4_6, 10),
+		textBlockStart(0, ""),
+		textDelta(0, "OK"),
+		blockStop(0),
+		messageDelta("end_turn", 5),
+		messageStop(),
+	)
+	streamer := &capturingStreamer{inner: newMockStreamer(sse)}
+	collector := &eventCollector{}
+
+	// The previous run was interrupted before the tool ran.
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("List files")),
+		anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("toolu_1", map[string]any{}, "Bash")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Never mind")),
+	}
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:  streamer,
+		Tools:     newMockToolExecutor(),
+		Model:     anthropic.ModelClaudeOpus4_6,
+		MaxTokens: 1024,
+		Messages:  &messages,
+		Sink:      collector,
+	})
+
+	require.Len(t, collector.results, 1)
+	assert.Equal(t, "success", collector.results[0].Subtype)
+	assert.Equal(t, []HistoryRepair{{Kind: RepairInterruptedToolUse, MessageIndex: 2, ToolUseID: "toolu_1"}}, collector.repairs)
+
+	require.Len(t, streamer.params, 1)
+	sent := streamer.params[0].Messages
+	require.Len(t, sent, 3)
+	require.Len(t, sent[2].Content, 2)
+	result := sent[2].Content[0].OfToolResult
+	require.NotNil(t, result, "the tool result comes first")
+	assert.Equal(t, "toolu_1", result.ToolUseID)
+	assert.True(t, result.IsError.Value)
+	assert.Equal(t, InterruptedToolResult, result.Content[0].OfText.Text)
+	assert.Equal(t, "Never mind", sent[2].Content[1].OfText.Text)
+	assert.Len(t, messages, 4, "the repaired history is kept")
+}
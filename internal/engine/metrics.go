@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
+)
+
+// metrics returns the configured metrics, or a no-op implementation.
+func (cfg *LoopConfig) metrics() metrics.Metrics {
+	return metrics.OrNop(cfg.Metrics)
+}
+
+// recordAPICall records the latency and outcome of one model request.
+func recordAPICall(m metrics.Metrics, model anthropic.Model, elapsed time.Duration, err error) {
+	m.Observe(metrics.APIDuration, elapsed.Seconds(),
+		metrics.L(metrics.LabelModel, string(model)),
+		metrics.L(metrics.LabelOutcome, metrics.Outcome(err != nil)))
+}
+
+// recordUsage records the tokens and cost of one model response.
+func recordUsage(m metrics.Metrics, model anthropic.Model, usage BudgetUsage, cost decimal.Decimal) {
+	modelLabel := metrics.L(metrics.LabelModel, string(model))
+	for _, t := range []struct {
+		typ    string
+		tokens int
+	}{
+		{metrics.TokenInput, usage.InputTokens},
+		{metrics.TokenOutput, usage.OutputTokens},
+		{metrics.TokenCacheRead, usage.CacheRead},
+		{metrics.TokenCacheCreation, usage.CacheCreation},
+	} {
+		if t.tokens > 0 {
+			m.Add(metrics.Tokens, float64(t.tokens), modelLabel, metrics.L(metrics.LabelType, t.typ))
+		}
+	}
+	if cost.IsPositive() {
+		m.Add(metrics.Cost, cost.InexactFloat64(), modelLabel)
+	}
+}
+
+// RecordUsage records the tokens and cost of a model response received
+// outside the loop and its calls, such as a batch result, into m, which
+// may be nil.
+func RecordUsage(m metrics.Metrics, model anthropic.Model, usage anthropic.Usage, cost decimal.Decimal) {
+	recordUsage(metrics.OrNop(m), model, budgetUsage(usage), cost)
+}
+
+// RecordCall accounts for a model request made outside the loop, such as
+// one titling the session, as the loop accounts for its own: it records
+// its latency, usage and cost into m and budget, either of which may be
+// nil, and returns the cost as priced by pricing.
+func RecordCall(m metrics.Metrics, budget BudgetChecker, pricing CostCalculator, model anthropic.Model, usage anthropic.Usage, elapsed time.Duration, err error) decimal.Decimal {
+	m = metrics.OrNop(m)
+	recordAPICall(m, model, elapsed, err)
+	callUsage := budgetUsage(usage)
+	cost := decimal.Zero
+	if pricing != nil {
+		cost = pricing.Cost(model, callUsage)
+	}
+	recordUsage(m, model, callUsage, cost)
+	if budget != nil {
+		budget.RecordUsage(model, callUsage)
+	}
+	return cost
+}
+
+func budgetUsage(usage anthropic.Usage) BudgetUsage {
+	return BudgetUsage{
+		InputTokens:   int(usage.InputTokens),
+		OutputTokens:  int(usage.OutputTokens),
+		CacheRead:     int(usage.CacheReadInputTokens),
+		CacheCreation: int(usage.CacheCreationInputTokens),
+	}
+}
+
+// hookErr records and logs a failed hook invocation for event and returns
+// err.
+func hookErr(cfg *LoopConfig, event string, err error) error {
+	if err != nil {
+		cfg.metrics().Add(metrics.HookFailures, 1, metrics.L(metrics.LabelEvent, event))
+		cfg.logger().Warn("hook failed", "event", event, "error", err)
+	}
+	return err
+}
+
+// recordDenial records a tool call refused by the permission policy.
+func recordDenial(cfg *LoopConfig, tool string) {
+	cfg.metrics().Add(metrics.PermissionDenials, 1, metrics.L(metrics.LabelTool, tool))
+	cfg.logger().Debug("tool call denied", LogKeyTool, tool)
+}
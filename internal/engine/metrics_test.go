@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
+)
+
+// recordingMetrics keeps the sum of every series and the number of
+// histogram observations, keyed by "name{k=v,...}" with sorted labels.
+type recordingMetrics struct {
+	mu       sync.Mutex
+	sums     map[string]float64
+	observed map[string]int
+	calls    []string // Names in call order
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{sums: map[string]float64{}, observed: map[string]int{}}
+}
+
+func seriesKey(name string, labels []metrics.Label) string {
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l.Key + "=" + l.Value
+	}
+	slices.Sort(parts)
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
+
+func (r *recordingMetrics) Add(name string, delta float64, labels ...metrics.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sums[seriesKey(name, labels)] += delta
+	r.calls = append(r.calls, name)
+}
+
+func (r *recordingMetrics) Set(name string, value float64, labels ...metrics.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sums[seriesKey(name, labels)] = value
+	r.calls = append(r.calls, name)
+}
+
+func (r *recordingMetrics) Observe(name string, value float64, labels ...metrics.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observed[seriesKey(name, labels)]++
+	r.calls = append(r.calls, name)
+}
+
+func TestRunLoop_RecordsMetrics(t *testing.T) {
+	m := newRecordingMetrics()
+	streamer := &overloadedThenStreamer{next: newMockStreamer(
+		buildSSE(
+			messageStart(anthropic.ModelClaudeSonnet4_5, 100),
+			toolUseStart(0, "toolu_1", "Echo"),
+			inputJSONDelta(0, `{}`),
+			blockStop(0),
+			messageDelta("tool_use", 10),
+			messageStop(),
+		),
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 200),
+			textBlockStart(0, ""),
+			textDelta(0, "Done"),
+			blockStop(0),
+			messageDelta("end_turn", 20),
+			messageStop(),
+		),
+	)}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:      streamer,
+		Tools:         newMockToolExecutor(),
+		Model:         anthropic.ModelClaudeOpus4_6,
+		FallbackModel: anthropic.ModelClaudeSonnet4_5,
+		MaxTokens:     1024,
+		Messages:      &messages,
+		SessionID:     "test-session",
+		Sink:          &eventCollector{},
+		Pricing:       mockPricing{anthropic.ModelClaudeSonnet4_5: 1, anthropic.ModelClaudeOpus4_6: 2},
+		Permission:    &mockPermissionChecker{decision: 1},
+		Metrics:       m,
+	})
+
+	opus, sonnet := string(anthropic.ModelClaudeOpus4_6), string(anthropic.ModelClaudeSonnet4_5)
+	assert.Equal(t, map[string]int{
+		"agent.api.duration{model=" + opus + ",outcome=error}":     1,
+		"agent.api.duration{model=" + sonnet + ",outcome=success}": 1,
+		"agent.api.duration{model=" + opus + ",outcome=success}":   1,
+	}, m.observed)
+
+	assert.Equal(t, 1.0, m.sums["agent.api.retries{model="+opus+"}"])
+	assert.Equal(t, 100.0, m.sums["agent.tokens{model="+sonnet+",type=input}"])
+	assert.Equal(t, 10.0, m.sums["agent.tokens{model="+sonnet+",type=output}"])
+	assert.Equal(t, 200.0, m.sums["agent.tokens{model="+opus+",type=input}"])
+	assert.Equal(t, 110.0, m.sums["agent.cost{model="+sonnet+"}"])
+	assert.Equal(t, 440.0, m.sums["agent.cost{model="+opus+"}"])
+	assert.Equal(t, 1.0, m.sums["agent.permission.denials{tool=Echo}"])
+
+	// The active-runs gauge goes up first and back to zero at the end.
+	assert.Equal(t, metrics.ActiveRuns, m.calls[0])
+	assert.Equal(t, metrics.ActiveRuns, m.calls[len(m.calls)-1])
+	assert.Zero(t, m.sums["agent.runs.active{}"])
+}
+
+func TestRunLoop_RecordsHookFailures(t *testing.T) {
+	m := newRecordingMetrics()
+	streamer := newMockStreamer(
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 100),
+			toolUseStart(0, "toolu_1", "Echo"),
+			inputJSONDelta(0, `{}`),
+			blockStop(0),
+			messageDelta("tool_use", 10),
+			messageStop(),
+		),
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 100),
+			textBlockStart(0, ""),
+			textDelta(0, "Done"),
+			blockStop(0),
+			messageDelta("end_turn", 10),
+			messageStop(),
+		),
+	)
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:  streamer,
+		Tools:     newMockToolExecutor(),
+		Model:     anthropic.ModelClaudeOpus4_6,
+		MaxTokens: 1024,
+		Messages:  &messages,
+		SessionID: "test-session",
+		Sink:      &eventCollector{},
+		Hooks:     &mockHookRunner{preToolErr: errors.New("hook crashed")},
+		Metrics:   m,
+	})
+
+	assert.Equal(t, 1.0, m.sums["agent.hook.failures{event=PreToolUse}"])
+	assert.Len(t, m.sums, 4, "only active runs, tokens and the hook failure: %v", m.sums)
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"slices"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// InterruptedToolResult is the content of the tool result added for a
+// tool use whose result is missing, as the Claude Code CLI writes it.
+const InterruptedToolResult = "[Request interrupted by user for tool use]"
+
+// RepairKind identifies a change RepairHistory made.
+type RepairKind string
+
+const (
+	// RepairInterruptedToolUse is a tool use answered with an
+	// InterruptedToolResult.
+	RepairInterruptedToolUse RepairKind = "interrupted_tool_use"
+	// RepairOrphanToolResult is a tool result dropped because no tool use
+	// of the message before it has its ID.
+	RepairOrphanToolResult RepairKind = "orphan_tool_result"
+	// RepairMergedMessages is a message merged into the message before it,
+	// which had the same role.
+	RepairMergedMessages RepairKind = "merged_messages"
+)
+
+// HistoryRepair describes a change RepairHistory made.
+type HistoryRepair struct {
+	Kind RepairKind
+	// MessageIndex locates the message changed, or the one following a
+	// message removed, in the history as repaired up to this change.
+	MessageIndex int
+	// ToolUseID is the ID of the tool use answered or of the result
+	// dropped.
+	ToolUseID string
+}
+
+// RepairHistory makes msgs acceptable to the API again after a run was
+// interrupted between a tool use and its result, or the history was
+// otherwise damaged: it merges consecutive messages of the same role,
+// answers each tool use lacking a result in the next message with an
+// InterruptedToolResult, and drops tool results answering no tool use of
+// the message before. It returns msgs itself and no repairs if nothing
+// needed changing; msgs is never modified.
+func RepairHistory(msgs []anthropic.MessageParam) ([]anthropic.MessageParam, []HistoryRepair) {
+	var repairs []HistoryRepair
+	out := mergeRoles(msgs, &repairs)
+	out = pairToolUses(out, &repairs)
+	// Dropping results may have emptied a message between two others.
+	out = mergeRoles(out, &repairs)
+	if len(repairs) == 0 {
+		return msgs, nil
+	}
+	return out, repairs
+}
+
+func mergeRoles(msgs []anthropic.MessageParam, repairs *[]HistoryRepair) []anthropic.MessageParam {
+	out := make([]anthropic.MessageParam, 0, len(msgs))
+	for _, msg := range msgs {
+		if last := len(out) - 1; last >= 0 && out[last].Role == msg.Role {
+			out[last].Content = slices.Concat(out[last].Content, msg.Content)
+			*repairs = append(*repairs, HistoryRepair{Kind: RepairMergedMessages, MessageIndex: last})
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// pairToolUses answers the tool uses of each assistant message in the
+// user message after it, with its tool results first as the API requires.
+func pairToolUses(msgs []anthropic.MessageParam, repairs *[]HistoryRepair) []anthropic.MessageParam {
+	out := make([]anthropic.MessageParam, 0, len(msgs))
+	var pending []string // tool uses of the last assistant message
+
+	// answer returns the results for pending, using those given and
+	// adding one for each missing.
+	answer := func(given map[string]anthropic.ContentBlockParamUnion) []anthropic.ContentBlockParamUnion {
+		results := make([]anthropic.ContentBlockParamUnion, 0, len(pending))
+		for _, id := range pending {
+			if r, ok := given[id]; ok {
+				results = append(results, r)
+				continue
+			}
+			results = append(results, anthropic.NewToolResultBlock(id, InterruptedToolResult, true))
+			*repairs = append(*repairs, HistoryRepair{Kind: RepairInterruptedToolUse, MessageIndex: len(out), ToolUseID: id})
+		}
+		pending = nil
+		return results
+	}
+
+	for _, msg := range msgs {
+		if msg.Role != anthropic.MessageParamRoleUser {
+			if len(pending) > 0 {
+				out = append(out, anthropic.NewUserMessage(answer(nil)...))
+			}
+			out = append(out, msg)
+			for _, b := range msg.Content {
+				if b.OfToolUse != nil {
+					pending = append(pending, b.OfToolUse.ID)
+				}
+			}
+			continue
+		}
+
+		given := make(map[string]anthropic.ContentBlockParamUnion)
+		var rest []anthropic.ContentBlockParamUnion
+		for _, b := range msg.Content {
+			if b.OfToolResult == nil {
+				rest = append(rest, b)
+				continue
+			}
+			id := b.OfToolResult.ToolUseID
+			if _, dup := given[id]; dup || !slices.Contains(pending, id) {
+				*repairs = append(*repairs, HistoryRepair{Kind: RepairOrphanToolResult, MessageIndex: len(out), ToolUseID: id})
+				continue
+			}
+			given[id] = b
+		}
+		content := append(answer(given), rest...)
+		if len(content) == 0 {
+			continue
+		}
+		out = append(out, anthropic.MessageParam{Role: msg.Role, Content: content})
+	}
+	if len(pending) > 0 {
+		out = append(out, anthropic.NewUserMessage(answer(nil)...))
+	}
+	return out
+}
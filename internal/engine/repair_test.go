@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func userText(text string) anthropic.MessageParam {
+	return anthropic.NewUserMessage(anthropic.NewTextBlock(text))
+}
+
+func toolCall(ids ...string) anthropic.MessageParam {
+	var blocks []anthropic.ContentBlockParamUnion
+	for _, id := range ids {
+		blocks = append(blocks, anthropic.NewToolUseBlock(id, map[string]any{}, "Bash"))
+	}
+	return anthropic.NewAssistantMessage(blocks...)
+}
+
+func toolResults(ids ...string) anthropic.MessageParam {
+	var blocks []anthropic.ContentBlockParamUnion
+	for _, id := range ids {
+		blocks = append(blocks, anthropic.NewToolResultBlock(id, "ok", false))
+	}
+	return anthropic.NewUserMessage(blocks...)
+}
+
+// describe lists each block of msgs as role:type[:id].
+func describe(msgs []anthropic.MessageParam) [][]string {
+	var out [][]string
+	for _, msg := range msgs {
+		var blocks []string
+		for _, b := range msg.Content {
+			switch {
+			case b.OfText != nil:
+				blocks = append(blocks, string(msg.Role)+":text:"+b.OfText.Text)
+			case b.OfToolUse != nil:
+				blocks = append(blocks, string(msg.Role)+":tool_use:"+b.OfToolUse.ID)
+			case b.OfToolResult != nil:
+				kind := ":tool_result:"
+				if b.OfToolResult.Content[0].OfText.Text == InterruptedToolResult {
+					kind = ":interrupted:"
+				}
+				blocks = append(blocks, string(msg.Role)+kind+b.OfToolResult.ToolUseID)
+			}
+		}
+		out = append(out, blocks)
+	}
+	return out
+}
+
+func TestRepairHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgs    []anthropic.MessageParam
+		want    [][]string
+		repairs []HistoryRepair
+	}{
+		{
+			name: "valid history",
+			msgs: []anthropic.MessageParam{userText("hi"), toolCall("a"), toolResults("a"), anthropic.NewAssistantMessage(anthropic.NewTextBlock("done"))},
+			want: [][]string{{"user:text:hi"}, {"assistant:tool_use:a"}, {"user:tool_result:a"}, {"assistant:text:done"}},
+		},
+		{
+			name:    "interrupted at the end",
+			msgs:    []anthropic.MessageParam{userText("hi"), toolCall("a", "b")},
+			want:    [][]string{{"user:text:hi"}, {"assistant:tool_use:a", "assistant:tool_use:b"}, {"user:interrupted:a", "user:interrupted:b"}},
+			repairs: []HistoryRepair{{RepairInterruptedToolUse, 2, "a"}, {RepairInterruptedToolUse, 2, "b"}},
+		},
+		{
+			name:    "some results missing",
+			msgs:    []anthropic.MessageParam{userText("hi"), toolCall("a", "b"), toolResults("b")},
+			want:    [][]string{{"user:text:hi"}, {"assistant:tool_use:a", "assistant:tool_use:b"}, {"user:interrupted:a", "user:tool_result:b"}},
+			repairs: []HistoryRepair{{RepairInterruptedToolUse, 2, "a"}},
+		},
+		{
+			name:    "orphan results",
+			msgs:    []anthropic.MessageParam{userText("hi"), toolCall("a"), toolResults("a", "a", "x"), anthropic.NewAssistantMessage(anthropic.NewTextBlock("done"))},
+			want:    [][]string{{"user:text:hi"}, {"assistant:tool_use:a"}, {"user:tool_result:a"}, {"assistant:text:done"}},
+			repairs: []HistoryRepair{{RepairOrphanToolResult, 2, "a"}, {RepairOrphanToolResult, 2, "x"}},
+		},
+		{
+			name: "orphan result message removed",
+			msgs: []anthropic.MessageParam{userText("hi"), anthropic.NewAssistantMessage(anthropic.NewTextBlock("one")), toolResults("x"), anthropic.NewAssistantMessage(anthropic.NewTextBlock("two"))},
+			want: [][]string{{"user:text:hi"}, {"assistant:text:one", "assistant:text:two"}},
+			repairs: []HistoryRepair{
+				{RepairOrphanToolResult, 2, "x"},
+				{RepairMergedMessages, 1, ""},
+			},
+		},
+		{
+			name: "consecutive messages merged",
+			msgs: []anthropic.MessageParam{userText("hi"), userText("again"), toolCall("a"), userText("stop"), toolResults("a")},
+			want: [][]string{{"user:text:hi", "user:text:again"}, {"assistant:tool_use:a"}, {"user:tool_result:a", "user:text:stop"}},
+			repairs: []HistoryRepair{
+				{RepairMergedMessages, 0, ""},
+				{RepairMergedMessages, 2, ""},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := describe(tt.msgs)
+			got, repairs := RepairHistory(tt.msgs)
+			assert.Equal(t, tt.want, describe(got))
+			assert.Equal(t, tt.repairs, repairs)
+			assert.Equal(t, before, describe(tt.msgs), "the input is not modified")
+			if tt.repairs == nil {
+				require.Len(t, got, len(tt.msgs))
+				assert.Same(t, &tt.msgs[0], &got[0])
+			}
+		})
+	}
+}
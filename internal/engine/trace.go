@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Span attributes without a GenAI semantic convention equivalent.
+const (
+	AttrRetryCount     = attribute.Key("agent.api.retry_count")
+	AttrToolIsError    = attribute.Key("agent.tool.is_error")
+	AttrPermission     = attribute.Key("agent.tool.permission")
+	AttrHookDurationMs = attribute.Key("agent.tool.hook_duration_ms")
+)
+
+// DefaultProviderName is reported as gen_ai.provider.name when
+// LoopConfig.ProviderName is empty.
+const DefaultProviderName = "anthropic"
+
+// tracer returns the configured tracer, or a no-op tracer.
+func (cfg *LoopConfig) tracer() trace.Tracer {
+	if cfg.Tracer != nil {
+		return cfg.Tracer
+	}
+	return noop.NewTracerProvider().Tracer("")
+}
+
+func (cfg *LoopConfig) providerName() string {
+	if cfg.ProviderName != "" {
+		return cfg.ProviderName
+	}
+	return DefaultProviderName
+}
+
+// startChatSpan starts the span for one model request, named
+// "chat {model}" per the GenAI conventions.
+func startChatSpan(ctx context.Context, cfg *LoopConfig, params anthropic.MessageNewParams) (context.Context, trace.Span) {
+	return cfg.tracer().Start(ctx, "chat "+string(params.Model),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.GenAIOperationNameChat,
+			semconv.GenAIProviderNameKey.String(cfg.providerName()),
+			semconv.GenAIRequestModel(string(params.Model)),
+			semconv.GenAIRequestMaxTokens(int(params.MaxTokens)),
+			semconv.GenAIConversationID(cfg.SessionID),
+		))
+}
+
+// endChatSpan records the response, usage and retry count of a model
+// request. A non-nil err marks the span as failed.
+func endChatSpan(span trace.Span, msg anthropic.Message, retries int, err error) {
+	span.SetAttributes(AttrRetryCount.Int(retries))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(semconv.ErrorTypeOther)
+		span.End()
+		return
+	}
+	span.SetAttributes(
+		semconv.GenAIResponseID(msg.ID),
+		semconv.GenAIResponseModel(string(msg.Model)),
+		semconv.GenAIResponseFinishReasons(string(msg.StopReason)),
+		semconv.GenAIUsageInputTokens(int(msg.Usage.InputTokens)),
+		semconv.GenAIUsageOutputTokens(int(msg.Usage.OutputTokens)),
+		semconv.GenAIUsageCacheReadInputTokens(int(msg.Usage.CacheReadInputTokens)),
+		semconv.GenAIUsageCacheCreationInputTokens(int(msg.Usage.CacheCreationInputTokens)),
+	)
+	span.End()
+}
+
+// toolTrace collects what happened while processing one tool_use block.
+type toolTrace struct {
+	permission string        // "allow", "deny" or "ask"; empty without a checker
+	hooks      time.Duration // Time spent in hooks for this call
+	err        error         // Registry or hook error, if any
+}
+
+// timeHook runs fn and adds its duration to the hook latency.
+func (t *toolTrace) timeHook(fn func()) {
+	start := time.Now()
+	fn()
+	t.hooks += time.Since(start)
+}
+
+// startToolSpan starts the span for one tool execution, named
+// "execute_tool {tool}" per the GenAI conventions.
+func startToolSpan(ctx context.Context, cfg *LoopConfig, toolUse anthropic.ToolUseBlock) (context.Context, trace.Span) {
+	return cfg.tracer().Start(ctx, "execute_tool "+toolUse.Name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			semconv.GenAIOperationNameExecuteTool,
+			semconv.GenAIToolName(toolUse.Name),
+			semconv.GenAIToolCallID(toolUse.ID),
+			semconv.GenAIToolType("function"),
+		))
+}
+
+// endToolSpan records the outcome of a tool execution.
+func endToolSpan(span trace.Span, t *toolTrace, isError bool) {
+	span.SetAttributes(
+		AttrToolIsError.Bool(isError),
+		AttrHookDurationMs.Int64(t.hooks.Milliseconds()),
+	)
+	if t.permission != "" {
+		span.SetAttributes(AttrPermission.String(t.permission))
+	}
+	if t.err != nil {
+		span.RecordError(t.err)
+		span.SetStatus(codes.Error, t.err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracer(t *testing.T) (*tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return exporter, tp
+}
+
+func spanAttrs(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(s.Attributes))
+	for _, kv := range s.Attributes {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func spansNamed(spans tracetest.SpanStubs, name string) []tracetest.SpanStub {
+	var out []tracetest.SpanStub
+	for _, s := range spans {
+		if s.Name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestRunLoop_TracesAPICallsAndTools(t *testing.T) {
+	exporter, tp := newTestTracer(t)
+	streamer := newMockStreamer(
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 100),
+			toolUseStart(0, "toolu_1", "Echo"),
+			inputJSONDelta(0, `{}`),
+			blockStop(0),
+			toolUseStart(1, "toolu_2", "Missing"),
+			inputJSONDelta(1, `{}`),
+			blockStop(1),
+			messageDelta("tool_use", 10),
+			messageStop(),
+		),
+		buildSSE(
+			messageStart(anthropic.ModelClaudeOpus4_6, 200),
+			textBlockStart(0, ""),
+			textDelta(0, "done"),
+			blockStop(0),
+			messageDelta("end_turn", 20),
+			messageStop(),
+		),
+	)
+	tools := newMockToolExecutor()
+	tools.Register("Echo", func(ctx context.Context, input json.RawMessage) (string, bool, error) {
+		return "ok", false, nil
+	})
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	RunLoop(ctx, LoopConfig{
+		Streamer:   streamer,
+		Tools:      tools,
+		Model:      anthropic.ModelClaudeOpus4_6,
+		MaxTokens:  1024,
+		Messages:   &messages,
+		SessionID:  "test-session",
+		Sink:       &eventCollector{},
+		Hooks:      &mockHookRunner{},
+		Permission: &mockPermissionChecker{decision: 0},
+		Tracer:     tp.Tracer("test"),
+	})
+	root.End()
+
+	spans := exporter.GetSpans()
+	chats := spansNamed(spans, "chat "+string(anthropic.ModelClaudeOpus4_6))
+	require.Len(t, chats, 2)
+	for _, s := range chats {
+		assert.Equal(t, root.SpanContext().SpanID(), s.Parent.SpanID())
+	}
+	first := spanAttrs(chats[0])
+	assert.Equal(t, "chat", first["gen_ai.operation.name"].AsString())
+	assert.Equal(t, "anthropic", first["gen_ai.provider.name"].AsString())
+	assert.Equal(t, string(anthropic.ModelClaudeOpus4_6), first["gen_ai.request.model"].AsString())
+	assert.Equal(t, int64(1024), first["gen_ai.request.max_tokens"].AsInt64())
+	assert.Equal(t, "test-session", first["gen_ai.conversation.id"].AsString())
+	assert.Equal(t, []string{"tool_use"}, first["gen_ai.response.finish_reasons"].AsStringSlice())
+	assert.Equal(t, int64(100), first["gen_ai.usage.input_tokens"].AsInt64())
+	assert.Equal(t, int64(10), first["gen_ai.usage.output_tokens"].AsInt64())
+	assert.Equal(t, int64(0), first[AttrRetryCount].AsInt64())
+
+	echo := spansNamed(spans, "execute_tool Echo")
+	require.Len(t, echo, 1)
+	assert.Equal(t, root.SpanContext().SpanID(), echo[0].Parent.SpanID())
+	attrs := spanAttrs(echo[0])
+	assert.Equal(t, "execute_tool", attrs["gen_ai.operation.name"].AsString())
+	assert.Equal(t, "toolu_1", attrs["gen_ai.tool.call.id"].AsString())
+	assert.Equal(t, "allow", attrs[AttrPermission].AsString())
+	assert.False(t, attrs[AttrToolIsError].AsBool())
+	assert.Contains(t, attrs, AttrHookDurationMs)
+	assert.Equal(t, codes.Unset, echo[0].Status.Code)
+
+	missing := spansNamed(spans, "execute_tool Missing")
+	require.Len(t, missing, 1)
+	assert.True(t, spanAttrs(missing[0])[AttrToolIsError].AsBool())
+	assert.Equal(t, codes.Error, missing[0].Status.Code)
+}
+
+func TestRunLoop_TracesFallbackRetry(t *testing.T) {
+	exporter, tp := newTestTracer(t)
+	streamer := &overloadedThenStreamer{next: newMockStreamer(buildSSE(
+		messageStart(anthropic.ModelClaudeSonnet4_5, 100),
+		textBlockStart(0, ""),
+		textDelta(0, "OK"),
+		blockStop(0),
+		messageDelta("end_turn", 50),
+		messageStop(),
+	))}
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:      streamer,
+		Tools:         newMockToolExecutor(),
+		Model:         anthropic.ModelClaudeOpus4_6,
+		FallbackModel: anthropic.ModelClaudeSonnet4_5,
+		MaxTokens:     1024,
+		Messages:      &messages,
+		SessionID:     "test-session",
+		Sink:          &eventCollector{},
+		Tracer:        tp.Tracer("test"),
+		ProviderName:  "custom",
+	})
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	attrs := spanAttrs(spans[0])
+	assert.Equal(t, int64(1), attrs[AttrRetryCount].AsInt64())
+	assert.Equal(t, "custom", attrs["gen_ai.provider.name"].AsString())
+	assert.Equal(t, string(anthropic.ModelClaudeSonnet4_5), attrs["gen_ai.response.model"].AsString())
+}
+
+func TestRunLoop_TracesStreamError(t *testing.T) {
+	exporter, tp := newTestTracer(t)
+	messages := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Hi")),
+	}
+
+	RunLoop(context.Background(), LoopConfig{
+		Streamer:  &errorStreamer{err: errors.New("boom")},
+		Tools:     newMockToolExecutor(),
+		Model:     anthropic.ModelClaudeOpus4_6,
+		MaxTokens: 1024,
+		Messages:  &messages,
+		SessionID: "test-session",
+		Sink:      &eventCollector{},
+		Tracer:    tp.Tracer("test"),
+	})
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "boom", spans[0].Status.Description)
+}
+
+// errorStreamer fails every request with err.
+type errorStreamer struct{ err error }
+
+func (s *errorStreamer) NewStreaming(context.Context, anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, s.err)
+}
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/invopop/jsonschema"
@@ -17,7 +18,7 @@ func Generate[T any]() anthropic.ToolInputSchemaParam {
 	// from the root definition.
 	root := extractRoot(s)
 
-	properties := schemaProperties(root)
+	properties := schemaProperties(root, &refResolver{defs: s.Definitions})
 
 	return anthropic.ToolInputSchemaParam{
 		Properties: properties,
@@ -30,6 +31,9 @@ func extractRoot(s *jsonschema.Schema) *jsonschema.Schema {
 	if s.Ref != "" && s.Definitions != nil {
 		// invopop/jsonschema puts the actual type under $defs with a ref like
 		// "#/$defs/TypeName". Extract the type name from the ref.
+		if def := resolveRef(s.Ref, s.Definitions); def != nil {
+			return def
+		}
 		for _, def := range s.Definitions {
 			if def.Type == "object" {
 				return def
@@ -39,21 +43,57 @@ func extractRoot(s *jsonschema.Schema) *jsonschema.Schema {
 	return s
 }
 
+// refResolver inlines $defs references while converting nested properties.
+// It tracks the references currently being expanded so recursive types
+// terminate as a plain object instead of recursing forever.
+type refResolver struct {
+	defs      jsonschema.Definitions
+	expanding map[string]bool
+}
+
+// resolveRef looks up a "#/$defs/TypeName" reference in defs.
+func resolveRef(ref string, defs jsonschema.Definitions) *jsonschema.Schema {
+	const prefix = "#/$defs/"
+	if !strings.HasPrefix(ref, prefix) {
+		return nil
+	}
+	return defs[strings.TrimPrefix(ref, prefix)]
+}
+
 // schemaProperties converts an ordered map of properties into a plain
 // map[string]any suitable for the Anthropic API.
-func schemaProperties(s *jsonschema.Schema) map[string]any {
+func schemaProperties(s *jsonschema.Schema, r *refResolver) map[string]any {
 	if s.Properties == nil {
 		return nil
 	}
 	props := make(map[string]any)
 	for pair := s.Properties.Oldest(); pair != nil; pair = pair.Next() {
-		props[pair.Key] = propertySchema(pair.Value)
+		props[pair.Key] = propertySchema(pair.Value, r)
 	}
 	return props
 }
 
 // propertySchema converts a single property schema to a serializable map.
-func propertySchema(s *jsonschema.Schema) map[string]any {
+// Nested struct types are referenced via $ref and are inlined from defs.
+func propertySchema(s *jsonschema.Schema, r *refResolver) map[string]any {
+	if s.Ref != "" {
+		if def := resolveRef(s.Ref, r.defs); def != nil {
+			if r.expanding[s.Ref] {
+				return map[string]any{"type": "object"}
+			}
+			if r.expanding == nil {
+				r.expanding = make(map[string]bool)
+			}
+			r.expanding[s.Ref] = true
+			m := propertySchema(def, r)
+			delete(r.expanding, s.Ref)
+			if s.Description != "" {
+				m["description"] = s.Description
+			}
+			return m
+		}
+	}
+
 	m := make(map[string]any)
 
 	if s.Type != "" {
@@ -82,7 +122,7 @@ func propertySchema(s *jsonschema.Schema) map[string]any {
 	// Nested object properties
 	if s.Properties != nil {
 		m["type"] = "object"
-		m["properties"] = schemaProperties(s)
+		m["properties"] = schemaProperties(s, r)
 		if len(s.Required) > 0 {
 			m["required"] = s.Required
 		}
@@ -90,7 +130,7 @@ func propertySchema(s *jsonschema.Schema) map[string]any {
 
 	// Array items
 	if s.Items != nil {
-		m["items"] = propertySchema(s.Items)
+		m["items"] = propertySchema(s.Items, r)
 	}
 
 	return m
@@ -101,3 +141,56 @@ func GenerateJSON[T any]() (json.RawMessage, error) {
 	param := Generate[T]()
 	return json.Marshal(param)
 }
+
+// ToStrictMap converts a tool input schema into a standalone JSON Schema
+// document suitable for native structured outputs. Every object node gets
+// additionalProperties: false (unless it already declares it), which the
+// constrained decoder requires.
+func ToStrictMap(s anthropic.ToolInputSchemaParam) (map[string]any, error) {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	closeObjects(m)
+	return m, nil
+}
+
+// closeObjects recursively adds additionalProperties: false to object
+// schemas, including those in definitions that $ref points to.
+func closeObjects(node map[string]any) {
+	if node["type"] == "object" || node["properties"] != nil {
+		if _, ok := node["additionalProperties"]; !ok {
+			node["additionalProperties"] = false
+		}
+	}
+	// Keywords holding a schema.
+	for _, key := range []string{"items", "additionalProperties"} {
+		if child, ok := node[key].(map[string]any); ok {
+			closeObjects(child)
+		}
+	}
+	// Keywords holding schemas by name.
+	for _, key := range []string{"properties", "$defs", "definitions"} {
+		if children, ok := node[key].(map[string]any); ok {
+			for _, c := range children {
+				if child, ok := c.(map[string]any); ok {
+					closeObjects(child)
+				}
+			}
+		}
+	}
+	// Keywords holding a list of schemas.
+	for _, key := range []string{"anyOf", "allOf", "oneOf", "prefixItems"} {
+		if children, ok := node[key].([]any); ok {
+			for _, c := range children {
+				if child, ok := c.(map[string]any); ok {
+					closeObjects(child)
+				}
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -109,3 +110,92 @@ func TestGenerateJSONRoundtrip(t *testing.T) {
 	assert.NotNil(t, m["properties"])
 	assert.NotNil(t, m["required"])
 }
+
+type nestedChild struct {
+	City string `json:"city" jsonschema:"required"`
+}
+
+type nestedParent struct {
+	Name    string        `json:"name" jsonschema:"required"`
+	Address nestedChild   `json:"address" jsonschema:"required,description=Home address"`
+	History []nestedChild `json:"history,omitempty"`
+}
+
+func TestGenerateNestedStruct(t *testing.T) {
+	schema := Generate[nestedParent]()
+
+	props, ok := schema.Properties.(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, []string{"name", "address"}, schema.Required)
+
+	addr, ok := props["address"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "object", addr["type"])
+	assert.Equal(t, "Home address", addr["description"])
+	assert.Equal(t, []string{"city"}, addr["required"])
+	assert.Contains(t, addr["properties"], "city")
+
+	history, ok := props["history"].(map[string]any)
+	require.True(t, ok)
+	items, ok := history["items"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "object", items["type"])
+}
+
+type recursiveNode struct {
+	Value    string          `json:"value"`
+	Children []recursiveNode `json:"children,omitempty"`
+}
+
+func TestGenerateRecursiveStruct_Terminates(t *testing.T) {
+	schema := Generate[recursiveNode]()
+
+	props, ok := schema.Properties.(map[string]any)
+	require.True(t, ok)
+	children, ok := props["children"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "array", children["type"])
+}
+
+func TestToStrictMap_ClosesNestedObjects(t *testing.T) {
+	m, err := ToStrictMap(Generate[nestedParent]())
+	require.NoError(t, err)
+
+	assert.Equal(t, "object", m["type"])
+	assert.Equal(t, false, m["additionalProperties"])
+
+	props := m["properties"].(map[string]any)
+	addr := props["address"].(map[string]any)
+	assert.Equal(t, false, addr["additionalProperties"])
+
+	items := props["history"].(map[string]any)["items"].(map[string]any)
+	assert.Equal(t, false, items["additionalProperties"])
+}
+
+func TestToStrictMap_ClosesObjectsInEverySubschema(t *testing.T) {
+	object := func() map[string]any {
+		return map[string]any{"type": "object", "properties": map[string]any{"a": map[string]any{"type": "string"}}}
+	}
+	m, err := ToStrictMap(anthropic.ToolInputSchemaParam{
+		Properties: map[string]any{
+			"home":   map[string]any{"$ref": "#/$defs/address"},
+			"extra":  map[string]any{"type": "object", "additionalProperties": object()},
+			"pair":   map[string]any{"type": "array", "prefixItems": []any{object()}},
+			"merged": map[string]any{"allOf": []any{object()}},
+		},
+		ExtraFields: map[string]any{
+			"$defs":       map[string]any{"address": object()},
+			"definitions": map[string]any{"legacy": object()},
+		},
+	})
+	require.NoError(t, err)
+
+	closed := func(node any) any { return node.(map[string]any)["additionalProperties"] }
+	props := m["properties"].(map[string]any)
+	assert.Equal(t, false, closed(m["$defs"].(map[string]any)["address"]))
+	assert.Equal(t, false, closed(m["definitions"].(map[string]any)["legacy"]))
+	assert.Equal(t, false, closed(closed(props["extra"])))
+	assert.Equal(t, false, closed(props["pair"].(map[string]any)["prefixItems"].([]any)[0]))
+	assert.Equal(t, false, closed(props["merged"].(map[string]any)["allOf"].([]any)[0]))
+	assert.Nil(t, closed(props["home"]), "a $ref is not an object schema")
+}
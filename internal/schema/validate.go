@@ -0,0 +1,337 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Validator checks JSON documents against a compiled JSON Schema.
+// It supports the subset of JSON Schema produced by Generate and commonly
+// used for tool inputs: type, required, enum, properties, additionalProperties,
+// items, anyOf, and $ref to a location in the same document, such as
+// "#/$defs/Address".
+type Validator struct {
+	root map[string]any
+}
+
+// NewValidator compiles a tool input schema into a Validator.
+// The schema is normalized through a JSON round-trip so that Go-typed values
+// (e.g. []string for required) and decoded JSON are handled uniformly.
+func NewValidator(s anthropic.ToolInputSchemaParam) (*Validator, error) {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("schema: marshal: %w", err)
+	}
+	return NewValidatorJSON(raw)
+}
+
+// NewValidatorJSON compiles a raw JSON Schema document into a Validator.
+// It fails if a $ref does not resolve to a schema in the document or
+// refers, directly or through other refs, to itself.
+func NewValidatorJSON(raw json.RawMessage) (*Validator, error) {
+	var root map[string]any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("schema: unmarshal: %w", err)
+	}
+	v := &Validator{root: root}
+	if err := v.checkRefs(root); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// checkRefs checks that every $ref in node resolves and that no chain of
+// refs loops back on itself.
+func (v *Validator) checkRefs(node any) error {
+	switch n := node.(type) {
+	case map[string]any:
+		if _, ok := n["$ref"]; ok {
+			seen := map[string]bool{}
+			for s := n; s["$ref"] != nil; {
+				ref, _ := s["$ref"].(string)
+				if seen[ref] {
+					return fmt.Errorf("schema: $ref %q refers to itself", ref)
+				}
+				seen[ref] = true
+				target, err := v.resolve(ref)
+				if err != nil {
+					return err
+				}
+				s = target
+			}
+		}
+		for _, child := range n {
+			if err := v.checkRefs(child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range n {
+			if err := v.checkRefs(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the schema a $ref points to. Only refs to a location in
+// the same document, given as a JSON pointer fragment, are supported.
+func (v *Validator) resolve(ref string) (map[string]any, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok || (pointer != "" && !strings.HasPrefix(pointer, "/")) {
+		return nil, fmt.Errorf("schema: unsupported $ref %q", ref)
+	}
+	var node any = v.root
+	if pointer != "" {
+		for _, token := range strings.Split(pointer[1:], "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			switch n := node.(type) {
+			case map[string]any:
+				node = n[token]
+			case []any:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(n) {
+					return nil, fmt.Errorf("schema: unresolved $ref %q", ref)
+				}
+				node = n[i]
+			default:
+				node = nil
+			}
+		}
+	}
+	target, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema: unresolved $ref %q", ref)
+	}
+	return target, nil
+}
+
+// Validate checks data against the schema and returns a list of violations.
+// An empty result means the document is valid. Each violation is prefixed
+// with the JSON path of the offending value (e.g. "$.items[0].name").
+func (v *Validator) Validate(data json.RawMessage) []string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return []string{fmt.Sprintf("$: invalid JSON: %s", err.Error())}
+	}
+	var violations []string
+	v.validateValue(v.root, doc, "$", &violations)
+	return violations
+}
+
+// Validate is a convenience that compiles s and validates data in one call.
+func Validate(s anthropic.ToolInputSchemaParam, data json.RawMessage) []string {
+	v, err := NewValidator(s)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return v.Validate(data)
+}
+
+// validateValue recursively validates value against the schema node s,
+// appending any violations found to out. A $ref applies alongside the
+// node's other keywords.
+func (v *Validator) validateValue(s map[string]any, value any, path string, out *[]string) {
+	if s == nil {
+		return
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		// NewValidatorJSON checked that every ref resolves.
+		target, _ := v.resolve(ref)
+		n := len(*out)
+		v.validateValue(target, value, path, out)
+		if len(*out) > n {
+			return
+		}
+	}
+
+	if anyOf, ok := s["anyOf"].([]any); ok && len(anyOf) > 0 {
+		matched := false
+		for _, sub := range anyOf {
+			subSchema, _ := sub.(map[string]any)
+			var subViolations []string
+			v.validateValue(subSchema, value, path, &subViolations)
+			if len(subViolations) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			*out = append(*out, fmt.Sprintf("%s: does not match any of the allowed schemas", path))
+			return
+		}
+	}
+
+	if types := schemaTypes(s); len(types) > 0 {
+		actual := jsonType(value)
+		if !typeMatches(types, actual, value) {
+			*out = append(*out, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), actual))
+			return
+		}
+	}
+
+	if enum, ok := s["enum"].([]any); ok && len(enum) > 0 {
+		if !enumContains(enum, value) {
+			*out = append(*out, fmt.Sprintf("%s: value %s is not one of %s", path, formatJSON(value), formatJSON(enum)))
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		v.validateObject(s, val, path, out)
+	case []any:
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range val {
+				v.validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), out)
+			}
+		}
+	}
+}
+
+// validateObject checks required fields, declared properties, and
+// additionalProperties for an object value.
+func (v *Validator) validateObject(s map[string]any, obj map[string]any, path string, out *[]string) {
+	if required, ok := s["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := obj[name]; !present {
+				*out = append(*out, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]any)
+
+	// Iterate keys in sorted order so violations are deterministic.
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		child := path + "." + k
+		if propSchema, ok := props[k].(map[string]any); ok {
+			v.validateValue(propSchema, obj[k], child, out)
+			continue
+		}
+		switch ap := s["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				*out = append(*out, fmt.Sprintf("%s: unexpected property", child))
+			}
+		case map[string]any:
+			v.validateValue(ap, obj[k], child, out)
+		}
+	}
+}
+
+// schemaTypes returns the declared type(s) of a schema node.
+func schemaTypes(s map[string]any) []string {
+	switch t := s["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			if str, ok := v.(string); ok {
+				types = append(types, str)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// jsonType returns the JSON Schema type name of a decoded value.
+func jsonType(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := val.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// typeMatches reports whether the actual type satisfies any declared type.
+// Integers satisfy "number", and whole-valued numbers (e.g. 3.0) satisfy "integer".
+func typeMatches(declared []string, actual string, value any) bool {
+	for _, t := range declared {
+		switch {
+		case t == actual:
+			return true
+		case t == "number" && actual == "integer":
+			return true
+		case t == "integer" && actual == "number":
+			if n, ok := value.(json.Number); ok {
+				if f, err := n.Float64(); err == nil && f == math.Trunc(f) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// enumContains reports whether value equals any enum member.
+func enumContains(enum []any, value any) bool {
+	for _, e := range enum {
+		if jsonEqual(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonEqual compares two decoded JSON values, treating numbers by value.
+func jsonEqual(a, b any) bool {
+	an, aNum := toFloat(a)
+	bn, bNum := toFloat(b)
+	if aNum && bNum {
+		return an == bn
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func formatJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
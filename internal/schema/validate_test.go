@@ -0,0 +1,120 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validateAddress struct {
+	City string `json:"city" jsonschema:"required"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type validateInput struct {
+	Name    string          `json:"name" jsonschema:"required"`
+	Age     int             `json:"age" jsonschema:"required"`
+	Level   string          `json:"level,omitempty" jsonschema:"enum=low,enum=high"`
+	Tags    []string        `json:"tags,omitempty"`
+	Address validateAddress `json:"address" jsonschema:"required"`
+}
+
+func TestValidate_Valid(t *testing.T) {
+	s := Generate[validateInput]()
+	violations := Validate(s, json.RawMessage(`{"name":"a","age":3,"level":"low","tags":["x"],"address":{"city":"c"}}`))
+	assert.Empty(t, violations)
+}
+
+func TestValidate_MissingRequired(t *testing.T) {
+	s := Generate[validateInput]()
+	violations := Validate(s, json.RawMessage(`{"name":"a","address":{}}`))
+
+	assert.Contains(t, violations, `$: missing required property "age"`)
+	assert.Contains(t, violations, `$.address: missing required property "city"`)
+}
+
+func TestValidate_WrongType(t *testing.T) {
+	s := Generate[validateInput]()
+	violations := Validate(s, json.RawMessage(`{"name":1,"age":"x","tags":[1],"address":{"city":"c"}}`))
+
+	assert.Contains(t, violations, "$.name: expected string, got integer")
+	assert.Contains(t, violations, "$.age: expected integer, got string")
+	assert.Contains(t, violations, "$.tags[0]: expected string, got integer")
+}
+
+func TestValidate_IntegerAcceptsWholeNumber(t *testing.T) {
+	s := Generate[validateInput]()
+	violations := Validate(s, json.RawMessage(`{"name":"a","age":3.0,"address":{"city":"c"}}`))
+	assert.Empty(t, violations)
+
+	violations = Validate(s, json.RawMessage(`{"name":"a","age":3.5,"address":{"city":"c"}}`))
+	assert.Equal(t, []string{"$.age: expected integer, got number"}, violations)
+}
+
+func TestValidate_Enum(t *testing.T) {
+	s := Generate[validateInput]()
+	violations := Validate(s, json.RawMessage(`{"name":"a","age":1,"level":"medium","address":{"city":"c"}}`))
+
+	require.Len(t, violations, 1)
+	assert.Contains(t, violations[0], `$.level: value "medium" is not one of`)
+}
+
+func TestValidate_InvalidJSON(t *testing.T) {
+	s := Generate[validateInput]()
+	violations := Validate(s, json.RawMessage(`{not json`))
+
+	require.Len(t, violations, 1)
+	assert.Contains(t, violations[0], "invalid JSON")
+}
+
+func TestValidator_AdditionalPropertiesFalse(t *testing.T) {
+	v, err := NewValidatorJSON(json.RawMessage(`{"type":"object","properties":{"a":{"type":"string"}},"additionalProperties":false}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"$.b: unexpected property"}, v.Validate(json.RawMessage(`{"a":"x","b":1}`)))
+}
+
+func TestValidator_AnyOfNullable(t *testing.T) {
+	v, err := NewValidatorJSON(json.RawMessage(`{"type":"object","properties":{"a":{"anyOf":[{"type":"string"},{"type":"null"}]}}}`))
+	require.NoError(t, err)
+
+	assert.Empty(t, v.Validate(json.RawMessage(`{"a":null}`)))
+	assert.Empty(t, v.Validate(json.RawMessage(`{"a":"x"}`)))
+	assert.Equal(t, []string{"$.a: does not match any of the allowed schemas"}, v.Validate(json.RawMessage(`{"a":1}`)))
+}
+
+func TestValidate_LocalRefs(t *testing.T) {
+	v, err := NewValidatorJSON(json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"home": {"$ref": "#/$defs/address"},
+			"tree": {"$ref": "#/$defs/node"}
+		},
+		"$defs": {
+			"address": {"type": "object", "required": ["city"], "properties": {"city": {"type": "string"}}},
+			"node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}, "name": {"type": "string"}}}
+		}
+	}`))
+	require.NoError(t, err)
+
+	assert.Empty(t, v.Validate(json.RawMessage(`{"home":{"city":"c"},"tree":{"children":[{"name":"a"}]}}`)))
+	violations := v.Validate(json.RawMessage(`{"home":{},"tree":{"children":[{"name":1}]}}`))
+	assert.Contains(t, violations, `$.home: missing required property "city"`)
+	assert.Contains(t, violations, `$.tree.children[0].name: expected string, got integer`)
+}
+
+func TestNewValidatorJSON_RejectsBadRefs(t *testing.T) {
+	for name, doc := range map[string]string{
+		"missing":  `{"properties": {"a": {"$ref": "#/$defs/nope"}}}`,
+		"remote":   `{"properties": {"a": {"$ref": "https://example.com/a.json"}}}`,
+		"cycle":    `{"$ref": "#/$defs/a", "$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}}`,
+		"non-text": `{"properties": {"a": {"$ref": 1}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewValidatorJSON(json.RawMessage(doc))
+			assert.Error(t, err)
+		})
+	}
+}
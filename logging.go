@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
+)
+
+// Log attribute keys used on every record the SDK emits.
+const (
+	LogKeySessionID = engine.LogKeySessionID
+	LogKeyRunID     = engine.LogKeyRunID
+	LogKeyTool      = engine.LogKeyTool
+	LogKeyMember    = engine.LogKeyMember
+)
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// WithLogger sets the logger for the agent and the packages it drives (MCP,
+// subagents, teams). Errors the SDK recovers from — a hook that failed, a
+// settings file that could not be read, an MCP server that did not connect —
+// are logged at warn level; API calls and tool executions at debug level.
+// Without this option, runs started from a tool call use the caller's
+// logger, and others log nothing.
+func WithLogger(l *slog.Logger) AgentOption {
+	return func(o *agentOptions) { o.logger = l }
+}
+
+// WithLogRedaction logs tool inputs and outputs as their size only, for
+// deployments where they may contain secrets or personal data.
+func WithLogRedaction(redact bool) AgentOption {
+	return func(o *agentOptions) { o.redactToolIO = redact }
+}
+
+// Logger returns the logger set with WithLogger, or a logger that discards
+// everything. It is never nil.
+func (a *Agent) Logger() *slog.Logger {
+	if a.opts.logger != nil {
+		return a.opts.logger
+	}
+	return discardLogger
+}
+
+// contextLogger is the logger carried by a context: the base logger runs
+// started from it derive theirs from, and the attributes of the current run.
+type contextLogger struct {
+	base  *slog.Logger
+	attrs []any
+}
+
+// WithContextLogger returns a context carrying l, which runs started from it
+// log to unless configured with WithLogger.
+func WithContextLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKeyLogger, contextLogger{base: l})
+}
+
+// ContextLogger returns the logger from context, or one that discards
+// everything. Inside a tool call it is the calling run's logger, carrying
+// its session_id and run_id.
+func ContextLogger(ctx context.Context) *slog.Logger {
+	if v, ok := ctx.Value(ctxKeyLogger).(contextLogger); ok && v.base != nil {
+		return v.base.With(v.attrs...)
+	}
+	return discardLogger
+}
+
+// runLogger resolves the logger for a run and returns it with the run's
+// attributes, along with a context carrying it for tool calls. Child runs
+// derive from the same base logger, so attributes are not repeated.
+func (a *Agent) runLogger(ctx context.Context, sessionID, runID string) (context.Context, *slog.Logger) {
+	base := a.opts.logger
+	if base == nil {
+		if v, ok := ctx.Value(ctxKeyLogger).(contextLogger); ok {
+			base = v.base
+		}
+	}
+	if base == nil {
+		return ctx, discardLogger
+	}
+	attrs := []any{LogKeySessionID, sessionID, LogKeyRunID, runID}
+	return context.WithValue(ctx, ctxKeyLogger, contextLogger{base: base, attrs: attrs}), base.With(attrs...)
+}
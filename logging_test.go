@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sessionIDAttr = regexp.MustCompile(` session_id=(\S+)`)
+
+func debugLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestRun_LogsWithRunAttributesIncludingChildRuns(t *testing.T) {
+	var buf bytes.Buffer
+	child := NewAgent(WithModel("test-model"), WithProvider(&scriptedProvider{responses: []string{textResponse("child done")}}))
+	parent := NewAgent(WithLogger(debugLogger(&buf)), WithModel("test-model"),
+		WithProvider(&scriptedProvider{responses: []string{toolUseResponse("toolu_1", "Delegate"), textResponse("done")}}))
+	RegisterTool(parent.Tools(), &delegateTool{child: child})
+
+	session := NewSession()
+	stream := parent.RunWithSession(context.Background(), session, "go")
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4, buf.String()) // 3 API requests and the tool call
+	sessions := map[string]bool{}
+	for _, line := range lines {
+		// The child run logs through the parent's logger with its own
+		// attributes rather than appending them to the parent's.
+		assert.Equal(t, 1, strings.Count(line, " session_id="), line)
+		assert.Equal(t, 1, strings.Count(line, " run_id=run_"), line)
+		if m := sessionIDAttr.FindStringSubmatch(line); m != nil {
+			sessions[m[1]] = true
+		}
+	}
+	assert.Len(t, sessions, 2)
+	assert.True(t, sessions[session.ID])
+	assert.Regexp(t, `msg="tool call" session_id=\S+ run_id=\S+ tool=Delegate`, buf.String())
+}
+
+func TestNewAgent_LogsUnreadableSettingsAtWarn(t *testing.T) {
+	var buf bytes.Buffer
+	path := filepath.Join(t.TempDir(), "settings.json")
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0o644))
+
+	NewAgent(WithLogger(debugLogger(&buf)), WithSettingSources(path, filepath.Join(t.TempDir(), "missing.json")))
+
+	out := buf.String()
+	assert.Contains(t, out, `level=WARN msg="skipping unreadable settings file" path=`+path)
+	assert.NotContains(t, out, "missing.json")
+}
+
+func TestLogger_DefaultsToDiscard(t *testing.T) {
+	a := NewAgent()
+	require.NotNil(t, a.Logger())
+	assert.False(t, a.Logger().Enabled(context.Background(), slog.LevelError))
+	assert.False(t, ContextLogger(context.Background()).Enabled(context.Background(), slog.LevelError))
+}
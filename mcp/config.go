@@ -3,6 +3,12 @@
 // local ToolRegistry so the agent loop can call them transparently.
 package mcp
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
 // TransportType identifies the MCP transport protocol.
 type TransportType string
 
@@ -34,3 +40,49 @@ type ServerConfig struct {
 	// Transport selects the communication protocol.
 	Transport TransportType
 }
+
+// fileConfig is the format of an MCP configuration file, as read by the
+// Claude Code CLI's --mcp-config flag and found in .mcp.json files.
+type fileConfig struct {
+	MCPServers map[string]struct {
+		Type    string            `json:"type"`
+		Command string            `json:"command"`
+		Args    []string          `json:"args"`
+		Env     map[string]string `json:"env"`
+		URL     string            `json:"url"`
+	} `json:"mcpServers"`
+}
+
+// LoadConfigFile reads server configurations from a JSON file of the form
+//
+//	{"mcpServers": {"docs": {"command": "npx", "args": ["@context7/mcp"]},
+//	                "api":  {"type": "http", "url": "https://example.com/mcp"}}}
+//
+// A server's type is "stdio" (the default), "sse", or "http".
+func LoadConfigFile(path string) (map[string]ServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: read config: %w", err)
+	}
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("mcp: parse config %s: %w", path, err)
+	}
+
+	servers := make(map[string]ServerConfig, len(fc.MCPServers))
+	for name, s := range fc.MCPServers {
+		cfg := ServerConfig{Command: s.Command, Args: s.Args, Env: s.Env, URL: s.URL}
+		switch s.Type {
+		case "", "stdio":
+			cfg.Transport = TransportStdio
+		case "sse":
+			cfg.Transport = TransportSSE
+		case "http", string(TransportStreamableHTTP):
+			cfg.Transport = TransportStreamableHTTP
+		default:
+			return nil, fmt.Errorf("mcp: server %q: unknown type %q", name, s.Type)
+		}
+		servers[name] = cfg
+	}
+	return servers, nil
+}
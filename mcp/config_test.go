@@ -0,0 +1,44 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".mcp.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfig(t, `{"mcpServers": {
+		"docs": {"command": "npx", "args": ["@context7/mcp"], "env": {"TOKEN": "x"}},
+		"events": {"type": "sse", "url": "http://localhost:9000/sse"},
+		"api": {"type": "http", "url": "https://example.com/mcp"}
+	}}`)
+
+	servers, err := LoadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ServerConfig{
+		"docs":   {Command: "npx", Args: []string{"@context7/mcp"}, Env: map[string]string{"TOKEN": "x"}, Transport: TransportStdio},
+		"events": {URL: "http://localhost:9000/sse", Transport: TransportSSE},
+		"api":    {URL: "https://example.com/mcp", Transport: TransportStreamableHTTP},
+	}, servers)
+}
+
+func TestLoadConfigFile_Errors(t *testing.T) {
+	_, err := LoadConfigFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+
+	_, err = LoadConfigFile(writeConfig(t, `{"mcpServers":`))
+	assert.Error(t, err)
+
+	_, err = LoadConfigFile(writeConfig(t, `{"mcpServers": {"x": {"type": "websocket"}}}`))
+	assert.ErrorContains(t, err, `unknown type "websocket"`)
+}
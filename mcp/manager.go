@@ -4,8 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strings"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
 )
 
 // serverConn represents an active connection to a single MCP server.
@@ -22,28 +31,51 @@ type serverConn struct {
 type Manager struct {
 	configs map[string]ServerConfig
 	servers map[string]*serverConn
+	logger  *slog.Logger
 	mu      sync.RWMutex
 }
 
+// ManagerOption configures a Manager.
+type ManagerOption func(*Manager)
+
+// WithManagerLogger sets the logger server failures the Manager recovers
+// from are reported to, such as a server whose tool listing failed.
+func WithManagerLogger(l *slog.Logger) ManagerOption {
+	return func(m *Manager) {
+		if l != nil {
+			m.logger = l
+		}
+	}
+}
+
 // NewManager creates a Manager from the given server configurations.
 // Call Connect to establish connections.
-func NewManager(configs map[string]ServerConfig) *Manager {
+func NewManager(configs map[string]ServerConfig, opts ...ManagerOption) *Manager {
 	cfgs := make(map[string]ServerConfig, len(configs))
 	for k, v := range configs {
 		cfgs[k] = v
 	}
-	return &Manager{
+	m := &Manager{
 		configs: cfgs,
 		servers: make(map[string]*serverConn),
+		logger:  slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	return m
 }
 
 // NewManagerWithTransports creates a Manager with pre-built transports.
 // This is primarily useful for testing with mock transports.
-func NewManagerWithTransports(transports map[string]Transport) *Manager {
+func NewManagerWithTransports(transports map[string]Transport, opts ...ManagerOption) *Manager {
 	m := &Manager{
 		configs: make(map[string]ServerConfig),
 		servers: make(map[string]*serverConn),
+		logger:  slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
 	for name, t := range transports {
 		m.servers[name] = &serverConn{
@@ -83,6 +115,7 @@ func (m *Manager) Connect(ctx context.Context) error {
 		if err != nil {
 			// Non-fatal: server connected but tools listing failed.
 			// Store the connection anyway; tools may become available later.
+			m.logger.Warn("mcp server connected without tools", "server", name, "error", err)
 			tools = nil
 		}
 
@@ -121,6 +154,7 @@ func (m *Manager) ConnectWithTransports(ctx context.Context) error {
 
 		tools, err := sc.transport.ListTools(sctx)
 		if err != nil {
+			m.logger.Warn("mcp server connected without tools", "server", name, "error", err)
 			tools = nil
 		}
 
@@ -219,7 +253,29 @@ func (m *Manager) CallTool(ctx context.Context, fullName string, args map[string
 		return "", fmt.Errorf("%w: %s on server %s", ErrToolNotFound, toolName, serverName)
 	}
 
-	return sc.transport.CallTool(ctx, toolName, args)
+	// Trace the call as a child of the calling tool's span; the transport
+	// receives the span context for propagation to the server.
+	ctx, span := agent.TracerFromContext(ctx).Start(ctx, "tools/call "+toolName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.McpMethodNameToolsCall,
+			semconv.GenAIOperationNameExecuteTool,
+			semconv.GenAIToolName(toolName),
+		))
+	defer span.End()
+
+	start := time.Now()
+	out, err := sc.transport.CallTool(ctx, toolName, args)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	rec := agent.ContextMetrics(ctx)
+	server, tool := metrics.L(metrics.LabelServer, serverName), metrics.L(metrics.LabelTool, toolName)
+	rec.Observe(metrics.MCPDuration, time.Since(start).Seconds(), server, tool)
+	rec.Add(metrics.MCPCalls, 1, server, tool, metrics.L(metrics.LabelOutcome, metrics.Outcome(err != nil)))
+	return out, err
 }
 
 // CallToolRaw is like CallTool but accepts raw JSON input and parses it
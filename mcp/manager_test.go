@@ -3,10 +3,20 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/metrics/promtext"
 )
 
 // mockTransport is a Transport stub that returns canned data for testing.
@@ -318,3 +328,52 @@ func TestManager_ServerNames(t *testing.T) {
 	assert.Contains(t, names, "alpha")
 	assert.Contains(t, names, "beta")
 }
+
+func TestManager_CallTool_TracesUnderCallerSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	mock := newMockTransport([]ToolInfo{{Name: "greet"}}, nil)
+	var transportSpan trace.SpanContext
+	mock.callFn = func(ctx context.Context, _ string, _ map[string]any) (string, error) {
+		transportSpan = trace.SpanContextFromContext(ctx)
+		return "", errors.New("server gone")
+	}
+	mgr := NewManagerWithTransports(map[string]Transport{"greeter": mock})
+	require.NoError(t, mgr.ConnectWithTransports(context.Background()))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "execute_tool mcp__greeter__greet")
+	_, err := mgr.CallTool(ctx, "mcp__greeter__greet", nil)
+	parent.End()
+	require.Error(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	call := spans[0]
+	assert.Equal(t, "tools/call greet", call.Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), call.Parent.SpanID())
+	assert.Equal(t, call.SpanContext.SpanID(), transportSpan.SpanID(), "transport should receive the call span")
+	assert.Equal(t, codes.Error, call.Status.Code)
+	assert.Contains(t, call.Attributes, semconv.McpMethodNameToolsCall)
+}
+
+func TestManager_CallTool_RecordsMetrics(t *testing.T) {
+	mock := newMockTransport([]ToolInfo{{Name: "greet"}}, nil)
+	mock.callFn = func(context.Context, string, map[string]any) (string, error) {
+		return "", errors.New("server gone")
+	}
+	mgr := NewManagerWithTransports(map[string]Transport{"greeter": mock})
+	require.NoError(t, mgr.ConnectWithTransports(context.Background()))
+
+	reg := promtext.New()
+	ctx := agent.WithContextMetrics(context.Background(), reg)
+	_, err := mgr.CallTool(ctx, "mcp__greeter__greet", nil)
+	require.Error(t, err)
+
+	var out strings.Builder
+	_, err = reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `agent_mcp_calls_total{outcome="error",server="greeter",tool="greet"} 1`)
+	assert.Contains(t, out.String(), `agent_mcp_duration_seconds_count{server="greeter",tool="greet"} 1`)
+}
@@ -11,8 +11,9 @@ import (
 //
 // MCP servers are connected eagerly during Agent construction so tools are
 // available before the first Run(). Connection errors are non-fatal — servers
-// that fail to connect are silently skipped. Use the manual NewManager +
-// RegisterBridgedTools path if you need explicit error handling.
+// that fail to connect are skipped and logged at warn level to the agent's
+// logger. Use the manual NewManager + RegisterBridgedTools path if you need
+// explicit error handling.
 //
 // The Agent.Close() method will disconnect all MCP servers.
 //
@@ -29,10 +30,12 @@ func WithServers(servers map[string]ServerConfig) agent.AgentOption {
 		if len(servers) == 0 {
 			return
 		}
-		mgr := NewManager(servers)
+		mgr := NewManager(servers, WithManagerLogger(a.Logger()))
 
 		// Best-effort connect — errors are non-fatal (tools just won't appear).
-		_ = mgr.Connect(context.Background())
+		if err := mgr.Connect(context.Background()); err != nil {
+			a.Logger().Warn("mcp servers skipped", "error", err)
+		}
 
 		RegisterBridgedTools(a.Tools(), mgr)
 
@@ -52,10 +55,12 @@ func WithTransports(transports map[string]Transport) agent.AgentOption {
 		if len(transports) == 0 {
 			return
 		}
-		mgr := NewManagerWithTransports(transports)
+		mgr := NewManagerWithTransports(transports, WithManagerLogger(a.Logger()))
 
 		// Best-effort connect.
-		_ = mgr.ConnectWithTransports(context.Background())
+		if err := mgr.ConnectWithTransports(context.Background()); err != nil {
+			a.Logger().Warn("mcp servers skipped", "error", err)
+		}
 
 		RegisterBridgedTools(a.Tools(), mgr)
 
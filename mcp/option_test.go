@@ -1,8 +1,11 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -113,3 +116,40 @@ func TestWithTransports_ToolsExecutable(t *testing.T) {
 	require.NotNil(t, result)
 	assert.False(t, result.IsError)
 }
+
+// flakyTransport is a mockTransport whose Connect or ListTools fails.
+type flakyTransport struct {
+	*mockTransport
+	connectErr, listErr error
+}
+
+func (f *flakyTransport) Connect(ctx context.Context) error {
+	if f.connectErr != nil {
+		return f.connectErr
+	}
+	return f.mockTransport.Connect(ctx)
+}
+
+func (f *flakyTransport) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+	return f.mockTransport.ListTools(ctx)
+}
+
+func TestWithTransports_LogsFailedServers(t *testing.T) {
+	var buf bytes.Buffer
+	a := agent.NewAgent(
+		agent.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+		WithTransports(map[string]Transport{
+			"down":    &flakyTransport{mockTransport: newMockTransport(nil, nil), connectErr: errors.New("refused")},
+			"no-list": &flakyTransport{mockTransport: newMockTransport(nil, nil), listErr: errors.New("timeout")},
+			"ok":      newMockTransport([]ToolInfo{{Name: "search"}}, nil),
+		}),
+	)
+
+	assert.Equal(t, []string{"mcp__ok__search"}, a.Tools().Names())
+	out := buf.String()
+	assert.Contains(t, out, `level=WARN msg="mcp servers skipped" error="mcp: connect errors: down: refused"`)
+	assert.Contains(t, out, `level=WARN msg="mcp server connected without tools" server=no-list error=timeout`)
+}
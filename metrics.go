@@ -0,0 +1,17 @@
+package agent
+
+import "github.com/armatrix/claude-agent-sdk-go/metrics"
+
+// WithMetrics records metrics about the agent's runs into m: API latency,
+// token usage, cost, retries, tool calls, permission denials, hook failures,
+// compactions and active runs. Use otelmetrics or promtext from the metrics
+// package tree, or any other metrics.Metrics implementation. Without this
+// option, runs started from a tool call record into the caller's metrics.
+func WithMetrics(m metrics.Metrics) AgentOption {
+	return func(o *agentOptions) { o.metrics = m }
+}
+
+// Metrics returns the metrics set with WithMetrics, or nil.
+func (a *Agent) Metrics() metrics.Metrics {
+	return a.opts.metrics
+}
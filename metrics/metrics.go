@@ -0,0 +1,177 @@
+// Package metrics defines the metrics the SDK records about agent workloads
+// and the small Metrics interface they are recorded through.
+//
+// Two implementations are provided: otelmetrics records into an
+// OpenTelemetry Meter, and promtext keeps an in-memory registry served in
+// the Prometheus text exposition format. Install one with agent.WithMetrics;
+// runs started from a tool call (subagents, MCP calls) inherit it through the
+// context.
+package metrics
+
+// Kind is the instrument type of a metric.
+type Kind int
+
+const (
+	// KindCounter is a monotonically increasing sum.
+	KindCounter Kind = iota
+	// KindUpDownCounter is a sum that may go up and down, such as the
+	// number of runs in flight.
+	KindUpDownCounter
+	// KindGauge is a value sampled at a point in time.
+	KindGauge
+	// KindHistogram is a distribution of observed values.
+	KindHistogram
+)
+
+// Label is a key/value dimension attached to a measurement.
+type Label struct {
+	Key   string
+	Value string
+}
+
+// L is shorthand for constructing a Label.
+func L(key, value string) Label {
+	return Label{Key: key, Value: value}
+}
+
+// Metrics records measurements. Names are the constants declared in this
+// package; implementations look up the instrument kind, unit and help text
+// in Descriptors and should accept unknown names as well. Implementations
+// must be safe for concurrent use.
+type Metrics interface {
+	// Add adds delta to a counter or up-down counter.
+	Add(name string, delta float64, labels ...Label)
+	// Set records the current value of a gauge.
+	Set(name string, value float64, labels ...Label)
+	// Observe records a value into a histogram.
+	Observe(name string, value float64, labels ...Label)
+}
+
+// Nop is a Metrics that discards every measurement.
+var Nop Metrics = nop{}
+
+type nop struct{}
+
+func (nop) Add(string, float64, ...Label)     {}
+func (nop) Set(string, float64, ...Label)     {}
+func (nop) Observe(string, float64, ...Label) {}
+
+// OrNop returns m, or Nop when m is nil.
+func OrNop(m Metrics) Metrics {
+	if m == nil {
+		return Nop
+	}
+	return m
+}
+
+// Metric names.
+const (
+	// APIDuration is the latency of model requests in seconds.
+	// Labels: model, outcome.
+	APIDuration = "agent.api.duration"
+	// APIRetries counts model requests retried on the fallback model.
+	// Labels: model (the model that failed).
+	APIRetries = "agent.api.retries"
+	// Tokens counts tokens consumed. Labels: model, type.
+	Tokens = "agent.tokens"
+	// Cost is the estimated spend in USD. Labels: model.
+	Cost = "agent.cost"
+	// ActiveRuns is the number of agent runs in flight.
+	ActiveRuns = "agent.runs.active"
+	// Compactions counts context compactions. Labels: strategy.
+	Compactions = "agent.compactions"
+
+	// ToolCalls counts tool executions. Labels: tool, outcome.
+	ToolCalls = "agent.tool.calls"
+	// ToolDuration is the execution time of tools in seconds. Labels: tool.
+	ToolDuration = "agent.tool.duration"
+	// PermissionDenials counts tool calls denied by the permission policy
+	// or a PermissionRequest hook. Labels: tool.
+	PermissionDenials = "agent.permission.denials"
+	// HookFailures counts hook invocations that returned an error.
+	// Labels: event.
+	HookFailures = "agent.hook.failures"
+
+	// MCPCalls counts MCP tool calls. Labels: server, tool, outcome.
+	MCPCalls = "agent.mcp.calls"
+	// MCPDuration is the latency of MCP tool calls in seconds.
+	// Labels: server, tool.
+	MCPDuration = "agent.mcp.duration"
+
+	// SubagentRuns counts finished subagent runs. Labels: agent, outcome.
+	SubagentRuns = "agent.subagent.runs"
+	// SubagentsActive is the number of subagents running. Labels: agent.
+	SubagentsActive = "agent.subagent.active"
+
+	// TeamDeliveryFailures counts team messages that could not be
+	// delivered. Labels: member, reason.
+	TeamDeliveryFailures = "agent.team.delivery_failures"
+	// TeamInboxDepth is the number of messages waiting in a member's inbox.
+	// Labels: member.
+	TeamInboxDepth = "agent.team.inbox_depth"
+)
+
+// Label keys.
+const (
+	LabelModel    = "model"
+	LabelOutcome  = "outcome"
+	LabelType     = "type"
+	LabelTool     = "tool"
+	LabelEvent    = "event"
+	LabelStrategy = "strategy"
+	LabelServer   = "server"
+	LabelAgent    = "agent"
+	LabelMember   = "member"
+	LabelReason   = "reason"
+)
+
+// Values of the outcome label.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Values of the type label on Tokens.
+const (
+	TokenInput         = "input"
+	TokenOutput        = "output"
+	TokenCacheRead     = "cache_read"
+	TokenCacheCreation = "cache_creation"
+)
+
+// Descriptor describes a metric for implementations that need to declare
+// instruments up front.
+type Descriptor struct {
+	Kind Kind
+	Unit string // UCUM unit, e.g. "s", "{token}", "USD"
+	Help string
+}
+
+// Descriptors describes every metric the SDK records.
+var Descriptors = map[string]Descriptor{
+	APIDuration:          {KindHistogram, "s", "Latency of model requests."},
+	APIRetries:           {KindCounter, "{retry}", "Model requests retried on the fallback model."},
+	Tokens:               {KindCounter, "{token}", "Tokens consumed by model requests."},
+	Cost:                 {KindCounter, "USD", "Estimated spend on model requests."},
+	ActiveRuns:           {KindUpDownCounter, "{run}", "Agent runs in flight."},
+	Compactions:          {KindCounter, "{compaction}", "Context compactions."},
+	ToolCalls:            {KindCounter, "{call}", "Tool executions."},
+	ToolDuration:         {KindHistogram, "s", "Execution time of tools."},
+	PermissionDenials:    {KindCounter, "{call}", "Tool calls denied by permission checks."},
+	HookFailures:         {KindCounter, "{failure}", "Hook invocations that returned an error."},
+	MCPCalls:             {KindCounter, "{call}", "MCP tool calls."},
+	MCPDuration:          {KindHistogram, "s", "Latency of MCP tool calls."},
+	SubagentRuns:         {KindCounter, "{run}", "Finished subagent runs."},
+	SubagentsActive:      {KindUpDownCounter, "{run}", "Subagents running."},
+	TeamDeliveryFailures: {KindCounter, "{message}", "Team messages that could not be delivered."},
+	TeamInboxDepth:       {KindGauge, "{message}", "Messages waiting in a team member's inbox."},
+}
+
+// Outcome returns OutcomeError when failed is true, otherwise
+// OutcomeSuccess.
+func Outcome(failed bool) string {
+	if failed {
+		return OutcomeError
+	}
+	return OutcomeSuccess
+}
@@ -0,0 +1,138 @@
+// Package otelmetrics implements metrics.Metrics on an OpenTelemetry
+// MeterProvider. Counters, up-down counters, gauges and histograms map onto
+// the corresponding float64 instruments; instruments are created on first
+// use.
+//
+//	m := otelmetrics.New(otel.GetMeterProvider())
+//	a := agent.NewAgent(agent.WithMetrics(m))
+package otelmetrics
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
+)
+
+// MeterName is the instrumentation scope name of the meter used.
+const MeterName = "github.com/armatrix/claude-agent-sdk-go"
+
+// DurationBuckets are the explicit histogram boundaries, in seconds, used
+// for duration histograms. The SDK default boundaries are tuned for
+// milliseconds and would put every model request in one bucket.
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Metrics records measurements into OpenTelemetry instruments. It is safe
+// for concurrent use.
+type Metrics struct {
+	meter metric.Meter
+
+	mu          sync.Mutex
+	instruments map[string]instrument
+}
+
+// instrument is a created instrument and its kind. The kind is kept
+// because SDK instruments implement every instrument interface.
+type instrument struct {
+	kind metrics.Kind
+	inst any // Nil if the meter rejected the instrument
+}
+
+var _ metrics.Metrics = (*Metrics)(nil)
+
+// New creates a Metrics recording through a meter of mp.
+func New(mp metric.MeterProvider) *Metrics {
+	return NewWithMeter(mp.Meter(MeterName))
+}
+
+// NewWithMeter creates a Metrics recording through meter.
+func NewWithMeter(meter metric.Meter) *Metrics {
+	return &Metrics{meter: meter, instruments: make(map[string]instrument)}
+}
+
+// Add implements metrics.Metrics.
+func (m *Metrics) Add(name string, delta float64, labels ...metrics.Label) {
+	i := m.instrument(name, metrics.KindCounter)
+	opt := metric.WithAttributeSet(attributes(labels))
+	switch i.kind {
+	case metrics.KindCounter:
+		if c, ok := i.inst.(metric.Float64Counter); ok {
+			c.Add(context.Background(), delta, opt)
+		}
+	case metrics.KindUpDownCounter:
+		if c, ok := i.inst.(metric.Float64UpDownCounter); ok {
+			c.Add(context.Background(), delta, opt)
+		}
+	}
+}
+
+// Set implements metrics.Metrics.
+func (m *Metrics) Set(name string, value float64, labels ...metrics.Label) {
+	i := m.instrument(name, metrics.KindGauge)
+	if g, ok := i.inst.(metric.Float64Gauge); ok && i.kind == metrics.KindGauge {
+		g.Record(context.Background(), value, metric.WithAttributeSet(attributes(labels)))
+	}
+}
+
+// Observe implements metrics.Metrics.
+func (m *Metrics) Observe(name string, value float64, labels ...metrics.Label) {
+	i := m.instrument(name, metrics.KindHistogram)
+	if h, ok := i.inst.(metric.Float64Histogram); ok && i.kind == metrics.KindHistogram {
+		h.Record(context.Background(), value, metric.WithAttributeSet(attributes(labels)))
+	}
+}
+
+// instrument returns the instrument for name, creating it on first use.
+// fallback is the kind assumed for names without a descriptor.
+func (m *Metrics) instrument(name string, fallback metrics.Kind) instrument {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if inst, ok := m.instruments[name]; ok {
+		return inst
+	}
+
+	desc, ok := metrics.Descriptors[name]
+	if !ok {
+		desc = metrics.Descriptor{Kind: fallback}
+	}
+	var (
+		inst any
+		err  error
+	)
+	switch desc.Kind {
+	case metrics.KindCounter:
+		inst, err = m.meter.Float64Counter(name,
+			metric.WithDescription(desc.Help), metric.WithUnit(desc.Unit))
+	case metrics.KindUpDownCounter:
+		inst, err = m.meter.Float64UpDownCounter(name,
+			metric.WithDescription(desc.Help), metric.WithUnit(desc.Unit))
+	case metrics.KindGauge:
+		inst, err = m.meter.Float64Gauge(name,
+			metric.WithDescription(desc.Help), metric.WithUnit(desc.Unit))
+	case metrics.KindHistogram:
+		opts := []metric.Float64HistogramOption{
+			metric.WithDescription(desc.Help), metric.WithUnit(desc.Unit),
+		}
+		if desc.Unit == "s" {
+			opts = append(opts, metric.WithExplicitBucketBoundaries(DurationBuckets...))
+		}
+		inst, err = m.meter.Float64Histogram(name, opts...)
+	}
+	if err != nil {
+		inst = nil
+	}
+	i := instrument{kind: desc.Kind, inst: inst}
+	m.instruments[name] = i
+	return i
+}
+
+func attributes(labels []metrics.Label) attribute.Set {
+	kvs := make([]attribute.KeyValue, len(labels))
+	for i, l := range labels {
+		kvs[i] = attribute.String(l.Key, l.Value)
+	}
+	return attribute.NewSet(kvs...)
+}
@@ -0,0 +1,81 @@
+package otelmetrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
+)
+
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	out := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		assert.Equal(t, MeterName, sm.Scope.Name)
+		for _, m := range sm.Metrics {
+			out[m.Name] = m
+		}
+	}
+	return out
+}
+
+func TestMetrics_RecordsInstruments(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	model := metrics.L(metrics.LabelModel, "claude")
+	m.Add(metrics.Tokens, 100, model, metrics.L(metrics.LabelType, metrics.TokenInput))
+	m.Add(metrics.Tokens, 50, model, metrics.L(metrics.LabelType, metrics.TokenInput))
+	m.Add(metrics.ActiveRuns, 1)
+	m.Add(metrics.ActiveRuns, 1)
+	m.Add(metrics.ActiveRuns, -1)
+	m.Set(metrics.TeamInboxDepth, 4, metrics.L(metrics.LabelMember, "lead"))
+	m.Observe(metrics.APIDuration, 1.5, model, metrics.L(metrics.LabelOutcome, metrics.OutcomeSuccess))
+	m.Observe(metrics.APIDuration, 0.5, model, metrics.L(metrics.LabelOutcome, metrics.OutcomeSuccess))
+
+	got := collect(t, reader)
+
+	tokens := got[metrics.Tokens]
+	assert.Equal(t, "{token}", tokens.Unit)
+	sum := tokens.Data.(metricdata.Sum[float64])
+	assert.True(t, sum.IsMonotonic)
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, 150.0, sum.DataPoints[0].Value)
+	typ, _ := sum.DataPoints[0].Attributes.Value(attribute.Key(metrics.LabelType))
+	assert.Equal(t, metrics.TokenInput, typ.AsString())
+
+	active := got[metrics.ActiveRuns].Data.(metricdata.Sum[float64])
+	assert.False(t, active.IsMonotonic)
+	assert.Equal(t, 1.0, active.DataPoints[0].Value)
+
+	depth := got[metrics.TeamInboxDepth].Data.(metricdata.Gauge[float64])
+	assert.Equal(t, 4.0, depth.DataPoints[0].Value)
+
+	latency := got[metrics.APIDuration]
+	assert.Equal(t, "s", latency.Unit)
+	hist := latency.Data.(metricdata.Histogram[float64])
+	require.Len(t, hist.DataPoints, 1)
+	assert.Equal(t, uint64(2), hist.DataPoints[0].Count)
+	assert.Equal(t, 2.0, hist.DataPoints[0].Sum)
+	assert.Equal(t, DurationBuckets, hist.DataPoints[0].Bounds)
+}
+
+func TestMetrics_UnknownNames(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	m.Add("custom.count", 3)
+	m.Set(metrics.ToolCalls, 9) // Counter: gauge values are ignored
+
+	got := collect(t, reader)
+	assert.Equal(t, 3.0, got["custom.count"].Data.(metricdata.Sum[float64]).DataPoints[0].Value)
+	assert.NotContains(t, got, metrics.ToolCalls)
+}
@@ -0,0 +1,279 @@
+// Package promtext implements metrics.Metrics with an in-memory registry
+// served in the Prometheus text exposition format, for deployments that
+// scrape Prometheus without running an OpenTelemetry pipeline.
+//
+//	reg := promtext.New()
+//	a := agent.NewAgent(agent.WithMetrics(reg))
+//	http.Handle("/metrics", reg)
+package promtext
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
+)
+
+// ContentType is the Content-Type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the histogram upper bounds, in seconds, used unless
+// WithBuckets is given. They span fast tool calls to long model requests.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Option configures a Registry.
+type Option func(*Registry)
+
+// WithBuckets sets the histogram bucket upper bounds.
+func WithBuckets(buckets []float64) Option {
+	return func(r *Registry) {
+		r.buckets = slices.Sorted(slices.Values(buckets))
+	}
+}
+
+// WithNamespace prefixes every exposed metric name with ns and an underscore.
+func WithNamespace(ns string) Option {
+	return func(r *Registry) { r.namespace = ns }
+}
+
+// Registry accumulates measurements and renders them as Prometheus text.
+// It implements metrics.Metrics and http.Handler and is safe for
+// concurrent use.
+type Registry struct {
+	buckets   []float64
+	namespace string
+
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+var _ metrics.Metrics = (*Registry)(nil)
+
+// family holds every labelled series of one metric.
+type family struct {
+	kind   metrics.Kind
+	desc   metrics.Descriptor
+	series map[string]*series
+}
+
+type series struct {
+	labels  []metrics.Label // Sorted by key
+	value   float64         // Counter or gauge value
+	counts  []uint64        // Per-bucket counts (not cumulative)
+	sum     float64
+	samples uint64
+}
+
+// New creates an empty Registry.
+func New(opts ...Option) *Registry {
+	r := &Registry{
+		buckets:  DefaultBuckets,
+		families: make(map[string]*family),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Add implements metrics.Metrics.
+func (r *Registry) Add(name string, delta float64, labels ...metrics.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, metrics.KindCounter, labels).value += delta
+}
+
+// Set implements metrics.Metrics.
+func (r *Registry) Set(name string, value float64, labels ...metrics.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, metrics.KindGauge, labels).value = value
+}
+
+// Observe implements metrics.Metrics.
+func (r *Registry) Observe(name string, value float64, labels ...metrics.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.series(name, metrics.KindHistogram, labels)
+	if s.counts == nil {
+		return // name is not a histogram
+	}
+	i, _ := slices.BinarySearch(r.buckets, value)
+	s.counts[i]++
+	s.sum += value
+	s.samples++
+}
+
+// series returns the series for name and labels, creating it if needed.
+// fallback is the kind assumed for names without a descriptor. r.mu must
+// be held.
+func (r *Registry) series(name string, fallback metrics.Kind, labels []metrics.Label) *series {
+	f, ok := r.families[name]
+	if !ok {
+		desc, known := metrics.Descriptors[name]
+		if !known {
+			desc = metrics.Descriptor{Kind: fallback}
+		}
+		f = &family{kind: desc.Kind, desc: desc, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+
+	sorted := slices.Clone(labels)
+	slices.SortFunc(sorted, func(a, b metrics.Label) int { return strings.Compare(a.Key, b.Key) })
+	key := formatLabels(sorted)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: sorted}
+		if f.kind == metrics.KindHistogram {
+			s.counts = make([]uint64, len(r.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP writes the current metrics in the text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = r.WriteTo(w)
+}
+
+// WriteTo writes the current metrics in the text exposition format. Metric
+// and series order is deterministic.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	r.mu.Lock()
+	names := slices.Sorted(maps.Keys(r.families))
+	for _, name := range names {
+		r.writeFamily(bw, name, r.families[name])
+	}
+	r.mu.Unlock()
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (r *Registry) writeFamily(w *bufio.Writer, name string, f *family) {
+	promName := r.exposedName(name, f)
+	typ := "gauge"
+	switch f.kind {
+	case metrics.KindCounter:
+		typ = "counter"
+	case metrics.KindHistogram:
+		typ = "histogram"
+	}
+	if f.desc.Help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", promName, escapeHelp(f.desc.Help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", promName, typ)
+
+	for _, key := range slices.Sorted(maps.Keys(f.series)) {
+		s := f.series[key]
+		if f.kind != metrics.KindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", promName, key, formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, le := range r.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", promName,
+				formatLabels(append(slices.Clip(s.labels), metrics.L("le", formatFloat(le)))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", promName,
+			formatLabels(append(slices.Clip(s.labels), metrics.L("le", "+Inf"))), s.samples)
+		fmt.Fprintf(w, "%s_sum%s %s\n", promName, key, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", promName, key, s.samples)
+	}
+}
+
+// exposedName converts a dotted metric name to a Prometheus name, adding
+// the unit suffix and, for counters, the _total suffix.
+func (r *Registry) exposedName(name string, f *family) string {
+	n := sanitizeName(name)
+	if r.namespace != "" {
+		n = sanitizeName(r.namespace) + "_" + n
+	}
+	switch f.desc.Unit {
+	case "s":
+		n += "_seconds"
+	case "USD":
+		n += "_usd"
+	}
+	if f.kind == metrics.KindCounter {
+		n += "_total"
+	}
+	return n
+}
+
+// sanitizeName replaces characters not allowed in metric names.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// formatLabels renders labels as {k="v",...}, or "" when there are none.
+func formatLabels(labels []metrics.Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(sanitizeName(l.Key))
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(l.Value))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(v string) string { return labelValueEscaper.Replace(v) }
+func escapeHelp(v string) string       { return helpEscaper.Replace(v) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
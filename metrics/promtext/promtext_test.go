@@ -0,0 +1,88 @@
+package promtext
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+	var sb strings.Builder
+	n, err := r.WriteTo(&sb)
+	require.NoError(t, err)
+	assert.Equal(t, int64(sb.Len()), n)
+	return sb.String()
+}
+
+func TestRegistry_Exposition(t *testing.T) {
+	r := New(WithBuckets([]float64{1, 0.1}))
+
+	tool := metrics.L(metrics.LabelTool, "Read")
+	r.Add(metrics.ToolCalls, 1, tool, metrics.L(metrics.LabelOutcome, metrics.OutcomeSuccess))
+	r.Add(metrics.ToolCalls, 2, metrics.L(metrics.LabelOutcome, metrics.OutcomeSuccess), tool)
+	r.Add(metrics.ActiveRuns, 1)
+	r.Add(metrics.ActiveRuns, -1)
+	r.Set(metrics.TeamInboxDepth, 3, metrics.L(metrics.LabelMember, `a"b`))
+	r.Observe(metrics.ToolDuration, 0.05, tool)
+	r.Observe(metrics.ToolDuration, 0.5, tool)
+	r.Observe(metrics.ToolDuration, 5, tool)
+	r.Add(metrics.Cost, 0.25, metrics.L(metrics.LabelModel, "m"))
+
+	assert.Equal(t, `# HELP agent_cost_usd_total Estimated spend on model requests.
+# TYPE agent_cost_usd_total counter
+agent_cost_usd_total{model="m"} 0.25
+# HELP agent_runs_active Agent runs in flight.
+# TYPE agent_runs_active gauge
+agent_runs_active 0
+# HELP agent_team_inbox_depth Messages waiting in a team member's inbox.
+# TYPE agent_team_inbox_depth gauge
+agent_team_inbox_depth{member="a\"b"} 3
+# HELP agent_tool_calls_total Tool executions.
+# TYPE agent_tool_calls_total counter
+agent_tool_calls_total{outcome="success",tool="Read"} 3
+# HELP agent_tool_duration_seconds Execution time of tools.
+# TYPE agent_tool_duration_seconds histogram
+agent_tool_duration_seconds_bucket{tool="Read",le="0.1"} 1
+agent_tool_duration_seconds_bucket{tool="Read",le="1"} 2
+agent_tool_duration_seconds_bucket{tool="Read",le="+Inf"} 3
+agent_tool_duration_seconds_sum{tool="Read"} 5.55
+agent_tool_duration_seconds_count{tool="Read"} 3
+`, render(t, r))
+}
+
+func TestRegistry_UnknownNamesAndNamespace(t *testing.T) {
+	r := New(WithNamespace("myapp"))
+	r.Add("custom.events", 2)
+	r.Set("custom.level", 7)
+	r.Observe(metrics.ToolCalls, 1) // Counter: observations are ignored
+
+	out := render(t, r)
+	assert.Contains(t, out, "# TYPE myapp_custom_events_total counter\nmyapp_custom_events_total 2\n")
+	assert.Contains(t, out, "# TYPE myapp_custom_level gauge\nmyapp_custom_level 7\n")
+	assert.NotContains(t, out, "# HELP myapp_custom")
+	assert.Contains(t, out, "myapp_agent_tool_calls_total 0\n")
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := New()
+	r.Add(metrics.Compactions, 1, metrics.L(metrics.LabelStrategy, "server"))
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, ContentType, resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), `agent_compactions_total{strategy="server"} 1`)
+}
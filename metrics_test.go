@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics/promtext"
+)
+
+func exposition(t *testing.T, reg *promtext.Registry) string {
+	t.Helper()
+	var sb strings.Builder
+	_, err := reg.WriteTo(&sb)
+	require.NoError(t, err)
+	return sb.String()
+}
+
+func TestRun_RecordsMetricsIncludingChildRuns(t *testing.T) {
+	reg := promtext.New()
+	child := NewAgent(WithModel("test-model"), WithProvider(&scriptedProvider{responses: []string{textResponse("child done")}}))
+	parent := NewAgent(WithMetrics(reg), WithModel("test-model"),
+		WithProvider(&scriptedProvider{responses: []string{toolUseResponse("toolu_1", "Delegate"), textResponse("done")}}))
+	RegisterTool(parent.Tools(), &delegateTool{child: child})
+
+	stream := parent.Run(context.Background(), "go")
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+
+	out := exposition(t, reg)
+	// The child run records into the parent's metrics through the context.
+	assert.Contains(t, out, `agent_api_duration_seconds_count{model="test-model",outcome="success"} 3`)
+	assert.Contains(t, out, `agent_tokens_total{model="test-model",type="input"} 30`)
+	assert.Contains(t, out, `agent_tokens_total{model="test-model",type="output"} 15`)
+	assert.Contains(t, out, `agent_tool_calls_total{outcome="success",tool="Delegate"} 1`)
+	assert.Contains(t, out, `agent_tool_duration_seconds_count{tool="Delegate"} 1`)
+	assert.Contains(t, out, "agent_runs_active 0\n")
+}
+
+func TestToolRegistry_Execute_RecordsMetrics(t *testing.T) {
+	reg := promtext.New()
+	ctx := WithContextMetrics(context.Background(), reg)
+	r := NewToolRegistry()
+	RegisterTool(r, &stubTool{name: "echo"})
+
+	_, err := r.Execute(ctx, "echo", []byte(`{"text":"hi"}`))
+	require.NoError(t, err)
+	result, err := r.Execute(ctx, "echo", []byte(`[1]`))
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	_, err = r.Execute(ctx, "missing", []byte(`{}`))
+	require.Error(t, err)
+
+	out := exposition(t, reg)
+	assert.Contains(t, out, `agent_tool_calls_total{outcome="success",tool="echo"} 1`)
+	assert.Contains(t, out, `agent_tool_calls_total{outcome="error",tool="echo"} 1`)
+	assert.Contains(t, out, `agent_tool_duration_seconds_count{tool="echo"} 2`)
+	assert.Contains(t, out, `agent_tool_calls_total{outcome="not_found",tool="missing"} 1`)
+	assert.NotContains(t, out, `agent_tool_duration_seconds_count{tool="missing"}`)
+}
@@ -1,11 +1,21 @@
 package agent
 
 import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/armatrix/claude-agent-sdk-go/checkpoint"
 	"github.com/armatrix/claude-agent-sdk-go/hook"
+	"github.com/armatrix/claude-agent-sdk-go/internal/budget"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
 	"github.com/armatrix/claude-agent-sdk-go/permission"
 )
 
@@ -52,8 +62,13 @@ type agentOptions struct {
 	maxTurns          int
 	maxThinkingTokens int64
 	maxBudget         decimal.Decimal
+	pricing           map[anthropic.Model]ModelPricing
+	sharedBudget      *Budget
+	budgetPolicy      *BudgetPolicy
 	compact           CompactConfig
 	streamBufferSize  int
+	streamOverflow    OverflowPolicy
+	queryPolicy       QueryPolicy
 	betas             []string
 
 	// System prompt injected before conversation.
@@ -66,8 +81,11 @@ type agentOptions struct {
 	toolSearch          bool
 	toolSearchThreshold float64
 
-	// Session store for persistence.
-	sessionStore SessionStore
+	// Session store for persistence, and when runs save to it.
+	sessionStore     SessionStore
+	autoSave         AutoSavePolicy
+	autoSaveInterval time.Duration
+	autoTitleModel   anthropic.Model
 
 	// Structured output format. Zero value means no structured output.
 	outputFormat *OutputFormat
@@ -92,6 +110,32 @@ type agentOptions struct {
 	// Environment variables merged into tool execution context.
 	env map[string]string
 
+	// Checkpointer recording files before tool calls change them. Nil
+	// disables checkpoints.
+	checkpointer checkpoint.Checkpointer
+
+	// Name reported on the agent's spans.
+	name string
+
+	// Tracer provider for run, API call and tool spans. Nil means the
+	// provider of the span in the run's context, then the global provider.
+	tracerProvider trace.TracerProvider
+
+	// Metrics recorder for runs and tool calls. Nil means the metrics in the
+	// run's context, if any.
+	metrics metrics.Metrics
+
+	// Logger for recovered errors, API calls and tool executions. Nil means
+	// the logger in the run's context, if any.
+	logger *slog.Logger
+
+	// Log tool inputs and outputs as their size only.
+	redactToolIO bool
+
+	// Provider serving model requests instead of the Anthropic API. Nil means
+	// the Anthropic client built from clientOptions.
+	provider Provider
+
 	// Anthropic client options (auth provider, base URL, etc.).
 	// Passed directly to anthropic.NewClient().
 	clientOptions []option.RequestOption
@@ -100,6 +144,9 @@ type agentOptions struct {
 	// use these to inject setup logic without import cycles.
 	onInit []func(*Agent)
 
+	// Callbacks releasing per-session resources when a session ends.
+	onSessionClose []func(ctx context.Context, sessionID string) error
+
 	// Fallback model used when the primary model returns overloaded/unavailable.
 	fallbackModel anthropic.Model
 
@@ -144,9 +191,15 @@ func (o *agentOptions) applyDefaults() {
 	if o.compact.PreserveLastN == 0 {
 		o.compact.PreserveLastN = 2
 	}
-	if o.streamBufferSize == 0 {
+	if o.streamBufferSize <= 0 {
 		o.streamBufferSize = DefaultStreamBufferSize
 	}
+	if o.pricing == nil {
+		o.pricing = budget.DefaultPricing
+	}
+	if o.autoSaveInterval == 0 {
+		o.autoSaveInterval = DefaultAutoSaveInterval
+	}
 }
 
 // resolveOptions applies all option functions and fills defaults.
@@ -198,10 +251,39 @@ func WithBetas(betas ...string) AgentOption {
 // --- Budget ---
 
 // WithBudget sets the maximum budget in USD for a run. Zero means unlimited.
+// For batches (see Agent.RunBatch) it limits all of the agent's batches
+// together.
 func WithBudget(maxUSD decimal.Decimal) AgentOption {
 	return func(o *agentOptions) { o.maxBudget = maxUSD }
 }
 
+// WithSharedBudget makes every run of the agent draw from b. Agents, forks,
+// subagents and team members given the same Budget (or children of it) share
+// one limit. WithBudget, if also set, caps each run within b.
+func WithSharedBudget(b *Budget) AgentOption {
+	return func(o *agentOptions) { o.sharedBudget = b }
+}
+
+// WithBudgetPolicy configures warnings, a wrap-up note, a model downgrade and
+// per-tool-call ceilings as a run consumes its budget.
+func WithBudgetPolicy(policy BudgetPolicy) AgentOption {
+	return func(o *agentOptions) { o.budgetPolicy = &policy }
+}
+
+// ModelPricing holds per-model token prices in USD per million tokens.
+type ModelPricing = budget.ModelPricing
+
+// WithPricing overrides the per-model prices used for cost reporting and
+// budget enforcement. Models not listed keep their built-in pricing.
+func WithPricing(pricing map[anthropic.Model]ModelPricing) AgentOption {
+	return func(o *agentOptions) {
+		merged := make(map[anthropic.Model]ModelPricing, len(budget.DefaultPricing)+len(pricing))
+		maps.Copy(merged, budget.DefaultPricing)
+		maps.Copy(merged, pricing)
+		o.pricing = merged
+	}
+}
+
 // --- Compaction ---
 
 // WithCompaction sets the full compaction configuration.
@@ -271,10 +353,57 @@ func WithSessionStore(store SessionStore) AgentOption {
 	return func(o *agentOptions) { o.sessionStore = store }
 }
 
+// WithAutoSave sets when runs save their session to the session store.
+// Default: AutoSaveEveryTurn.
+func WithAutoSave(policy AutoSavePolicy) AgentOption {
+	return func(o *agentOptions) { o.autoSave = policy }
+}
+
+// WithAutoSaveInterval sets the shortest time between two saves within a
+// run with AutoSaveEveryTurn; saves skipped in between are made at the end
+// of the run. Negative saves on every turn. Default: DefaultAutoSaveInterval.
+func WithAutoSaveInterval(d time.Duration) AgentOption {
+	return func(o *agentOptions) { o.autoSaveInterval = d }
+}
+
+// WithAutoTitle has runs give an untitled session a title, generated by
+// model from its first exchange when a run succeeds. The title is
+// generated while the ResultEvent is delivered, and set before the stream
+// ends, when the session is saved again. Its tokens and cost count towards
+// the session, the budget and the metrics like the run's own. A cheap
+// model such as Haiku suffices. Default: disabled.
+func WithAutoTitle(model anthropic.Model) AgentOption {
+	return func(o *agentOptions) { o.autoTitleModel = model }
+}
+
+// --- Streaming ---
+
+// WithStreamBufferSize sets how many events an AgentStream buffers ahead
+// of its consumer. Default: DefaultStreamBufferSize.
+func WithStreamBufferSize(n int) AgentOption {
+	return func(o *agentOptions) { o.streamBufferSize = n }
+}
+
+// WithStreamOverflow sets what happens to text deltas when the stream's
+// buffer is full. Default: OverflowBlock.
+func WithStreamOverflow(policy OverflowPolicy) AgentOption {
+	return func(o *agentOptions) { o.streamOverflow = policy }
+}
+
+// --- Client ---
+
+// WithQueryPolicy sets what a Client does with a query started while
+// another is running. Default: QueryQueue.
+func WithQueryPolicy(policy QueryPolicy) AgentOption {
+	return func(o *agentOptions) { o.queryPolicy = policy }
+}
+
 // --- Structured Output ---
 
 // WithOutputFormat sets a structured output format.
 // The agent will inject a hidden tool and force tool_choice to extract structured data.
+// Runs with a schema the agent cannot validate against fail with
+// ErrOutputSchema before calling the model.
 func WithOutputFormat(format OutputFormat) AgentOption {
 	return func(o *agentOptions) { o.outputFormat = &format }
 }
@@ -323,6 +452,15 @@ func WithHooks(matchers ...hook.Matcher) AgentOption {
 	return func(o *agentOptions) { o.hookMatchers = matchers }
 }
 
+// WithAdditionalHooks adds hook matchers to those registered so far, for
+// code that wraps an agent and needs its own hooks next to the caller's.
+// A later WithHooks replaces them too.
+func WithAdditionalHooks(matchers ...hook.Matcher) AgentOption {
+	return func(o *agentOptions) {
+		o.hookMatchers = append(slices.Clip(o.hookMatchers), matchers...)
+	}
+}
+
 // --- Permissions ---
 
 // WithPermissionMode sets the permission mode for tool access control.
@@ -384,6 +522,23 @@ func WithEnv(env map[string]string) AgentOption {
 	return func(o *agentOptions) { o.env = env }
 }
 
+// --- Checkpoints ---
+
+// WithCheckpointer has tool calls record the files they change in c, so
+// they can be listed, diffed and rewound through a Client. The built-in
+// Write, Edit and NotebookEdit tools record each file before changing it.
+// checkpoint.ForWorkDir snapshots the whole working directory instead,
+// covering files changed by Bash.
+func WithCheckpointer(c checkpoint.Checkpointer) AgentOption {
+	return func(o *agentOptions) { o.checkpointer = c }
+}
+
+// WithFileCheckpointing records files in memory before tool calls change
+// them; see WithCheckpointer.
+func WithFileCheckpointing() AgentOption {
+	return func(o *agentOptions) { o.checkpointer = checkpoint.NewHistory() }
+}
+
 // --- Client Options (Authentication) ---
 
 // WithClientOptions sets raw anthropic-sdk-go request options.
@@ -437,3 +592,14 @@ func WithOnInit(fn func(*Agent)) AgentOption {
 		o.onInit = append(o.onInit, fn)
 	}
 }
+
+// WithOnSessionClose registers a callback that runs when a session ends:
+// after a Run, whose session is new, and when a Client is closed. Tools
+// holding resources per session release them from it, as
+// tools.ShellPool.CloseSession does for shells. Callbacks are executed in
+// registration order.
+func WithOnSessionClose(fn func(ctx context.Context, sessionID string) error) AgentOption {
+	return func(o *agentOptions) {
+		o.onSessionClose = append(o.onSessionClose, fn)
+	}
+}
@@ -62,6 +62,21 @@ func TestWithBudget(t *testing.T) {
 	assert.True(t, budget.Equal(opts.maxBudget))
 }
 
+func TestWithPricing_MergesOverDefaults(t *testing.T) {
+	custom := ModelPricing{InputPerMTok: decimal.NewFromInt(1), OutputPerMTok: decimal.NewFromInt(2)}
+	opts := resolveOptions([]AgentOption{
+		WithPricing(map[anthropic.Model]ModelPricing{"my-model": custom}),
+	})
+
+	assert.True(t, custom.InputPerMTok.Equal(opts.pricing["my-model"].InputPerMTok))
+	assert.Contains(t, opts.pricing, anthropic.ModelClaudeOpus4_6, "built-in prices should remain")
+}
+
+func TestPricing_DefaultsToBuiltin(t *testing.T) {
+	opts := resolveOptions(nil)
+	assert.Contains(t, opts.pricing, anthropic.ModelClaudeSonnet4_5)
+}
+
 func TestWithCompaction(t *testing.T) {
 	config := CompactConfig{
 		Strategy:          CompactClient,
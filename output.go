@@ -10,12 +10,36 @@ import (
 	"github.com/armatrix/claude-agent-sdk-go/internal/schema"
 )
 
-// OutputFormat defines a structured output format using the hidden tool pattern.
-// The Anthropic API achieves structured output by injecting a hidden tool with
-// the desired JSON schema and forcing tool_choice to that tool.
+// OutputMode selects how structured output is obtained from the model.
+type OutputMode string
+
+const (
+	// OutputModeHiddenTool injects a hidden tool with the desired JSON schema
+	// and forces tool_choice to that tool. This is the default.
+	OutputModeHiddenTool OutputMode = "hidden_tool"
+
+	// OutputModeNative uses constrained decoding via the beta output_format
+	// parameter. The model may use its normal tools during the run, and the
+	// text of the final response is parsed as the structured output.
+	OutputModeNative OutputMode = "native"
+)
+
+// OutputFormat defines a structured output format. By default it uses the
+// hidden tool pattern: a hidden tool with the desired JSON schema is injected
+// and tool_choice is forced to that tool. Set Mode to OutputModeNative to use
+// the API's constrained decoding instead.
 type OutputFormat struct {
 	Name   string                        // Tool name (e.g., "structured_output")
 	Schema anthropic.ToolInputSchemaParam // JSON Schema for the output
+
+	// Mode selects hidden-tool or native structured output. The zero value
+	// means OutputModeHiddenTool.
+	Mode OutputMode
+
+	// MaxRetries is how many times the model may re-submit output that fails
+	// schema validation. Zero uses DefaultStructuredOutputRetries; a negative
+	// value disables retries so the first invalid output ends the run.
+	MaxRetries int
 }
 
 // NewOutputFormat creates an OutputFormat with the given name and schema.
@@ -32,6 +56,33 @@ func NewOutputFormatType[T any](name string) OutputFormat {
 	}
 }
 
+// maxRetries resolves the effective retry limit for schema validation failures.
+func (f OutputFormat) maxRetries() int {
+	switch {
+	case f.MaxRetries < 0:
+		return 0
+	case f.MaxRetries == 0:
+		return DefaultStructuredOutputRetries
+	default:
+		return f.MaxRetries
+	}
+}
+
+// validator compiles the format's schema. A schema that does not compile,
+// such as one with a $ref that does not resolve, fails with ErrOutputSchema.
+func (f OutputFormat) validator() (*schema.Validator, error) {
+	v, err := schema.NewValidator(f.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOutputSchema, err)
+	}
+	return v, nil
+}
+
+// native reports whether the format uses native constrained decoding.
+func (f OutputFormat) native() bool {
+	return f.Mode == OutputModeNative
+}
+
 // injectOutputTool adds the hidden structured_output tool to the tool list
 // and sets tool_choice to force its use.
 func injectOutputTool(params *anthropic.MessageNewParams, format OutputFormat) {
@@ -60,6 +111,32 @@ func ExtractStructuredOutput(msg anthropic.Message, toolName string) (json.RawMe
 	return nil, fmt.Errorf("structured output tool %q not found in response", toolName)
 }
 
+// ExtractNativeStructuredOutput extracts the structured output produced in
+// native mode, which is the text of the final assistant message: its text
+// blocks concatenated, as the run's result reads it.
+func ExtractNativeStructuredOutput(msg anthropic.Message) (json.RawMessage, error) {
+	for _, block := range msg.Content {
+		if block.Type == "text" {
+			return json.RawMessage(finalMessageText(msg)), nil
+		}
+	}
+	return nil, fmt.Errorf("structured output text not found in response")
+}
+
+// ExtractNativeStructuredOutputTyped extracts and unmarshals native-mode
+// structured output into type T.
+func ExtractNativeStructuredOutputTyped[T any](msg anthropic.Message) (*T, error) {
+	raw, err := ExtractNativeStructuredOutput(msg)
+	if err != nil {
+		return nil, err
+	}
+	var result T
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal structured output: %w", err)
+	}
+	return &result, nil
+}
+
 // ExtractStructuredOutputTyped extracts and unmarshals structured output into type T.
 func ExtractStructuredOutputTyped[T any](msg anthropic.Message, toolName string) (*T, error) {
 	raw, err := ExtractStructuredOutput(msg, toolName)
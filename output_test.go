@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -162,3 +163,70 @@ func TestWithOutputFormatType_Option(t *testing.T) {
 	require.NotNil(t, agent.opts.outputFormat)
 	assert.Equal(t, "typed_test", agent.opts.outputFormat.Name)
 }
+
+func TestOutputFormat_MaxRetries(t *testing.T) {
+	format := NewOutputFormatType[testOutputStruct]("out")
+	assert.Equal(t, DefaultStructuredOutputRetries, format.maxRetries())
+
+	format.MaxRetries = 5
+	assert.Equal(t, 5, format.maxRetries())
+
+	format.MaxRetries = -1
+	assert.Equal(t, 0, format.maxRetries())
+}
+
+func TestOutputFormat_Mode(t *testing.T) {
+	format := NewOutputFormatType[testOutputStruct]("out")
+	assert.False(t, format.native(), "zero mode should default to hidden tool")
+
+	format.Mode = OutputModeHiddenTool
+	assert.False(t, format.native())
+
+	format.Mode = OutputModeNative
+	assert.True(t, format.native())
+}
+
+func TestExtractNativeStructuredOutputTyped(t *testing.T) {
+	// The output may be split across text blocks.
+	msg := anthropic.Message{
+		Content: []anthropic.ContentBlockUnion{
+			{Type: "thinking", Thinking: "thinking out loud"},
+			{Type: "text", Text: `{"name":"Carol",`},
+			{Type: "text", Text: `"score":7}`},
+		},
+	}
+
+	result, err := ExtractNativeStructuredOutputTyped[testOutputStruct](msg)
+	require.NoError(t, err)
+	assert.Equal(t, "Carol", result.Name)
+	assert.Equal(t, 7, result.Score)
+}
+
+func TestExtractNativeStructuredOutput_NoText(t *testing.T) {
+	_, err := ExtractNativeStructuredOutput(anthropic.Message{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+// danglingRefFormat has a $ref to a definition it does not have.
+func danglingRefFormat() OutputFormat {
+	return NewOutputFormat("out", anthropic.ToolInputSchemaParam{
+		Properties: map[string]any{"home": map[string]any{"$ref": "#/$defs/address"}},
+	})
+}
+
+func TestRun_InvalidOutputSchemaFailsBeforeModel(t *testing.T) {
+	for _, mode := range []OutputMode{OutputModeHiddenTool, OutputModeNative} {
+		t.Run(string(mode), func(t *testing.T) {
+			format := danglingRefFormat()
+			format.Mode = mode
+			provider := &scriptedProvider{responses: []string{textResponse(`{"home":{}}`)}}
+			a := NewAgent(WithProvider(provider), WithModel("test-model"), WithOutputFormat(format))
+
+			stream := a.Run(context.Background(), "Where do you live?")
+			_, err := stream.Result()
+			require.ErrorIs(t, err, ErrOutputSchema)
+			assert.Len(t, provider.responses, 1, "the model was called")
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+)
+
+// Provider serves model requests for an agent. The agent loop speaks the
+// Anthropic Messages wire format, so a Provider for another backend (see the
+// provider/openai package) translates the request parameters on the way out
+// and synthesizes Anthropic stream events on the way back.
+//
+// Request failures should surface as stream errors; an error mentioning
+// "overloaded", "503" or "529" triggers the fallback model, if configured.
+type Provider interface {
+	NewStreaming(ctx context.Context, params anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion]
+}
+
+// WithProvider routes model requests through p instead of the Anthropic API.
+// Compaction and beta features are Anthropic-specific and are not applied.
+func WithProvider(p Provider) AgentOption {
+	return func(o *agentOptions) { o.provider = p }
+}
+
+// Provider returns the provider set with WithProvider, or nil when the agent
+// talks to the Anthropic API directly.
+func (a *Agent) Provider() Provider {
+	return a.opts.provider
+}
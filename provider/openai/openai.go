@@ -0,0 +1,118 @@
+// Package openai provides an agent.Provider for OpenAI-compatible
+// chat-completions endpoints, including local servers such as Ollama and
+// vLLM. Requests are translated from Anthropic message parameters and the
+// streamed chunks are turned back into Anthropic stream events, so the agent
+// loop, tools and sessions work unchanged.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+)
+
+// DefaultBaseURL is the OpenAI API endpoint used when WithBaseURL is not set.
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// Provider streams model responses from a chat-completions endpoint.
+// It implements agent.Provider.
+type Provider struct {
+	name       string
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// Option configures a Provider.
+type Option func(*Provider)
+
+// WithBaseURL sets the API base URL, e.g. "http://localhost:11434/v1" for
+// Ollama. The "/chat/completions" path is appended to it.
+func WithBaseURL(url string) Option {
+	return func(p *Provider) { p.baseURL = strings.TrimRight(url, "/") }
+}
+
+// WithAPIKey sets the bearer token. Defaults to $OPENAI_API_KEY; local
+// servers usually need none.
+func WithAPIKey(key string) Option {
+	return func(p *Provider) { p.apiKey = key }
+}
+
+// WithModel sends model instead of the agent's model name, so an agent
+// configured for Claude can be pointed at another model without changes.
+func WithModel(model string) Option {
+	return func(p *Provider) { p.model = model }
+}
+
+// WithProviderName sets the name reported as gen_ai.provider.name on trace
+// spans. Defaults to "openai".
+func WithProviderName(name string) Option {
+	return func(p *Provider) { p.name = name }
+}
+
+// WithHTTPClient sets the HTTP client used for requests.
+func WithHTTPClient(c *http.Client) Option {
+	return func(p *Provider) { p.httpClient = c }
+}
+
+// New creates a Provider.
+func New(opts ...Option) *Provider {
+	p := &Provider{
+		name:       "openai",
+		baseURL:    DefaultBaseURL,
+		apiKey:     os.Getenv("OPENAI_API_KEY"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Name returns the provider name reported on trace spans.
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// NewStreaming sends params as a streaming chat-completions request and
+// returns the response as Anthropic stream events. Transport and HTTP errors
+// are reported through the stream's Err.
+func (p *Provider) NewStreaming(ctx context.Context, params anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	req := p.buildRequest(params)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, fmt.Errorf("openai: encode request: %w", err))
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, fmt.Errorf("openai: %w", err))
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, fmt.Errorf("openai: %w", err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil,
+			fmt.Errorf("openai: %s: %s", resp.Status, strings.TrimSpace(string(msg))))
+	}
+
+	return translateStream(resp.Body, req.Model)
+}
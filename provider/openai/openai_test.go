@@ -0,0 +1,294 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// fakeChatServer emulates a streaming chat-completions endpoint. Each request
+// is answered with the next scripted list of chunks.
+type fakeChatServer struct {
+	mu        sync.Mutex
+	responses [][]string
+	requests  []map[string]any
+	auth      []string
+}
+
+func newFakeChatServer(t *testing.T, responses ...[]string) (*fakeChatServer, *httptest.Server) {
+	t.Helper()
+	f := &fakeChatServer{responses: responses}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeChatServer) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path != "/v1/chat/completions" {
+		http.NotFound(w, r)
+		return
+	}
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	f.requests = append(f.requests, body)
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+
+	if len(f.responses) == 0 {
+		http.Error(w, "no scripted response", http.StatusInternalServerError)
+		return
+	}
+	chunks := f.responses[0]
+	f.responses = f.responses[1:]
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, c := range chunks {
+		fmt.Fprintf(w, "data: %s\n\n", c)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func textChunk(s string) string {
+	return fmt.Sprintf(`{"id":"chatcmpl-1","model":"gpt-test","choices":[{"index":0,"delta":{"content":%q},"finish_reason":null}]}`, s)
+}
+
+func finishChunk(reason string) string {
+	return fmt.Sprintf(`{"id":"chatcmpl-1","model":"gpt-test","choices":[{"index":0,"delta":{},"finish_reason":%q}]}`, reason)
+}
+
+func usageChunk(prompt, completion, cached int) string {
+	return fmt.Sprintf(`{"id":"chatcmpl-1","model":"gpt-test","choices":[],"usage":{"prompt_tokens":%d,"completion_tokens":%d,"prompt_tokens_details":{"cached_tokens":%d}}}`,
+		prompt, completion, cached)
+}
+
+func accumulate(t *testing.T, p *Provider, params anthropic.MessageNewParams) anthropic.Message {
+	t.Helper()
+	stream := p.NewStreaming(context.Background(), params)
+	defer stream.Close()
+
+	var msg anthropic.Message
+	for stream.Next() {
+		event := stream.Current()
+		require.NoError(t, msg.Accumulate(event))
+		if event.Type == "message_delta" && event.Usage.InputTokens > 0 {
+			msg.Usage.InputTokens = event.Usage.InputTokens
+			msg.Usage.CacheReadInputTokens = event.Usage.CacheReadInputTokens
+		}
+	}
+	require.NoError(t, stream.Err())
+	return msg
+}
+
+func TestNewStreaming_Text(t *testing.T) {
+	api, srv := newFakeChatServer(t, []string{
+		textChunk("Hello"), textChunk(", world"), finishChunk("stop"), usageChunk(120, 7, 20),
+	})
+	p := New(WithBaseURL(srv.URL+"/v1/"), WithAPIKey("sk-test"))
+
+	msg := accumulate(t, p, anthropic.MessageNewParams{
+		Model:     "gpt-test",
+		MaxTokens: 256,
+		System:    []anthropic.TextBlockParam{{Text: "Be brief."}},
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))},
+	})
+
+	require.Len(t, msg.Content, 1)
+	assert.Equal(t, "Hello, world", msg.Content[0].Text)
+	assert.Equal(t, anthropic.StopReasonEndTurn, msg.StopReason)
+	assert.Equal(t, anthropic.Model("gpt-test"), msg.Model)
+	assert.Equal(t, int64(100), msg.Usage.InputTokens)
+	assert.Equal(t, int64(20), msg.Usage.CacheReadInputTokens)
+	assert.Equal(t, int64(7), msg.Usage.OutputTokens)
+
+	require.Len(t, api.requests, 1)
+	req := api.requests[0]
+	assert.Equal(t, "Bearer sk-test", api.auth[0])
+	assert.Equal(t, true, req["stream"])
+	assert.Equal(t, map[string]any{"include_usage": true}, req["stream_options"])
+	assert.Equal(t, float64(256), req["max_tokens"])
+	assert.Equal(t, []any{
+		map[string]any{"role": "system", "content": "Be brief."},
+		map[string]any{"role": "user", "content": "hi"},
+	}, req["messages"])
+}
+
+func TestNewStreaming_ToolCalls(t *testing.T) {
+	api, srv := newFakeChatServer(t, []string{
+		textChunk("Checking."),
+		`{"id":"c","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"weather","arguments":""}}]}}]}`,
+		`{"id":"c","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"c","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Oslo\"}"}}]}}]}`,
+		`{"id":"c","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"time","arguments":"{}"}}]}}]}`,
+		finishChunk("tool_calls"),
+	})
+	p := New(WithBaseURL(srv.URL+"/v1"), WithModel("local-model"))
+
+	msg := accumulate(t, p, anthropic.MessageNewParams{
+		Model:     anthropic.ModelClaudeSonnet4_5,
+		MaxTokens: 100,
+		Tools: []anthropic.ToolUnionParam{{OfTool: &anthropic.ToolParam{
+			Name:        "weather",
+			Description: anthropic.String("Get the weather"),
+			InputSchema: anthropic.ToolInputSchemaParam{
+				Properties: map[string]any{"city": map[string]any{"type": "string"}},
+				Required:   []string{"city"},
+			},
+		}}},
+		ToolChoice: anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}},
+		Messages: []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock("weather?")),
+			anthropic.NewAssistantMessage(
+				anthropic.NewTextBlock("Let me look."),
+				anthropic.NewToolUseBlock("toolu_1", map[string]any{"city": "Paris"}, "weather"),
+			),
+			anthropic.NewUserMessage(
+				anthropic.NewToolResultBlock("toolu_1", "no data", true),
+				anthropic.NewTextBlock("try Oslo"),
+			),
+		},
+	})
+
+	require.Len(t, msg.Content, 3)
+	assert.Equal(t, "Checking.", msg.Content[0].Text)
+	assert.Equal(t, "tool_use", msg.Content[1].Type)
+	assert.Equal(t, "call_a", msg.Content[1].ID)
+	assert.Equal(t, "weather", msg.Content[1].Name)
+	assert.JSONEq(t, `{"city":"Oslo"}`, string(msg.Content[1].Input))
+	assert.Equal(t, "call_b", msg.Content[2].ID)
+	assert.Equal(t, "time", msg.Content[2].Name)
+	assert.Equal(t, anthropic.StopReasonToolUse, msg.StopReason)
+
+	req := api.requests[0]
+	assert.Equal(t, "local-model", req["model"])
+	assert.Equal(t, "required", req["tool_choice"])
+
+	raw, err := json.Marshal(req["tools"])
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"function","function":{"name":"weather","description":"Get the weather",
+		"parameters":{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}}}]`, string(raw))
+
+	raw, err = json.Marshal(req["messages"])
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"role":"user","content":"weather?"},
+		{"role":"assistant","content":"Let me look.","tool_calls":[
+			{"index":0,"id":"toolu_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]},
+		{"role":"tool","content":"error: no data","tool_call_id":"toolu_1"},
+		{"role":"user","content":"try Oslo"}
+	]`, string(raw))
+}
+
+func TestNewStreaming_ToolCallsWithoutIndex(t *testing.T) {
+	// Ollama sends each call whole, all at index 0, and finishes with "stop".
+	_, srv := newFakeChatServer(t, []string{
+		`{"model":"llama","choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_1","function":{"name":"a","arguments":"{\"x\":1}"}}]}}]}`,
+		`{"model":"llama","choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_2","function":{"name":"b","arguments":"{}"}}]}}]}`,
+		finishChunk("stop"),
+	})
+
+	msg := accumulate(t, New(WithBaseURL(srv.URL+"/v1")), anthropic.MessageNewParams{Model: "llama", MaxTokens: 10})
+
+	require.Len(t, msg.Content, 2)
+	assert.Equal(t, "a", msg.Content[0].Name)
+	assert.Equal(t, "b", msg.Content[1].Name)
+	assert.Equal(t, anthropic.StopReasonToolUse, msg.StopReason)
+}
+
+func TestNewStreaming_StructuredOutput(t *testing.T) {
+	api, srv := newFakeChatServer(t, []string{textChunk(`{"ok":true}`), finishChunk("stop")})
+	schema := map[string]any{"type": "object", "properties": map[string]any{"ok": map[string]any{"type": "boolean"}}}
+
+	params := anthropic.MessageNewParams{Model: "m", MaxTokens: 10}
+	params.OutputConfig.Format = anthropic.JSONOutputFormatParam{Schema: schema}
+	accumulate(t, New(WithBaseURL(srv.URL+"/v1")), params)
+
+	assert.Equal(t, map[string]any{
+		"type":        "json_schema",
+		"json_schema": map[string]any{"name": "output", "schema": schema, "strict": true},
+	}, api.requests[0]["response_format"])
+}
+
+func TestNewStreaming_HTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"busy"}}`, http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	stream := New(WithBaseURL(srv.URL)).NewStreaming(context.Background(), anthropic.MessageNewParams{Model: "m"})
+	assert.False(t, stream.Next())
+	require.Error(t, stream.Err())
+	assert.Contains(t, stream.Err().Error(), "503")
+	assert.Contains(t, stream.Err().Error(), "busy")
+}
+
+func TestNewStreaming_ErrorChunk(t *testing.T) {
+	_, srv := newFakeChatServer(t, []string{textChunk("par"), `{"error":{"message":"model crashed"}}`})
+
+	stream := New(WithBaseURL(srv.URL+"/v1")).NewStreaming(context.Background(), anthropic.MessageNewParams{Model: "m"})
+	for stream.Next() {
+	}
+	require.Error(t, stream.Err())
+	assert.Contains(t, stream.Err().Error(), "model crashed")
+}
+
+type weatherInput struct {
+	City string `json:"city"`
+}
+
+type weatherTool struct{ calls []string }
+
+func (w *weatherTool) Name() string        { return "weather" }
+func (w *weatherTool) Description() string { return "Get the weather for a city" }
+func (w *weatherTool) Execute(_ context.Context, in weatherInput) (*agent.ToolResult, error) {
+	w.calls = append(w.calls, in.City)
+	return agent.TextResult("sunny in " + in.City), nil
+}
+
+func TestAgentRun_ThroughProvider(t *testing.T) {
+	api, srv := newFakeChatServer(t,
+		[]string{
+			`{"id":"c1","model":"local","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Oslo\"}"}}]}}]}`,
+			finishChunk("tool_calls"),
+			usageChunk(50, 10, 0),
+		},
+		[]string{textChunk("It is sunny."), finishChunk("stop"), usageChunk(80, 5, 0)},
+	)
+	tool := &weatherTool{}
+	a := agent.NewAgent(agent.WithProvider(New(WithBaseURL(srv.URL + "/v1"))))
+	agent.RegisterTool(a.Tools(), tool)
+
+	stream := a.Run(context.Background(), "Weather in Oslo?")
+	var result *agent.ResultEvent
+	for stream.Next() {
+		if r, ok := stream.Current().(*agent.ResultEvent); ok {
+			result = r
+		}
+	}
+	require.NoError(t, stream.Err())
+	require.NotNil(t, result)
+
+	assert.False(t, result.IsError)
+	msgs := stream.Session().Messages
+	require.Len(t, msgs, 4)
+	assert.Equal(t, "It is sunny.", msgs[3].Content[0].OfText.Text)
+	assert.Equal(t, []string{"Oslo"}, tool.calls)
+	assert.Equal(t, int64(130), result.Usage.InputTokens)
+	assert.Equal(t, int64(15), result.Usage.OutputTokens)
+
+	require.Len(t, api.requests, 2)
+	raw, err := json.Marshal(api.requests[1]["messages"])
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `{"content":"sunny in Oslo","role":"tool","tool_call_id":"call_1"}`)
+}
@@ -0,0 +1,209 @@
+package openai
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// chatRequest is the body of a chat-completions request.
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Tools          []chatTool      `json:"tools,omitempty"`
+	ToolChoice     any             `json:"tool_choice,omitempty"`
+	MaxTokens      int64           `json:"max_tokens,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatMessage struct {
+	Role       string     `json:"role"`
+	Content    *string    `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type toolCall struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function functionCall `json:"function"`
+}
+
+type functionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function functionDecl `json:"function"`
+}
+
+type functionDecl struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type responseFormat struct {
+	Type       string     `json:"type"`
+	JSONSchema jsonSchema `json:"json_schema"`
+}
+
+type jsonSchema struct {
+	Name   string `json:"name"`
+	Schema any    `json:"schema"`
+	Strict bool   `json:"strict"`
+}
+
+// buildRequest translates Anthropic message parameters into a streaming
+// chat-completions request. Only text, tool_use and tool_result blocks carry
+// over; thinking, images and Anthropic server tools are dropped.
+func (p *Provider) buildRequest(params anthropic.MessageNewParams) chatRequest {
+	req := chatRequest{
+		Model:         string(params.Model),
+		MaxTokens:     params.MaxTokens,
+		Stop:          params.StopSequences,
+		Stream:        true,
+		StreamOptions: &streamOptions{IncludeUsage: true},
+	}
+	if p.model != "" {
+		req.Model = p.model
+	}
+	if params.Temperature.Valid() {
+		t := params.Temperature.Value
+		req.Temperature = &t
+	}
+
+	if len(params.System) > 0 {
+		texts := make([]string, len(params.System))
+		for i, block := range params.System {
+			texts[i] = block.Text
+		}
+		req.Messages = append(req.Messages, textMessage("system", strings.Join(texts, "\n\n")))
+	}
+	for _, msg := range params.Messages {
+		req.Messages = append(req.Messages, convertMessage(msg)...)
+	}
+
+	for _, tool := range params.Tools {
+		if tool.OfTool == nil {
+			continue
+		}
+		schema, err := json.Marshal(tool.OfTool.InputSchema)
+		if err != nil {
+			continue
+		}
+		req.Tools = append(req.Tools, chatTool{
+			Type: "function",
+			Function: functionDecl{
+				Name:        tool.OfTool.Name,
+				Description: tool.OfTool.Description.Value,
+				Parameters:  schema,
+			},
+		})
+	}
+	if len(req.Tools) > 0 {
+		req.ToolChoice = convertToolChoice(params.ToolChoice)
+	}
+
+	if schema := params.OutputConfig.Format.Schema; schema != nil {
+		req.ResponseFormat = &responseFormat{
+			Type:       "json_schema",
+			JSONSchema: jsonSchema{Name: "output", Schema: schema, Strict: true},
+		}
+	}
+	return req
+}
+
+// convertMessage translates one Anthropic message into chat messages. Tool
+// results become separate "tool" messages placed before any user text, since
+// they must directly follow the assistant message that issued the calls.
+func convertMessage(msg anthropic.MessageParam) []chatMessage {
+	var (
+		out   []chatMessage
+		texts []string
+		calls []toolCall
+	)
+	for _, block := range msg.Content {
+		switch {
+		case block.OfText != nil:
+			texts = append(texts, block.OfText.Text)
+		case block.OfToolUse != nil:
+			args, err := json.Marshal(block.OfToolUse.Input)
+			if err != nil || string(args) == "null" {
+				args = []byte("{}")
+			}
+			calls = append(calls, toolCall{
+				Index:    len(calls),
+				ID:       block.OfToolUse.ID,
+				Type:     "function",
+				Function: functionCall{Name: block.OfToolUse.Name, Arguments: string(args)},
+			})
+		case block.OfToolResult != nil:
+			out = append(out, toolResultMessage(block.OfToolResult))
+		}
+	}
+
+	role := string(msg.Role)
+	switch {
+	case len(calls) > 0:
+		m := chatMessage{Role: role, ToolCalls: calls}
+		if len(texts) > 0 {
+			text := strings.Join(texts, "\n")
+			m.Content = &text
+		}
+		out = append(out, m)
+	case len(texts) > 0:
+		out = append(out, textMessage(role, strings.Join(texts, "\n")))
+	}
+	return out
+}
+
+// toolResultMessage converts a tool_result block into a "tool" message.
+// Chat completions has no error flag, so failures are marked in the text.
+func toolResultMessage(r *anthropic.ToolResultBlockParam) chatMessage {
+	var texts []string
+	for _, c := range r.Content {
+		if c.OfText != nil {
+			texts = append(texts, c.OfText.Text)
+		}
+	}
+	content := strings.Join(texts, "\n")
+	if r.IsError.Value {
+		content = "error: " + content
+	}
+	return chatMessage{Role: "tool", Content: &content, ToolCallID: r.ToolUseID}
+}
+
+func textMessage(role, text string) chatMessage {
+	return chatMessage{Role: role, Content: &text}
+}
+
+// convertToolChoice maps an Anthropic tool choice onto chat completions.
+// Returns nil (the server default, "auto") when unset.
+func convertToolChoice(tc anthropic.ToolChoiceUnionParam) any {
+	switch {
+	case tc.OfTool != nil:
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]string{"name": tc.OfTool.Name},
+		}
+	case tc.OfAny != nil:
+		return "required"
+	case tc.OfNone != nil:
+		return "none"
+	default:
+		return nil
+	}
+}
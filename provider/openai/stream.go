@@ -0,0 +1,267 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+)
+
+// chatChunk is one streamed chat-completions chunk.
+type chatChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string     `json:"content"`
+			ToolCalls []toolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type chatUsage struct {
+	PromptTokens        int64 `json:"prompt_tokens"`
+	CompletionTokens    int64 `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// translateStream converts a chat-completions SSE body into Anthropic stream
+// events, following the same pipe-and-re-encode approach the engine uses for
+// beta streams.
+func translateStream(body io.ReadCloser, model string) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer pw.Close()
+		defer body.Close()
+
+		t := &streamTranslator{w: pw, model: model}
+		if err := t.run(body); err != nil {
+			t.emit("error", map[string]any{
+				"type":  "error",
+				"error": map[string]string{"type": "api_error", "message": err.Error()},
+			})
+		}
+	}()
+
+	resp := &http.Response{StatusCode: http.StatusOK, Body: pr, Header: http.Header{}}
+	return ssestream.NewStream[anthropic.MessageStreamEventUnion](ssestream.NewDecoder(resp), nil)
+}
+
+// streamTranslator tracks the open content block while turning chunk deltas
+// into content_block_start/delta/stop events.
+type streamTranslator struct {
+	w     io.Writer
+	model string
+
+	started bool
+	blocks  int    // Content blocks started so far
+	open    string // Kind of the open block: "", "text" or "tool_use"
+	toolIdx int    // Chat-completions index of the open tool call
+	toolID  string // ID of the open tool call
+	sawTool bool
+	finish  string
+	usage   *chatUsage
+}
+
+func (t *streamTranslator) run(body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if string(data) == "[DONE]" {
+			break
+		}
+
+		var chunk chatChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("openai: decode chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("openai: %s", chunk.Error.Message)
+		}
+		if err := t.chunk(chunk); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("openai: %w", err)
+	}
+	return t.finishMessage()
+}
+
+func (t *streamTranslator) chunk(c chatChunk) error {
+	if err := t.start(c.ID, c.Model); err != nil {
+		return err
+	}
+	if c.Usage != nil {
+		t.usage = c.Usage
+	}
+	for _, choice := range c.Choices {
+		if choice.Delta.Content != "" {
+			if err := t.text(choice.Delta.Content); err != nil {
+				return err
+			}
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			if err := t.toolCall(tc); err != nil {
+				return err
+			}
+		}
+		if choice.FinishReason != "" {
+			t.finish = choice.FinishReason
+		}
+	}
+	return nil
+}
+
+func (t *streamTranslator) start(id, model string) error {
+	if t.started {
+		return nil
+	}
+	t.started = true
+	if model == "" {
+		model = t.model
+	}
+	return t.emit("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":            id,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         map[string]int64{"input_tokens": 0, "output_tokens": 0},
+		},
+	})
+}
+
+func (t *streamTranslator) text(s string) error {
+	if t.open != "text" {
+		if err := t.closeBlock(); err != nil {
+			return err
+		}
+		if err := t.openBlock("text", map[string]any{"type": "text", "text": ""}); err != nil {
+			return err
+		}
+	}
+	return t.delta(map[string]any{"type": "text_delta", "text": s})
+}
+
+// toolCall handles a tool_calls delta. A call starts a new tool_use block
+// when its index or ID changes; some servers (e.g. Ollama) send every call
+// whole with index 0, so the ID is what tells them apart.
+func (t *streamTranslator) toolCall(tc toolCall) error {
+	isNew := t.open != "tool_use" || tc.Index != t.toolIdx || (tc.ID != "" && tc.ID != t.toolID)
+	if isNew {
+		if err := t.closeBlock(); err != nil {
+			return err
+		}
+		id := tc.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", t.blocks)
+		}
+		t.toolIdx, t.toolID, t.sawTool = tc.Index, id, true
+		if err := t.openBlock("tool_use", map[string]any{
+			"type": "tool_use", "id": id, "name": tc.Function.Name, "input": map[string]any{},
+		}); err != nil {
+			return err
+		}
+	}
+	if tc.Function.Arguments == "" {
+		return nil
+	}
+	return t.delta(map[string]any{"type": "input_json_delta", "partial_json": tc.Function.Arguments})
+}
+
+func (t *streamTranslator) openBlock(kind string, block map[string]any) error {
+	t.open = kind
+	return t.emit("content_block_start", map[string]any{
+		"type": "content_block_start", "index": t.blocks, "content_block": block,
+	})
+}
+
+func (t *streamTranslator) delta(d map[string]any) error {
+	return t.emit("content_block_delta", map[string]any{
+		"type": "content_block_delta", "index": t.blocks, "delta": d,
+	})
+}
+
+func (t *streamTranslator) closeBlock() error {
+	if t.open == "" {
+		return nil
+	}
+	t.open = ""
+	idx := t.blocks
+	t.blocks++
+	return t.emit("content_block_stop", map[string]any{"type": "content_block_stop", "index": idx})
+}
+
+// finishMessage closes the open block and reports the stop reason and usage.
+// Chat completions counts cached prompt tokens within prompt_tokens, whereas
+// Anthropic input_tokens excludes cache reads.
+func (t *streamTranslator) finishMessage() error {
+	if err := t.start("", ""); err != nil {
+		return err
+	}
+	if err := t.closeBlock(); err != nil {
+		return err
+	}
+	usage := map[string]int64{"output_tokens": 0}
+	if t.usage != nil {
+		cached := t.usage.PromptTokensDetails.CachedTokens
+		usage["input_tokens"] = t.usage.PromptTokens - cached
+		usage["cache_read_input_tokens"] = cached
+		usage["output_tokens"] = t.usage.CompletionTokens
+	}
+	if err := t.emit("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": t.stopReason(), "stop_sequence": nil},
+		"usage": usage,
+	}); err != nil {
+		return err
+	}
+	return t.emit("message_stop", map[string]any{"type": "message_stop"})
+}
+
+// stopReason maps finish_reason onto Anthropic stop reasons. Some servers
+// report "stop" even when the model called tools, so any tool call wins.
+func (t *streamTranslator) stopReason() anthropic.StopReason {
+	switch {
+	case t.sawTool || t.finish == "tool_calls" || t.finish == "function_call":
+		return anthropic.StopReasonToolUse
+	case t.finish == "length":
+		return anthropic.StopReasonMaxTokens
+	case t.finish == "content_filter":
+		return anthropic.StopReasonRefusal
+	default:
+		return anthropic.StopReasonEndTurn
+	}
+}
+
+func (t *streamTranslator) emit(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(t.w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
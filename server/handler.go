@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("POST /sessions", s.handleCreate)
+	s.mux.HandleFunc("GET /sessions/{id}", s.handleGet)
+	s.mux.HandleFunc("POST /sessions/{id}/messages", s.handleMessage)
+	s.mux.HandleFunc("POST /sessions/{id}/interrupt", s.handleInterrupt)
+	s.mux.HandleFunc("POST /sessions/{id}/permissions/{request_id}", s.handlePermission)
+	s.mux.HandleFunc("POST /sessions/{id}/asks/{request_id}", s.handleAsk)
+}
+
+// handleCreate creates a session and responds with its state.
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	h := s.newSession(Tenant(r.Context()))
+	if err := s.register(h); err != nil {
+		_ = h.client.Agent().Close()
+		s.writeSessionError(w, err)
+		return
+	}
+	defer s.release(h)
+	writeJSON(w, http.StatusCreated, h.state())
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	h, err := s.acquire(r, r.PathValue("id"))
+	if err != nil {
+		s.writeSessionError(w, err)
+		return
+	}
+	defer s.release(h)
+	writeJSON(w, http.StatusOK, h.state())
+}
+
+// messageRequest is the body of POST /sessions/{id}/messages.
+type messageRequest struct {
+	Prompt string `json:"prompt"`
+}
+
+// handleMessage runs a prompt, waiting for the session's previous query to
+// finish, and streams its events and prompts as SSE.
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	var req messageRequest
+	if !decodeBody(w, r, &req, "message") {
+		return
+	}
+	if req.Prompt == "" {
+		writeError(w, http.StatusBadRequest, errors.New("prompt is required"))
+		return
+	}
+	h, err := s.acquire(r, r.PathValue("id"))
+	if err != nil {
+		s.writeSessionError(w, err)
+		return
+	}
+	defer s.release(h)
+
+	select {
+	case h.slot <- struct{}{}:
+	case <-r.Context().Done():
+		return
+	}
+	defer func() { <-h.slot }()
+	if !s.startRun() {
+		writeError(w, http.StatusServiceUnavailable, errShuttingDown)
+		return
+	}
+	defer s.runs.Done()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	sse := &sseWriter{w: w, rc: http.NewResponseController(w)}
+	s.query(r.Context(), h, req.Prompt, sse)
+}
+
+// query runs prompt on h, writing its events and prompts to sse. Write
+// errors do not stop the run, which ends when the request is cancelled.
+func (s *Server) query(ctx context.Context, h *hostedSession, prompt string, sse *sseWriter) {
+	prompts := make(chan *promptMessage)
+	h.beginQuery(prompts)
+	defer h.endQuery()
+
+	stream := h.client.Query(ctx, prompt)
+	events := make(chan agent.Event)
+	go func() {
+		defer close(events)
+		for stream.Next() {
+			events <- stream.Current()
+		}
+	}()
+
+	enc := agent.NewNDJSONWriter(sse)
+	var writeErr error
+	var result bool
+	for events != nil {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			_, isResult := e.(*agent.ResultEvent)
+			result = result || isResult
+			if writeErr == nil {
+				writeErr = enc.Write(e)
+			}
+		case msg := <-prompts:
+			if writeErr == nil {
+				writeErr = sse.writeJSON(msg)
+			}
+		}
+	}
+	// A run that ended without a result, such as one that never started,
+	// reports why in a final message.
+	if err := stream.Err(); err != nil && !result && writeErr == nil {
+		_ = sse.writeJSON(errorMessage{Type: typeError, SessionID: h.id, Error: err.Error()})
+	}
+	if err := s.store.Save(context.WithoutCancel(ctx), h.client.Session()); err != nil {
+		s.opts.logger.Warn("session not saved", agent.LogKeySessionID, h.id, "error", err)
+	}
+}
+
+func (s *Server) handleInterrupt(w http.ResponseWriter, r *http.Request) {
+	h, err := s.acquire(r, r.PathValue("id"))
+	if err != nil {
+		s.writeSessionError(w, err)
+		return
+	}
+	defer s.release(h)
+	h.client.Interrupt()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// permissionAnswer is the body of POST /sessions/{id}/permissions/{request_id}.
+type permissionAnswer struct {
+	Decision string `json:"decision"` // "allow" or "deny"
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (s *Server) handlePermission(w http.ResponseWriter, r *http.Request) {
+	var req permissionAnswer
+	if !decodeBody(w, r, &req, "permission answer") {
+		return
+	}
+	if req.Decision != "allow" && req.Decision != "deny" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decision must be \"allow\" or \"deny\", not %q", req.Decision))
+		return
+	}
+	if req.Decision == "deny" && req.Reason == "" {
+		req.Reason = "denied by user"
+	}
+	s.answer(w, r, typePermissionRequest, promptAnswer{allow: req.Decision == "allow", reason: req.Reason})
+}
+
+// askAnswer is the body of POST /sessions/{id}/asks/{request_id}.
+type askAnswer struct {
+	Answer string `json:"answer"`
+}
+
+func (s *Server) handleAsk(w http.ResponseWriter, r *http.Request) {
+	var req askAnswer
+	if !decodeBody(w, r, &req, "ask answer") {
+		return
+	}
+	s.answer(w, r, typeAskRequest, promptAnswer{text: req.Answer})
+}
+
+// answer delivers a to the pending prompt named by the request path.
+func (s *Server) answer(w http.ResponseWriter, r *http.Request, typ string, a promptAnswer) {
+	h, err := s.acquire(r, r.PathValue("id"))
+	if err != nil {
+		s.writeSessionError(w, err)
+		return
+	}
+	defer s.release(h)
+	if err := h.answer(typ, r.PathValue("request_id"), a); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeSessionError maps errors of acquiring a session to a status.
+func (s *Server) writeSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errSessionNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errShuttingDown):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		s.opts.logger.Error("session not loaded", "error", err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// decodeBody decodes the JSON body of r into v, responding with an error
+// and returning false if it is malformed or too large.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any, what string) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+	status := http.StatusBadRequest
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	writeError(w, status, fmt.Errorf("decode %s: %w", what, err))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// sseWriter frames each line written to it as an SSE data message.
+type sseWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (s *sseWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	for line := range bytes.Lines(p) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\n")))
+		buf.WriteString("\n\n")
+	}
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeJSON sends v as one SSE message.
+func (s *sseWriter) writeJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.Write(append(data, '\n'))
+	return err
+}
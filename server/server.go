@@ -0,0 +1,273 @@
+// Package server hosts agent sessions behind an HTTP API, so a web backend
+// can drive agents without writing its own session plumbing.
+//
+// Each session is backed by an [agent.Client] and persisted to a
+// [agent.SessionStore]. Routes:
+//
+//	POST /sessions                                  create a session
+//	GET  /sessions/{id}                             session state
+//	POST /sessions/{id}/messages                    run a prompt, streaming events as SSE
+//	POST /sessions/{id}/interrupt                   interrupt the running prompt
+//	POST /sessions/{id}/permissions/{request_id}    answer a permission request
+//	POST /sessions/{id}/asks/{request_id}           answer an AskUserQuestion request
+//
+// Events are sent as SSE "data:" lines holding the stream-json encoding of
+// agent.NDJSONWriter. While a prompt runs, the stream also carries
+// "permission_request" and "ask_request" messages; the run waits until
+// they are answered on the matching endpoint. A run that ends without a
+// result message, such as one that could not start, ends the stream with
+// an "error" message.
+//
+// Queries on one session run one at a time; a second message waits for
+// the first to finish. Sessions idle for longer than the idle timeout are
+// saved and unloaded, and loaded again from the store on their next
+// request.
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/session"
+)
+
+// Defaults for Server options.
+const (
+	DefaultIdleTimeout     = 30 * time.Minute
+	DefaultPromptTimeout   = 5 * time.Minute
+	DefaultMaxRequestBytes = 1 << 20
+)
+
+// AuthFunc authenticates a request and returns the tenant it acts for.
+// A non-nil error rejects the request with 401 Unauthorized. Sessions are
+// only visible to the tenant that created them, which is saved with the
+// session as a tag. Without WithAuth, requests act for the empty tenant
+// and cannot reach sessions created for another.
+type AuthFunc func(r *http.Request) (tenant string, err error)
+
+// Option configures a Server.
+type Option func(*options)
+
+type options struct {
+	agentOpts       []agent.AgentOption
+	auth            AuthFunc
+	idleTimeout     time.Duration
+	promptTimeout   time.Duration
+	maxRequestBytes int64
+	logger          *slog.Logger
+}
+
+// WithAgentOptions sets the options of the agent built for each session.
+// The server adds the session store, a PermissionRequest hook and the
+// AskUserQuestion tool.
+func WithAgentOptions(opts ...agent.AgentOption) Option {
+	return func(o *options) { o.agentOpts = append(o.agentOpts, opts...) }
+}
+
+// WithAuth authenticates every request with fn before it is routed.
+func WithAuth(fn AuthFunc) Option {
+	return func(o *options) { o.auth = fn }
+}
+
+// WithIdleTimeout unloads sessions that have not been used for d.
+// Zero or negative disables eviction.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) { o.idleTimeout = d }
+}
+
+// WithPromptTimeout bounds how long a run waits for a permission or ask
+// answer. An unanswered permission request denies the tool.
+func WithPromptTimeout(d time.Duration) Option {
+	return func(o *options) { o.promptTimeout = d }
+}
+
+// WithMaxRequestBytes limits request bodies to n bytes; larger ones are
+// rejected with 413 Request Entity Too Large. Zero or negative removes the
+// limit.
+func WithMaxRequestBytes(n int64) Option {
+	return func(o *options) { o.maxRequestBytes = n }
+}
+
+// WithLogger logs session saves, evictions and failures to l.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// Server is an http.Handler hosting agent sessions.
+type Server struct {
+	opts  options
+	store agent.SessionStore
+	mux   *http.ServeMux
+
+	mu       sync.Mutex
+	sessions map[string]*hostedSession
+	closing  bool
+	runs     sync.WaitGroup
+	stop     chan struct{}
+}
+
+// New returns a server persisting sessions to store. A nil store keeps
+// them in memory. Call Shutdown to stop the server's eviction loop.
+func New(store agent.SessionStore, opts ...Option) *Server {
+	o := options{
+		idleTimeout:     DefaultIdleTimeout,
+		promptTimeout:   DefaultPromptTimeout,
+		maxRequestBytes: DefaultMaxRequestBytes,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	if o.logger == nil {
+		o.logger = slog.New(slog.DiscardHandler)
+	}
+	if store == nil {
+		store = session.NewMemoryStore()
+	}
+
+	s := &Server{
+		opts:     o,
+		store:    store,
+		mux:      http.NewServeMux(),
+		sessions: make(map[string]*hostedSession),
+		stop:     make(chan struct{}),
+	}
+	s.routes()
+	if o.idleTimeout > 0 {
+		go s.evictLoop(o.idleTimeout)
+	}
+	return s
+}
+
+type tenantKey struct{}
+
+// Tenant returns the tenant the request was authenticated for. Runs use
+// the request context, so tools can call it too.
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// ServeHTTP authenticates the request and routes it.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.maxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.opts.maxRequestBytes)
+	}
+	if s.opts.auth != nil {
+		tenant, err := s.opts.auth(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant))
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Shutdown stops accepting messages and waits for running prompts to
+// finish. If ctx ends first, the remaining runs are interrupted. Every
+// loaded session is then saved and closed. Call it before shutting down
+// the http.Server, whose Shutdown waits for open event streams.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closing {
+		s.closing = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.mu.Lock()
+		for _, h := range s.sessions {
+			h.client.Interrupt()
+		}
+		s.mu.Unlock()
+		<-drained
+	}
+
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = make(map[string]*hostedSession)
+	s.mu.Unlock()
+	for _, h := range sessions {
+		err = errors.Join(err, s.closeSession(h))
+	}
+	return err
+}
+
+// startRun registers a run for Shutdown to wait on. It reports false once
+// the server is shutting down.
+func (s *Server) startRun() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.runs.Add(1)
+	return true
+}
+
+// evictLoop unloads idle sessions until Shutdown.
+func (s *Server) evictLoop(idle time.Duration) {
+	ticker := time.NewTicker(idle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.evictIdle(now.Add(-idle))
+		}
+	}
+}
+
+// evictIdle unloads sessions not in use and last used before cutoff. A
+// session stays registered until it is saved, and stays loaded if the save
+// fails, to be tried again on the next tick.
+func (s *Server) evictIdle(cutoff time.Time) {
+	var idle []*hostedSession
+	s.mu.Lock()
+	for _, h := range s.sessions {
+		if h.refs == 0 && h.evicting == nil && h.lastUsed.Before(cutoff) {
+			h.evicting = make(chan struct{})
+			idle = append(idle, h)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, h := range idle {
+		err := h.client.Close()
+		s.mu.Lock()
+		if err == nil && s.sessions[h.id] == h {
+			delete(s.sessions, h.id)
+		}
+		close(h.evicting)
+		h.evicting = nil
+		s.mu.Unlock()
+
+		if err != nil {
+			s.opts.logger.Warn("idle session not saved, kept loaded", agent.LogKeySessionID, h.id, "error", err)
+			continue
+		}
+		_ = h.client.Agent().Close()
+		s.opts.logger.Debug("session evicted", agent.LogKeySessionID, h.id)
+	}
+}
+
+// closeSession saves a session and releases its agent.
+func (s *Server) closeSession(h *hostedSession) error {
+	return errors.Join(h.client.Close(), h.client.Agent().Close())
+}
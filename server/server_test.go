@@ -0,0 +1,603 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/hook"
+	"github.com/armatrix/claude-agent-sdk-go/session"
+)
+
+// scriptedProvider replays canned SSE responses. With a gate, each request
+// waits for a value on it first.
+type scriptedProvider struct {
+	mu        sync.Mutex
+	responses []string
+	requests  []int
+	gate      chan struct{}
+	started   chan struct{}
+}
+
+func (p *scriptedProvider) NewStreaming(ctx context.Context, params anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	if p.gate != nil {
+		p.started <- struct{}{}
+		select {
+		case <-p.gate:
+		case <-ctx.Done():
+			return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, ctx.Err())
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, len(params.Messages))
+	if len(p.responses) == 0 {
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, fmt.Errorf("no scripted response"))
+	}
+	body := p.responses[0]
+	p.responses = p.responses[1:]
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}
+	return ssestream.NewStream[anthropic.MessageStreamEventUnion](ssestream.NewDecoder(resp), nil)
+}
+
+func gated(p *scriptedProvider) *scriptedProvider {
+	p.gate = make(chan struct{})
+	p.started = make(chan struct{}, 8)
+	return p
+}
+
+func sseEvents(events ...string) string {
+	var sb strings.Builder
+	for _, e := range events {
+		var head struct{ Type string }
+		_ = json.Unmarshal([]byte(e), &head)
+		fmt.Fprintf(&sb, "event: %s\ndata: %s\n\n", head.Type, e)
+	}
+	return sb.String()
+}
+
+func textResponse(text string) string {
+	return sseEvents(
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"test-model","content":[],"stop_reason":null,"usage":{"input_tokens":10,"output_tokens":0}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`, text),
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	)
+}
+
+func toolUseResponse(name, input string) string {
+	return sseEvents(
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"test-model","content":[],"stop_reason":null,"usage":{"input_tokens":10,"output_tokens":0}}}`,
+		fmt.Sprintf(`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":%q,"input":{}}}`, name),
+		fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":%q}}`, input),
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	)
+}
+
+// launchInput is the input of launchTool.
+type launchInput struct{}
+
+// launchTool is a write tool, so the default permission mode asks for it.
+type launchTool struct{ ran chan struct{} }
+
+func (l *launchTool) Name() string        { return "Launch" }
+func (l *launchTool) Description() string { return "Launch the rocket" }
+func (l *launchTool) Execute(context.Context, launchInput) (*agent.ToolResult, error) {
+	close(l.ran)
+	return agent.TextResult("launched"), nil
+}
+
+// newTestServer serves a Server whose sessions run on p.
+func newTestServer(t *testing.T, p *scriptedProvider, opts ...Option) (*Server, *httptest.Server) {
+	t.Helper()
+	opts = append([]Option{WithAgentOptions(agent.WithProvider(p), agent.WithModel("test-model"))}, opts...)
+	s := New(session.NewMemoryStore(), opts...)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		_ = s.Shutdown(context.Background())
+		ts.Close()
+	})
+	return s, ts
+}
+
+func do(t *testing.T, method, url, body string, header ...string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func decode(t *testing.T, resp *http.Response) map[string]any {
+	t.Helper()
+	defer resp.Body.Close()
+	var v map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	return v
+}
+
+func createSession(t *testing.T, ts *httptest.Server, header ...string) string {
+	t.Helper()
+	resp := do(t, http.MethodPost, ts.URL+"/sessions", "", header...)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	return decode(t, resp)["session_id"].(string)
+}
+
+// eventStream reads the SSE messages of a query.
+type eventStream struct {
+	resp    *http.Response
+	scanner *bufio.Scanner
+}
+
+func sendMessage(t *testing.T, ts *httptest.Server, id, prompt string) *eventStream {
+	t.Helper()
+	body, _ := json.Marshal(messageRequest{Prompt: prompt})
+	resp := do(t, http.MethodPost, ts.URL+"/sessions/"+id+"/messages", string(body))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	t.Cleanup(func() { resp.Body.Close() })
+	return &eventStream{resp: resp, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next returns the next message, or nil at the end of the stream.
+func (s *eventStream) next(t *testing.T) map[string]any {
+	t.Helper()
+	for s.scanner.Scan() {
+		data, ok := strings.CutPrefix(s.scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var v map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &v))
+		return v
+	}
+	return nil
+}
+
+// until returns the first message of type typ.
+func (s *eventStream) until(t *testing.T, typ string) map[string]any {
+	t.Helper()
+	for v := s.next(t); v != nil; v = s.next(t) {
+		if v["type"] == typ {
+			return v
+		}
+	}
+	t.Fatalf("stream ended without a %s message", typ)
+	return nil
+}
+
+func TestServer_MessageStreamsEventsAndPersists(t *testing.T) {
+	p := &scriptedProvider{responses: []string{textResponse("Paris")}}
+	s, ts := newTestServer(t, p)
+	id := createSession(t, ts)
+
+	stream := sendMessage(t, ts, id, "Capital of France?")
+	var types []string
+	for v := stream.next(t); v != nil; v = stream.next(t) {
+		types = append(types, v["type"].(string))
+		assert.Equal(t, id, v["session_id"])
+	}
+	assert.Equal(t, []string{"system", "stream_event", "assistant", "result"}, types)
+
+	info := decode(t, do(t, http.MethodGet, ts.URL+"/sessions/"+id, ""))
+	assert.Len(t, info["messages"], 2)
+	assert.Equal(t, false, info["running"])
+
+	saved, err := s.store.Load(context.Background(), id)
+	require.NoError(t, err)
+	assert.Len(t, saved.Messages, 2)
+}
+
+func TestServer_UnknownSession(t *testing.T) {
+	_, ts := newTestServer(t, &scriptedProvider{})
+	resp := do(t, http.MethodGet, ts.URL+"/sessions/sess_missing", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_PermissionRequest(t *testing.T) {
+	for _, tc := range []struct {
+		decision string
+		ran      bool
+	}{
+		{"allow", true},
+		{"deny", false},
+	} {
+		t.Run(tc.decision, func(t *testing.T) {
+			p := &scriptedProvider{responses: []string{toolUseResponse("Launch", `{}`), textResponse("done")}}
+			tool := &launchTool{ran: make(chan struct{})}
+			_, ts := newTestServer(t, p, WithAgentOptions(agent.WithOnInit(func(a *agent.Agent) {
+				agent.RegisterTool(a.Tools(), tool)
+			})))
+			id := createSession(t, ts)
+
+			stream := sendMessage(t, ts, id, "Launch it")
+			req := stream.until(t, typePermissionRequest)
+			assert.Equal(t, "Launch", req["tool_name"])
+
+			info := decode(t, do(t, http.MethodGet, ts.URL+"/sessions/"+id, ""))
+			assert.Equal(t, true, info["running"])
+			assert.Len(t, info["pending"], 1)
+
+			resp := do(t, http.MethodPost, ts.URL+"/sessions/"+id+"/permissions/"+req["request_id"].(string), `{"decision":"`+tc.decision+`"}`)
+			resp.Body.Close()
+			require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+			result := stream.until(t, "result")
+			assert.Equal(t, "success", result["subtype"])
+			select {
+			case <-tool.ran:
+				assert.True(t, tc.ran)
+			default:
+				assert.False(t, tc.ran)
+			}
+		})
+	}
+}
+
+func TestServer_UserHooksKeptNextToPermissionHook(t *testing.T) {
+	p := &scriptedProvider{responses: []string{toolUseResponse("Launch", `{}`), textResponse("done")}}
+	tool := &launchTool{ran: make(chan struct{})}
+	var mu sync.Mutex
+	var fired []hook.Event
+	record := func(_ context.Context, in *hook.Input) (*hook.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fired = append(fired, in.Event)
+		return nil, nil
+	}
+	_, ts := newTestServer(t, p, WithAgentOptions(
+		agent.WithHooks(hook.Matcher{Event: hook.PreToolUse, Hooks: []hook.Func{record}}),
+		agent.WithOnInit(func(a *agent.Agent) { agent.RegisterTool(a.Tools(), tool) }),
+	))
+	id := createSession(t, ts)
+
+	stream := sendMessage(t, ts, id, "Launch it")
+	req := stream.until(t, typePermissionRequest)
+	resp := do(t, http.MethodPost, ts.URL+"/sessions/"+id+"/permissions/"+req["request_id"].(string), `{"decision":"allow"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	assert.Equal(t, "success", stream.until(t, "result")["subtype"])
+	<-tool.ran
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []hook.Event{hook.PreToolUse}, fired)
+}
+
+func TestServer_AskRequest(t *testing.T) {
+	p := &scriptedProvider{responses: []string{
+		toolUseResponse("AskUserQuestion", `{"question":"Which color?"}`),
+		textResponse("Blue it is"),
+	}}
+	_, ts := newTestServer(t, p)
+	id := createSession(t, ts)
+
+	stream := sendMessage(t, ts, id, "Paint the shed")
+	req := stream.until(t, typeAskRequest)
+	assert.Equal(t, "Which color?", req["question"])
+
+	resp := do(t, http.MethodPost, ts.URL+"/sessions/"+id+"/asks/"+req["request_id"].(string), `{"answer":"blue"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	user := stream.until(t, "user")
+	data, _ := json.Marshal(user["message"])
+	assert.Contains(t, string(data), "blue")
+	assert.Equal(t, "success", stream.until(t, "result")["subtype"])
+
+	resp = do(t, http.MethodPost, ts.URL+"/sessions/"+id+"/asks/"+req["request_id"].(string), `{"answer":"red"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_SerializesQueriesPerSession(t *testing.T) {
+	p := gated(&scriptedProvider{responses: []string{textResponse("Paris"), textResponse("Berlin")}})
+	_, ts := newTestServer(t, p)
+	id := createSession(t, ts)
+
+	first := sendMessage(t, ts, id, "Capital of France?")
+	<-p.started
+
+	second := make(chan *eventStream)
+	go func() { second <- sendMessage(t, ts, id, "And Germany?") }()
+	select {
+	case <-p.started:
+		t.Fatal("second query started while the first was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.gate <- struct{}{}
+	first.until(t, "result")
+	<-p.started
+	p.gate <- struct{}{}
+	(<-second).until(t, "result")
+
+	// The second query saw the first exchange.
+	assert.Equal(t, []int{1, 3}, p.requests)
+}
+
+func TestServer_Interrupt(t *testing.T) {
+	p := gated(&scriptedProvider{})
+	_, ts := newTestServer(t, p)
+	id := createSession(t, ts)
+
+	stream := sendMessage(t, ts, id, "Think forever")
+	<-p.started
+	resp := do(t, http.MethodPost, ts.URL+"/sessions/"+id+"/interrupt", "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	assert.Equal(t, true, stream.until(t, "result")["is_error"])
+}
+
+func TestServer_RunWithoutResultEndsWithError(t *testing.T) {
+	p := gated(&scriptedProvider{responses: []string{textResponse("Paris")}})
+	s, ts := newTestServer(t, p, WithAgentOptions(agent.WithQueryPolicy(agent.QueryReject)))
+	id := createSession(t, ts)
+
+	// Occupy the client behind the server's back so its query is rejected.
+	s.mu.Lock()
+	client := s.sessions[id].client
+	s.mu.Unlock()
+	busy := client.Query(context.Background(), "Capital of France?")
+	<-p.started
+
+	v := sendMessage(t, ts, id, "And Germany?").until(t, "error")
+	assert.Equal(t, id, v["session_id"])
+	assert.Contains(t, v["error"], "query already in progress")
+
+	p.gate <- struct{}{}
+	require.NoError(t, busy.Wait())
+}
+
+func TestServer_RejectsOversizedBody(t *testing.T) {
+	_, ts := newTestServer(t, &scriptedProvider{}, WithMaxRequestBytes(64))
+	id := createSession(t, ts)
+
+	body, _ := json.Marshal(messageRequest{Prompt: strings.Repeat("x", 100)})
+	resp := do(t, http.MethodPost, ts.URL+"/sessions/"+id+"/messages", string(body))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp = do(t, http.MethodPost, ts.URL+"/sessions/"+id+"/messages", "{")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_EvictsIdleSessions(t *testing.T) {
+	p := &scriptedProvider{responses: []string{textResponse("Paris")}}
+	s, ts := newTestServer(t, p, WithIdleTimeout(20*time.Millisecond))
+	id := createSession(t, ts)
+	sendMessage(t, ts, id, "Capital of France?").until(t, "result")
+
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.sessions) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// The session is loaded again from the store.
+	info := decode(t, do(t, http.MethodGet, ts.URL+"/sessions/"+id, ""))
+	assert.Equal(t, id, info["session_id"])
+	assert.Len(t, info["messages"], 2)
+}
+
+func TestServer_Auth(t *testing.T) {
+	auth := func(r *http.Request) (string, error) {
+		tenant := r.Header.Get("X-Tenant")
+		if tenant == "" {
+			return "", errors.New("missing tenant")
+		}
+		return tenant, nil
+	}
+	_, ts := newTestServer(t, &scriptedProvider{}, WithAuth(auth))
+
+	resp := do(t, http.MethodPost, ts.URL+"/sessions", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	id := createSession(t, ts, "X-Tenant", "acme")
+	resp = do(t, http.MethodGet, ts.URL+"/sessions/"+id, "", "X-Tenant", "acme")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do(t, http.MethodGet, ts.URL+"/sessions/"+id, "", "X-Tenant", "globex")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_AuthSurvivesRestart(t *testing.T) {
+	auth := func(r *http.Request) (string, error) {
+		return r.Header.Get("X-Tenant"), nil
+	}
+	store := session.NewMemoryStore()
+	serve := func(opts ...Option) *httptest.Server {
+		s := New(store, append([]Option{WithAgentOptions(agent.WithProvider(&scriptedProvider{}))}, opts...)...)
+		ts := httptest.NewServer(s)
+		t.Cleanup(func() {
+			_ = s.Shutdown(context.Background())
+			ts.Close()
+		})
+		return ts
+	}
+	get := func(ts *httptest.Server, id string, header ...string) int {
+		resp := do(t, http.MethodGet, ts.URL+"/sessions/"+id, "", header...)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	first := New(store, WithAuth(auth))
+	ts := httptest.NewServer(first)
+	id := createSession(t, ts, "X-Tenant", "acme")
+	require.NoError(t, first.Shutdown(context.Background()))
+	ts.Close()
+
+	// A new process knows the owner from the store alone.
+	restarted := serve(WithAuth(auth))
+	assert.Equal(t, http.StatusOK, get(restarted, id, "X-Tenant", "acme"))
+	assert.Equal(t, http.StatusNotFound, get(restarted, id, "X-Tenant", "globex"))
+	assert.Equal(t, http.StatusNotFound, get(restarted, id))
+
+	// Without auth, a tenant's session stays out of reach.
+	assert.Equal(t, http.StatusNotFound, get(serve(), id))
+}
+
+// flakyStore fails or blocks saves on demand.
+type flakyStore struct {
+	*session.MemoryStore
+	mu    sync.Mutex
+	err   error
+	gate  chan struct{}
+	saves chan struct{}
+}
+
+func (f *flakyStore) Save(ctx context.Context, s *agent.Session) error {
+	f.mu.Lock()
+	err, gate := f.err, f.gate
+	f.mu.Unlock()
+	if gate != nil {
+		f.saves <- struct{}{}
+		<-gate
+	}
+	if err != nil {
+		return err
+	}
+	return f.MemoryStore.Save(ctx, s)
+}
+
+func TestServer_EvictionKeepsUnsavedSession(t *testing.T) {
+	store := &flakyStore{MemoryStore: session.NewMemoryStore()}
+	s := New(store, WithIdleTimeout(0), WithAgentOptions(agent.WithProvider(&scriptedProvider{responses: []string{textResponse("Paris")}})))
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		store.mu.Lock()
+		store.err = nil
+		store.mu.Unlock()
+		_ = s.Shutdown(context.Background())
+		ts.Close()
+	})
+	id := createSession(t, ts)
+	sendMessage(t, ts, id, "Capital of France?").until(t, "result")
+
+	store.mu.Lock()
+	store.err = errors.New("disk full")
+	store.mu.Unlock()
+	s.evictIdle(time.Now().Add(time.Hour))
+
+	s.mu.Lock()
+	_, loaded := s.sessions[id]
+	s.mu.Unlock()
+	assert.True(t, loaded, "a session that failed to save stays loaded")
+	info := decode(t, do(t, http.MethodGet, ts.URL+"/sessions/"+id, ""))
+	assert.Len(t, info["messages"], 2)
+}
+
+func TestServer_RequestWaitsForEvictionSave(t *testing.T) {
+	store := &flakyStore{MemoryStore: session.NewMemoryStore()}
+	s := New(store, WithIdleTimeout(0), WithAgentOptions(agent.WithProvider(&scriptedProvider{responses: []string{textResponse("Paris")}})))
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		_ = s.Shutdown(context.Background())
+		ts.Close()
+	})
+	id := createSession(t, ts)
+	sendMessage(t, ts, id, "Capital of France?").until(t, "result")
+
+	gate := make(chan struct{})
+	store.mu.Lock()
+	store.gate, store.saves = gate, make(chan struct{}, 1)
+	store.mu.Unlock()
+	evicted := make(chan struct{})
+	go func() {
+		s.evictIdle(time.Now().Add(time.Hour))
+		close(evicted)
+	}()
+	<-store.saves
+
+	got := make(chan map[string]any)
+	go func() { got <- decode(t, do(t, http.MethodGet, ts.URL+"/sessions/"+id, "")) }()
+	select {
+	case <-got:
+		t.Fatal("request served while the session was being saved")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	store.mu.Lock()
+	store.gate = nil
+	store.mu.Unlock()
+	close(gate)
+	<-evicted
+	// Loaded again from the saved copy.
+	assert.Len(t, (<-got)["messages"], 2)
+}
+
+func TestServer_ShutdownDrainsRuns(t *testing.T) {
+	p := gated(&scriptedProvider{responses: []string{textResponse("Paris")}})
+	s, ts := newTestServer(t, p)
+	id := createSession(t, ts)
+
+	stream := sendMessage(t, ts, id, "Capital of France?")
+	<-p.started
+
+	done := make(chan error)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.closing
+	}, time.Second, time.Millisecond)
+
+	resp := do(t, http.MethodPost, ts.URL+"/sessions", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the run finished")
+	default:
+	}
+
+	p.gate <- struct{}{}
+	assert.Equal(t, "success", stream.until(t, "result")["subtype"])
+	require.NoError(t, <-done)
+
+	saved, err := s.store.Load(context.Background(), id)
+	require.NoError(t, err)
+	assert.Len(t, saved.Messages, 2)
+}
+
+func TestServer_ShutdownInterruptsAfterDeadline(t *testing.T) {
+	p := gated(&scriptedProvider{})
+	s, ts := newTestServer(t, p)
+	id := createSession(t, ts)
+
+	stream := sendMessage(t, ts, id, "Think forever")
+	<-p.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, true, stream.until(t, "result")["is_error"])
+}
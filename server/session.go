@@ -0,0 +1,364 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/hook"
+	"github.com/armatrix/claude-agent-sdk-go/tools"
+)
+
+// Prompt message types, sent on the event stream of a running query, and
+// the prefixes of their request IDs.
+const (
+	typePermissionRequest = "permission_request"
+	typeAskRequest        = "ask_request"
+	typeError             = "error"
+
+	prefixPermission = "perm"
+	prefixAsk        = "ask"
+)
+
+// tenantTagPrefix starts the session tag naming the tenant that owns the
+// session, which is saved with it so ownership survives evictions and
+// restarts.
+const tenantTagPrefix = "server-tenant:"
+
+var (
+	errSessionNotFound = errors.New("session not found")
+	errShuttingDown    = errors.New("server is shutting down")
+	errRequestNotFound = errors.New("no pending request with this ID")
+)
+
+// promptMessage asks the client for a permission decision or an answer.
+type promptMessage struct {
+	Type      string            `json:"type"`
+	RequestID string            `json:"request_id"`
+	SessionID string            `json:"session_id"`
+	ToolName  string            `json:"tool_name,omitempty"`
+	Input     json.RawMessage   `json:"input,omitempty"`
+	Question  string            `json:"question,omitempty"`
+	Options   []tools.AskOption `json:"options,omitempty"`
+}
+
+// errorMessage ends the event stream of a query that failed without a
+// result event.
+type errorMessage struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Error     string `json:"error"`
+}
+
+// promptAnswer is the client's reply to a promptMessage.
+type promptAnswer struct {
+	allow  bool
+	reason string
+	text   string
+}
+
+type pendingPrompt struct {
+	msg    *promptMessage
+	answer chan promptAnswer
+}
+
+// hostedSession is a loaded session and the client running it.
+type hostedSession struct {
+	id            string
+	tenant        string
+	client        *agent.Client
+	promptTimeout time.Duration
+
+	// slot holds a token while a query runs, serializing queries.
+	slot chan struct{}
+
+	// refs, lastUsed and evicting are guarded by Server.mu. evicting is
+	// set while the session is saved to be unloaded, and closed once it
+	// was unloaded or kept.
+	refs     int
+	lastUsed time.Time
+	evicting chan struct{}
+
+	mu      sync.Mutex
+	info    sessionInfo // as of the last completed query
+	out     chan *promptMessage
+	pending map[string]*pendingPrompt
+}
+
+// sessionInfo is the body of GET /sessions/{id}.
+type sessionInfo struct {
+	SessionID    string                   `json:"session_id"`
+	Model        string                   `json:"model,omitempty"`
+	NumTurns     int                      `json:"num_turns"`
+	TotalCostUSD json.Number              `json:"total_cost_usd"`
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+	Messages     []anthropic.MessageParam `json:"messages"`
+	Running      bool                     `json:"running"`
+	Pending      []*promptMessage         `json:"pending"`
+}
+
+// newSession builds an unregistered session for tenant with a fresh client.
+func (s *Server) newSession(tenant string) *hostedSession {
+	h := &hostedSession{
+		tenant:        tenant,
+		promptTimeout: s.opts.promptTimeout,
+		slot:          make(chan struct{}, 1),
+		pending:       make(map[string]*pendingPrompt),
+	}
+	opts := append(slices.Clone(s.opts.agentOpts),
+		agent.WithSessionStore(s.store),
+		agent.WithAdditionalHooks(hook.Matcher{
+			Event:   hook.PermissionRequest,
+			Hooks:   []hook.Func{h.permissionHook},
+			Timeout: s.opts.promptTimeout,
+		}),
+		// Asking is how the model reaches the user, so it needs no approval.
+		agent.WithAllowedTools("AskUserQuestion"),
+		agent.WithOnInit(func(a *agent.Agent) {
+			agent.RegisterTool(a.Tools(), &tools.AskTool{Callback: h.ask})
+		}),
+	)
+	h.client = agent.NewClient(opts...)
+	if tenant != "" {
+		sess := h.client.Session()
+		sess.Metadata.Tags = append(sess.Metadata.Tags, tenantTagPrefix+tenant)
+	}
+	h.id = h.client.Session().ID
+	h.snapshot()
+	return h
+}
+
+// sessionTenant returns the tenant owning sess: empty for sessions created
+// without authentication, or outside the server.
+func sessionTenant(sess *agent.Session) string {
+	for _, tag := range sess.Metadata.Tags {
+		if tenant, ok := strings.CutPrefix(tag, tenantTagPrefix); ok {
+			return tenant
+		}
+	}
+	return ""
+}
+
+// acquire returns the session with id for the request's tenant, loading it
+// from the store if needed. Callers must release it.
+func (s *Server) acquire(r *http.Request, id string) (*hostedSession, error) {
+	tenant := Tenant(r.Context())
+	for {
+		s.mu.Lock()
+		h, ok := s.sessions[id]
+		if ok && h.evicting != nil {
+			// Wait for the eviction's save, so the store holds the latest
+			// copy, or for the session to be kept loaded.
+			evicting := h.evicting
+			s.mu.Unlock()
+			select {
+			case <-evicting:
+				continue
+			case <-r.Context().Done():
+				return nil, r.Context().Err()
+			}
+		}
+		if ok {
+			defer s.mu.Unlock()
+			if h.tenant != tenant {
+				return nil, errSessionNotFound
+			}
+			h.refs++
+			return h, nil
+		}
+		closing := s.closing
+		s.mu.Unlock()
+		if closing {
+			return nil, errShuttingDown
+		}
+		break
+	}
+
+	h := s.newSession(tenant)
+	err := h.client.Resume(r.Context(), id)
+	if err == nil && sessionTenant(h.client.Session()) != tenant {
+		err = errSessionNotFound
+	}
+	if err != nil {
+		_ = h.client.Agent().Close()
+		if errors.Is(err, agent.ErrSessionNotFound) {
+			return nil, errSessionNotFound
+		}
+		return nil, err
+	}
+	h.id = id
+	h.snapshot()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.sessions[id]; ok {
+		// Loaded concurrently by another request.
+		_ = h.client.Agent().Close()
+		if existing.tenant != tenant {
+			return nil, errSessionNotFound
+		}
+		h = existing
+	} else {
+		s.sessions[id] = h
+	}
+	h.refs++
+	return h, nil
+}
+
+// register adds a newly created session.
+func (s *Server) register(h *hostedSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return errShuttingDown
+	}
+	s.sessions[h.id] = h
+	h.refs++
+	return nil
+}
+
+// release marks the end of a request's use of h.
+func (s *Server) release(h *hostedSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h.refs--
+	h.lastUsed = time.Now()
+}
+
+// snapshot records the session's state for GET while no query runs.
+func (h *hostedSession) snapshot() {
+	sess := h.client.Session()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.info = sessionInfo{
+		SessionID:    sess.ID,
+		Model:        string(sess.Metadata.Model),
+		NumTurns:     sess.Metadata.NumTurns,
+		TotalCostUSD: json.Number(sess.Metadata.TotalCost.String()),
+		CreatedAt:    sess.CreatedAt,
+		UpdatedAt:    sess.UpdatedAt,
+		Messages:     slices.Clone(sess.Messages),
+	}
+}
+
+// state returns the session's info with its live status.
+func (h *hostedSession) state() sessionInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	info := h.info
+	if info.Messages == nil {
+		info.Messages = []anthropic.MessageParam{}
+	}
+	info.Running = h.out != nil
+	info.Pending = []*promptMessage{}
+	for _, p := range h.pending {
+		info.Pending = append(info.Pending, p.msg)
+	}
+	slices.SortFunc(info.Pending, func(a, b *promptMessage) int {
+		return strings.Compare(a.RequestID, b.RequestID)
+	})
+	return info
+}
+
+// beginQuery routes prompts of the running query to out.
+func (h *hostedSession) beginQuery(out chan *promptMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.out = out
+}
+
+// endQuery stops routing prompts and records the session's new state.
+func (h *hostedSession) endQuery() {
+	h.mu.Lock()
+	h.out = nil
+	h.mu.Unlock()
+	h.snapshot()
+}
+
+// prompt sends msg to the running query's client and waits for the answer.
+func (h *hostedSession) prompt(ctx context.Context, msg *promptMessage) (promptAnswer, error) {
+	msg.SessionID = h.id
+	p := &pendingPrompt{msg: msg, answer: make(chan promptAnswer, 1)}
+
+	h.mu.Lock()
+	out := h.out
+	if out != nil {
+		h.pending[msg.RequestID] = p
+	}
+	h.mu.Unlock()
+	if out == nil {
+		return promptAnswer{}, errors.New("no query is running")
+	}
+	defer func() {
+		h.mu.Lock()
+		delete(h.pending, msg.RequestID)
+		h.mu.Unlock()
+	}()
+
+	select {
+	case out <- msg:
+	case <-ctx.Done():
+		return promptAnswer{}, ctx.Err()
+	}
+	select {
+	case a := <-p.answer:
+		return a, nil
+	case <-ctx.Done():
+		return promptAnswer{}, ctx.Err()
+	}
+}
+
+// answer delivers the client's answer to a pending prompt of type typ.
+func (h *hostedSession) answer(typ, requestID string, a promptAnswer) error {
+	h.mu.Lock()
+	p, ok := h.pending[requestID]
+	if ok && p.msg.Type == typ {
+		delete(h.pending, requestID)
+	}
+	h.mu.Unlock()
+	if !ok || p.msg.Type != typ {
+		return errRequestNotFound
+	}
+	p.answer <- a
+	return nil
+}
+
+// permissionHook asks the client whether a tool the permission policy
+// flagged for confirmation may run. No answer denies it.
+func (h *hostedSession) permissionHook(ctx context.Context, in *hook.Input) (*hook.Result, error) {
+	a, err := h.prompt(ctx, &promptMessage{
+		Type:      typePermissionRequest,
+		RequestID: agent.GenerateID(prefixPermission),
+		ToolName:  in.ToolName,
+		Input:     in.ToolInput,
+	})
+	if err != nil {
+		return &hook.Result{Block: true, Decision: "deny", Reason: "permission request not answered"}, nil
+	}
+	if !a.allow {
+		return &hook.Result{Block: true, Decision: "deny", Reason: a.reason}, nil
+	}
+	return &hook.Result{Decision: "allow"}, nil
+}
+
+// ask is the AskUserQuestion callback.
+func (h *hostedSession) ask(ctx context.Context, question string, options []tools.AskOption) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.promptTimeout)
+	defer cancel()
+	a, err := h.prompt(ctx, &promptMessage{
+		Type:      typeAskRequest,
+		RequestID: agent.GenerateID(prefixAsk),
+		Question:  question,
+		Options:   options,
+	})
+	return a.text, err
+}
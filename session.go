@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"crypto/sha256"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -15,6 +16,10 @@ type Session struct {
 	Metadata  SessionMeta
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// responses holds the details of assistant messages' responses, by
+	// messageKey. See RecordResponse.
+	responses map[[sha256.Size]byte]*MessageResponse
 }
 
 // SessionMeta contains summary statistics for a session.
@@ -23,6 +28,17 @@ type SessionMeta struct {
 	TotalCost   decimal.Decimal
 	TotalTokens Usage
 	NumTurns    int
+
+	// Title and Tags describe the session in listings. Title is set by
+	// WithAutoTitle if empty.
+	Title string
+	Tags  []string
+
+	// ParentID is the session this one was forked from, and BranchPoint
+	// the number of leading messages it shares with it. Both are zero for
+	// a session that is not a fork.
+	ParentID    string
+	BranchPoint int
 }
 
 // NewSession creates a new empty session.
@@ -35,6 +51,21 @@ func NewSession() *Session {
 	}
 }
 
+// AutoSavePolicy decides when a run saves its session to the agent's
+// session store. A run without a store never saves.
+type AutoSavePolicy int
+
+const (
+	// AutoSaveEveryTurn saves after each assistant response and each tool
+	// result, at most once per auto-save interval, and at the end of the
+	// run. This is the default.
+	AutoSaveEveryTurn AutoSavePolicy = iota
+	// AutoSaveEndOfRun saves once, before the ResultEvent is sent.
+	AutoSaveEndOfRun
+	// AutoSaveManual leaves saving to the caller.
+	AutoSaveManual
+)
+
 // SessionStore defines the interface for session persistence backends.
 type SessionStore interface {
 	Save(ctx context.Context, session *Session) error
@@ -4,7 +4,13 @@
 // Available stores:
 //   - [MemoryStore] keeps sessions in memory (useful for testing).
 //   - [FileStore] persists sessions as JSON files on disk.
+//   - [TranscriptStore] appends sessions to JSONL transcripts in the layout
+//     of Claude Code, and loads Claude Code's own transcripts.
 //
-// Both implement [agent.FullSessionStore] which extends [agent.SessionStore]
-// with List and Fork operations.
+// All implement [agent.FullSessionStore] which extends [agent.SessionStore]
+// with List and Fork operations. MemoryStore and FileStore also implement
+// [agent.SessionIndex], listing session summaries from an index kept up to
+// date by Save, with paging, filtering and text search. Package sqlstore
+// stores sessions in a SQL database shared by several processes, and
+// package export renders them as Markdown or HTML transcripts.
 package session
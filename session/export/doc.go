@@ -0,0 +1,16 @@
+// Package export renders agent transcripts for people to read: a session
+// with [Markdown] or [HTML], and the events of a team run with
+// [TeamMarkdown] or [TeamHTML].
+//
+// Transcripts show the user prompts, the assistant's text, its thinking
+// folded away, each tool call with its pretty-printed input and its
+// result, truncated past a limit with the rest behind an expander, and
+// images inline. The HTML is a single self-contained page.
+//
+// A session holds its messages but not what each response cost. Pass the
+// events its runs streamed with [WithEvents] to annotate each response
+// with its tokens and cost and mark where the context was compacted.
+//
+// Secrets are redacted from the text, tool inputs and results by
+// [DefaultRedactor] unless another [Redactor] is set with [WithRedactor].
+package export
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"io"
+	"maps"
+	"regexp"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/internal/budget"
+	"github.com/armatrix/claude-agent-sdk-go/teams"
+)
+
+// DefaultMaxResultLength is the number of characters of a tool result
+// shown before the rest is folded away.
+const DefaultMaxResultLength = 2000
+
+// Option configures an export.
+type Option func(*options)
+
+type options struct {
+	title           string
+	events          []agent.Event
+	pricing         map[anthropic.Model]agent.ModelPricing
+	redact          Redactor
+	maxResultLength int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		pricing:         budget.DefaultPricing,
+		redact:          DefaultRedactor,
+		maxResultLength: DefaultMaxResultLength,
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	if o.redact == nil {
+		o.redact = func(s string) string { return s }
+	}
+	return o
+}
+
+// WithTitle sets the transcript's title. Default: the session's title, or
+// its ID.
+func WithTitle(title string) Option {
+	return func(o *options) { o.title = title }
+}
+
+// WithEvents annotates the session's responses with the tokens and cost
+// reported by the events its runs streamed, and marks compactions. The
+// events are matched to the session's last responses, so they may cover
+// only its latest runs.
+func WithEvents(events []agent.Event) Option {
+	return func(o *options) { o.events = events }
+}
+
+// WithPricing overrides the per-model prices used to cost each response,
+// as agent.WithPricing does for runs.
+func WithPricing(pricing map[anthropic.Model]agent.ModelPricing) Option {
+	return func(o *options) {
+		merged := maps.Clone(budget.DefaultPricing)
+		maps.Copy(merged, pricing)
+		o.pricing = merged
+	}
+}
+
+// WithRedactor sets the Redactor applied to all exported text. Nil turns
+// redaction off. Default: DefaultRedactor.
+func WithRedactor(r Redactor) Option {
+	return func(o *options) { o.redact = r }
+}
+
+// WithRedactPatterns also redacts the matches of patterns, after the
+// Redactor set so far.
+func WithRedactPatterns(patterns ...*regexp.Regexp) Option {
+	return func(o *options) {
+		prev, extra := o.redact, RedactPatterns(patterns...)
+		if prev == nil {
+			o.redact = extra
+			return
+		}
+		o.redact = func(s string) string { return extra(prev(s)) }
+	}
+}
+
+// WithMaxResultLength sets how many characters of a tool result are shown
+// before the rest is folded away. Zero or less shows results in full.
+// Default: DefaultMaxResultLength.
+func WithMaxResultLength(n int) Option {
+	return func(o *options) { o.maxResultLength = n }
+}
+
+// Markdown writes the session as a Markdown transcript to w.
+func Markdown(w io.Writer, s *agent.Session, opts ...Option) error {
+	return writeMarkdown(w, newOptions(opts).session(s))
+}
+
+// HTML writes the session as a self-contained HTML page to w.
+func HTML(w io.Writer, s *agent.Session, opts ...Option) error {
+	return writeHTML(w, newOptions(opts).session(s))
+}
+
+// TeamMarkdown writes a team run, from the events its stream produced, as
+// a Markdown transcript to w, with one section per run of each member.
+// The events do not include the prompt each run started from. WithEvents
+// does not apply.
+func TeamMarkdown(w io.Writer, events []*teams.Event, opts ...Option) error {
+	return writeMarkdown(w, newOptions(opts).team(events))
+}
+
+// TeamHTML writes a team run like TeamMarkdown, as a self-contained HTML
+// page.
+func TeamHTML(w io.Writer, events []*teams.Event, opts ...Option) error {
+	return writeHTML(w, newOptions(opts).team(events))
+}
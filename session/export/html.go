@@ -0,0 +1,89 @@
+package export
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+func writeHTML(w io.Writer, t transcript) error {
+	return pageTemplate.Execute(w, t)
+}
+
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	// imageSource lets the data URIs of embedded images through, which
+	// html/template otherwise rejects.
+	"imageSource": func(src string) any {
+		if strings.HasPrefix(src, "data:image/") {
+			return template.URL(src)
+		}
+		return src
+	},
+	"lower": strings.ToLower,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font: 15px/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2328; max-width: 960px; margin: 2em auto; padding: 0 1em; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; border-bottom: 1px solid #d0d7de; padding-bottom: .3em; margin-top: 2em; }
+ul.facts { color: #59636e; padding-left: 1.2em; }
+.message { border: 1px solid #d0d7de; border-radius: 6px; margin: 1em 0; padding: .5em 1em; }
+.message.user { background: #f6f8fa; }
+.role { font-weight: 600; }
+.annotation { color: #59636e; font-size: .85em; margin-left: .5em; }
+.text { white-space: pre-wrap; overflow-wrap: anywhere; }
+.note { color: #59636e; font-style: italic; }
+pre { background: #f6f8fa; border: 1px solid #d0d7de; border-radius: 6px; padding: .6em; overflow-x: auto; white-space: pre-wrap; overflow-wrap: anywhere; }
+.tool-name { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; }
+.result.error pre { border-color: #cf222e; background: #ffebe9; }
+details > summary { cursor: pointer; color: #59636e; }
+img { max-width: 100%; border: 1px solid #d0d7de; border-radius: 6px; }
+.compaction { text-align: center; color: #59636e; border-top: 1px dashed #d0d7de; border-bottom: 1px dashed #d0d7de; padding: .3em; margin: 1em 0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{template "facts" .Facts}}
+{{- range .Sections}}
+{{- if .Heading}}
+<h2>{{.Heading}}</h2>
+{{template "facts" .Facts}}
+{{- end}}
+{{- range .Entries}}
+{{- if .Role}}
+<div class="message {{lower .Role}}">
+<div><span class="role">{{.Role}}</span>{{if .Annotation}}<span class="annotation">{{.Annotation}}</span>{{end}}</div>
+{{- range .Blocks}}
+{{template "block" .}}
+{{- end}}
+</div>
+{{- else}}
+<div class="compaction">Context compacted</div>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+{{define "facts"}}{{if .}}<ul class="facts">
+{{- range .}}
+<li>{{.}}</li>
+{{- end}}
+</ul>{{end}}{{end}}
+{{define "images"}}{{range .}}<p><img src="{{imageSource .}}" alt="image"></p>{{end}}{{end}}
+{{define "block"}}
+{{- if eq .Kind "text"}}<p class="text">{{.Text}}</p>
+{{- else if eq .Kind "thinking"}}<details class="thinking"><summary>Thinking</summary><p class="text">{{.Text}}</p></details>
+{{- else if eq .Kind "note"}}<p class="note">{{.Text}}</p>
+{{- else if eq .Kind "image"}}{{template "images" .Images}}
+{{- else if eq .Kind "tool_call"}}<div class="tool-call"><p>Tool call: <span class="tool-name">{{.Name}}</span></p><pre>{{.Input}}</pre>
+{{- with .Result}}{{template "block" .}}{{end}}</div>
+{{- else if eq .Kind "result"}}<div class="result{{if .IsError}} error{{end}}"><p>{{if .IsError}}Error{{else}}Result{{end}}:</p>
+{{- if .Truncated}}<pre>{{.Preview}}</pre><details><summary>Show all ({{.Hidden}} more characters)</summary><pre>{{.Text}}</pre></details>
+{{- else if or .Text (not .Images)}}<pre>{{.Text}}</pre>{{end}}
+{{- template "images" .Images}}</div>
+{{- end}}
+{{- end}}`))
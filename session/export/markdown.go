@@ -0,0 +1,104 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func writeMarkdown(w io.Writer, t transcript) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s\n\n", t.Title)
+	writeFacts(bw, t.Facts)
+	for _, sec := range t.Sections {
+		level := "##"
+		if sec.Heading != "" {
+			fmt.Fprintf(bw, "## %s\n\n", sec.Heading)
+			writeFacts(bw, sec.Facts)
+			level = "###"
+		}
+		for _, e := range sec.Entries {
+			if e.Role == "" {
+				bw.WriteString("---\n\n*Context compacted.*\n\n---\n\n")
+				continue
+			}
+			fmt.Fprintf(bw, "%s %s\n\n", level, e.Role)
+			if e.Annotation != "" {
+				fmt.Fprintf(bw, "*%s*\n\n", e.Annotation)
+			}
+			for _, b := range e.Blocks {
+				writeMarkdownBlock(bw, b)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func writeFacts(w *bufio.Writer, facts []string) {
+	if len(facts) == 0 {
+		return
+	}
+	for _, f := range facts {
+		fmt.Fprintf(w, "- %s\n", f)
+	}
+	w.WriteString("\n")
+}
+
+func writeMarkdownBlock(w *bufio.Writer, b block) {
+	switch b.Kind {
+	case blockText:
+		fmt.Fprintf(w, "%s\n\n", strings.TrimRight(b.Text, "\n"))
+	case blockThinking:
+		fmt.Fprintf(w, "<details>\n<summary>Thinking</summary>\n\n%s\n\n</details>\n\n", strings.TrimRight(b.Text, "\n"))
+	case blockNote:
+		fmt.Fprintf(w, "*%s*\n\n", b.Text)
+	case blockImage:
+		writeMarkdownImages(w, b.Images)
+	case blockToolCall:
+		fmt.Fprintf(w, "**Tool call:** `%s`\n\n", b.Name)
+		writeCode(w, "json", b.Input)
+		if b.Result != nil {
+			writeMarkdownBlock(w, *b.Result)
+		}
+	case blockResult:
+		label := "Result"
+		if b.IsError {
+			label = "Error"
+		}
+		fmt.Fprintf(w, "**%s:**\n\n", label)
+		if !b.Truncated() {
+			if b.Text != "" || len(b.Images) == 0 {
+				writeCode(w, "", b.Text)
+			}
+		} else {
+			writeCode(w, "", b.Preview)
+			fmt.Fprintf(w, "<details>\n<summary>Show all (%d more characters)</summary>\n\n", b.Hidden())
+			writeCode(w, "", b.Text)
+			w.WriteString("</details>\n\n")
+		}
+		writeMarkdownImages(w, b.Images)
+	}
+}
+
+func writeMarkdownImages(w *bufio.Writer, images []string) {
+	for _, src := range images {
+		fmt.Fprintf(w, "![image](%s)\n\n", src)
+	}
+}
+
+// writeCode writes text as a fenced code block, with a fence longer than
+// any run of backticks in it.
+func writeCode(w *bufio.Writer, lang, text string) {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	fmt.Fprintf(w, "%s%s\n%s\n%s\n\n", fence, lang, strings.TrimRight(text, "\n"), fence)
+}
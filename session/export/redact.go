@@ -0,0 +1,65 @@
+package export
+
+import "regexp"
+
+// Redacted replaces each secret a Redactor finds.
+const Redacted = "[REDACTED]"
+
+// Redactor returns text with the secrets in it replaced.
+type Redactor func(text string) string
+
+// defaultPatterns match common secrets. Where a pattern has a group named
+// secret, only that group is replaced, keeping e.g. the name assigned to.
+var defaultPatterns = []*regexp.Regexp{
+	// Anthropic, OpenAI and similar API keys.
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),
+	// AWS access key IDs.
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	// GitHub tokens.
+	regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})`),
+	// Slack tokens.
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	// Google API keys.
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`),
+	// PEM private keys.
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	// Bearer tokens in authorization headers.
+	regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9._~+/-]{16,}=*)`),
+	// Credentials in URLs.
+	regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^\s:/@]+:(?P<secret>[^\s@/]+)@`),
+	// Assignments to secret-sounding names, in code, env files and JSON.
+	regexp.MustCompile(`(?i)\b[a-z0-9_.-]*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[:=]\s*["']?(?P<secret>[^\s"',;]{6,})`),
+}
+
+// DefaultRedactor replaces common credentials: API keys of Anthropic,
+// OpenAI, AWS, GitHub, Slack and Google, private keys, bearer tokens,
+// passwords in URLs and values assigned to names like password, secret,
+// token or api_key.
+func DefaultRedactor(text string) string {
+	return redact(text, defaultPatterns)
+}
+
+// RedactPatterns returns a Redactor replacing the matches of patterns, or
+// of their group named secret if they have one.
+func RedactPatterns(patterns ...*regexp.Regexp) Redactor {
+	return func(text string) string { return redact(text, patterns) }
+}
+
+func redact(text string, patterns []*regexp.Regexp) string {
+	for _, re := range patterns {
+		group := re.SubexpIndex("secret")
+		if group < 0 {
+			text = re.ReplaceAllLiteralString(text, Redacted)
+			continue
+		}
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			loc := re.FindStringSubmatchIndex(match)
+			start, end := loc[2*group], loc[2*group+1]
+			if start < 0 {
+				return match
+			}
+			return match[:start] + Redacted + match[end:]
+		})
+	}
+	return text
+}
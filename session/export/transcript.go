@@ -0,0 +1,417 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/internal/budget"
+	"github.com/armatrix/claude-agent-sdk-go/teams"
+)
+
+// transcript is what both formats render: a title, facts about the run,
+// and sections of entries, one for a session and one per member run for
+// a team.
+type transcript struct {
+	Title    string
+	Facts    []string
+	Sections []section
+}
+
+type section struct {
+	// Heading is empty for the single section of a session.
+	Heading string
+	Facts   []string
+	Entries []entry
+}
+
+// entry is a message, or a compaction marker when Role is empty.
+type entry struct {
+	Role string
+	// Annotation gives the model, tokens and cost of a response.
+	Annotation string
+	Blocks     []block
+}
+
+type blockKind string
+
+const (
+	blockText     blockKind = "text"
+	blockThinking blockKind = "thinking"
+	blockToolCall blockKind = "tool_call"
+	blockResult   blockKind = "result"
+	blockImage    blockKind = "image"
+	blockNote     blockKind = "note"
+)
+
+type block struct {
+	Kind blockKind
+	// Text is the text of a text, thinking or note block, and the full
+	// text of a result.
+	Text string
+	// Name and Input are those of a tool call, the input pretty-printed.
+	Name  string
+	Input string
+	// Result is the result of a tool call, if the transcript has it.
+	Result *block
+	// IsError marks a failed tool result. Preview is the start of a
+	// result's text when it is truncated.
+	IsError bool
+	Preview string
+	// Images are the sources of an image block's image, or of the images
+	// of a result, as URLs or data URIs.
+	Images []string
+}
+
+// Truncated reports whether a result's text is longer than its preview.
+func (b block) Truncated() bool { return b.Preview != "" }
+
+// Hidden returns the number of characters of a result past its preview.
+func (b block) Hidden() int {
+	return len([]rune(b.Text)) - len([]rune(b.Preview))
+}
+
+func (o *options) session(s *agent.Session) transcript {
+	title := o.title
+	if title == "" {
+		title = s.Metadata.Title
+	}
+	if title == "" {
+		title = "Session " + s.ID
+	}
+	meta := s.Metadata
+	facts := []string{"Session: " + s.ID}
+	if meta.Model != "" {
+		facts = append(facts, "Model: "+string(meta.Model))
+	}
+	if !s.CreatedAt.IsZero() {
+		facts = append(facts, "Created: "+s.CreatedAt.Format(time.RFC3339))
+	}
+	if meta.ParentID != "" {
+		facts = append(facts, fmt.Sprintf("Forked from: %s at message %d", meta.ParentID, meta.BranchPoint))
+	}
+	if len(meta.Tags) > 0 {
+		facts = append(facts, "Tags: "+strings.Join(meta.Tags, ", "))
+	}
+	if meta.NumTurns > 0 {
+		facts = append(facts, fmt.Sprintf("Turns: %d", meta.NumTurns))
+	}
+	if u := meta.TotalTokens; u != (agent.Usage{}) {
+		facts = append(facts, "Tokens: "+formatUsage(u.InputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens))
+	}
+	if !meta.TotalCost.IsZero() {
+		facts = append(facts, "Cost: "+formatCost(meta.TotalCost))
+	}
+	return transcript{
+		Title:    o.redact(title),
+		Facts:    facts,
+		Sections: []section{{Entries: o.entries(s.Messages, o.events)}},
+	}
+}
+
+func (o *options) team(events []*teams.Event) transcript {
+	title := o.title
+	if title == "" {
+		title = "Team run"
+	}
+
+	// Each run of a member starts with a SystemEvent.
+	type run struct {
+		member string
+		events []agent.Event
+	}
+	var runs []*run
+	var members []string
+	current := make(map[string]*run)
+	for _, ev := range events {
+		if ev == nil || ev.AgentEvent == nil {
+			continue
+		}
+		r := current[ev.MemberName]
+		if _, ok := ev.AgentEvent.(*agent.SystemEvent); ok || r == nil {
+			if r == nil {
+				members = append(members, ev.MemberName)
+			}
+			r = &run{member: ev.MemberName}
+			current[ev.MemberName] = r
+			runs = append(runs, r)
+		}
+		r.events = append(r.events, ev.AgentEvent)
+	}
+
+	t := transcript{Title: o.redact(title)}
+	if len(members) > 0 {
+		t.Facts = append(t.Facts, "Members: "+strings.Join(members, ", "))
+	}
+	total := decimal.Zero
+	count := make(map[string]int)
+	for _, r := range runs {
+		count[r.member]++
+		heading := r.member
+		if count[r.member] > 1 {
+			heading = fmt.Sprintf("%s (run %d)", r.member, count[r.member])
+		}
+		sec := section{Heading: heading}
+		var messages []anthropic.MessageParam
+		for _, e := range r.events {
+			switch e := e.(type) {
+			case *agent.SystemEvent:
+				sec.Facts = append(sec.Facts, "Session: "+e.SessionID, "Model: "+string(e.Model))
+			case *agent.AssistantEvent:
+				messages = append(messages, e.Message.ToParam())
+			case *agent.UserEvent:
+				messages = append(messages, e.Message)
+			case *agent.ResultEvent:
+				total = total.Add(e.TotalCost)
+				sec.Facts = append(sec.Facts, o.resultFacts(e)...)
+			}
+		}
+		sec.Entries = o.entries(messages, r.events)
+		t.Sections = append(t.Sections, sec)
+	}
+	if !total.IsZero() {
+		t.Facts = append(t.Facts, "Cost: "+formatCost(total))
+	}
+	return t
+}
+
+func (o *options) resultFacts(e *agent.ResultEvent) []string {
+	result := fmt.Sprintf("Result: %s after %d turns", e.Subtype, e.NumTurns)
+	if u := e.Usage; u != (agent.Usage{}) {
+		result += ", " + formatUsage(u.InputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens)
+	}
+	if !e.TotalCost.IsZero() {
+		result += ", " + formatCost(e.TotalCost)
+	}
+	facts := []string{result}
+	for _, msg := range e.Errors {
+		facts = append(facts, "Error: "+o.redact(msg))
+	}
+	return facts
+}
+
+// entries converts messages to entries. A tool result is shown with the
+// call it answers, and events annotate the last responses.
+func (o *options) entries(messages []anthropic.MessageParam, events []agent.Event) []entry {
+	calls := make(map[string]bool)
+	results := make(map[string]anthropic.ContentBlockParamUnion)
+	for _, msg := range messages {
+		for _, b := range msg.Content {
+			switch {
+			case b.OfToolUse != nil:
+				calls[b.OfToolUse.ID] = true
+			case b.OfServerToolUse != nil:
+				calls[b.OfServerToolUse.ID] = true
+			case b.OfToolResult != nil:
+				results[b.OfToolResult.ToolUseID] = b
+			case b.OfWebSearchToolResult != nil:
+				results[b.OfWebSearchToolResult.ToolUseID] = b
+			}
+		}
+	}
+
+	// The k-th assistant event belongs to the k-th of the last responses.
+	var responses []anthropic.Message
+	compactions := make(map[int]int) // by the response they precede
+	for _, e := range events {
+		switch e := e.(type) {
+		case *agent.AssistantEvent:
+			responses = append(responses, e.Message)
+		case *agent.CompactEvent:
+			compactions[len(responses)]++
+		}
+	}
+	assistants := 0
+	for _, msg := range messages {
+		if msg.Role == anthropic.MessageParamRoleAssistant {
+			assistants++
+		}
+	}
+	first := assistants - len(responses)
+
+	var entries []entry
+	compacted := func(n int) {
+		for range compactions[n] {
+			entries = append(entries, entry{})
+		}
+	}
+	ordinal := 0
+	for _, msg := range messages {
+		e := entry{Role: "User"}
+		if msg.Role == anthropic.MessageParamRoleAssistant {
+			e.Role = "Assistant"
+		}
+		for _, b := range msg.Content {
+			if id := resultID(b); id != "" && calls[id] {
+				continue // shown with its call
+			}
+			e.Blocks = append(e.Blocks, o.block(b, results))
+		}
+		if msg.Role != anthropic.MessageParamRoleAssistant {
+			if len(e.Blocks) > 0 {
+				entries = append(entries, e)
+			}
+			continue
+		}
+		if i := ordinal - first; i >= 0 && i < len(responses) {
+			compacted(i)
+			e.Annotation = o.annotation(responses[i])
+		}
+		ordinal++
+		entries = append(entries, e)
+	}
+	compacted(len(responses))
+	return entries
+}
+
+func resultID(b anthropic.ContentBlockParamUnion) string {
+	switch {
+	case b.OfToolResult != nil:
+		return b.OfToolResult.ToolUseID
+	case b.OfWebSearchToolResult != nil:
+		return b.OfWebSearchToolResult.ToolUseID
+	}
+	return ""
+}
+
+func (o *options) block(b anthropic.ContentBlockParamUnion, results map[string]anthropic.ContentBlockParamUnion) block {
+	switch {
+	case b.OfText != nil:
+		return block{Kind: blockText, Text: o.redact(b.OfText.Text)}
+	case b.OfThinking != nil:
+		return block{Kind: blockThinking, Text: o.redact(b.OfThinking.Thinking)}
+	case b.OfRedactedThinking != nil:
+		return block{Kind: blockNote, Text: "Thinking redacted by the API."}
+	case b.OfImage != nil:
+		return block{Kind: blockImage, Images: []string{imageSource(b.OfImage.Source)}}
+	case b.OfDocument != nil:
+		title := "Document"
+		if b.OfDocument.Title.Valid() {
+			title += ": " + b.OfDocument.Title.Value
+		}
+		return block{Kind: blockNote, Text: o.redact(title)}
+	case b.OfSearchResult != nil:
+		return block{Kind: blockNote, Text: o.redact("Search result: " + b.OfSearchResult.Title)}
+	case b.OfToolUse != nil:
+		call := block{Kind: blockToolCall, Name: b.OfToolUse.Name, Input: o.prettyJSON(b.OfToolUse.Input)}
+		if r, ok := results[b.OfToolUse.ID]; ok {
+			result := o.block(r, nil)
+			call.Result = &result
+		}
+		return call
+	case b.OfServerToolUse != nil:
+		call := block{Kind: blockToolCall, Name: string(b.OfServerToolUse.Name), Input: o.prettyJSON(b.OfServerToolUse.Input)}
+		if r, ok := results[b.OfServerToolUse.ID]; ok {
+			result := o.block(r, nil)
+			call.Result = &result
+		}
+		return call
+	case b.OfToolResult != nil:
+		r := b.OfToolResult
+		result := block{Kind: blockResult, IsError: r.IsError.Valid() && r.IsError.Value}
+		var texts []string
+		for _, c := range r.Content {
+			switch {
+			case c.OfText != nil:
+				texts = append(texts, c.OfText.Text)
+			case c.OfImage != nil:
+				result.Images = append(result.Images, imageSource(c.OfImage.Source))
+			case c.OfSearchResult != nil:
+				texts = append(texts, "Search result: "+c.OfSearchResult.Title)
+			case c.OfDocument != nil:
+				texts = append(texts, "Document")
+			}
+		}
+		o.setResultText(&result, strings.Join(texts, "\n"))
+		return result
+	case b.OfWebSearchToolResult != nil:
+		result := block{Kind: blockResult}
+		o.setResultText(&result, o.prettyJSON(b.OfWebSearchToolResult.Content))
+		return result
+	}
+	return block{Kind: blockNote, Text: "Unsupported content block."}
+}
+
+// setResultText sets the redacted text of a result and, when it is longer
+// than the limit, its preview.
+func (o *options) setResultText(b *block, text string) {
+	b.Text = o.redact(text)
+	if o.maxResultLength <= 0 {
+		return
+	}
+	if runes := []rune(b.Text); len(runes) > o.maxResultLength {
+		b.Preview = string(runes[:o.maxResultLength])
+	}
+}
+
+func imageSource(src anthropic.ImageBlockParamSourceUnion) string {
+	switch {
+	case src.OfBase64 != nil:
+		return "data:" + string(src.OfBase64.MediaType) + ";base64," + src.OfBase64.Data
+	case src.OfURL != nil:
+		return src.OfURL.URL
+	}
+	return ""
+}
+
+// prettyJSON returns v as indented, redacted JSON.
+func (o *options) prettyJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return o.redact(fmt.Sprint(v))
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return o.redact(string(data))
+	}
+	return o.redact(buf.String())
+}
+
+// annotation describes the model, tokens and cost of a response.
+func (o *options) annotation(msg anthropic.Message) string {
+	u := msg.Usage
+	parts := []string{string(msg.Model), formatUsage(u.InputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens)}
+	if p, ok := o.pricing[msg.Model]; ok {
+		parts = append(parts, formatCost(p.Cost(budget.Usage{
+			InputTokens:              int(u.InputTokens),
+			OutputTokens:             int(u.OutputTokens),
+			CacheReadInputTokens:     int(u.CacheReadInputTokens),
+			CacheCreationInputTokens: int(u.CacheCreationInputTokens),
+		})))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func formatUsage(input, output, cacheRead, cacheCreation int64) string {
+	s := formatCount(input) + " in, " + formatCount(output) + " out"
+	if cacheRead > 0 {
+		s += ", " + formatCount(cacheRead) + " cache read"
+	}
+	if cacheCreation > 0 {
+		s += ", " + formatCount(cacheCreation) + " cache write"
+	}
+	return s
+}
+
+// formatCount formats n with thousands separators.
+func formatCount(n int64) string {
+	s := fmt.Sprint(n)
+	start := 0
+	if n < 0 {
+		start = 1
+	}
+	for i := len(s) - 3; i > start; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+func formatCost(cost decimal.Decimal) string {
+	return "$" + cost.StringFixed(4)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -18,18 +20,53 @@ import (
 // FileStore persists sessions as individual JSON files in a directory.
 // Each session is stored as {id}.json.
 type FileStore struct {
-	dir string
+	dir    string
+	logger *slog.Logger
+
+	// mu guards index, which caches the summaries of session files. It is
+	// built on the first ListSummaries and refreshed from files changed
+	// since.
+	mu    sync.Mutex
+	index map[string]fileIndexEntry
+}
+
+// fileIndexEntry is an index entry and the state of the file it was read
+// from.
+type fileIndexEntry struct {
+	indexEntry
+	modTime time.Time
+	size    int64
 }
 
-var _ agent.FullSessionStore = (*FileStore)(nil)
+var (
+	_ agent.FullSessionStore = (*FileStore)(nil)
+	_ agent.SessionIndex     = (*FileStore)(nil)
+)
+
+// FileStoreOption configures a FileStore.
+type FileStoreOption func(*FileStore)
+
+// WithLogger logs session files List skips because they cannot be loaded
+// to l at warn level.
+func WithLogger(l *slog.Logger) FileStoreOption {
+	return func(f *FileStore) {
+		if l != nil {
+			f.logger = l
+		}
+	}
+}
 
 // NewFileStore creates a FileStore that saves sessions to the given directory.
 // The directory is created if it does not exist.
-func NewFileStore(dir string) (*FileStore, error) {
+func NewFileStore(dir string, opts ...FileStoreOption) (*FileStore, error) {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("create session dir: %w", err)
 	}
-	return &FileStore{dir: dir}, nil
+	f := &FileStore{dir: dir, logger: slog.New(slog.DiscardHandler)}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f, nil
 }
 
 // sessionJSON is the on-disk representation of a session.
@@ -46,6 +83,10 @@ type metadataJSON struct {
 	TotalCost   string `json:"total_cost"`
 	TotalTokens agent.Usage `json:"total_tokens"`
 	NumTurns    int    `json:"num_turns"`
+	Title       string   `json:"title,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	ParentID    string   `json:"parent_id,omitempty"`
+	BranchPoint int      `json:"branch_point,omitempty"`
 }
 
 // Save writes a session to disk as JSON.
@@ -62,6 +103,10 @@ func (f *FileStore) Save(_ context.Context, session *agent.Session) error {
 			TotalCost:   session.Metadata.TotalCost.String(),
 			TotalTokens: session.Metadata.TotalTokens,
 			NumTurns:    session.Metadata.NumTurns,
+			Title:       session.Metadata.Title,
+			Tags:        session.Metadata.Tags,
+			ParentID:    session.Metadata.ParentID,
+			BranchPoint: session.Metadata.BranchPoint,
 		},
 		CreatedAt: session.CreatedAt,
 		UpdatedAt: session.UpdatedAt,
@@ -76,6 +121,9 @@ func (f *FileStore) Save(_ context.Context, session *agent.Session) error {
 	if err := os.WriteFile(path, b, 0o644); err != nil {
 		return fmt.Errorf("write session file: %w", err)
 	}
+	if info, err := os.Stat(path); err == nil {
+		f.indexPut(session, info)
+	}
 	return nil
 }
 
@@ -85,7 +133,7 @@ func (f *FileStore) Load(_ context.Context, id string) (*agent.Session, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("session not found: %s", id)
+			return nil, fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
 		}
 		return nil, fmt.Errorf("read session file: %w", err)
 	}
@@ -108,6 +156,10 @@ func (f *FileStore) Load(_ context.Context, id string) (*agent.Session, error) {
 			TotalCost:   cost,
 			TotalTokens: data.Metadata.TotalTokens,
 			NumTurns:    data.Metadata.NumTurns,
+			Title:       data.Metadata.Title,
+			Tags:        data.Metadata.Tags,
+			ParentID:    data.Metadata.ParentID,
+			BranchPoint: data.Metadata.BranchPoint,
 		},
 		CreatedAt: data.CreatedAt,
 		UpdatedAt: data.UpdatedAt,
@@ -119,10 +171,13 @@ func (f *FileStore) Delete(_ context.Context, id string) error {
 	path := f.path(id)
 	if err := os.Remove(path); err != nil {
 		if os.IsNotExist(err) {
-			return fmt.Errorf("session not found: %s", id)
+			return fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
 		}
 		return fmt.Errorf("remove session file: %w", err)
 	}
+	f.mu.Lock()
+	delete(f.index, id)
+	f.mu.Unlock()
 	return nil
 }
 
@@ -142,7 +197,10 @@ func (f *FileStore) List(_ context.Context) ([]*agent.Session, error) {
 		id := strings.TrimSuffix(entry.Name(), ".json")
 		s, err := f.Load(context.Background(), id)
 		if err != nil {
-			continue // skip corrupt files
+			// skip corrupt files
+			f.logger.Warn("skipping unreadable session file",
+				agent.LogKeySessionID, id, "path", filepath.Join(f.dir, entry.Name()), "error", err)
+			continue
 		}
 		sessions = append(sessions, s)
 	}
@@ -163,6 +221,65 @@ func (f *FileStore) Fork(ctx context.Context, id string) (*agent.Session, error)
 	return forked, nil
 }
 
+// ListSummaries returns a page of the summaries of the sessions q selects.
+// Files written by other processes are picked up by their modification
+// time and size.
+func (f *FileStore) ListSummaries(ctx context.Context, q agent.SessionQuery) (*agent.SessionPage, error) {
+	dirEntries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read session dir: %w", err)
+	}
+
+	f.mu.Lock()
+	if f.index == nil {
+		f.index = make(map[string]fileIndexEntry)
+	}
+	seen := make(map[string]bool, len(dirEntries))
+	for _, entry := range dirEntries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		seen[id] = true
+		if cached, ok := f.index[id]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			continue
+		}
+		s, err := f.Load(ctx, id)
+		if err != nil {
+			f.logger.Warn("skipping unreadable session file",
+				agent.LogKeySessionID, id, "path", filepath.Join(f.dir, entry.Name()), "error", err)
+			delete(f.index, id)
+			continue
+		}
+		f.index[id] = fileIndexEntry{indexEntry: newIndexEntry(s), modTime: info.ModTime(), size: info.Size()}
+	}
+	entries := make([]indexEntry, 0, len(f.index))
+	for id, e := range f.index {
+		if !seen[id] {
+			delete(f.index, id)
+			continue
+		}
+		entries = append(entries, e.indexEntry)
+	}
+	f.mu.Unlock()
+
+	return querySummaries(entries, q)
+}
+
+// indexPut updates the index, once built, with a session just written to
+// the file described by info.
+func (f *FileStore) indexPut(s *agent.Session, info os.FileInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.index != nil {
+		f.index[s.ID] = fileIndexEntry{indexEntry: newIndexEntry(s), modTime: info.ModTime(), size: info.Size()}
+	}
+}
+
 func (f *FileStore) path(id string) string {
 	return filepath.Join(f.dir, id+".json")
 }
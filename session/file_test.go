@@ -1,7 +1,9 @@
 package session_test
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
@@ -184,6 +186,22 @@ func TestFileStore_RoundTripMetadata(t *testing.T) {
 	assert.Equal(t, int64(200), loaded.Metadata.TotalTokens.CacheReadInputTokens)
 }
 
+func TestFileStore_ListLogsCorruptFiles(t *testing.T) {
+	var buf bytes.Buffer
+	dir := tempDir(t)
+	store, err := session.NewFileStore(dir, session.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, store.Save(ctx, makeSession("valid")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644))
+
+	list, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Contains(t, buf.String(), `level=WARN msg="skipping unreadable session file" session_id=broken`)
+}
+
 func TestFileStore_ListSkipsNonJSON(t *testing.T) {
 	dir := tempDir(t)
 	store, err := session.NewFileStore(dir)
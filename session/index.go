@@ -0,0 +1,128 @@
+package session
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// indexEntry is what a store's index keeps of a session: its summary and
+// the lowercased text SessionQuery.Text searches.
+type indexEntry struct {
+	summary agent.SessionSummary
+	text    string
+}
+
+func newIndexEntry(s *agent.Session) indexEntry {
+	return indexEntry{summary: s.Summary(), text: searchText(s)}
+}
+
+// searchText returns the session's title and the text of its messages and
+// tool results, lowercased.
+func searchText(s *agent.Session) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(s.Metadata.Title))
+	write := func(text string) {
+		b.WriteByte('\n')
+		b.WriteString(strings.ToLower(text))
+	}
+	for _, msg := range s.Messages {
+		for _, block := range msg.Content {
+			switch {
+			case block.OfText != nil:
+				write(block.OfText.Text)
+			case block.OfToolResult != nil:
+				for _, c := range block.OfToolResult.Content {
+					if c.OfText != nil {
+						write(c.OfText.Text)
+					}
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// matches reports whether e is selected by q's filters.
+func (e *indexEntry) matches(q *agent.SessionQuery) bool {
+	s := &e.summary
+	switch {
+	case q.Model != "" && s.Model != q.Model:
+		return false
+	case q.ParentID != "" && s.ParentID != q.ParentID:
+		return false
+	case !q.UpdatedAfter.IsZero() && !s.UpdatedAt.After(q.UpdatedAfter):
+		return false
+	case !q.UpdatedBefore.IsZero() && !s.UpdatedAt.Before(q.UpdatedBefore):
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !slices.Contains(s.Tags, tag) {
+			return false
+		}
+	}
+	for _, word := range strings.Fields(strings.ToLower(q.Text)) {
+		if !strings.Contains(e.text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// querySummaries returns the page of entries q selects. Cursors are
+// offsets into the sorted matches.
+func querySummaries(entries []indexEntry, q agent.SessionQuery) (*agent.SessionPage, error) {
+	offset := 0
+	if q.Cursor != "" {
+		n, err := strconv.Atoi(q.Cursor)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("session: invalid cursor %q", q.Cursor)
+		}
+		offset = n
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = agent.DefaultSessionPageSize
+	}
+
+	var matched []agent.SessionSummary
+	for i := range entries {
+		if entries[i].matches(&q) {
+			matched = append(matched, entries[i].summary)
+		}
+	}
+	slices.SortFunc(matched, func(a, b agent.SessionSummary) int {
+		var c int
+		switch q.Sort {
+		case agent.SortByCreated:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		case agent.SortByCost:
+			c = a.TotalCost.Cmp(b.TotalCost)
+		case agent.SortByTurns:
+			c = cmp.Compare(a.NumTurns, b.NumTurns)
+		default:
+			c = a.UpdatedAt.Compare(b.UpdatedAt)
+		}
+		if c == 0 {
+			c = strings.Compare(a.ID, b.ID)
+		}
+		if !q.Ascending {
+			c = -c
+		}
+		return c
+	})
+
+	page := &agent.SessionPage{Sessions: []agent.SessionSummary{}}
+	if offset < len(matched) {
+		end := min(offset+limit, len(matched))
+		page.Sessions = matched[offset:end]
+		if end < len(matched) {
+			page.NextCursor = strconv.Itoa(end)
+		}
+	}
+	return page, nil
+}
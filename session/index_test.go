@@ -0,0 +1,199 @@
+package session_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/session"
+)
+
+// seedIndex saves five sessions, sess-0 to sess-4, updated an hour apart
+// in that order, with costs and turns rising with their number.
+func seedIndex(t *testing.T, store agent.SessionStore) time.Time {
+	t.Helper()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		s := makeSession(fmt.Sprintf("sess-%d", i))
+		s.CreatedAt = base.Add(-time.Duration(i) * time.Hour)
+		s.UpdatedAt = base.Add(time.Duration(i) * time.Hour)
+		s.Metadata.NumTurns = i
+		s.Metadata.TotalCost = decimal.NewFromInt(int64(10 - i))
+		if i%2 == 1 {
+			s.Metadata.Model = "claude-haiku-4-5"
+			s.Metadata.Tags = []string{"odd"}
+		}
+		s.Messages = []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf("Question number %d about Kubernetes", i))),
+			anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("toolu_1", map[string]any{}, "Bash")),
+			anthropic.NewUserMessage(anthropic.NewToolResultBlock("toolu_1", fmt.Sprintf("output-%d", i), false)),
+		}
+		require.NoError(t, store.Save(context.Background(), s))
+	}
+	return base
+}
+
+func summaryIDs(page *agent.SessionPage) []string {
+	ids := make([]string, len(page.Sessions))
+	for i, s := range page.Sessions {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+func testSessionIndex(t *testing.T, store agent.SessionIndex) {
+	ctx := context.Background()
+	base := seedIndex(t, store)
+
+	list := func(q agent.SessionQuery) []string {
+		t.Helper()
+		page, err := store.ListSummaries(ctx, q)
+		require.NoError(t, err)
+		return summaryIDs(page)
+	}
+
+	t.Run("summary", func(t *testing.T) {
+		page, err := store.ListSummaries(ctx, agent.SessionQuery{Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, page.Sessions, 1)
+		s := page.Sessions[0]
+		assert.Equal(t, "sess-4", s.ID)
+		assert.Equal(t, "Question number 4 about Kubernetes", s.FirstPrompt)
+		assert.Equal(t, 4, s.NumTurns)
+		assert.True(t, s.UpdatedAt.Equal(base.Add(4*time.Hour)))
+		assert.NotEmpty(t, page.NextCursor)
+	})
+
+	t.Run("sort", func(t *testing.T) {
+		assert.Equal(t, []string{"sess-4", "sess-3", "sess-2", "sess-1", "sess-0"}, list(agent.SessionQuery{}))
+		assert.Equal(t, []string{"sess-0", "sess-1", "sess-2", "sess-3", "sess-4"}, list(agent.SessionQuery{Ascending: true}))
+		assert.Equal(t, []string{"sess-0", "sess-1", "sess-2", "sess-3", "sess-4"}, list(agent.SessionQuery{Sort: agent.SortByCreated}))
+		assert.Equal(t, []string{"sess-0", "sess-1", "sess-2", "sess-3", "sess-4"}, list(agent.SessionQuery{Sort: agent.SortByCost}))
+		assert.Equal(t, []string{"sess-4", "sess-3", "sess-2", "sess-1", "sess-0"}, list(agent.SessionQuery{Sort: agent.SortByTurns}))
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		assert.Equal(t, []string{"sess-3", "sess-1"}, list(agent.SessionQuery{Model: "claude-haiku-4-5"}))
+		assert.Equal(t, []string{"sess-3", "sess-1"}, list(agent.SessionQuery{Tags: []string{"odd"}}))
+		assert.Empty(t, list(agent.SessionQuery{Tags: []string{"odd", "even"}}))
+		assert.Equal(t, []string{"sess-3", "sess-2"}, list(agent.SessionQuery{
+			UpdatedAfter:  base.Add(time.Hour),
+			UpdatedBefore: base.Add(4 * time.Hour),
+		}))
+	})
+
+	t.Run("search", func(t *testing.T) {
+		assert.Len(t, list(agent.SessionQuery{Text: "kubernetes"}), 5)
+		assert.Equal(t, []string{"sess-2"}, list(agent.SessionQuery{Text: "NUMBER 2"}))
+		assert.Equal(t, []string{"sess-3"}, list(agent.SessionQuery{Text: "output-3"}), "tool results are searched")
+		assert.Empty(t, list(agent.SessionQuery{Text: "kubernetes helm"}))
+	})
+
+	t.Run("paginate", func(t *testing.T) {
+		var ids []string
+		q := agent.SessionQuery{Limit: 2}
+		for {
+			page, err := store.ListSummaries(ctx, q)
+			require.NoError(t, err)
+			ids = append(ids, summaryIDs(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		assert.Equal(t, []string{"sess-4", "sess-3", "sess-2", "sess-1", "sess-0"}, ids)
+
+		_, err := store.ListSummaries(ctx, agent.SessionQuery{Cursor: "bogus"})
+		assert.Error(t, err)
+	})
+
+	t.Run("branches", func(t *testing.T) {
+		s, err := store.Load(ctx, "sess-2")
+		require.NoError(t, err)
+		branch, err := s.ForkAt(1)
+		require.NoError(t, err)
+		require.NoError(t, store.Save(ctx, branch))
+
+		loaded, err := store.Load(ctx, branch.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "sess-2", loaded.Metadata.ParentID)
+		assert.Equal(t, 1, loaded.Metadata.BranchPoint)
+
+		page, err := store.ListSummaries(ctx, agent.SessionQuery{ParentID: "sess-2"})
+		require.NoError(t, err)
+		require.Len(t, page.Sessions, 1)
+		assert.Equal(t, branch.ID, page.Sessions[0].ID)
+
+		require.NoError(t, store.Delete(ctx, branch.ID))
+	})
+
+	t.Run("updates", func(t *testing.T) {
+		s, err := store.Load(ctx, "sess-0")
+		require.NoError(t, err)
+		s.Metadata.Title = "Cluster upgrade"
+		s.UpdatedAt = base.Add(10 * time.Hour)
+		require.NoError(t, store.Save(ctx, s))
+
+		page, err := store.ListSummaries(ctx, agent.SessionQuery{Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, page.Sessions, 1)
+		assert.Equal(t, "Cluster upgrade", page.Sessions[0].Title)
+		assert.Equal(t, []string{"sess-0"}, list(agent.SessionQuery{Text: "upgrade"}), "titles are searched")
+
+		require.NoError(t, store.Delete(ctx, "sess-0"))
+		assert.Empty(t, list(agent.SessionQuery{Text: "upgrade"}))
+	})
+}
+
+func TestMemoryStore_ListSummaries(t *testing.T) {
+	testSessionIndex(t, session.NewMemoryStore())
+}
+
+func TestFileStore_ListSummaries(t *testing.T) {
+	store, err := session.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	testSessionIndex(t, store)
+}
+
+func TestFileStore_ListSummariesSeesOtherWriters(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store, err := session.NewFileStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, makeSession("sess-1")))
+	page, err := store.ListSummaries(ctx, agent.SessionQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+
+	// Another process writes and removes session files.
+	other, err := session.NewFileStore(dir)
+	require.NoError(t, err)
+	s := makeSession("sess-2")
+	s.Metadata.Title = "From elsewhere"
+	require.NoError(t, other.Save(ctx, s))
+	require.NoError(t, os.Remove(filepath.Join(dir, "sess-1.json")))
+
+	page, err = store.ListSummaries(ctx, agent.SessionQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, "From elsewhere", page.Sessions[0].Title)
+}
+
+func TestClient_ContinueLatestUsesIndex(t *testing.T) {
+	store := session.NewMemoryStore()
+	seedIndex(t, store)
+
+	client := agent.NewClient(agent.WithSessionStore(store))
+	require.NoError(t, client.ContinueLatest(context.Background()))
+	assert.Equal(t, "sess-4", client.Session().ID)
+	require.NoError(t, client.Close())
+}
@@ -4,6 +4,7 @@ package session
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,14 +18,19 @@ import (
 type MemoryStore struct {
 	mu       sync.RWMutex
 	sessions map[string]*agent.Session
+	index    map[string]indexEntry
 }
 
-var _ agent.FullSessionStore = (*MemoryStore)(nil)
+var (
+	_ agent.FullSessionStore = (*MemoryStore)(nil)
+	_ agent.SessionIndex     = (*MemoryStore)(nil)
+)
 
 // NewMemoryStore creates a new empty MemoryStore.
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
 		sessions: make(map[string]*agent.Session),
+		index:    make(map[string]indexEntry),
 	}
 }
 
@@ -37,18 +43,19 @@ func (m *MemoryStore) Save(_ context.Context, session *agent.Session) error {
 	defer m.mu.Unlock()
 
 	m.sessions[session.ID] = deepCopy(session)
+	m.index[session.ID] = newIndexEntry(session)
 	return nil
 }
 
 // Load retrieves a session by ID. Returns a deep copy so callers cannot mutate store state.
-// Returns an error if the session is not found.
+// Returns an error wrapping agent.ErrSessionNotFound if the session is not found.
 func (m *MemoryStore) Load(_ context.Context, id string) (*agent.Session, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	s, ok := m.sessions[id]
 	if !ok {
-		return nil, fmt.Errorf("session not found: %s", id)
+		return nil, fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
 	}
 	return deepCopy(s), nil
 }
@@ -59,9 +66,10 @@ func (m *MemoryStore) Delete(_ context.Context, id string) error {
 	defer m.mu.Unlock()
 
 	if _, ok := m.sessions[id]; !ok {
-		return fmt.Errorf("session not found: %s", id)
+		return fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
 	}
 	delete(m.sessions, id)
+	delete(m.index, id)
 	return nil
 }
 
@@ -84,14 +92,26 @@ func (m *MemoryStore) Fork(_ context.Context, id string) (*agent.Session, error)
 
 	original, ok := m.sessions[id]
 	if !ok {
-		return nil, fmt.Errorf("session not found: %s", id)
+		return nil, fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
 	}
 
 	forked := original.Clone()
 	m.sessions[forked.ID] = deepCopy(forked)
+	m.index[forked.ID] = newIndexEntry(forked)
 	return forked, nil
 }
 
+// ListSummaries returns a page of the summaries of the sessions q selects.
+func (m *MemoryStore) ListSummaries(_ context.Context, q agent.SessionQuery) (*agent.SessionPage, error) {
+	m.mu.RLock()
+	entries := make([]indexEntry, 0, len(m.index))
+	for _, e := range m.index {
+		entries = append(entries, e)
+	}
+	m.mu.RUnlock()
+	return querySummaries(entries, q)
+}
+
 // deepCopy creates a deep copy of a session.
 func deepCopy(s *agent.Session) *agent.Session {
 	msgs := make([]anthropic.MessageParam, len(s.Messages))
@@ -105,6 +125,10 @@ func deepCopy(s *agent.Session) *agent.Session {
 			TotalCost:   s.Metadata.TotalCost,
 			TotalTokens: s.Metadata.TotalTokens,
 			NumTurns:    s.Metadata.NumTurns,
+			Title:       s.Metadata.Title,
+			Tags:        slices.Clone(s.Metadata.Tags),
+			ParentID:    s.Metadata.ParentID,
+			BranchPoint: s.Metadata.BranchPoint,
 		},
 		CreatedAt: s.CreatedAt,
 		UpdatedAt: time.Time(s.UpdatedAt),
@@ -0,0 +1,321 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// Page sizes of ListPage.
+const (
+	DefaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// ListOptions selects a page of sessions. Zero fields do not filter.
+type ListOptions struct {
+	// Limit is the page size, at most 500. Default: DefaultPageSize.
+	Limit int
+	// Cursor continues a listing from the Page.NextCursor of the previous
+	// page, with the same filters and order.
+	Cursor string
+
+	// Sort orders the sessions, descending unless Ascending is set. Ties
+	// are ordered by ID.
+	Sort      agent.SessionSort
+	Ascending bool
+
+	Model         anthropic.Model
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	MinTurns      int
+	// ParentID selects the sessions forked from a session.
+	ParentID string
+
+	// IncludeMessages loads the sessions' messages; without it only their
+	// metadata is read.
+	IncludeMessages bool
+}
+
+// Page is one page of sessions, in the order ListOptions.Sort selects.
+type Page struct {
+	Sessions []*agent.Session
+	// NextCursor continues the listing; it is empty on the last page.
+	NextCursor string
+}
+
+// ListPage returns a page of sessions matching opts, most recently updated
+// first unless opts.Sort orders them otherwise.
+func (s *Store) ListPage(ctx context.Context, opts ListOptions) (*Page, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	var (
+		where []string
+		args  []any
+	)
+	if opts.Model != "" {
+		where = append(where, "model = ?")
+		args = append(args, string(opts.Model))
+	}
+	if !opts.UpdatedAfter.IsZero() {
+		where = append(where, "updated_at > ?")
+		args = append(args, opts.UpdatedAfter.UnixNano())
+	}
+	if !opts.UpdatedBefore.IsZero() {
+		where = append(where, "updated_at < ?")
+		args = append(args, opts.UpdatedBefore.UnixNano())
+	}
+	if opts.ParentID != "" {
+		where = append(where, "parent_id = ?")
+		args = append(args, opts.ParentID)
+	}
+	if opts.MinTurns > 0 {
+		where = append(where, "num_turns >= ?")
+		args = append(args, opts.MinTurns)
+	}
+	order := sortOrder(opts.Sort)
+	cmp, dir := "<", "DESC"
+	if opts.Ascending {
+		cmp, dir = ">", "ASC"
+	}
+	if opts.Cursor != "" {
+		value, id, err := order.decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		key := order.param()
+		where = append(where, "("+order.expr+" "+cmp+" "+key+" OR ("+order.expr+" = "+key+" AND id "+cmp+" ?))")
+		args = append(args, value, value, id)
+	}
+
+	query := `SELECT ` + sessionColumns + ` FROM agent_sessions`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// One extra row tells whether there is a next page.
+	query += ` ORDER BY ` + order.expr + ` ` + dir + `, id ` + dir + ` LIMIT ` + strconv.Itoa(limit+1)
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query sessions: %w", err)
+	}
+	sessions, versions, err := scanSessions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Sessions: sessions}
+	if len(sessions) > limit {
+		page.Sessions = sessions[:limit]
+		last := page.Sessions[limit-1]
+		page.NextCursor = order.encodeCursor(last)
+	}
+	if opts.IncludeMessages {
+		// Sessions listed with their messages can be saved as if loaded.
+		for i, session := range page.Sessions {
+			hashes, err := s.loadMessages(ctx, s.db, session)
+			if err != nil {
+				return nil, err
+			}
+			s.mu.Lock()
+			s.known[session.ID] = &savedState{version: versions[i], hashes: hashes}
+			s.mu.Unlock()
+		}
+	}
+	return page, nil
+}
+
+// ListSummaries returns a page of the summaries of the sessions q selects.
+// It reads the sessions' metadata and first prompt without their other
+// messages, except that q.Text is matched by reading the messages of each
+// session the other filters select. Tags are matched as sessions are read,
+// so a page with tags may scan more rows than it returns.
+func (s *Store) ListSummaries(ctx context.Context, q agent.SessionQuery) (*agent.SessionPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = agent.DefaultSessionPageSize
+	}
+	opts := ListOptions{
+		Limit:           min(limit, maxPageSize),
+		Cursor:          q.Cursor,
+		Sort:            q.Sort,
+		Ascending:       q.Ascending,
+		Model:           q.Model,
+		UpdatedAfter:    q.UpdatedAfter,
+		UpdatedBefore:   q.UpdatedBefore,
+		ParentID:        q.ParentID,
+		IncludeMessages: q.Text != "",
+	}
+	filtered := len(q.Tags) > 0 || q.Text != ""
+
+	page := &agent.SessionPage{Sessions: []agent.SessionSummary{}}
+	var last *agent.Session
+	for {
+		p, err := s.ListPage(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range p.Sessions {
+			if !matchesQuery(session, &q) {
+				continue
+			}
+			if len(page.Sessions) == opts.Limit {
+				// Another session matches; continue after the last one
+				// returned.
+				page.NextCursor = sortOrder(q.Sort).encodeCursor(last)
+				return page, nil
+			}
+			summary, err := s.summary(ctx, session)
+			if err != nil {
+				return nil, err
+			}
+			page.Sessions = append(page.Sessions, summary)
+			last = session
+		}
+		if !filtered || p.NextCursor == "" {
+			page.NextCursor = p.NextCursor
+			return page, nil
+		}
+		opts.Cursor = p.NextCursor
+	}
+}
+
+// matchesQuery reports whether session has every tag of q, and if q.Text
+// is set, every word of it in its title or message text, ignoring case.
+func matchesQuery(session *agent.Session, q *agent.SessionQuery) bool {
+	for _, tag := range q.Tags {
+		if !slices.Contains(session.Metadata.Tags, tag) {
+			return false
+		}
+	}
+	words := strings.Fields(strings.ToLower(q.Text))
+	if len(words) == 0 {
+		return true
+	}
+	texts := []string{strings.ToLower(session.Metadata.Title)}
+	for _, msg := range session.Messages {
+		for _, block := range msg.Content {
+			switch {
+			case block.OfText != nil:
+				texts = append(texts, strings.ToLower(block.OfText.Text))
+			case block.OfToolResult != nil:
+				for _, c := range block.OfToolResult.Content {
+					if c.OfText != nil {
+						texts = append(texts, strings.ToLower(c.OfText.Text))
+					}
+				}
+			}
+		}
+	}
+	text := strings.Join(texts, "\n")
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// summary returns the summary of a listed session, reading its first user
+// message if its messages were not loaded.
+func (s *Store) summary(ctx context.Context, session *agent.Session) (agent.SessionSummary, error) {
+	if len(session.Messages) > 0 {
+		return session.Summary(), nil
+	}
+	var content string
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(
+		`SELECT content FROM agent_messages WHERE session_id = ? AND role = ? ORDER BY seq LIMIT 1`),
+		session.ID, string(anthropic.MessageParamRoleUser)).Scan(&content)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return session.Summary(), nil
+	case err != nil:
+		return agent.SessionSummary{}, fmt.Errorf("query first prompt of %s: %w", session.ID, err)
+	}
+	var msg anthropic.MessageParam
+	if err := json.Unmarshal([]byte(content), &msg); err != nil {
+		return agent.SessionSummary{}, fmt.Errorf("unmarshal first prompt of %s: %w", session.ID, err)
+	}
+	withPrompt := *session
+	withPrompt.Messages = []anthropic.MessageParam{msg}
+	return withPrompt.Summary(), nil
+}
+
+// costExpr orders by total_cost, which is stored as text.
+const costExpr = `CAST(total_cost AS DECIMAL(30,10))`
+
+// order is the column a listing is sorted by.
+type order struct {
+	sort agent.SessionSort
+	expr string
+}
+
+func sortOrder(sort agent.SessionSort) order {
+	switch sort {
+	case agent.SortByCreated:
+		return order{sort, "created_at"}
+	case agent.SortByCost:
+		return order{sort, costExpr}
+	case agent.SortByTurns:
+		return order{sort, "num_turns"}
+	default:
+		return order{agent.SortByUpdated, "updated_at"}
+	}
+}
+
+// param is the placeholder a cursor's value is compared through.
+func (o order) param() string {
+	if o.sort == agent.SortByCost {
+		return `CAST(? AS DECIMAL(30,10))`
+	}
+	return "?"
+}
+
+// encodeCursor returns an opaque cursor for the position after session.
+func (o order) encodeCursor(session *agent.Session) string {
+	var value string
+	switch o.sort {
+	case agent.SortByCreated:
+		value = strconv.FormatInt(session.CreatedAt.UnixNano(), 10)
+	case agent.SortByCost:
+		value = session.Metadata.TotalCost.String()
+	case agent.SortByTurns:
+		value = strconv.Itoa(session.Metadata.NumTurns)
+	default:
+		value = strconv.FormatInt(session.UpdatedAt.UnixNano(), 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(value + ":" + session.ID))
+}
+
+// decodeCursor returns the sort value and ID of the session a cursor
+// continues after.
+func (o order) decodeCursor(cursor string) (any, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		value, id, ok := strings.Cut(string(data), ":")
+		if ok && o.sort == agent.SortByCost {
+			if _, derr := decimal.NewFromString(value); derr == nil {
+				return value, id, nil
+			}
+		} else if n, perr := strconv.ParseInt(value, 10, 64); ok && perr == nil {
+			return n, id, nil
+		}
+	}
+	return nil, "", fmt.Errorf("sqlstore: invalid cursor %q", cursor)
+}
@@ -0,0 +1,219 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect adapts the store's SQL to a database.
+type Dialect struct {
+	name string
+	// dollar binds arguments as $1, $2, ... instead of ?.
+	dollar bool
+	// text is the column type of message content, which can be large.
+	text string
+	// indexes and columns count the indexes and columns of a table with
+	// a name; their arguments are the table and the name.
+	indexes, columns string
+}
+
+// Supported dialects.
+var (
+	SQLite = Dialect{
+		name:    "sqlite",
+		text:    "TEXT",
+		indexes: `SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?`,
+		columns: `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`,
+	}
+	Postgres = Dialect{
+		name:    "postgres",
+		dollar:  true,
+		text:    "TEXT",
+		indexes: `SELECT COUNT(*) FROM pg_indexes WHERE schemaname = current_schema() AND tablename = ? AND indexname = ?`,
+		columns: `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+	}
+	MySQL = Dialect{
+		name:    "mysql",
+		text:    "LONGTEXT",
+		indexes: `SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`,
+		columns: `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+	}
+)
+
+// String returns the dialect's name.
+func (d Dialect) String() string {
+	return d.name
+}
+
+// rebind rewrites the ? placeholders of query for the dialect.
+func (d Dialect) rebind(query string) string {
+	if !d.dollar {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// migration is one version of the schema, applied in a transaction.
+type migration struct {
+	version int
+	steps   func(d Dialect) []step
+}
+
+// step is one statement of a migration. MySQL commits each DDL statement
+// as it runs, so a migration that fails there leaves the steps before the
+// failure applied; a step whose object exists is skipped, so the
+// migration can be retried.
+type step struct {
+	stmt string
+	// exists reports whether the step was applied; nil when stmt is
+	// idempotent.
+	exists func(ctx context.Context, tx *sql.Tx, d Dialect) (bool, error)
+}
+
+func createIndex(name, table, columns string) step {
+	return step{
+		stmt: "CREATE INDEX " + name + " ON " + table + " (" + columns + ")",
+		exists: func(ctx context.Context, tx *sql.Tx, d Dialect) (bool, error) {
+			return d.count(ctx, tx, d.indexes, table, name)
+		},
+	}
+}
+
+func addColumn(table, column, definition string) step {
+	return step{
+		stmt: "ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition,
+		exists: func(ctx context.Context, tx *sql.Tx, d Dialect) (bool, error) {
+			return d.count(ctx, tx, d.columns, table, column)
+		},
+	}
+}
+
+// count reports whether query counts any rows.
+func (d Dialect) count(ctx context.Context, tx *sql.Tx, query string, args ...any) (bool, error) {
+	var n int
+	if err := tx.QueryRowContext(ctx, d.rebind(query), args...).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// migrations are applied in order. Never edit one that has been released;
+// append a new one instead.
+var migrations = []migration{
+	{version: 1, steps: func(d Dialect) []step {
+		return []step{
+			{stmt: `CREATE TABLE IF NOT EXISTS agent_sessions (
+				id                    VARCHAR(255) NOT NULL PRIMARY KEY,
+				version               BIGINT       NOT NULL,
+				model                 VARCHAR(255) NOT NULL,
+				total_cost            VARCHAR(64)  NOT NULL,
+				input_tokens          BIGINT       NOT NULL,
+				output_tokens         BIGINT       NOT NULL,
+				cache_read_tokens     BIGINT       NOT NULL,
+				cache_creation_tokens BIGINT       NOT NULL,
+				num_turns             INTEGER      NOT NULL,
+				created_at            BIGINT       NOT NULL,
+				updated_at            BIGINT       NOT NULL
+			)`},
+			createIndex("agent_sessions_updated", "agent_sessions", "updated_at, id"),
+			{stmt: `CREATE TABLE IF NOT EXISTS agent_messages (
+				session_id VARCHAR(255) NOT NULL,
+				seq        INTEGER      NOT NULL,
+				role       VARCHAR(16)  NOT NULL,
+				content    ` + d.text + ` NOT NULL,
+				PRIMARY KEY (session_id, seq)
+			)`},
+		}
+	}},
+	{version: 2, steps: func(d Dialect) []step {
+		return []step{
+			addColumn("agent_sessions", "title", "VARCHAR(1024) NOT NULL DEFAULT ''"),
+			// tags is a JSON array, NULL when the session has none.
+			addColumn("agent_sessions", "tags", d.text),
+		}
+	}},
+	{version: 3, steps: func(d Dialect) []step {
+		return []step{
+			addColumn("agent_sessions", "parent_id", "VARCHAR(255) NOT NULL DEFAULT ''"),
+			addColumn("agent_sessions", "branch_point", "INTEGER NOT NULL DEFAULT 0"),
+			createIndex("agent_sessions_parent", "agent_sessions", "parent_id"),
+		}
+	}},
+}
+
+// SchemaVersion is the schema version Migrate brings a database to.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate creates the store's tables, or updates them to the current
+// schema. Each migration runs in its own transaction and skips the steps
+// already applied, so a failed one can be retried, including on MySQL,
+// where the steps before the failure stay applied. New runs it unless
+// WithoutMigrations is given.
+func (s *Store) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS agent_schema_migrations (
+		version    INTEGER NOT NULL PRIMARY KEY,
+		applied_at BIGINT  NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	var current sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM agent_schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	for _, m := range migrations {
+		if int64(m.version) <= current.Int64 {
+			continue
+		}
+		if err := s.apply(ctx, m); err != nil {
+			return fmt.Errorf("migrate to version %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) apply(ctx context.Context, m migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, st := range m.steps(s.dialect) {
+		if st.exists != nil {
+			applied, err := st.exists(ctx, tx, s.dialect)
+			if err != nil {
+				return fmt.Errorf("inspect schema: %w", err)
+			}
+			if applied {
+				continue
+			}
+		}
+		if _, err := tx.ExecContext(ctx, st.stmt); err != nil {
+			return err
+		}
+	}
+	// A concurrent migration of the same version fails here, on the
+	// primary key, and rolls back.
+	if _, err := tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO agent_schema_migrations (version, applied_at) VALUES (?, ?)`),
+		m.version, time.Now().UnixNano()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
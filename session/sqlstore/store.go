@@ -0,0 +1,385 @@
+// Package sqlstore persists agent sessions in a database through
+// database/sql, so instances of a service can share them.
+//
+// Sessions are kept in two tables: agent_sessions holds one row of
+// metadata per session, and agent_messages one row per message, so saving
+// a session inserts only its new messages. The schema is created and
+// migrated by [Store.Migrate].
+//
+// Saves use optimistic concurrency: each session row has a version, and a
+// Save fails with [ErrConflict] if another writer saved the session since
+// this store last loaded or saved it. Load the session again to continue
+// from the other writer's state.
+//
+// The store does not import a driver; register one for the database, such
+// as modernc.org/sqlite, github.com/jackc/pgx/v5/stdlib or
+// github.com/go-sql-driver/mysql, and pass the matching [Dialect].
+package sqlstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// ErrConflict is returned by Save when the session was saved or deleted by
+// another writer since this store last loaded or saved it.
+var ErrConflict = errors.New("sqlstore: session was modified concurrently")
+
+// Store is an agent.FullSessionStore backed by a SQL database.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+
+	mu    sync.Mutex
+	known map[string]*savedState // by session ID
+}
+
+var (
+	_ agent.FullSessionStore = (*Store)(nil)
+	_ agent.SessionIndex     = (*Store)(nil)
+)
+
+// savedState is what the store last read or wrote of a session.
+type savedState struct {
+	version int64
+	hashes  [][sha256.Size]byte // of each message's content
+}
+
+// Option configures a Store.
+type Option func(*options)
+
+type options struct {
+	dialect     Dialect
+	skipMigrate bool
+}
+
+// WithDialect sets the database's SQL dialect. Default: SQLite.
+func WithDialect(d Dialect) Option {
+	return func(o *options) { o.dialect = d }
+}
+
+// WithoutMigrations skips migrating the schema in New, for deployments
+// that run Migrate separately.
+func WithoutMigrations() Option {
+	return func(o *options) { o.skipMigrate = true }
+}
+
+// New returns a store on db and migrates its schema.
+func New(ctx context.Context, db *sql.DB, opts ...Option) (*Store, error) {
+	o := options{dialect: SQLite}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	s := &Store{
+		db:      db,
+		dialect: o.dialect,
+		known:   make(map[string]*savedState),
+	}
+	if !o.skipMigrate {
+		if err := s.Migrate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Save writes the session's metadata and the messages added since this
+// store last loaded or saved it. If earlier messages changed, those from
+// the first change on are replaced.
+func (s *Store) Save(ctx context.Context, session *agent.Session) error {
+	if session == nil {
+		return fmt.Errorf("session is nil")
+	}
+	contents := make([][]byte, len(session.Messages))
+	hashes := make([][sha256.Size]byte, len(session.Messages))
+	for i, msg := range session.Messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("marshal message %d: %w", i, err)
+		}
+		contents[i], hashes[i] = data, sha256.Sum256(data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.known[session.ID]
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	version, err := s.writeSession(ctx, tx, session, prev)
+	if err != nil {
+		return err
+	}
+
+	shared := 0
+	if prev != nil {
+		for shared < len(prev.hashes) && shared < len(hashes) && prev.hashes[shared] == hashes[shared] {
+			shared++
+		}
+		if shared < len(prev.hashes) {
+			if _, err := tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM agent_messages WHERE session_id = ? AND seq >= ?`),
+				session.ID, shared); err != nil {
+				return fmt.Errorf("delete replaced messages: %w", err)
+			}
+		}
+	}
+	insert := s.dialect.rebind(`INSERT INTO agent_messages (session_id, seq, role, content) VALUES (?, ?, ?, ?)`)
+	for i := shared; i < len(session.Messages); i++ {
+		if _, err := tx.ExecContext(ctx, insert, session.ID, i, string(session.Messages[i].Role), string(contents[i])); err != nil {
+			return fmt.Errorf("insert message %d: %w", i, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	s.known[session.ID] = &savedState{version: version, hashes: hashes}
+	return nil
+}
+
+// writeSession inserts or updates the session row and returns its new
+// version. A session this store has not seen must not exist yet.
+func (s *Store) writeSession(ctx context.Context, tx *sql.Tx, session *agent.Session, prev *savedState) (int64, error) {
+	meta := session.Metadata
+	var tags sql.NullString
+	if len(meta.Tags) > 0 {
+		b, err := json.Marshal(meta.Tags)
+		if err != nil {
+			return 0, fmt.Errorf("marshal tags: %w", err)
+		}
+		tags = sql.NullString{String: string(b), Valid: true}
+	}
+	args := []any{
+		string(meta.Model), meta.TotalCost.String(),
+		meta.TotalTokens.InputTokens, meta.TotalTokens.OutputTokens,
+		meta.TotalTokens.CacheReadInputTokens, meta.TotalTokens.CacheCreationInputTokens,
+		meta.NumTurns, session.CreatedAt.UnixNano(), session.UpdatedAt.UnixNano(),
+		meta.Title, tags, meta.ParentID, meta.BranchPoint,
+	}
+
+	if prev == nil {
+		var exists int
+		err := tx.QueryRowContext(ctx, s.dialect.rebind(`SELECT 1 FROM agent_sessions WHERE id = ?`), session.ID).Scan(&exists)
+		if err == nil {
+			return 0, fmt.Errorf("%w: %s was saved by another writer; load it first", ErrConflict, session.ID)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("check session: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO agent_sessions
+			(model, total_cost, input_tokens, output_tokens, cache_read_tokens, cache_creation_tokens,
+			 num_turns, created_at, updated_at, title, tags, parent_id, branch_point, id, version)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`), append(args, session.ID)...)
+		if err != nil {
+			return 0, fmt.Errorf("insert session: %w", err)
+		}
+		return 1, nil
+	}
+
+	res, err := tx.ExecContext(ctx, s.dialect.rebind(`UPDATE agent_sessions SET
+		model = ?, total_cost = ?, input_tokens = ?, output_tokens = ?, cache_read_tokens = ?,
+		cache_creation_tokens = ?, num_turns = ?, created_at = ?, updated_at = ?, title = ?, tags = ?,
+		parent_id = ?, branch_point = ?, version = version + 1
+		WHERE id = ? AND version = ?`), append(args, session.ID, prev.version)...)
+	if err != nil {
+		return 0, fmt.Errorf("update session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("update session: %w", err)
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrConflict, session.ID)
+	}
+	return prev.version + 1, nil
+}
+
+// Load reads a session and its messages.
+func (s *Store) Load(ctx context.Context, id string) (*agent.Session, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, s.dialect.rebind(`SELECT `+sessionColumns+` FROM agent_sessions WHERE id = ?`), id)
+	if err != nil {
+		return nil, fmt.Errorf("query session: %w", err)
+	}
+	sessions, versions, err := scanSessions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
+	}
+	session := sessions[0]
+	hashes, err := s.loadMessages(ctx, tx, session)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	s.mu.Lock()
+	s.known[id] = &savedState{version: versions[0], hashes: hashes}
+	s.mu.Unlock()
+	return session, nil
+}
+
+// loadMessages reads the session's messages into it and returns the hash
+// of each.
+func (s *Store) loadMessages(ctx context.Context, q querier, session *agent.Session) ([][sha256.Size]byte, error) {
+	rows, err := q.QueryContext(ctx, s.dialect.rebind(`SELECT content FROM agent_messages WHERE session_id = ? ORDER BY seq`), session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("query messages: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes [][sha256.Size]byte
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		var msg anthropic.MessageParam
+		if err := json.Unmarshal([]byte(content), &msg); err != nil {
+			return nil, fmt.Errorf("unmarshal message %d: %w", len(session.Messages), err)
+		}
+		session.Messages = append(session.Messages, msg)
+		hashes = append(hashes, sha256.Sum256([]byte(content)))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query messages: %w", err)
+	}
+	return hashes, nil
+}
+
+// Delete removes a session and its messages.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM agent_sessions WHERE id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
+	}
+	if _, err := tx.ExecContext(ctx, s.dialect.rebind(`DELETE FROM agent_messages WHERE session_id = ?`), id); err != nil {
+		return fmt.Errorf("delete messages: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	delete(s.known, id)
+	return nil
+}
+
+// List returns every session with its messages. Use ListPage to list
+// large stores.
+func (s *Store) List(ctx context.Context) ([]*agent.Session, error) {
+	var sessions []*agent.Session
+	opts := ListOptions{Limit: maxPageSize, IncludeMessages: true}
+	for {
+		page, err := s.ListPage(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, page.Sessions...)
+		if page.NextCursor == "" {
+			return sessions, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// Fork loads a session, clones it with a new ID, saves the clone, and returns it.
+func (s *Store) Fork(ctx context.Context, id string) (*agent.Session, error) {
+	original, err := s.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	forked := original.Clone()
+	if err := s.Save(ctx, forked); err != nil {
+		return nil, fmt.Errorf("save forked session: %w", err)
+	}
+	return forked, nil
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+const sessionColumns = `id, version, model, total_cost, input_tokens, output_tokens,
+	cache_read_tokens, cache_creation_tokens, num_turns, created_at, updated_at, title, tags, parent_id, branch_point`
+
+// scanSessions reads and closes rows of sessionColumns.
+func scanSessions(rows *sql.Rows) ([]*agent.Session, []int64, error) {
+	defer rows.Close()
+
+	var (
+		sessions []*agent.Session
+		versions []int64
+	)
+	for rows.Next() {
+		var (
+			session          agent.Session
+			version          int64
+			model, cost      string
+			created, updated int64
+			tags             sql.NullString
+		)
+		tokens := &session.Metadata.TotalTokens
+		if err := rows.Scan(&session.ID, &version, &model, &cost,
+			&tokens.InputTokens, &tokens.OutputTokens, &tokens.CacheReadInputTokens, &tokens.CacheCreationInputTokens,
+			&session.Metadata.NumTurns, &created, &updated,
+			&session.Metadata.Title, &tags, &session.Metadata.ParentID, &session.Metadata.BranchPoint); err != nil {
+			return nil, nil, fmt.Errorf("scan session: %w", err)
+		}
+		session.Metadata.Model = anthropic.Model(model)
+		if d, err := decimal.NewFromString(cost); err == nil {
+			session.Metadata.TotalCost = d
+		}
+		if tags.Valid {
+			if err := json.Unmarshal([]byte(tags.String), &session.Metadata.Tags); err != nil {
+				return nil, nil, fmt.Errorf("unmarshal tags of %s: %w", session.ID, err)
+			}
+		}
+		session.CreatedAt = time.Unix(0, created)
+		session.UpdatedAt = time.Unix(0, updated)
+		sessions = append(sessions, &session)
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("query sessions: %w", err)
+	}
+	return sessions, versions, nil
+}
@@ -0,0 +1,387 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/session/sqlstore"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "sessions.db"))
+	require.NoError(t, err)
+	// SQLite allows one writer; a single connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newStore(t *testing.T, db *sql.DB) *sqlstore.Store {
+	t.Helper()
+	store, err := sqlstore.New(context.Background(), db)
+	require.NoError(t, err)
+	return store
+}
+
+func makeSession(id string) *agent.Session {
+	s := agent.NewSession()
+	s.ID = id
+	s.Messages = []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("hello")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("hi")),
+	}
+	s.Metadata.Model = "claude-opus-4-6"
+	s.Metadata.TotalCost = decimal.RequireFromString("0.0125")
+	s.Metadata.TotalTokens = agent.Usage{InputTokens: 10, OutputTokens: 5, CacheReadInputTokens: 3, CacheCreationInputTokens: 2}
+	s.Metadata.NumTurns = 1
+	s.Metadata.Title = "Greeting"
+	s.Metadata.Tags = []string{"demo", "smoke"}
+	return s
+}
+
+func messageCount(t *testing.T, db *sql.DB, id string) int {
+	t.Helper()
+	var n int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM agent_messages WHERE session_id = ?`, id).Scan(&n))
+	return n
+}
+
+func TestStore_SaveAndLoad(t *testing.T) {
+	store := newStore(t, openDB(t))
+	ctx := context.Background()
+
+	s := makeSession("sess-1")
+	require.NoError(t, store.Save(ctx, s))
+
+	loaded, err := store.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.Equal(t, "sess-1", loaded.ID)
+	require.Len(t, loaded.Messages, 2)
+	assert.Equal(t, "hi", loaded.Messages[1].Content[0].OfText.Text)
+	assert.Equal(t, anthropic.MessageParamRoleAssistant, loaded.Messages[1].Role)
+	assert.Equal(t, s.Metadata.Model, loaded.Metadata.Model)
+	assert.True(t, s.Metadata.TotalCost.Equal(loaded.Metadata.TotalCost))
+	assert.Equal(t, s.Metadata.TotalTokens, loaded.Metadata.TotalTokens)
+	assert.Equal(t, 1, loaded.Metadata.NumTurns)
+	assert.Equal(t, "Greeting", loaded.Metadata.Title)
+	assert.Equal(t, []string{"demo", "smoke"}, loaded.Metadata.Tags)
+	assert.True(t, s.CreatedAt.Equal(loaded.CreatedAt))
+	assert.True(t, s.UpdatedAt.Equal(loaded.UpdatedAt))
+
+	_, err = store.Load(ctx, "missing")
+	assert.ErrorIs(t, err, agent.ErrSessionNotFound)
+	assert.Error(t, store.Save(ctx, nil))
+}
+
+func TestStore_SaveAppendsAndReplacesMessages(t *testing.T) {
+	db := openDB(t)
+	store := newStore(t, db)
+	ctx := context.Background()
+
+	s := makeSession("sess-1")
+	require.NoError(t, store.Save(ctx, s))
+	var firstRowID int64
+	require.NoError(t, db.QueryRow(`SELECT rowid FROM agent_messages WHERE session_id = ? AND seq = 0`, "sess-1").Scan(&firstRowID))
+
+	s.Messages = append(s.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock("more")))
+	require.NoError(t, store.Save(ctx, s))
+	assert.Equal(t, 3, messageCount(t, db, "sess-1"))
+	var rowID int64
+	require.NoError(t, db.QueryRow(`SELECT rowid FROM agent_messages WHERE session_id = ? AND seq = 0`, "sess-1").Scan(&rowID))
+	assert.Equal(t, firstRowID, rowID, "unchanged messages are not rewritten")
+
+	// Rewriting history replaces messages from the first change.
+	s.Messages = []anthropic.MessageParam{s.Messages[0], anthropic.NewAssistantMessage(anthropic.NewTextBlock("summary"))}
+	require.NoError(t, store.Save(ctx, s))
+	assert.Equal(t, 2, messageCount(t, db, "sess-1"))
+
+	loaded, err := store.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	require.Len(t, loaded.Messages, 2)
+	assert.Equal(t, "summary", loaded.Messages[1].Content[0].OfText.Text)
+}
+
+func TestStore_ConcurrentWritersConflict(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	a := newStore(t, db)
+	b := newStore(t, db)
+
+	require.NoError(t, a.Save(ctx, makeSession("sess-1")))
+
+	// b never loaded the session, so it cannot overwrite it.
+	assert.ErrorIs(t, b.Save(ctx, makeSession("sess-1")), sqlstore.ErrConflict)
+
+	sa, err := a.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	sb, err := b.Load(ctx, "sess-1")
+	require.NoError(t, err)
+
+	sa.Messages = append(sa.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock("from a")))
+	require.NoError(t, a.Save(ctx, sa))
+
+	sb.Messages = append(sb.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock("from b")))
+	assert.ErrorIs(t, b.Save(ctx, sb), sqlstore.ErrConflict)
+
+	// Reloading picks up a's state and lets b continue.
+	sb, err = b.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.Equal(t, "from a", sb.Messages[2].Content[0].OfText.Text)
+	sb.Metadata.NumTurns = 2
+	require.NoError(t, b.Save(ctx, sb))
+
+	// Deleting the session also conflicts with a later save.
+	require.NoError(t, b.Delete(ctx, "sess-1"))
+	assert.ErrorIs(t, a.Save(ctx, sa), sqlstore.ErrConflict)
+}
+
+func TestStore_Delete(t *testing.T) {
+	db := openDB(t)
+	store := newStore(t, db)
+	ctx := context.Background()
+
+	require.NoError(t, store.Save(ctx, makeSession("sess-1")))
+	require.NoError(t, store.Delete(ctx, "sess-1"))
+	assert.Equal(t, 0, messageCount(t, db, "sess-1"))
+	_, err := store.Load(ctx, "sess-1")
+	assert.ErrorIs(t, err, agent.ErrSessionNotFound)
+	assert.ErrorIs(t, store.Delete(ctx, "sess-1"), agent.ErrSessionNotFound)
+
+	// A deleted session can be saved again.
+	require.NoError(t, store.Save(ctx, makeSession("sess-1")))
+}
+
+func TestStore_Fork(t *testing.T) {
+	store := newStore(t, openDB(t))
+	ctx := context.Background()
+
+	require.NoError(t, store.Save(ctx, makeSession("sess-1")))
+	forked, err := store.Fork(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, "sess-1", forked.ID)
+
+	loaded, err := store.Load(ctx, forked.ID)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Messages, 2)
+	assert.Equal(t, "sess-1", loaded.Metadata.ParentID)
+	assert.Equal(t, 2, loaded.Metadata.BranchPoint)
+
+	page, err := store.ListPage(ctx, sqlstore.ListOptions{ParentID: "sess-1"})
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, forked.ID, page.Sessions[0].ID)
+}
+
+func TestStore_ListPage(t *testing.T) {
+	store := newStore(t, openDB(t))
+	ctx := context.Background()
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 7 {
+		s := makeSession(fmt.Sprintf("sess-%d", i))
+		s.UpdatedAt = base.Add(time.Duration(i) * time.Hour)
+		s.Metadata.NumTurns = i
+		if i%2 == 1 {
+			s.Metadata.Model = "claude-haiku-4-5"
+		}
+		require.NoError(t, store.Save(ctx, s))
+	}
+
+	var ids []string
+	opts := sqlstore.ListOptions{Limit: 3}
+	for {
+		page, err := store.ListPage(ctx, opts)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Sessions), 3)
+		for _, s := range page.Sessions {
+			assert.Empty(t, s.Messages)
+			ids = append(ids, s.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"sess-6", "sess-5", "sess-4", "sess-3", "sess-2", "sess-1", "sess-0"}, ids)
+
+	page, err := store.ListPage(ctx, sqlstore.ListOptions{
+		Model:           "claude-haiku-4-5",
+		UpdatedAfter:    base.Add(time.Hour),
+		MinTurns:        2,
+		IncludeMessages: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 2)
+	assert.Equal(t, "sess-5", page.Sessions[0].ID)
+	assert.Equal(t, "sess-3", page.Sessions[1].ID)
+	assert.Len(t, page.Sessions[0].Messages, 2)
+	assert.Empty(t, page.NextCursor)
+
+	_, err = store.ListPage(ctx, sqlstore.ListOptions{Cursor: "not a cursor"})
+	assert.Error(t, err)
+
+	all, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 7)
+}
+
+func TestStore_ListSummaries(t *testing.T) {
+	store := newStore(t, openDB(t))
+	ctx := context.Background()
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		s := makeSession(fmt.Sprintf("sess-%d", i))
+		s.CreatedAt = base.Add(-time.Duration(i) * time.Hour)
+		s.UpdatedAt = base.Add(time.Duration(i) * time.Hour)
+		s.Metadata.NumTurns = i
+		s.Metadata.TotalCost = decimal.NewFromInt(int64(10 - i))
+		s.Metadata.Tags = nil
+		if i%2 == 1 {
+			s.Metadata.Tags = []string{"odd"}
+		}
+		s.Messages = []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf("Question number %d about Kubernetes", i))),
+			anthropic.NewAssistantMessage(anthropic.NewTextBlock(fmt.Sprintf("answer-%d", i))),
+		}
+		require.NoError(t, store.Save(ctx, s))
+	}
+
+	list := func(q agent.SessionQuery) []string {
+		t.Helper()
+		var ids []string
+		for {
+			page, err := store.ListSummaries(ctx, q)
+			require.NoError(t, err)
+			for _, s := range page.Sessions {
+				ids = append(ids, s.ID)
+			}
+			if page.NextCursor == "" {
+				return ids
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+
+	page, err := store.ListSummaries(ctx, agent.SessionQuery{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, "sess-4", page.Sessions[0].ID)
+	assert.Equal(t, "Question number 4 about Kubernetes", page.Sessions[0].FirstPrompt)
+	assert.Equal(t, "Greeting", page.Sessions[0].Title)
+	assert.NotEmpty(t, page.NextCursor)
+
+	for _, limit := range []int{0, 2} {
+		assert.Equal(t, []string{"sess-4", "sess-3", "sess-2", "sess-1", "sess-0"}, list(agent.SessionQuery{Limit: limit}))
+		assert.Equal(t, []string{"sess-0", "sess-1", "sess-2", "sess-3", "sess-4"}, list(agent.SessionQuery{Limit: limit, Ascending: true}))
+		assert.Equal(t, []string{"sess-0", "sess-1", "sess-2", "sess-3", "sess-4"}, list(agent.SessionQuery{Limit: limit, Sort: agent.SortByCreated}))
+		assert.Equal(t, []string{"sess-0", "sess-1", "sess-2", "sess-3", "sess-4"}, list(agent.SessionQuery{Limit: limit, Sort: agent.SortByCost}))
+		assert.Equal(t, []string{"sess-4", "sess-3", "sess-2", "sess-1", "sess-0"}, list(agent.SessionQuery{Limit: limit, Sort: agent.SortByTurns}))
+		assert.Equal(t, []string{"sess-3", "sess-1"}, list(agent.SessionQuery{Limit: 1, Tags: []string{"odd"}}))
+		assert.Equal(t, []string{"sess-2"}, list(agent.SessionQuery{Limit: limit, Text: "NUMBER 2"}))
+		assert.Equal(t, []string{"sess-3"}, list(agent.SessionQuery{Limit: limit, Text: "answer-3"}))
+	}
+	assert.Empty(t, list(agent.SessionQuery{Tags: []string{"odd", "even"}}))
+
+	_, err = store.ListSummaries(ctx, agent.SessionQuery{Cursor: "bogus"})
+	assert.Error(t, err)
+}
+
+func TestStore_ClientContinueLatestUsesSummaries(t *testing.T) {
+	store := newStore(t, openDB(t))
+	ctx := context.Background()
+	older := makeSession("sess-1")
+	older.UpdatedAt = time.Now().Add(-time.Hour)
+	require.NoError(t, store.Save(ctx, older))
+	require.NoError(t, store.Save(ctx, makeSession("sess-2")))
+
+	client := agent.NewClient(agent.WithSessionStore(store))
+	require.NoError(t, client.ContinueLatest(ctx))
+	assert.Equal(t, "sess-2", client.Session().ID)
+	assert.Len(t, client.Session().Messages, 2)
+	require.NoError(t, client.Close())
+}
+
+func TestStore_Migrate(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	store, err := sqlstore.New(ctx, db, sqlstore.WithoutMigrations())
+	require.NoError(t, err)
+	assert.Error(t, store.Save(ctx, makeSession("sess-1")), "tables do not exist yet")
+
+	require.NoError(t, store.Migrate(ctx))
+	require.NoError(t, store.Migrate(ctx), "migrating twice is a no-op")
+	var version int
+	require.NoError(t, db.QueryRow(`SELECT MAX(version) FROM agent_schema_migrations`).Scan(&version))
+	assert.Equal(t, sqlstore.SchemaVersion(), version)
+	require.NoError(t, store.Save(ctx, makeSession("sess-1")))
+}
+
+func TestStore_MigrateRetriesPartialMigration(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	store := newStore(t, db)
+	require.NoError(t, store.Save(ctx, makeSession("sess-1")))
+
+	// As MySQL leaves a failed migration: versions 2 and 3 unrecorded, and
+	// the last step of 3 not applied.
+	_, err := db.Exec(`DELETE FROM agent_schema_migrations WHERE version >= 2`)
+	require.NoError(t, err)
+	_, err = db.Exec(`DROP INDEX agent_sessions_parent`)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Migrate(ctx))
+	var version int
+	require.NoError(t, db.QueryRow(`SELECT MAX(version) FROM agent_schema_migrations`).Scan(&version))
+	assert.Equal(t, sqlstore.SchemaVersion(), version)
+	var indexes int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'agent_sessions_parent'`).Scan(&indexes))
+	assert.Equal(t, 1, indexes)
+
+	loaded, err := store.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Greeting", loaded.Metadata.Title)
+}
+
+func TestStore_ClientResume(t *testing.T) {
+	store := newStore(t, openDB(t))
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, makeSession("sess-1")))
+
+	client := agent.NewClient(agent.WithSessionStore(store))
+	require.NoError(t, client.Resume(ctx, "sess-1"))
+	assert.Len(t, client.Session().Messages, 2)
+	require.NoError(t, client.Close())
+}
+
+func TestStore_ClientBranches(t *testing.T) {
+	store := newStore(t, openDB(t))
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, makeSession("sess-1")))
+
+	client := agent.NewClient(agent.WithSessionStore(store))
+	require.NoError(t, client.Resume(ctx, "sess-1"))
+	require.NoError(t, client.RewindTo(ctx, 0))
+	branch := client.Session()
+
+	branches, err := client.Branches(ctx, "sess-1")
+	require.NoError(t, err)
+	require.Len(t, branches, 1)
+	assert.Equal(t, branch.ID, branches[0].ID)
+	assert.Equal(t, 0, branches[0].BranchPoint)
+	assert.True(t, branches[0].TotalCost.IsZero(), "the fork's cost stays with its parent")
+	require.NoError(t, client.Close())
+}
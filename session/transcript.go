@@ -0,0 +1,767 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// Transcript line types. Claude Code writes further types, such as
+// "system", which are skipped when loading.
+const (
+	lineUser      = "user"
+	lineAssistant = "assistant"
+	// lineSummary titles the branch ending at its leaf. The store's
+	// summary lines also hold the session's metadata, in fields Claude
+	// Code does not read.
+	lineSummary = "summary"
+)
+
+// TranscriptStore persists sessions as append-only JSONL transcripts in
+// the layout Claude Code uses, so sessions can be inspected and resumed by
+// its tooling and Claude Code sessions can be loaded:
+//
+//	~/.claude/projects/<sanitized-cwd>/<session-id>.jsonl
+//
+// Each message is one line holding its uuid, the uuid of the message
+// before it, a timestamp, the working directory and git branch; assistant
+// messages keep the id, model, stop reason and usage of their response
+// (see agent.Session.RecordResponse). Saving appends the messages added
+// since the last save, and a summary line with the session's title and
+// metadata when they changed. A session whose history
+// was rewritten, by compaction for example, is appended as a new branch
+// from the last message it shares with the transcript; loading follows the
+// branch of the last save.
+//
+// A TranscriptStore assumes it is the only writer of its transcripts.
+type TranscriptStore struct {
+	cwd    string
+	dir    string
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	chains map[string]*transcriptChain // by session ID
+}
+
+var (
+	_ agent.FullSessionStore = (*TranscriptStore)(nil)
+	_ agent.MessageLocator   = (*TranscriptStore)(nil)
+)
+
+// TranscriptOption configures a TranscriptStore.
+type TranscriptOption func(*TranscriptStore)
+
+// WithProjectsDir stores transcripts under dir instead of
+// ~/.claude/projects.
+func WithProjectsDir(dir string) TranscriptOption {
+	return func(t *TranscriptStore) { t.dir = dir }
+}
+
+// WithTranscriptLogger logs transcript lines and files that cannot be read
+// to l at warn level.
+func WithTranscriptLogger(l *slog.Logger) TranscriptOption {
+	return func(t *TranscriptStore) {
+		if l != nil {
+			t.logger = l
+		}
+	}
+}
+
+// NewTranscriptStore creates a TranscriptStore for sessions run in the
+// working directory cwd. The project directory is created if it does not
+// exist.
+func NewTranscriptStore(cwd string, opts ...TranscriptOption) (*TranscriptStore, error) {
+	cwd, err := filepath.Abs(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("resolve cwd: %w", err)
+	}
+	t := &TranscriptStore{
+		cwd:    cwd,
+		logger: slog.New(slog.DiscardHandler),
+		chains: make(map[string]*transcriptChain),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("find projects dir: %w", err)
+		}
+		t.dir = filepath.Join(home, ".claude", "projects")
+	}
+	t.dir = filepath.Join(t.dir, SanitizePath(cwd))
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create project dir: %w", err)
+	}
+	return t, nil
+}
+
+// SanitizePath returns the name of the project directory Claude Code uses
+// for path: every character other than an ASCII letter or digit becomes
+// '-', so "/home/me/app" is "-home-me-app".
+func SanitizePath(path string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, path)
+}
+
+// Dir returns the project directory holding the store's transcripts.
+func (t *TranscriptStore) Dir() string {
+	return t.dir
+}
+
+// messageLine is a transcript line holding a message.
+type messageLine struct {
+	ParentUUID  *string   `json:"parentUuid"`
+	IsSidechain bool      `json:"isSidechain"`
+	UserType    string    `json:"userType"`
+	CWD         string    `json:"cwd"`
+	SessionID   string    `json:"sessionId"`
+	GitBranch   string    `json:"gitBranch"`
+	Type        string    `json:"type"`
+	Message     any       `json:"message"`
+	UUID        string    `json:"uuid"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// assistantMessage is the message of an assistant line, written as the
+// API response it came from.
+type assistantMessage struct {
+	ID           string                             `json:"id"`
+	Type         string                             `json:"type"`
+	Role         anthropic.MessageParamRole         `json:"role"`
+	Model        anthropic.Model                    `json:"model"`
+	Content      []anthropic.ContentBlockParamUnion `json:"content"`
+	StopReason   anthropic.StopReason               `json:"stop_reason"`
+	StopSequence *string                            `json:"stop_sequence"`
+	Usage        usageJSON                          `json:"usage"`
+}
+
+type usageJSON struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+}
+
+// summaryLine titles the session's current branch, whose last message is
+// LeafUUID, and holds the session's metadata. LeafUUID is empty if the
+// session has no messages.
+type summaryLine struct {
+	Type      string       `json:"type"`
+	Summary   string       `json:"summary"`
+	LeafUUID  string       `json:"leafUuid"`
+	SessionID string       `json:"sessionId"`
+	Metadata  metadataJSON `json:"metadata"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	Timestamp time.Time    `json:"timestamp,omitzero"`
+}
+
+// transcriptChain is what a transcript holds of a session's current
+// branch: for each message, the uuid of its last line and a hash of it.
+type transcriptChain struct {
+	uuids  []string
+	hashes [][sha256.Size]byte
+	// merged maps the uuids of the other lines of messages Claude Code
+	// wrote as several lines to the index of their message.
+	merged map[string]int
+	// summary is the last summaryLine written, without its timestamp.
+	summary []byte
+}
+
+// shared returns how many leading messages of msgs the chain holds.
+func (c *transcriptChain) shared(msgs []anthropic.MessageParam) (int, error) {
+	n := min(len(c.uuids), len(msgs))
+	if n == 0 {
+		return 0, nil
+	}
+	// Usually messages were only appended since the last save.
+	if n == len(c.uuids) {
+		h, err := hashMessage(msgs[n-1])
+		if err != nil {
+			return 0, err
+		}
+		if h == c.hashes[n-1] {
+			return n, nil
+		}
+	}
+	// The history was rewritten; find where it diverges.
+	for i := range n {
+		h, err := hashMessage(msgs[i])
+		if err != nil {
+			return 0, err
+		}
+		if h != c.hashes[i] {
+			return i, nil
+		}
+	}
+	return n, nil
+}
+
+// Save appends the session's messages not yet in its transcript, and a
+// summary line if the session's title or metadata changed.
+func (t *TranscriptStore) Save(_ context.Context, session *agent.Session) error {
+	if session == nil {
+		return fmt.Errorf("session is nil")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	chain, err := t.chain(session.ID)
+	if err != nil {
+		return err
+	}
+
+	shared, err := chain.shared(session.Messages)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	now := time.Now().UTC()
+	branch := gitBranch(t.cwd)
+	uuids := append([]string(nil), chain.uuids[:shared]...)
+	hashes := append([][sha256.Size]byte(nil), chain.hashes[:shared]...)
+	for i := shared; i < len(session.Messages); i++ {
+		msg := session.Messages[i]
+		h, err := hashMessage(msg)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, h)
+		line := messageLine{
+			UserType:  "external",
+			CWD:       t.cwd,
+			SessionID: session.ID,
+			GitBranch: branch,
+			Type:      string(msg.Role),
+			Message:   lineMessage(msg, session.Response(i)),
+			UUID:      uuid.NewString(),
+			Timestamp: now,
+		}
+		if len(uuids) > 0 {
+			line.ParentUUID = &uuids[len(uuids)-1]
+		}
+		if err := enc.Encode(line); err != nil {
+			return fmt.Errorf("marshal transcript line: %w", err)
+		}
+		uuids = append(uuids, line.UUID)
+	}
+
+	summary := summaryLine{
+		Type:      lineSummary,
+		Summary:   session.Metadata.Title,
+		SessionID: session.ID,
+		Metadata:  toMetadataJSON(session.Metadata),
+		CreatedAt: session.CreatedAt,
+		UpdatedAt: session.UpdatedAt,
+	}
+	if summary.Summary == "" {
+		summary.Summary = session.Summary().FirstPrompt
+	}
+	if len(uuids) > 0 {
+		summary.LeafUUID = uuids[len(uuids)-1]
+	}
+	summaryKey, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("marshal session metadata: %w", err)
+	}
+	if !bytes.Equal(summaryKey, chain.summary) {
+		summary.Timestamp = now
+		if err := enc.Encode(summary); err != nil {
+			return fmt.Errorf("marshal session metadata: %w", err)
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(t.path(session.ID), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open transcript: %w", err)
+	}
+	_, err = f.Write(append(lineBreak(f), buf.Bytes()...))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+
+	for id, i := range chain.merged {
+		if i >= shared {
+			delete(chain.merged, id)
+		}
+	}
+	chain.uuids, chain.hashes, chain.summary = uuids, hashes, summaryKey
+	return nil
+}
+
+// lineMessage returns what a message line holds of msg: for an assistant
+// message with a recorded response, the response.
+func lineMessage(msg anthropic.MessageParam, resp *agent.MessageResponse) any {
+	if resp == nil {
+		return msg
+	}
+	m := assistantMessage{
+		ID:         resp.ID,
+		Type:       "message",
+		Role:       msg.Role,
+		Model:      resp.Model,
+		Content:    msg.Content,
+		StopReason: resp.StopReason,
+		Usage: usageJSON{
+			InputTokens:              resp.Usage.InputTokens,
+			OutputTokens:             resp.Usage.OutputTokens,
+			CacheReadInputTokens:     resp.Usage.CacheReadInputTokens,
+			CacheCreationInputTokens: resp.Usage.CacheCreationInputTokens,
+		},
+	}
+	if resp.StopSequence != "" {
+		m.StopSequence = &resp.StopSequence
+	}
+	return m
+}
+
+// lineBreak returns the newline needed to end a last line cut short, so
+// appended lines do not run into it.
+func lineBreak(f *os.File) []byte {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil || last[0] == '\n' {
+		return nil
+	}
+	return []byte{'\n'}
+}
+
+// chain returns what the session's transcript holds, reading it if it was
+// not loaded or saved by this store yet.
+func (t *TranscriptStore) chain(id string) (*transcriptChain, error) {
+	if chain, ok := t.chains[id]; ok {
+		return chain, nil
+	}
+	_, chain, err := t.read(id)
+	if errors.Is(err, agent.ErrSessionNotFound) {
+		chain, err = &transcriptChain{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.chains[id] = chain
+	return chain, nil
+}
+
+// Load reads a session from its transcript, following the branch of the
+// last save. Transcripts written by Claude Code load too.
+func (t *TranscriptStore) Load(_ context.Context, id string) (*agent.Session, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	session, chain, err := t.read(id)
+	if err != nil {
+		return nil, err
+	}
+	t.chains[id] = chain
+	return session, nil
+}
+
+func (t *TranscriptStore) read(id string) (*agent.Session, *transcriptChain, error) {
+	f, err := os.Open(t.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
+		}
+		return nil, nil, fmt.Errorf("open transcript: %w", err)
+	}
+	defer f.Close()
+
+	session, chain, err := parseTranscript(f, t.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	session.ID = id
+	return session, chain, nil
+}
+
+// MessageIndex returns the index of the message whose transcript line, or
+// one of whose lines, has the uuid msgUUID, in the branch of the session's
+// last save.
+func (t *TranscriptStore) MessageIndex(_ context.Context, id, msgUUID string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	chain, err := t.chain(id)
+	if err != nil {
+		return 0, err
+	}
+	if i := slices.Index(chain.uuids, msgUUID); i >= 0 {
+		return i, nil
+	}
+	if i, ok := chain.merged[msgUUID]; ok {
+		return i, nil
+	}
+	return 0, fmt.Errorf("%w: %s in session %s", agent.ErrMessageNotFound, msgUUID, id)
+}
+
+// Delete removes a session's transcript.
+func (t *TranscriptStore) Delete(_ context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.chains, id)
+	if err := os.Remove(t.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", agent.ErrSessionNotFound, id)
+		}
+		return fmt.Errorf("remove transcript: %w", err)
+	}
+	return nil
+}
+
+// List returns all sessions in the project directory. Claude Code's
+// subagent transcripts (agent-*.jsonl) are skipped.
+func (t *TranscriptStore) List(ctx context.Context) ([]*agent.Session, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read project dir: %w", err)
+	}
+
+	var sessions []*agent.Session
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".jsonl") || strings.HasPrefix(name, "agent-") {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, ".jsonl")
+		s, err := t.Load(ctx, id)
+		if err != nil {
+			t.logger.Warn("skipping unreadable transcript",
+				agent.LogKeySessionID, id, "path", filepath.Join(t.dir, name), "error", err)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// Fork loads a session, clones it with a new ID, saves the clone to a new
+// transcript, and returns it.
+func (t *TranscriptStore) Fork(ctx context.Context, id string) (*agent.Session, error) {
+	original, err := t.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	forked := original.Clone()
+	if err := t.Save(ctx, forked); err != nil {
+		return nil, fmt.Errorf("save forked session: %w", err)
+	}
+	return forked, nil
+}
+
+func (t *TranscriptStore) path(id string) string {
+	return filepath.Join(t.dir, id+".jsonl")
+}
+
+// ImportTranscript reads a Claude Code transcript, or one written by a
+// TranscriptStore, into a session. The session's ID is the transcript's
+// session ID. Sessions imported from Claude Code have no cost, and count
+// one turn per assistant response.
+func ImportTranscript(path string) (*agent.Session, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open transcript: %w", err)
+	}
+	defer f.Close()
+
+	session, _, err := parseTranscript(f, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, err
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return session, nil
+}
+
+// transcriptEntry is any transcript line, as far as loading reads it.
+type transcriptEntry struct {
+	Type        string          `json:"type"`
+	UUID        string          `json:"uuid"`
+	ParentUUID  *string         `json:"parentUuid"`
+	IsSidechain bool            `json:"isSidechain"`
+	SessionID   string          `json:"sessionId"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Message     json.RawMessage `json:"message"`
+	Summary     string          `json:"summary"`
+
+	// Fields of summaryLine. Metadata is nil on Claude Code's summaries.
+	LeafUUID  string        `json:"leafUuid"`
+	Metadata  *metadataJSON `json:"metadata"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// transcriptMessage is the message of a user or assistant line. Claude
+// Code writes user content as a string or blocks, and assistant messages
+// as API responses, one line per content block.
+type transcriptMessage struct {
+	ID      string          `json:"id"`
+	Role    string          `json:"role"`
+	Model   string          `json:"model"`
+	Content json.RawMessage `json:"content"`
+	Usage   *usageJSON      `json:"usage"`
+}
+
+// parseTranscript reads the messages of the branch ending at the leaf of
+// the store's last summary line or, without one, at the last message line. Malformed
+// lines, such as one cut short by a crash, are logged and skipped.
+// Consecutive lines of the same role are merged into one message.
+func parseTranscript(r io.Reader, logger *slog.Logger) (*agent.Session, *transcriptChain, error) {
+	var (
+		entries = make(map[string]*transcriptEntry)
+		leaf    string
+		meta    *transcriptEntry
+		first   time.Time
+		last    time.Time
+	)
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var e transcriptEntry
+			if jerr := json.Unmarshal(data, &e); jerr != nil {
+				logger.Warn("skipping malformed transcript line", "line", n, "error", jerr)
+			} else {
+				switch {
+				case e.Type == lineSummary && e.Metadata != nil:
+					meta = &e
+				case e.UUID != "" && !e.IsSidechain:
+					entries[e.UUID] = &e
+					if e.Type == lineUser || e.Type == lineAssistant {
+						leaf = e.UUID
+					}
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read transcript: %w", err)
+		}
+	}
+	if meta != nil {
+		leaf = meta.LeafUUID
+	}
+
+	// Walk the branch back from its leaf.
+	var branch []*transcriptEntry
+	seen := make(map[string]bool)
+	for id := leaf; id != "" && !seen[id]; {
+		e, ok := entries[id]
+		if !ok {
+			break
+		}
+		seen[id] = true
+		branch = append(branch, e)
+		if e.ParentUUID == nil {
+			break
+		}
+		id = *e.ParentUUID
+	}
+
+	session := &agent.Session{}
+	chain := &transcriptChain{merged: make(map[string]int)}
+	counted := make(map[string]bool) // assistant responses split across lines
+	for i := len(branch) - 1; i >= 0; i-- {
+		e := branch[i]
+		if e.Type != lineUser && e.Type != lineAssistant {
+			continue
+		}
+		var m transcriptMessage
+		if err := json.Unmarshal(e.Message, &m); err != nil {
+			logger.Warn("skipping malformed transcript message", "uuid", e.UUID, "error", err)
+			continue
+		}
+		content, err := parseContent(m.Content)
+		if err != nil {
+			logger.Warn("skipping malformed transcript message", "uuid", e.UUID, "error", err)
+			continue
+		}
+		if session.ID == "" {
+			session.ID = e.SessionID
+		}
+		if first.IsZero() {
+			first = e.Timestamp
+		}
+		last = e.Timestamp
+
+		if e.Type == lineAssistant && (m.ID == "" || !counted[m.ID]) {
+			counted[m.ID] = true
+			sm := &session.Metadata
+			sm.NumTurns++
+			if m.Model != "" {
+				sm.Model = anthropic.Model(m.Model)
+			}
+			if u := m.Usage; u != nil {
+				sm.TotalTokens.InputTokens += u.InputTokens
+				sm.TotalTokens.OutputTokens += u.OutputTokens
+				sm.TotalTokens.CacheReadInputTokens += u.CacheReadInputTokens
+				sm.TotalTokens.CacheCreationInputTokens += u.CacheCreationInputTokens
+			}
+		}
+
+		role := anthropic.MessageParamRole(e.Type)
+		if n := len(session.Messages); n > 0 && session.Messages[n-1].Role == role {
+			session.Messages[n-1].Content = append(session.Messages[n-1].Content, content...)
+			chain.merged[chain.uuids[n-1]] = n - 1
+			chain.uuids[n-1] = e.UUID
+			continue
+		}
+		session.Messages = append(session.Messages, anthropic.MessageParam{Role: role, Content: content})
+		chain.uuids = append(chain.uuids, e.UUID)
+	}
+
+	chain.hashes = make([][sha256.Size]byte, len(session.Messages))
+	for i, msg := range session.Messages {
+		h, err := hashMessage(msg)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain.hashes[i] = h
+	}
+
+	session.CreatedAt, session.UpdatedAt = first, last
+	if meta != nil {
+		session.ID = meta.SessionID
+		session.Metadata = fromMetadataJSON(*meta.Metadata)
+		session.CreatedAt, session.UpdatedAt = meta.CreatedAt, meta.UpdatedAt
+		chain.summary, _ = json.Marshal(summaryLine{
+			Type:      lineSummary,
+			Summary:   meta.Summary,
+			LeafUUID:  meta.LeafUUID,
+			SessionID: meta.SessionID,
+			Metadata:  *meta.Metadata,
+			CreatedAt: meta.CreatedAt,
+			UpdatedAt: meta.UpdatedAt,
+		})
+	}
+	return session, chain, nil
+}
+
+// parseContent reads message content written as a string or as blocks.
+func parseContent(raw json.RawMessage) ([]anthropic.ContentBlockParamUnion, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []anthropic.ContentBlockParamUnion{anthropic.NewTextBlock(text)}, nil
+	}
+	var blocks []anthropic.ContentBlockParamUnion
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// hashMessage identifies a message's content, to find where a session
+// and its transcript diverge.
+func hashMessage(msg anthropic.MessageParam) ([sha256.Size]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("marshal message: %w", err)
+	}
+	return sha256.Sum256(data), nil
+}
+
+func toMetadataJSON(meta agent.SessionMeta) metadataJSON {
+	return metadataJSON{
+		Model:       string(meta.Model),
+		TotalCost:   meta.TotalCost.String(),
+		TotalTokens: meta.TotalTokens,
+		NumTurns:    meta.NumTurns,
+		Title:       meta.Title,
+		Tags:        meta.Tags,
+		ParentID:    meta.ParentID,
+		BranchPoint: meta.BranchPoint,
+	}
+}
+
+func fromMetadataJSON(m metadataJSON) agent.SessionMeta {
+	cost, err := decimal.NewFromString(m.TotalCost)
+	if err != nil {
+		cost = decimal.Zero
+	}
+	return agent.SessionMeta{
+		Model:       anthropic.Model(m.Model),
+		TotalCost:   cost,
+		TotalTokens: m.TotalTokens,
+		NumTurns:    m.NumTurns,
+		Title:       m.Title,
+		Tags:        m.Tags,
+		ParentID:    m.ParentID,
+		BranchPoint: m.BranchPoint,
+	}
+}
+
+// gitBranch returns the branch checked out in the git repository holding
+// dir, "HEAD" if it is detached, or "" outside a repository.
+func gitBranch(dir string) string {
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		if info, err := os.Stat(gitPath); err == nil {
+			gitDir := gitPath
+			if !info.IsDir() {
+				// A worktree or submodule: ".git" names the git directory.
+				data, err := os.ReadFile(gitPath)
+				if err != nil {
+					return ""
+				}
+				gitDir = strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+			}
+			head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return ""
+			}
+			if branch, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/"); ok {
+				return branch
+			}
+			return "HEAD"
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
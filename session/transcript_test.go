@@ -0,0 +1,404 @@
+package session_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/session"
+)
+
+func newTranscriptStore(t *testing.T, cwd string) *session.TranscriptStore {
+	t.Helper()
+	store, err := session.NewTranscriptStore(cwd, session.WithProjectsDir(t.TempDir()))
+	require.NoError(t, err)
+	return store
+}
+
+// transcriptLines decodes the well-formed lines of a session's transcript.
+func transcriptLines(t *testing.T, store *session.TranscriptStore, id string) []map[string]any {
+	t.Helper()
+	f, err := os.Open(filepath.Join(store.Dir(), id+".jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var lines []map[string]any
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var line map[string]any
+		if json.Unmarshal(sc.Bytes(), &line) == nil {
+			lines = append(lines, line)
+		}
+	}
+	require.NoError(t, sc.Err())
+	return lines
+}
+
+func messageLines(lines []map[string]any) []map[string]any {
+	var msgs []map[string]any
+	for _, line := range lines {
+		if line["type"] == "user" || line["type"] == "assistant" {
+			msgs = append(msgs, line)
+		}
+	}
+	return msgs
+}
+
+// assertSameMessages compares messages by their JSON, as decoding sets
+// the constant fields left empty by the constructors.
+func assertSameMessages(t *testing.T, want, got []anthropic.MessageParam) {
+	t.Helper()
+	wantJSON, err := json.Marshal(want)
+	require.NoError(t, err)
+	gotJSON, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(wantJSON), string(gotJSON))
+}
+
+func assistantText(text string) anthropic.MessageParam {
+	return anthropic.NewAssistantMessage(anthropic.NewTextBlock(text))
+}
+
+func TestSanitizePath(t *testing.T) {
+	assert.Equal(t, "-home-me-my-app", session.SanitizePath("/home/me/my app"))
+	assert.Equal(t, "C--Users-me-app-v2", session.SanitizePath(`C:\Users\me\app.v2`))
+}
+
+func TestTranscriptStore_ProjectLayout(t *testing.T) {
+	projects := t.TempDir()
+	store, err := session.NewTranscriptStore("/work/my app", session.WithProjectsDir(projects))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(projects, "-work-my-app"), store.Dir())
+
+	require.NoError(t, store.Save(context.Background(), makeSession("sess-1")))
+	assert.FileExists(t, filepath.Join(projects, "-work-my-app", "sess-1.jsonl"))
+}
+
+func TestTranscriptStore_SaveAndLoad(t *testing.T) {
+	store := newTranscriptStore(t, t.TempDir())
+	ctx := context.Background()
+
+	s := makeSession("sess-1")
+	s.Messages = append(s.Messages, assistantText("hi"))
+	s.Metadata.TotalTokens = agent.Usage{InputTokens: 10, OutputTokens: 5}
+	require.NoError(t, store.Save(ctx, s))
+
+	loaded, err := store.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.Equal(t, "sess-1", loaded.ID)
+	assertSameMessages(t, s.Messages, loaded.Messages)
+	assert.Equal(t, anthropic.Model("claude-opus-4-6"), loaded.Metadata.Model)
+	assert.True(t, loaded.Metadata.TotalCost.Equal(decimal.NewFromFloat(0.01)))
+	assert.Equal(t, s.Metadata.TotalTokens, loaded.Metadata.TotalTokens)
+	assert.Equal(t, 1, loaded.Metadata.NumTurns)
+	assert.True(t, s.CreatedAt.Equal(loaded.CreatedAt))
+	assert.True(t, s.UpdatedAt.Equal(loaded.UpdatedAt))
+}
+
+func TestTranscriptStore_AppendsNewMessages(t *testing.T) {
+	cwd := t.TempDir()
+	store := newTranscriptStore(t, cwd)
+	ctx := context.Background()
+	path := filepath.Join(store.Dir(), "sess-1.jsonl")
+
+	s := makeSession("sess-1")
+	require.NoError(t, store.Save(ctx, s))
+	before, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	s.Messages = append(s.Messages, assistantText("hi"), anthropic.NewUserMessage(anthropic.NewTextBlock("more")))
+	require.NoError(t, store.Save(ctx, s))
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(after, before), "earlier lines were rewritten")
+
+	msgs := messageLines(transcriptLines(t, store, "sess-1"))
+	require.Len(t, msgs, 3)
+	assert.Nil(t, msgs[0]["parentUuid"])
+	for i, line := range msgs {
+		assert.Equal(t, "sess-1", line["sessionId"])
+		assert.Equal(t, cwd, line["cwd"])
+		assert.NotEmpty(t, line["timestamp"])
+		assert.NotEmpty(t, line["uuid"])
+		if i > 0 {
+			assert.Equal(t, msgs[i-1]["uuid"], line["parentUuid"])
+		}
+	}
+	assert.Equal(t, "assistant", msgs[1]["type"])
+
+	// Saving again without changes writes nothing.
+	require.NoError(t, store.Save(ctx, s))
+	unchanged, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, after, unchanged)
+}
+
+func TestTranscriptStore_AssistantLineKeepsResponse(t *testing.T) {
+	store := newTranscriptStore(t, t.TempDir())
+	ctx := context.Background()
+
+	s := makeSession("sess-1")
+	var resp anthropic.Message
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-opus-4-6",
+		"content": [{"type": "text", "text": "hi"}],
+		"stop_reason": "end_turn", "stop_sequence": null,
+		"usage": {"input_tokens": 10, "output_tokens": 5, "cache_read_input_tokens": 3, "cache_creation_input_tokens": 0}
+	}`), &resp))
+	s.Messages = append(s.Messages, resp.ToParam())
+	s.RecordResponse(resp)
+	require.NoError(t, store.Save(ctx, s))
+
+	msgs := messageLines(transcriptLines(t, store, "sess-1"))
+	require.Len(t, msgs, 2)
+	msg := msgs[1]["message"].(map[string]any)
+	assert.Equal(t, "msg_1", msg["id"])
+	assert.Equal(t, "claude-opus-4-6", msg["model"])
+	assert.Equal(t, "end_turn", msg["stop_reason"])
+	assert.Equal(t, map[string]any{
+		"input_tokens":                float64(10),
+		"output_tokens":               float64(5),
+		"cache_read_input_tokens":     float64(3),
+		"cache_creation_input_tokens": float64(0),
+	}, msg["usage"])
+
+	loaded, err := store.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	assertSameMessages(t, s.Messages, loaded.Messages)
+}
+
+func TestTranscriptStore_SummaryLineHoldsMetadata(t *testing.T) {
+	store := newTranscriptStore(t, t.TempDir())
+	ctx := context.Background()
+
+	s := makeSession("sess-1")
+	s.Metadata.Title = "Greeting"
+	require.NoError(t, store.Save(ctx, s))
+
+	var summaries []map[string]any
+	for _, line := range transcriptLines(t, store, "sess-1") {
+		assert.Contains(t, []any{"user", "assistant", "summary"}, line["type"])
+		if line["type"] == "summary" {
+			summaries = append(summaries, line)
+		}
+	}
+	require.Len(t, summaries, 1)
+	assert.Equal(t, "Greeting", summaries[0]["summary"])
+	assert.Equal(t, messageLines(transcriptLines(t, store, "sess-1"))[0]["uuid"], summaries[0]["leafUuid"])
+	assert.NotNil(t, summaries[0]["metadata"])
+}
+
+func TestTranscriptStore_RewrittenHistoryBranches(t *testing.T) {
+	store := newTranscriptStore(t, t.TempDir())
+	ctx := context.Background()
+
+	s := makeSession("sess-1")
+	s.Messages = append(s.Messages, assistantText("one"), anthropic.NewUserMessage(anthropic.NewTextBlock("two")))
+	require.NoError(t, store.Save(ctx, s))
+
+	s.Messages = append(s.Messages[:1:1], assistantText("rewritten"))
+	require.NoError(t, store.Save(ctx, s))
+
+	msgs := messageLines(transcriptLines(t, store, "sess-1"))
+	require.Len(t, msgs, 4)
+	assert.Equal(t, msgs[0]["uuid"], msgs[3]["parentUuid"], "the new branch starts after the shared message")
+
+	loaded, err := store.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	assertSameMessages(t, s.Messages, loaded.Messages)
+
+	// Dropping messages without adding any moves the leaf back.
+	s.Messages = s.Messages[:1]
+	require.NoError(t, store.Save(ctx, s))
+	loaded, err = store.Load(ctx, "sess-1")
+	require.NoError(t, err)
+	assertSameMessages(t, s.Messages, loaded.Messages)
+}
+
+func TestTranscriptStore_ContinuesAfterReopen(t *testing.T) {
+	cwd := t.TempDir()
+	projects := t.TempDir()
+	ctx := context.Background()
+
+	first, err := session.NewTranscriptStore(cwd, session.WithProjectsDir(projects))
+	require.NoError(t, err)
+	s := makeSession("sess-1")
+	require.NoError(t, first.Save(ctx, s))
+
+	second, err := session.NewTranscriptStore(cwd, session.WithProjectsDir(projects))
+	require.NoError(t, err)
+	s.Messages = append(s.Messages, assistantText("hi"))
+	require.NoError(t, second.Save(ctx, s))
+
+	msgs := messageLines(transcriptLines(t, second, "sess-1"))
+	require.Len(t, msgs, 2)
+	assert.Equal(t, msgs[0]["uuid"], msgs[1]["parentUuid"])
+}
+
+func TestTranscriptStore_GitBranch(t *testing.T) {
+	repo := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, ".git"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/feature/x\n"), 0o644))
+	cwd := filepath.Join(repo, "sub")
+	require.NoError(t, os.MkdirAll(cwd, 0o755))
+
+	store := newTranscriptStore(t, cwd)
+	require.NoError(t, store.Save(context.Background(), makeSession("sess-1")))
+
+	msgs := messageLines(transcriptLines(t, store, "sess-1"))
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "feature/x", msgs[0]["gitBranch"])
+}
+
+func TestTranscriptStore_DeleteListFork(t *testing.T) {
+	store := newTranscriptStore(t, t.TempDir())
+	ctx := context.Background()
+
+	require.NoError(t, store.Save(ctx, makeSession("a")))
+	require.NoError(t, store.Save(ctx, makeSession("b")))
+	require.NoError(t, os.WriteFile(filepath.Join(store.Dir(), "agent-1234.jsonl"), nil, 0o644))
+
+	sessions, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	forked, err := store.Fork(ctx, "a")
+	require.NoError(t, err)
+	assert.NotEqual(t, "a", forked.ID)
+	loaded, err := store.Load(ctx, forked.ID)
+	require.NoError(t, err)
+	assertSameMessages(t, forked.Messages, loaded.Messages)
+
+	require.NoError(t, store.Delete(ctx, "a"))
+	_, err = store.Load(ctx, "a")
+	assert.ErrorIs(t, err, agent.ErrSessionNotFound)
+	assert.ErrorIs(t, store.Delete(ctx, "a"), agent.ErrSessionNotFound)
+}
+
+// claudeCodeTranscript is a transcript as Claude Code writes it: string
+// user content, an assistant response split into a line per block, a
+// tool result, a summary, a subagent line and a line cut short.
+const claudeCodeTranscript = `{"type":"summary","summary":"Fix the build","leafUuid":"u5"}
+{"parentUuid":null,"isSidechain":false,"userType":"external","cwd":"/work/app","sessionId":"0b1c","version":"1.0.80","gitBranch":"main","type":"user","message":{"role":"user","content":"fix the build"},"uuid":"u1","timestamp":"2025-08-01T10:00:00.000Z"}
+{"parentUuid":"u1","isSidechain":false,"userType":"external","cwd":"/work/app","sessionId":"0b1c","version":"1.0.80","gitBranch":"main","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Let me look."}],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":100,"output_tokens":20,"cache_read_input_tokens":50,"cache_creation_input_tokens":0}},"requestId":"req_1","type":"assistant","uuid":"u2","timestamp":"2025-08-01T10:00:01.000Z"}
+{"parentUuid":"u2","isSidechain":false,"userType":"external","cwd":"/work/app","sessionId":"0b1c","version":"1.0.80","gitBranch":"main","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"go build ./..."}}],"stop_reason":"tool_use","stop_sequence":null,"usage":{"input_tokens":100,"output_tokens":20,"cache_read_input_tokens":50,"cache_creation_input_tokens":0}},"requestId":"req_1","type":"assistant","uuid":"u3","timestamp":"2025-08-01T10:00:02.000Z"}
+{"parentUuid":"u3","isSidechain":true,"userType":"external","cwd":"/work/app","sessionId":"0b1c","type":"user","message":{"role":"user","content":"subagent prompt"},"uuid":"s1","timestamp":"2025-08-01T10:00:02.500Z"}
+{"parentUuid":"u3","isSidechain":false,"userType":"external","cwd":"/work/app","sessionId":"0b1c","version":"1.0.80","gitBranch":"main","type":"user","message":{"role":"user","content":[{"tool_use_id":"toolu_1","type":"tool_result","content":"ok","is_error":false}]},"uuid":"u4","timestamp":"2025-08-01T10:00:03.000Z","toolUseResult":{"stdout":"ok","stderr":""}}
+{"parentUuid":"u4","isSidechain":false,"userType":"external","cwd":"/work/app","sessionId":"0b1c","version":"1.0.80","gitBranch":"main","message":{"id":"msg_2","type":"message","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Fixed."}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":200,"output_tokens":5,"cache_read_input_tokens":0,"cache_creation_input_tokens":0}},"type":"assistant","uuid":"u5","timestamp":"2025-08-01T10:00:04.000Z"}
+{"parentUuid":"u5","isSidechain":false,"type":"user","message":{"role":"us`
+
+func TestImportTranscript_ClaudeCode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0b1c.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(claudeCodeTranscript), 0o644))
+
+	s, err := session.ImportTranscript(path)
+	require.NoError(t, err)
+	assert.Equal(t, "0b1c", s.ID)
+	require.Len(t, s.Messages, 4)
+
+	assert.Equal(t, anthropic.MessageParamRoleUser, s.Messages[0].Role)
+	require.NotNil(t, s.Messages[0].Content[0].OfText)
+	assert.Equal(t, "fix the build", s.Messages[0].Content[0].OfText.Text)
+
+	// The response split across two lines is one message.
+	assert.Equal(t, anthropic.MessageParamRoleAssistant, s.Messages[1].Role)
+	require.Len(t, s.Messages[1].Content, 2)
+	require.NotNil(t, s.Messages[1].Content[1].OfToolUse)
+	assert.Equal(t, "toolu_1", s.Messages[1].Content[1].OfToolUse.ID)
+
+	require.NotNil(t, s.Messages[2].Content[0].OfToolResult)
+	assert.Equal(t, "toolu_1", s.Messages[2].Content[0].OfToolResult.ToolUseID)
+	require.NotNil(t, s.Messages[3].Content[0].OfText)
+	assert.Equal(t, "Fixed.", s.Messages[3].Content[0].OfText.Text)
+
+	assert.Equal(t, anthropic.Model("claude-sonnet-4-5"), s.Metadata.Model)
+	assert.Equal(t, 2, s.Metadata.NumTurns)
+	assert.Equal(t, agent.Usage{InputTokens: 300, OutputTokens: 25, CacheReadInputTokens: 50}, s.Metadata.TotalTokens)
+	assert.Equal(t, "2025-08-01T10:00:00Z", s.CreatedAt.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, "2025-08-01T10:00:04Z", s.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"))
+}
+
+func TestTranscriptStore_ResumesClaudeCodeSession(t *testing.T) {
+	store := newTranscriptStore(t, "/work/app")
+	ctx := context.Background()
+	path := filepath.Join(store.Dir(), "0b1c.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(claudeCodeTranscript), 0o644))
+
+	s, err := store.Load(ctx, "0b1c")
+	require.NoError(t, err)
+	require.Len(t, s.Messages, 4)
+
+	s.Messages = append(s.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock("thanks")))
+	require.NoError(t, store.Save(ctx, s))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), claudeCodeTranscript), "Claude Code lines were rewritten")
+
+	lines := transcriptLines(t, store, "0b1c")
+	msgs := messageLines(lines[len(lines)-2:])
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "u5", msgs[0]["parentUuid"])
+
+	loaded, err := store.Load(ctx, "0b1c")
+	require.NoError(t, err)
+	assertSameMessages(t, s.Messages, loaded.Messages)
+	assert.Equal(t, s.Metadata.Model, loaded.Metadata.Model)
+	assert.Equal(t, s.Metadata.TotalTokens, loaded.Metadata.TotalTokens)
+}
+
+func TestTranscriptStore_MessageIndex(t *testing.T) {
+	store := newTranscriptStore(t, "/work/app")
+	ctx := context.Background()
+	path := filepath.Join(store.Dir(), "0b1c.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(claudeCodeTranscript), 0o644))
+
+	for uuid, want := range map[string]int{"u1": 0, "u2": 1, "u3": 1, "u4": 2, "u5": 3} {
+		index, err := store.MessageIndex(ctx, "0b1c", uuid)
+		require.NoError(t, err, uuid)
+		assert.Equal(t, want, index, uuid)
+	}
+	_, err := store.MessageIndex(ctx, "0b1c", "u6")
+	assert.ErrorIs(t, err, agent.ErrMessageNotFound)
+
+	// Messages cut from the branch are no longer found.
+	s, err := store.Load(ctx, "0b1c")
+	require.NoError(t, err)
+	s.Messages = append(s.Messages[:1:1], assistantText("rewritten"))
+	require.NoError(t, store.Save(ctx, s))
+	_, err = store.MessageIndex(ctx, "0b1c", "u2")
+	assert.ErrorIs(t, err, agent.ErrMessageNotFound)
+
+	msgs := messageLines(transcriptLines(t, store, "0b1c"))
+	index, err := store.MessageIndex(ctx, "0b1c", msgs[len(msgs)-1]["uuid"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, 1, index)
+}
+
+func TestClient_RewindToMessage(t *testing.T) {
+	store := newTranscriptStore(t, "/work/app")
+	ctx := context.Background()
+	path := filepath.Join(store.Dir(), "0b1c.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(claudeCodeTranscript), 0o644))
+
+	c := agent.NewClient(agent.WithSessionStore(store))
+	require.NoError(t, c.Resume(ctx, "0b1c"))
+
+	assert.ErrorIs(t, c.RewindToMessage(ctx, "u4"), agent.ErrInvalidRewindPoint, "u4 returns the results of u3's tool call")
+	require.NoError(t, c.RewindToMessage(ctx, "u1"))
+	branch := c.Session()
+	assert.Empty(t, branch.Messages)
+	assert.Equal(t, "0b1c", branch.Metadata.ParentID)
+	assert.Equal(t, 0, branch.Metadata.BranchPoint)
+}
@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// ForkAt returns a copy of the session holding its first index messages,
+// with a new ID and s as its parent, to continue differently from there.
+// The cut must not separate a tool use from its result: index fails with
+// ErrInvalidRewindPoint when the message before it calls tools or the
+// message at it returns their results. Like a clone, the fork's totals
+// start at zero.
+func (s *Session) ForkAt(index int) (*Session, error) {
+	if err := s.checkCut(index); err != nil {
+		return nil, err
+	}
+	forked := s.Clone()
+	forked.Messages = forked.Messages[:index:index]
+	forked.Metadata.BranchPoint = index
+	return forked, nil
+}
+
+// checkCut reports whether the history can be cut before message index.
+func (s *Session) checkCut(index int) error {
+	if index < 0 || index > len(s.Messages) {
+		return fmt.Errorf("%w: message %d of %d", ErrInvalidRewindPoint, index, len(s.Messages))
+	}
+	if index > 0 && hasBlock(s.Messages[index-1], func(b anthropic.ContentBlockParamUnion) bool { return b.OfToolUse != nil }) {
+		return fmt.Errorf("%w: message %d calls tools whose results would be cut", ErrInvalidRewindPoint, index-1)
+	}
+	if index < len(s.Messages) && hasBlock(s.Messages[index], func(b anthropic.ContentBlockParamUnion) bool { return b.OfToolResult != nil }) {
+		return fmt.Errorf("%w: message %d returns results of tools called before it", ErrInvalidRewindPoint, index)
+	}
+	return nil
+}
+
+func hasBlock(msg anthropic.MessageParam, match func(anthropic.ContentBlockParamUnion) bool) bool {
+	for _, block := range msg.Content {
+		if match(block) {
+			return true
+		}
+	}
+	return false
+}
+
+// PromptIndexes returns the indexes of the session's user prompts, the
+// user messages that are not tool results. Rewinding to the n-th of them
+// retries that prompt's turn.
+func (s *Session) PromptIndexes() []int {
+	var indexes []int
+	for i, msg := range s.Messages {
+		if msg.Role != anthropic.MessageParamRoleUser {
+			continue
+		}
+		if hasBlock(msg, func(b anthropic.ContentBlockParamUnion) bool { return b.OfToolResult != nil }) {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// RewindTo makes the client continue from before message index of its
+// session, on a branch forked with Session.ForkAt. The session rewound
+// from is kept, and with a store both are saved, so the alternatives can
+// be listed with Branches and resumed. With a checkpointer, the files the
+// tool calls changed from that message on are rewound too, including calls
+// made in the sessions it was forked from. It waits for a running query to
+// end, or returns ctx's error when ctx ends first; called from a hook or
+// tool of that query, it waits until ctx ends.
+func (c *Client) RewindTo(ctx context.Context, index int) error {
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() { <-c.slot }()
+
+	c.mu.Lock()
+	current := c.session
+	c.mu.Unlock()
+	return c.rewind(ctx, current, index)
+}
+
+// MessageLocator is a SessionStore that identifies the messages it saves,
+// as a TranscriptStore does by the uuids of their transcript lines.
+type MessageLocator interface {
+	SessionStore
+	// MessageIndex returns the index of the message uuid in the session
+	// id as last saved, or an error wrapping ErrMessageNotFound.
+	MessageIndex(ctx context.Context, id, uuid string) (int, error)
+}
+
+// RewindToMessage is like RewindTo, but continues from before the message
+// the client's store identifies as uuid. It requires a store implementing
+// MessageLocator.
+func (c *Client) RewindToMessage(ctx context.Context, uuid string) error {
+	if c.store == nil {
+		return errNoStore
+	}
+	locator, ok := c.store.(MessageLocator)
+	if !ok {
+		return ErrStoreNoMessageIDs
+	}
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() { <-c.slot }()
+
+	c.mu.Lock()
+	current := c.session
+	c.mu.Unlock()
+
+	index, err := locator.MessageIndex(ctx, current.ID, uuid)
+	if err != nil {
+		return err
+	}
+	return c.rewind(ctx, current, index)
+}
+
+// rewind moves the client to a branch of current forked before message
+// index. The caller holds the client's slot.
+func (c *Client) rewind(ctx context.Context, current *Session, index int) error {
+	branch, err := current.ForkAt(index)
+	if err != nil {
+		return err
+	}
+	if err := c.rewindFilesTo(ctx, current, index); err != nil {
+		return fmt.Errorf("rewind files: %w", err)
+	}
+	if c.store != nil {
+		if err := c.store.Save(ctx, current); err != nil {
+			return fmt.Errorf("save rewound session: %w", err)
+		}
+		if err := c.store.Save(ctx, branch); err != nil {
+			return fmt.Errorf("save branch: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.session = branch
+	c.mu.Unlock()
+	return nil
+}
+
+// Branches returns the summaries of the sessions forked from the session
+// id, in the order they were created. It requires a store implementing
+// SessionIndex or SessionLister; with a SessionLister every session is
+// loaded to find them.
+func (c *Client) Branches(ctx context.Context, id string) ([]SessionSummary, error) {
+	if c.store == nil {
+		return nil, errNoStore
+	}
+	index, ok := c.store.(SessionIndex)
+	if !ok {
+		return c.listBranches(ctx, id)
+	}
+	var branches []SessionSummary
+	q := SessionQuery{ParentID: id, Sort: SortByCreated, Ascending: true}
+	for {
+		page, err := index.ListSummaries(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, page.Sessions...)
+		if page.NextCursor == "" {
+			return branches, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+// listBranches finds the branches of id in a store that can only list
+// whole sessions.
+func (c *Client) listBranches(ctx context.Context, id string) ([]SessionSummary, error) {
+	lister, ok := c.store.(SessionLister)
+	if !ok {
+		return nil, ErrStoreNotListable
+	}
+	sessions, err := lister.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var branches []SessionSummary
+	for _, s := range sessions {
+		if s.Metadata.ParentID == id {
+			branches = append(branches, s.Summary())
+		}
+	}
+	slices.SortFunc(branches, func(a, b SessionSummary) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return branches, nil
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toolSession returns a session with two prompts, the first answered after
+// a tool call:
+//
+//	0 user prompt, 1 assistant tool use, 2 user tool result,
+//	3 assistant text, 4 user prompt, 5 assistant text
+func toolSession() *Session {
+	s := NewSession()
+	s.Messages = []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("list files")),
+		anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("toolu_1", map[string]any{"command": "ls"}, "Bash")),
+		anthropic.NewUserMessage(anthropic.NewToolResultBlock("toolu_1", "a.go", false)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("one file")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("thanks")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("welcome")),
+	}
+	s.Metadata.Title = "Files"
+	s.Metadata.TotalCost = decimal.RequireFromString("0.02")
+	s.Metadata.TotalTokens = Usage{InputTokens: 100, OutputTokens: 20}
+	s.Metadata.NumTurns = 3
+	return s
+}
+
+func TestSession_ForkAt(t *testing.T) {
+	s := toolSession()
+
+	forked, err := s.ForkAt(4)
+	require.NoError(t, err)
+	assert.NotEqual(t, s.ID, forked.ID)
+	assert.Len(t, forked.Messages, 4)
+	assert.Len(t, s.Messages, 6, "the original keeps its history")
+	assert.Equal(t, s.ID, forked.Metadata.ParentID)
+	assert.Equal(t, 4, forked.Metadata.BranchPoint)
+	assert.Equal(t, "Files", forked.Metadata.Title)
+	assert.True(t, forked.Metadata.TotalCost.IsZero(), "the shared messages' cost stays with the parent")
+	assert.Equal(t, Usage{}, forked.Metadata.TotalTokens)
+	assert.Equal(t, 0, forked.Metadata.NumTurns)
+
+	// Appending to the fork does not write into the original's array.
+	forked.Messages = append(forked.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock("other")))
+	assert.Equal(t, "thanks", s.Messages[4].Content[0].OfText.Text)
+
+	for _, index := range []int{0, 1, 3, 6} {
+		_, err := s.ForkAt(index)
+		assert.NoError(t, err, "index %d", index)
+	}
+	for _, index := range []int{-1, 2, 7} {
+		_, err := s.ForkAt(index)
+		assert.ErrorIs(t, err, ErrInvalidRewindPoint, "index %d", index)
+	}
+}
+
+func TestSession_PromptIndexes(t *testing.T) {
+	assert.Equal(t, []int{0, 4}, toolSession().PromptIndexes())
+	assert.Empty(t, NewSession().PromptIndexes())
+}
+
+// indexedStore is a test store listing the sessions forked from another.
+type indexedStore struct {
+	recordingStore
+}
+
+func (s *indexedStore) ListSummaries(_ context.Context, q SessionQuery) (*SessionPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page := &SessionPage{}
+	for _, sess := range s.sessions {
+		if sess.Metadata.ParentID == q.ParentID {
+			page.Sessions = append(page.Sessions, sess.Summary())
+		}
+	}
+	return page, nil
+}
+
+func TestClient_RewindTo(t *testing.T) {
+	store := &indexedStore{recordingStore: recordingStore{sessions: make(map[string]*Session)}}
+	c := NewClient(WithSessionStore(store))
+	original := toolSession()
+	c.session = original
+
+	assert.ErrorIs(t, c.RewindTo(context.Background(), 2), ErrInvalidRewindPoint)
+	assert.Same(t, original, c.Session())
+
+	require.NoError(t, c.RewindTo(context.Background(), original.PromptIndexes()[1]))
+	branch := c.Session()
+	assert.NotEqual(t, original.ID, branch.ID)
+	assert.Len(t, branch.Messages, 4)
+	assert.Contains(t, store.sessions, original.ID, "the rewound session is saved")
+	assert.Contains(t, store.sessions, branch.ID)
+
+	branches, err := c.Branches(context.Background(), original.ID)
+	require.NoError(t, err)
+	require.Len(t, branches, 1)
+	assert.Equal(t, branch.ID, branches[0].ID)
+	assert.Equal(t, 4, branches[0].BranchPoint)
+}
+
+func TestClient_Branches_NotIndexed(t *testing.T) {
+	_, err := NewClient().Branches(context.Background(), "sess")
+	assert.ErrorIs(t, err, ErrNoSessionStore)
+
+	c := NewClient(WithSessionStore(&recordingStore{sessions: make(map[string]*Session)}))
+	_, err = c.Branches(context.Background(), "sess")
+	assert.ErrorIs(t, err, ErrStoreNotListable)
+}
+
+// listingStore is a test store that lists whole sessions.
+type listingStore struct {
+	recordingStore
+}
+
+func (s *listingStore) List(context.Context) ([]*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []*Session
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+func TestClient_Branches_Lister(t *testing.T) {
+	store := &listingStore{recordingStore: recordingStore{sessions: make(map[string]*Session)}}
+	c := NewClient(WithSessionStore(store))
+	original := toolSession()
+	c.session = original
+
+	require.NoError(t, c.RewindTo(context.Background(), 4))
+	first := c.Session()
+	c.session = original
+	require.NoError(t, c.RewindTo(context.Background(), 0))
+	second := c.Session()
+	second.CreatedAt = first.CreatedAt.Add(time.Second)
+
+	branches, err := c.Branches(context.Background(), original.ID)
+	require.NoError(t, err)
+	require.Len(t, branches, 2)
+	assert.Equal(t, first.ID, branches[0].ID)
+	assert.Equal(t, second.ID, branches[1].ID)
+	assert.Equal(t, 0, branches[1].BranchPoint)
+}
+
+func TestClient_RewindToMessage_NotLocatable(t *testing.T) {
+	assert.ErrorIs(t, NewClient().RewindToMessage(context.Background(), "u1"), ErrNoSessionStore)
+
+	c := NewClient(WithSessionStore(&recordingStore{sessions: make(map[string]*Session)}))
+	assert.ErrorIs(t, c.RewindToMessage(context.Background(), "u1"), ErrStoreNoMessageIDs)
+}
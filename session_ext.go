@@ -2,13 +2,19 @@ package agent
 
 import (
 	"context"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
 )
 
 // Clone creates a deep copy of the session with a new ID and timestamp.
 // The message history is copied so the original session is not affected.
+// The copy records s as its parent, and its cost, token and turn totals
+// start at zero: what the shared messages cost stays with s, so summing a
+// branch tree counts it once.
 func (s *Session) Clone() *Session {
 	msgs := make([]anthropic.MessageParam, len(s.Messages))
 	copy(msgs, s.Messages)
@@ -19,12 +25,15 @@ func (s *Session) Clone() *Session {
 		Messages: msgs,
 		Metadata: SessionMeta{
 			Model:       s.Metadata.Model,
-			TotalCost:   s.Metadata.TotalCost,
-			TotalTokens: s.Metadata.TotalTokens,
-			NumTurns:    s.Metadata.NumTurns,
+			TotalCost:   decimal.Zero,
+			Title:       s.Metadata.Title,
+			Tags:        slices.Clone(s.Metadata.Tags),
+			ParentID:    s.ID,
+			BranchPoint: len(msgs),
 		},
 		CreatedAt: now,
 		UpdatedAt: now,
+		responses: maps.Clone(s.responses),
 	}
 }
 
@@ -15,6 +15,7 @@ func TestSession_Clone(t *testing.T) {
 		anthropic.NewUserMessage(anthropic.NewTextBlock("hello")))
 	original.Metadata.Model = "claude-opus-4-6"
 	original.Metadata.TotalCost = decimal.NewFromFloat(0.05)
+	original.Metadata.TotalTokens = Usage{InputTokens: 100, OutputTokens: 20}
 	original.Metadata.NumTurns = 3
 
 	cloned := original.Clone()
@@ -25,10 +26,13 @@ func TestSession_Clone(t *testing.T) {
 	// Messages are copied
 	require.Len(t, cloned.Messages, 1)
 
-	// Metadata is copied
+	// Metadata is copied, but the totals stay with the parent
 	assert.Equal(t, original.Metadata.Model, cloned.Metadata.Model)
-	assert.True(t, original.Metadata.TotalCost.Equal(cloned.Metadata.TotalCost))
-	assert.Equal(t, original.Metadata.NumTurns, cloned.Metadata.NumTurns)
+	assert.Equal(t, original.ID, cloned.Metadata.ParentID)
+	assert.Equal(t, 1, cloned.Metadata.BranchPoint)
+	assert.True(t, cloned.Metadata.TotalCost.IsZero())
+	assert.Equal(t, Usage{}, cloned.Metadata.TotalTokens)
+	assert.Equal(t, 0, cloned.Metadata.NumTurns)
 
 	// Modifying clone does not affect original
 	cloned.Messages = append(cloned.Messages,
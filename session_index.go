@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+)
+
+// maxSummaryPrompt is how many runes of the first prompt a summary keeps.
+const maxSummaryPrompt = 200
+
+// SessionSummary describes a session without its messages, for listing.
+type SessionSummary struct {
+	ID string
+	// Title is the session's title, empty until set or generated (see
+	// WithAutoTitle).
+	Title string
+	// FirstPrompt is the start of the session's first user message.
+	FirstPrompt string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Model       anthropic.Model
+	NumTurns    int
+	TotalCost   decimal.Decimal
+	Tags        []string
+	// ParentID and BranchPoint place a forked session in its branch tree;
+	// see SessionMeta.
+	ParentID    string
+	BranchPoint int
+}
+
+// Summary returns the session's summary.
+func (s *Session) Summary() SessionSummary {
+	prompt := []rune(s.FirstPrompt())
+	if len(prompt) > maxSummaryPrompt {
+		prompt = append(prompt[:maxSummaryPrompt], '…')
+	}
+	return SessionSummary{
+		ID:          s.ID,
+		Title:       s.Metadata.Title,
+		FirstPrompt: string(prompt),
+		CreatedAt:   s.CreatedAt,
+		UpdatedAt:   s.UpdatedAt,
+		Model:       s.Metadata.Model,
+		NumTurns:    s.Metadata.NumTurns,
+		TotalCost:   s.Metadata.TotalCost,
+		Tags:        slices.Clone(s.Metadata.Tags),
+		ParentID:    s.Metadata.ParentID,
+		BranchPoint: s.Metadata.BranchPoint,
+	}
+}
+
+// FirstPrompt returns the text of the session's first user message.
+func (s *Session) FirstPrompt() string {
+	for _, msg := range s.Messages {
+		if msg.Role != anthropic.MessageParamRoleUser {
+			continue
+		}
+		var parts []string
+		for _, block := range msg.Content {
+			if block.OfText != nil {
+				parts = append(parts, block.OfText.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// SessionSort orders a listing of sessions.
+type SessionSort int
+
+const (
+	// SortByUpdated orders by last update. This is the default.
+	SortByUpdated SessionSort = iota
+	SortByCreated
+	SortByCost
+	SortByTurns
+)
+
+// SessionQuery selects a page of session summaries. Zero fields do not
+// filter.
+type SessionQuery struct {
+	// Limit is the page size. Default: DefaultSessionPageSize.
+	Limit int
+	// Cursor continues a listing from the SessionPage.NextCursor of the
+	// previous page, with the same query.
+	Cursor string
+
+	// Sort orders the sessions, descending unless Ascending is set. Ties
+	// are ordered by ID.
+	Sort      SessionSort
+	Ascending bool
+
+	Model         anthropic.Model
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// Tags selects sessions having every one of the tags.
+	Tags []string
+	// ParentID selects the sessions forked from a session.
+	ParentID string
+
+	// Text selects sessions whose title or message text contains every
+	// word of it, ignoring case.
+	Text string
+}
+
+// SessionPage is one page of session summaries.
+type SessionPage struct {
+	Sessions []SessionSummary
+	// NextCursor continues the listing; it is empty on the last page.
+	NextCursor string
+}
+
+// SessionIndex is a SessionStore that lists sessions without loading
+// them.
+type SessionIndex interface {
+	SessionStore
+	ListSummaries(ctx context.Context, q SessionQuery) (*SessionPage, error)
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// MessageResponse holds what the API returned with an assistant message
+// besides its content, which the message's MessageParam does not keep.
+type MessageResponse struct {
+	ID           string
+	Model        anthropic.Model
+	StopReason   anthropic.StopReason
+	StopSequence string
+	Usage        Usage
+}
+
+// RecordResponse notes the details of msg, whose content was appended to
+// the session's messages, for stores that keep them, such as the
+// transcript store of the session package. Runs record every response.
+func (s *Session) RecordResponse(msg anthropic.Message) {
+	key, ok := messageKey(msg.ToParam())
+	if !ok {
+		return
+	}
+	if s.responses == nil {
+		s.responses = make(map[[sha256.Size]byte]*MessageResponse)
+	}
+	s.responses[key] = &MessageResponse{
+		ID:           msg.ID,
+		Model:        msg.Model,
+		StopReason:   msg.StopReason,
+		StopSequence: msg.StopSequence,
+		Usage: Usage{
+			InputTokens:              msg.Usage.InputTokens,
+			OutputTokens:             msg.Usage.OutputTokens,
+			CacheReadInputTokens:     msg.Usage.CacheReadInputTokens,
+			CacheCreationInputTokens: msg.Usage.CacheCreationInputTokens,
+		},
+	}
+}
+
+// Response returns the details recorded for the assistant message at
+// index i, or nil if none were: for user messages, messages loaded from a
+// store, and messages changed since their response.
+func (s *Session) Response(i int) *MessageResponse {
+	if len(s.responses) == 0 || i < 0 || i >= len(s.Messages) || s.Messages[i].Role != anthropic.MessageParamRoleAssistant {
+		return nil
+	}
+	key, ok := messageKey(s.Messages[i])
+	if !ok {
+		return nil
+	}
+	return s.responses[key]
+}
+
+// messageKey identifies a message by its content, so responses stay with
+// their messages when the history is compacted, repaired or forked.
+func messageKey(msg anthropic.MessageParam) ([sha256.Size]byte, bool) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	return sha256.Sum256(data), true
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snapshotStore records the state of the session at each save.
+type snapshotStore struct {
+	mu    sync.Mutex
+	saves []SessionMeta
+	msgs  []int
+	err   error
+}
+
+func (s *snapshotStore) Save(_ context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves = append(s.saves, session.Metadata)
+	s.msgs = append(s.msgs, len(session.Messages))
+	return s.err
+}
+
+func (s *snapshotStore) Load(context.Context, string) (*Session, error) {
+	return nil, ErrSessionNotFound
+}
+
+func (s *snapshotStore) Delete(context.Context, string) error { return nil }
+
+// runToolTurns runs a prompt answered by a tool call and a final text,
+// which appends an assistant message, a tool result and another assistant
+// message to the session.
+func runToolTurns(t *testing.T, store *snapshotStore, opts ...AgentOption) (*Session, []Event) {
+	t.Helper()
+	provider := &scriptedProvider{responses: []string{
+		toolUseResponse("toolu_1", "Missing"),
+		textResponse("done"),
+	}}
+	a := NewAgent(append([]AgentOption{WithProvider(provider), WithSessionStore(store)}, opts...)...)
+	session := NewSession()
+	stream := a.RunWithSession(context.Background(), session, "hi")
+	var events []Event
+	for e := range stream.Events() {
+		events = append(events, e)
+	}
+	return session, events
+}
+
+func TestAutoSave_EveryTurn(t *testing.T) {
+	store := &snapshotStore{}
+	session, _ := runToolTurns(t, store, WithAutoSaveInterval(-1))
+
+	// Assistant, tool result, assistant, and the totals at the end.
+	assert.Equal(t, []int{2, 3, 4, 4}, store.msgs)
+	assert.Equal(t, 1, store.saves[0].NumTurns)
+	assert.Equal(t, int64(10), store.saves[0].TotalTokens.InputTokens)
+	assert.Equal(t, 2, store.saves[2].NumTurns)
+	assert.Equal(t, session.Metadata, store.saves[3])
+	assert.Equal(t, 2, session.Metadata.NumTurns)
+	assert.Equal(t, int64(20), session.Metadata.TotalTokens.InputTokens)
+	assert.Equal(t, int64(10), session.Metadata.TotalTokens.OutputTokens)
+}
+
+func TestAutoSave_Debounced(t *testing.T) {
+	store := &snapshotStore{}
+	runToolTurns(t, store, WithAutoSaveInterval(time.Hour))
+
+	// The first turn saves; the rest wait for the end of the run.
+	assert.Equal(t, []int{2, 4}, store.msgs)
+}
+
+func TestAutoSave_EndOfRun(t *testing.T) {
+	store := &snapshotStore{}
+	session, _ := runToolTurns(t, store, WithAutoSave(AutoSaveEndOfRun), WithAutoSaveInterval(-1))
+
+	assert.Equal(t, []int{4}, store.msgs)
+	assert.Equal(t, session.Metadata, store.saves[0])
+}
+
+func TestAutoSave_Manual(t *testing.T) {
+	store := &snapshotStore{}
+	runToolTurns(t, store, WithAutoSave(AutoSaveManual))
+
+	assert.Empty(t, store.saves)
+}
+
+func TestAutoSave_ErrorEvent(t *testing.T) {
+	store := &snapshotStore{err: errors.New("disk full")}
+	session, events := runToolTurns(t, store, WithAutoSave(AutoSaveEndOfRun))
+
+	// The error comes just before the result.
+	require.GreaterOrEqual(t, len(events), 2)
+	saveErr, ok := events[len(events)-2].(*SessionSaveErrorEvent)
+	require.True(t, ok, "got %T", events[len(events)-2])
+	assert.Equal(t, session.ID, saveErr.SessionID)
+	assert.EqualError(t, saveErr.Err, "disk full")
+	assert.Equal(t, EventSessionSaveError, saveErr.Type())
+
+	result, ok := events[len(events)-1].(*ResultEvent)
+	require.True(t, ok, "got %T", events[len(events)-1])
+	assert.False(t, result.IsError)
+}
+
+func TestSession_Summary(t *testing.T) {
+	s := NewSession()
+	s.Messages = []anthropic.MessageParam{
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("ignored")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("first"), anthropic.NewTextBlock("second")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("later")),
+	}
+	s.Metadata.Title = "A title"
+	s.Metadata.Tags = []string{"x"}
+	s.Metadata.NumTurns = 3
+
+	summary := s.Summary()
+	assert.Equal(t, s.ID, summary.ID)
+	assert.Equal(t, "A title", summary.Title)
+	assert.Equal(t, "first\nsecond", summary.FirstPrompt)
+	assert.Equal(t, 3, summary.NumTurns)
+	assert.Equal(t, []string{"x"}, summary.Tags)
+
+	s.Messages = []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(strings.Repeat("é", 300)))}
+	assert.Equal(t, strings.Repeat("é", maxSummaryPrompt)+"…", s.Summary().FirstPrompt)
+}
+
+func TestSession_Response(t *testing.T) {
+	session, _ := runToolTurns(t, &snapshotStore{})
+	require.Len(t, session.Messages, 4)
+
+	assert.Nil(t, session.Response(0))
+	resp := session.Response(1)
+	require.NotNil(t, resp)
+	assert.Equal(t, "msg_1", resp.ID)
+	assert.Equal(t, anthropic.Model("test-model"), resp.Model)
+	assert.Equal(t, anthropic.StopReasonToolUse, resp.StopReason)
+	assert.Equal(t, Usage{InputTokens: 10, OutputTokens: 5}, resp.Usage)
+	assert.Nil(t, session.Response(2))
+	assert.Equal(t, anthropic.StopReasonEndTurn, session.Response(3).StopReason)
+
+	// A changed message no longer has its response.
+	session.Messages[3] = anthropic.NewAssistantMessage(anthropic.NewTextBlock("edited"))
+	assert.Nil(t, session.Response(3))
+	assert.NotNil(t, session.Clone().Response(1))
+}
+
+func TestAutoTitle(t *testing.T) {
+	provider := &scriptedProvider{responses: []string{
+		textResponse("hello there"),
+		textResponse("\"Friendly greeting.\"\nextra"),
+	}}
+	store := &snapshotStore{}
+	a := NewAgent(WithProvider(provider), WithSessionStore(store), WithAutoTitle("claude-haiku-4-5"))
+	session := NewSession()
+	for range a.RunWithSession(context.Background(), session, "hi").Events() {
+	}
+
+	assert.Equal(t, "Friendly greeting", session.Metadata.Title)
+	require.NotEmpty(t, store.saves)
+	assert.Equal(t, "Friendly greeting", store.saves[len(store.saves)-1].Title, "titled before the final save")
+
+	// A titled session keeps its title.
+	for range a.RunWithSession(context.Background(), session, "again").Events() {
+	}
+	assert.Equal(t, "Friendly greeting", session.Metadata.Title)
+}
+
+func TestAutoTitle_AfterResultAndCounted(t *testing.T) {
+	p := newGatedProvider(textResponse("hello there"), textResponse("Greeting"))
+	budget := NewBudget(decimal.NewFromInt(10))
+	a := NewAgent(WithProvider(p), WithAutoTitle(anthropic.ModelClaudeHaiku4_5), WithSharedBudget(budget))
+	session := NewSession()
+	stream := a.RunWithSession(context.Background(), session, "hi")
+	p.gate <- struct{}{}
+
+	var result *ResultEvent
+	for stream.Next() {
+		if r, ok := stream.Current().(*ResultEvent); ok {
+			result = r
+			// The title request is still waiting on its gate.
+			<-p.started
+			<-p.started
+			assert.Empty(t, session.Metadata.Title)
+			p.gate <- struct{}{}
+		}
+	}
+	require.NotNil(t, result)
+
+	assert.Equal(t, "Greeting", session.Metadata.Title)
+	assert.Equal(t, int64(20), session.Metadata.TotalTokens.InputTokens)
+	assert.Equal(t, 1, session.Metadata.NumTurns)
+	assert.True(t, session.Metadata.TotalCost.GreaterThan(result.TotalCost), "the title request is priced")
+	assert.True(t, budget.Spent().Equal(session.Metadata.TotalCost))
+}
+
+func TestAutoTitle_FailureKeepsRunResult(t *testing.T) {
+	// No scripted response is left for the title request.
+	provider := &scriptedProvider{responses: []string{textResponse("hello there")}}
+	a := NewAgent(WithProvider(provider), WithAutoTitle("claude-haiku-4-5"))
+	session := NewSession()
+	var result *ResultEvent
+	for e := range a.RunWithSession(context.Background(), session, "hi").Events() {
+		if r, ok := e.(*ResultEvent); ok {
+			result = r
+		}
+	}
+	require.NotNil(t, result)
+	assert.False(t, result.IsError)
+	assert.Empty(t, session.Metadata.Title)
+}
+
+func TestCleanTitle(t *testing.T) {
+	assert.Equal(t, "Fix the build", cleanTitle("  \"Fix the build.\"  "))
+	assert.Equal(t, "Title", cleanTitle("# Title\n\nMore text"))
+	assert.Len(t, []rune(cleanTitle(strings.Repeat("a", 200))), maxTitleLength)
+}
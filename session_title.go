@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
+)
+
+const (
+	// titleTimeout bounds the request generating a session's title.
+	titleTimeout = 30 * time.Second
+	// maxTitleLength is how many runes of a generated title are kept.
+	maxTitleLength = 80
+	// maxTitleContext is how many runes of the first prompt and response
+	// the title model sees.
+	maxTitleContext = 2000
+)
+
+const titleSystemPrompt = "Write a title of at most six words for the conversation below. " +
+	"Reply with the title only, without quotes or a final period."
+
+// titleCall is a title being generated for a session while its result is
+// delivered. done is closed once the other fields are set.
+type titleCall struct {
+	done    chan struct{}
+	model   anthropic.Model
+	title   string
+	usage   anthropic.Usage
+	elapsed time.Duration
+	err     error
+}
+
+// startTitle asks model, through streamer, for a short title of the
+// session's first exchange, in the background. The session is read before
+// it returns.
+func startTitle(ctx context.Context, streamer engine.MessageStreamer, model anthropic.Model, session *Session) *titleCall {
+	call := &titleCall{done: make(chan struct{}), model: model}
+	prompt := truncateRunes(session.FirstPrompt(), maxTitleContext)
+	reply := truncateRunes(firstReply(session), maxTitleContext)
+	go func() {
+		defer close(call.done)
+		start := time.Now()
+		call.title, call.usage, call.err = generateTitle(ctx, streamer, model, prompt, reply)
+		call.elapsed = time.Since(start)
+	}()
+	return call
+}
+
+// generateTitle asks model for a short title of the exchange of prompt and
+// reply, returning the usage of the request even if it fails.
+func generateTitle(ctx context.Context, streamer engine.MessageStreamer, model anthropic.Model, prompt, reply string) (string, anthropic.Usage, error) {
+	if prompt == "" {
+		return "", anthropic.Usage{}, errors.New("session has no prompt")
+	}
+	content := "User: " + prompt
+	if reply != "" {
+		content += "\n\nAssistant: " + reply
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, titleTimeout)
+	defer cancel()
+	stream := streamer.NewStreaming(ctx, anthropic.MessageNewParams{
+		Model:     model,
+		MaxTokens: 32,
+		System:    []anthropic.TextBlockParam{{Text: titleSystemPrompt}},
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(content))},
+	})
+	defer stream.Close()
+
+	msg := anthropic.Message{}
+	for stream.Next() {
+		if err := msg.Accumulate(stream.Current()); err != nil {
+			return "", msg.Usage, fmt.Errorf("accumulate title: %w", err)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return "", msg.Usage, fmt.Errorf("generate title: %w", err)
+	}
+	var text strings.Builder
+	for _, block := range msg.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	title := cleanTitle(text.String())
+	if title == "" {
+		return "", msg.Usage, errors.New("generate title: empty reply")
+	}
+	return title, msg.Usage, nil
+}
+
+// firstReply returns the text of the session's first assistant message.
+func firstReply(session *Session) string {
+	for _, msg := range session.Messages {
+		if msg.Role != anthropic.MessageParamRoleAssistant {
+			continue
+		}
+		var parts []string
+		for _, block := range msg.Content {
+			if block.OfText != nil {
+				parts = append(parts, block.OfText.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// cleanTitle keeps the first line of a model's reply, without the quotes
+// and final period models add despite being told not to.
+func cleanTitle(reply string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(reply), "\n")
+	title = strings.Trim(strings.TrimSpace(title), "\"'`*#")
+	title = strings.TrimSuffix(strings.TrimSpace(title), ".")
+	return truncateRunes(title, maxTitleLength)
+}
+
+// truncateRunes returns the first n runes of s.
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
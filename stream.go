@@ -1,5 +1,31 @@
 package agent
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+)
+
+// OverflowPolicy decides what happens to text deltas when the consumer of
+// an AgentStream falls behind and the stream's buffer is full. Other
+// events always wait for room, until the run's context ends or the stream
+// is closed.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the run wait for the consumer. This is the default.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropDeltas discards StreamEvents that do not fit. The text
+	// still arrives in the AssistantEvent that completes the response.
+	OverflowDropDeltas
+	// OverflowCoalesceDeltas merges StreamEvents that do not fit into the
+	// next one that does, so no text is lost but deltas grow larger.
+	OverflowCoalesceDeltas
+)
+
 // AgentStream is an iterator over events emitted during an agent run.
 // Usage:
 //
@@ -11,12 +37,27 @@ package agent
 //	if err := stream.Err(); err != nil {
 //	    // handle error
 //	}
+//
+// Callers that only need the outcome can use Result, Text, Wait or
+// StructuredOutput, which consume the rest of the stream. A caller that
+// stops reading early should call Close so the run does not wait on it.
 type AgentStream struct {
 	events  chan Event
 	current Event
 	err     error
 	done    bool
 	session *Session
+
+	// ctx is the run's context and cancel cancels it. abandoned is closed
+	// by Close to release a run blocked on a full buffer.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	abandoned chan struct{}
+	closeOnce sync.Once
+
+	// result and text collect the run's outcome as events are read.
+	result *ResultEvent
+	text   strings.Builder
 }
 
 // newStream creates a new AgentStream with the given event channel and session.
@@ -36,9 +77,26 @@ func (s *AgentStream) Next() bool {
 	event, ok := <-s.events
 	if !ok {
 		s.done = true
+		// Events of a cancelled run, its result included, may be dropped.
+		if s.result == nil && s.err == nil && s.ctx != nil {
+			s.err = s.ctx.Err()
+		}
 		return false
 	}
 	s.current = event
+	switch e := event.(type) {
+	case *AssistantEvent:
+		for _, block := range e.Message.Content {
+			if block.Type == "text" {
+				s.text.WriteString(block.Text)
+			}
+		}
+	case *ResultEvent:
+		s.result = e
+		if err := e.Err(); err != nil && s.err == nil {
+			s.err = err
+		}
+	}
 	return true
 }
 
@@ -47,11 +105,82 @@ func (s *AgentStream) Current() Event {
 	return s.current
 }
 
-// Err returns the first error encountered during iteration, if any.
+// Err returns the error the run ended with, if any: a *ResultError
+// wrapping ErrMaxTurns, ErrBudgetExhausted, ErrStructuredOutputRetries or
+// ErrExecution, and the context's error when the run was cancelled. It is
+// set once the result event has been read.
 func (s *AgentStream) Err() error {
 	return s.err
 }
 
+// Events returns an iterator over the remaining events, for use with
+// range. Breaking out of the loop leaves the rest of the stream unread.
+func (s *AgentStream) Events() iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		for s.Next() {
+			if !yield(s.Current()) {
+				return
+			}
+		}
+	}
+}
+
+// Wait consumes the rest of the stream and returns Err.
+func (s *AgentStream) Wait() error {
+	for s.Next() {
+	}
+	return s.err
+}
+
+// Result consumes the rest of the stream and returns the run's result
+// event along with Err. The result is nil if the run produced none.
+func (s *AgentStream) Result() (*ResultEvent, error) {
+	err := s.Wait()
+	return s.result, err
+}
+
+// Text consumes the rest of the stream and returns the text of every
+// assistant message read from it, concatenated as the text deltas are.
+func (s *AgentStream) Text() (string, error) {
+	err := s.Wait()
+	return s.text.String(), err
+}
+
+// StructuredOutput consumes the rest of s and decodes the run's structured
+// output, which requires an agent configured with WithOutputFormat.
+func StructuredOutput[T any](s *AgentStream) (*T, error) {
+	result, err := s.Result()
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || result.StructuredOutput == nil {
+		return nil, ErrNoStructuredOutput
+	}
+	var out T
+	if err := json.Unmarshal(result.StructuredOutput, &out); err != nil {
+		return nil, fmt.Errorf("unmarshal structured output: %w", err)
+	}
+	return &out, nil
+}
+
+// Close abandons the stream: it cancels the run, discards the events not
+// yet read and waits for the run to end. It may be called more than once,
+// after the stream is exhausted, and concurrently with Next. It always
+// returns nil.
+func (s *AgentStream) Close() error {
+	s.closeOnce.Do(func() {
+		if s.cancel != nil {
+			s.cancel()
+		}
+		if s.abandoned != nil {
+			close(s.abandoned)
+		}
+	})
+	for range s.events {
+	}
+	return nil
+}
+
 // Session returns the session associated with this stream.
 // The session is populated with conversation history after the run completes.
 func (s *AgentStream) Session() *Session {
@@ -64,3 +193,11 @@ func emptyStream() *AgentStream {
 	close(ch)
 	return newStream(ch, NewSession())
 }
+
+// errorStream returns a stream that reports err without running.
+func errorStream(err error, session *Session) *AgentStream {
+	s := emptyStream()
+	s.session = session
+	s.err = err
+	return s
+}
@@ -1,7 +1,12 @@
 package agent
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -82,3 +87,177 @@ func TestEventTypes(t *testing.T) {
 		assert.Equal(t, tc.expected, tc.event.Type(), "event type mismatch for %T", tc.event)
 	}
 }
+
+// streamOf returns a stream that yields events and ends.
+func streamOf(events ...Event) *AgentStream {
+	ch := make(chan Event, len(events))
+	for _, e := range events {
+		ch <- e
+	}
+	close(ch)
+	return newStream(ch, NewSession())
+}
+
+func TestStreamErr_MapsResultSubtypes(t *testing.T) {
+	tests := []struct {
+		subtype  string
+		sentinel error
+	}{
+		{"error_max_turns", ErrMaxTurns},
+		{"error_max_budget_usd", ErrBudgetExhausted},
+		{"error_max_structured_output_retries", ErrStructuredOutputRetries},
+		{"error_during_execution", ErrExecution},
+	}
+	for _, tc := range tests {
+		stream := streamOf(&ResultEvent{Subtype: tc.subtype, IsError: true, Errors: []string{"detail"}})
+		err := stream.Wait()
+
+		require.ErrorIs(t, err, tc.sentinel, tc.subtype)
+		var resultErr *ResultError
+		require.ErrorAs(t, err, &resultErr)
+		assert.Equal(t, tc.subtype, resultErr.Subtype)
+		assert.Equal(t, tc.sentinel.Error()+": detail", err.Error())
+	}
+
+	assert.NoError(t, streamOf(&ResultEvent{Subtype: "success"}).Wait())
+}
+
+func TestStreamErr_CancelledRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := NewAgent(WithProvider(&scriptedProvider{responses: []string{textResponse("hi")}}), WithModel("test-model"))
+
+	err := a.Run(ctx, "hello").Wait()
+	assert.ErrorIs(t, err, ErrExecution)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestStreamEvents_RangesOverEvents(t *testing.T) {
+	stream := streamOf(&SystemEvent{}, &StreamEvent{Delta: "a"}, &ResultEvent{Subtype: "success"})
+
+	var types []EventType
+	for e := range stream.Events() {
+		types = append(types, e.Type())
+		if e.Type() == EventStream {
+			break
+		}
+	}
+	assert.Equal(t, []EventType{EventSystem, EventStream}, types)
+
+	// The rest stays readable after breaking out.
+	result, err := stream.Result()
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Subtype)
+}
+
+func TestStreamText_ConcatenatesAssistantText(t *testing.T) {
+	a := NewAgent(WithProvider(&scriptedProvider{responses: []string{textResponse("Paris")}}), WithModel("test-model"))
+	stream := a.Run(context.Background(), "Capital of France?")
+
+	// Events read before Text still count.
+	require.True(t, stream.Next())
+	text, err := stream.Text()
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", text)
+
+	result, err := stream.Result()
+	require.NoError(t, err)
+	assert.Equal(t, "success", result.Subtype)
+}
+
+func TestStructuredOutput(t *testing.T) {
+	type answer struct {
+		City string `json:"city"`
+	}
+	stream := streamOf(
+		&AssistantEvent{Message: anthropic.Message{}},
+		&ResultEvent{Subtype: "success", StructuredOutput: json.RawMessage(`{"city":"Paris"}`)},
+	)
+	out, err := StructuredOutput[answer](stream)
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", out.City)
+
+	_, err = StructuredOutput[answer](streamOf(&ResultEvent{Subtype: "success"}))
+	assert.ErrorIs(t, err, ErrNoStructuredOutput)
+
+	_, err = StructuredOutput[answer](streamOf(&ResultEvent{Subtype: "error_max_turns", IsError: true}))
+	assert.ErrorIs(t, err, ErrMaxTurns)
+}
+
+func TestStreamClose_ReleasesRunAndIsIdempotent(t *testing.T) {
+	a := NewAgent(
+		WithProvider(&scriptedProvider{responses: []string{textResponse("Paris")}}),
+		WithModel("test-model"),
+		WithStreamBufferSize(1),
+	)
+	stream := a.Run(context.Background(), "Capital of France?")
+	require.True(t, stream.Next())
+
+	closed := make(chan struct{})
+	go func() {
+		assert.NoError(t, stream.Close())
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	assert.False(t, stream.Next())
+	assert.NoError(t, stream.Close())
+}
+
+func TestChannelSink_GivesUpWhenNobodyReads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	abandoned := make(chan struct{})
+	close(abandoned)
+
+	for name, sink := range map[string]*channelSink{
+		"cancelled": {ch: make(chan Event), ctx: ctx},
+		"abandoned": {ch: make(chan Event), abandoned: abandoned},
+	} {
+		done := make(chan struct{})
+		go func() {
+			sink.OnStream("a")
+			sink.OnAssistant(anthropic.Message{})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: sink blocked", name)
+		}
+	}
+}
+
+func TestChannelSink_OverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		want   []string
+	}{
+		{OverflowDropDeltas, []string{"a", "b", "assistant"}},
+		{OverflowCoalesceDeltas, []string{"a", "b", "cd", "assistant"}},
+	}
+	for _, tc := range tests {
+		ch := make(chan Event, 2)
+		sink := &channelSink{ch: ch, overflow: tc.policy}
+		for _, d := range []string{"a", "b", "c", "d"} {
+			sink.OnStream(d)
+		}
+		go func() {
+			sink.OnAssistant(anthropic.Message{})
+			close(ch)
+		}()
+
+		var got []string
+		for e := range ch {
+			if d, ok := e.(*StreamEvent); ok {
+				got = append(got, d.Delta)
+			} else {
+				got = append(got, string(e.Type()))
+			}
+		}
+		assert.Equal(t, tc.want, got, "policy %d", tc.policy)
+	}
+}
@@ -18,6 +18,10 @@ type Definition struct {
 	// Model overrides the parent's model. Empty means inherit parent.
 	Model anthropic.Model
 
+	// Provider serves this sub-agent's model requests, e.g. a cheaper
+	// OpenAI-compatible or local model. Nil means inherit parent.
+	Provider agent.Provider
+
 	// Instructions is an additional system prompt appended to the parent's.
 	Instructions string
 
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
 
 	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
 
 	"github.com/shopspring/decimal"
 )
@@ -98,7 +100,14 @@ func (r *Runner) Spawn(ctx context.Context, name, prompt string) (string, error)
 	childOpts := buildChildOptions(r.parent, def)
 	childAgent := agent.NewAgent(childOpts...)
 
+	// Record into the calling run's metrics, or the parent's when spawned
+	// outside a run; the child run inherits them through its context.
+	m := r.metrics(ctx)
+	ctx = agent.WithContextMetrics(ctx, m)
+	ctx, logger := r.logger(ctx)
+
 	runID := agent.GenerateID(agent.PrefixRun)
+	logger = logger.With(metrics.LabelAgent, name, "subagent_run_id", runID)
 	childCtx, cancel := context.WithCancel(ctx)
 	resultCh := make(chan *Result, 1)
 
@@ -113,6 +122,10 @@ func (r *Runner) Spawn(ctx context.Context, name, prompt string) (string, error)
 	r.active[runID] = handle
 	r.mu.Unlock()
 
+	agentLabel := metrics.L(metrics.LabelAgent, name)
+	m.Add(metrics.SubagentsActive, 1, agentLabel)
+	logger.Debug("subagent started")
+
 	go func() {
 		defer cancel()
 		if r.OnStart != nil {
@@ -122,6 +135,17 @@ func (r *Runner) Spawn(ctx context.Context, name, prompt string) (string, error)
 		if r.OnStop != nil {
 			r.OnStop(name, runID)
 		}
+		m.Add(metrics.SubagentsActive, -1, agentLabel)
+		m.Add(metrics.SubagentRuns, 1, agentLabel,
+			metrics.L(metrics.LabelOutcome, metrics.Outcome(result == nil || result.Err != nil)))
+		switch {
+		case result == nil:
+			logger.Warn("subagent finished without a result")
+		case result.Err != nil:
+			logger.Warn("subagent failed", "error", result.Err)
+		default:
+			logger.Debug("subagent finished", "cost", result.Cost.String())
+		}
 		resultCh <- result
 	}()
 
@@ -171,6 +195,26 @@ func (r *Runner) Definitions() map[string]*Definition {
 	return r.defs
 }
 
+// metrics returns the metrics carried by ctx, falling back to the parent
+// agent's.
+func (r *Runner) metrics(ctx context.Context) metrics.Metrics {
+	if m := agent.ContextMetrics(ctx); m != metrics.Nop {
+		return m
+	}
+	return metrics.OrNop(r.parent.Metrics())
+}
+
+// logger returns the logger carried by ctx, falling back to the parent
+// agent's. In the fallback case the returned context carries it, so the
+// child run logs there too.
+func (r *Runner) logger(ctx context.Context) (context.Context, *slog.Logger) {
+	if l := agent.ContextLogger(ctx); l.Enabled(ctx, slog.LevelError) {
+		return ctx, l
+	}
+	l := r.parent.Logger()
+	return agent.WithContextLogger(ctx, l), l
+}
+
 // removeHandle removes a completed run handle from the active map.
 func (r *Runner) removeHandle(runID string) {
 	r.mu.Lock()
@@ -188,7 +232,7 @@ func defaultRunFunc(ctx context.Context, childAgent *agent.Agent, prompt string)
 // buildChildOptions constructs AgentOption functions from a Definition,
 // inheriting the parent's model when the definition does not override it.
 func buildChildOptions(parent *agent.Agent, def *Definition) []agent.AgentOption {
-	var opts []agent.AgentOption
+	opts := []agent.AgentOption{agent.WithName(def.Name)}
 
 	// Inherit or override model.
 	if def.Model != "" {
@@ -197,6 +241,13 @@ func buildChildOptions(parent *agent.Agent, def *Definition) []agent.AgentOption
 		opts = append(opts, agent.WithModel(parent.Model()))
 	}
 
+	// Inherit or override provider.
+	if def.Provider != nil {
+		opts = append(opts, agent.WithProvider(def.Provider))
+	} else if p := parent.Provider(); p != nil {
+		opts = append(opts, agent.WithProvider(p))
+	}
+
 	// Override system prompt if specified.
 	if def.Instructions != "" {
 		opts = append(opts, agent.WithSystemPrompt(def.Instructions))
@@ -207,6 +258,12 @@ func buildChildOptions(parent *agent.Agent, def *Definition) []agent.AgentOption
 		opts = append(opts, agent.WithMaxTurns(def.MaxTurns))
 	}
 
+	// Draw from the parent's shared budget so it caps the whole tree. When
+	// spawned from a tool call, the call's context budget takes precedence.
+	if b := parent.SharedBudget(); b != nil {
+		opts = append(opts, agent.WithSharedBudget(b))
+	}
+
 	// Override budget if specified.
 	if !def.MaxBudget.IsZero() {
 		opts = append(opts, agent.WithBudget(def.MaxBudget))
@@ -224,22 +281,14 @@ func drainStream(stream *agent.AgentStream) *Result {
 		Session: stream.Session(),
 	}
 
-	for stream.Next() {
-		evt := stream.Current()
-
-		switch e := evt.(type) {
-		case *agent.ResultEvent:
-			result.Output = e.Result
-			result.Usage = e.Usage
-			result.Cost = e.TotalCost
-			if e.IsError {
-				result.Err = fmt.Errorf("subagent error: %s", e.Result)
-			}
-		}
+	final, err := stream.Result()
+	if final != nil {
+		result.Output = final.Result
+		result.Usage = final.Usage
+		result.Cost = final.TotalCost
 	}
-
-	if err := stream.Err(); err != nil {
-		result.Err = err
+	if err != nil {
+		result.Err = fmt.Errorf("subagent error: %w", err)
 	}
 
 	return result
@@ -3,15 +3,19 @@ package subagent
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
+	"github.com/armatrix/claude-agent-sdk-go/metrics/promtext"
 )
 
 // --- Mock RunFunc helpers ---
@@ -122,6 +126,33 @@ func TestBuildChildOptions_WithBudget(t *testing.T) {
 	require.NotNil(t, child)
 }
 
+func TestBuildChildOptions_InheritsSharedBudget(t *testing.T) {
+	shared := agent.NewBudget(decimal.NewFromFloat(10))
+	parent := agent.NewAgent(agent.WithSharedBudget(shared))
+	def := &Definition{Name: "child", MaxBudget: decimal.NewFromFloat(1)}
+
+	child := agent.NewAgent(buildChildOptions(parent, def)...)
+	assert.Same(t, shared, child.SharedBudget())
+}
+
+func TestBuildChildOptions_Provider(t *testing.T) {
+	inherited, own := &stubProvider{name: "inherited"}, &stubProvider{name: "own"}
+	parent := agent.NewAgent(agent.WithProvider(inherited))
+
+	child := agent.NewAgent(buildChildOptions(parent, &Definition{Name: "child"})...)
+	assert.Same(t, inherited, child.Provider())
+
+	child = agent.NewAgent(buildChildOptions(parent, &Definition{Name: "child", Provider: own})...)
+	assert.Same(t, own, child.Provider())
+}
+
+// stubProvider is an agent.Provider that is never called.
+type stubProvider struct{ name string }
+
+func (*stubProvider) NewStreaming(context.Context, anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	return nil
+}
+
 func TestBuildChildOptions_WithAdditionalOptions(t *testing.T) {
 	parent := agent.NewAgent()
 	def := &Definition{
@@ -511,3 +542,44 @@ func TestWait_RemovesHandleOnSuccess(t *testing.T) {
 	require.Error(t, err)
 	assert.ErrorIs(t, err, ErrRunNotFound)
 }
+
+func TestSpawn_RecordsMetrics(t *testing.T) {
+	reg := promtext.New()
+	runner := NewRunnerWithRunFunc(
+		agent.NewAgent(agent.WithMetrics(reg)),
+		map[string]*Definition{"worker": {Name: "worker"}},
+		errorRunFunc("something went wrong"),
+	)
+
+	runID, err := runner.Spawn(context.Background(), "worker", "do the work")
+	require.NoError(t, err)
+	_, err = runner.Wait(context.Background(), runID)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	_, err = reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `agent_subagent_runs_total{agent="worker",outcome="error"} 1`)
+	assert.Contains(t, out.String(), `agent_subagent_active{agent="worker"} 0`)
+}
+
+func TestSpawn_ChildInheritsCallerMetrics(t *testing.T) {
+	reg := promtext.New()
+	var childMetrics metrics.Metrics
+	runner := NewRunnerWithRunFunc(
+		agent.NewAgent(),
+		map[string]*Definition{"worker": {Name: "worker"}},
+		func(ctx context.Context, _ *agent.Agent, _ string) *Result {
+			childMetrics = agent.ContextMetrics(ctx)
+			return &Result{Output: "ok"}
+		},
+	)
+
+	ctx := agent.WithContextMetrics(context.Background(), reg)
+	runID, err := runner.Spawn(ctx, "worker", "do the work")
+	require.NoError(t, err)
+	_, err = runner.Wait(context.Background(), runID)
+	require.NoError(t, err)
+
+	assert.Same(t, reg, childMetrics)
+}
@@ -0,0 +1,117 @@
+package teams
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// MarshalEvent encodes e as agent.MarshalEvent encodes its agent event,
+// with the name of the member that emitted it as "member".
+func MarshalEvent(e *Event) ([]byte, error) {
+	data, err := agent.MarshalEvent(e.AgentEvent)
+	if err != nil {
+		return nil, err
+	}
+	return withMember(data, e.MemberName)
+}
+
+// UnmarshalEvent decodes an event encoded by MarshalEvent. Events without
+// a "member" field decode with an empty MemberName.
+func UnmarshalEvent(data []byte) (*Event, error) {
+	var m struct {
+		Member string `json:"member"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("teams: decode event: %w", err)
+	}
+	e, err := agent.UnmarshalEvent(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{MemberName: m.Member, AgentEvent: e}, nil
+}
+
+// withMember adds a leading "member" field to the encoded JSON object data.
+func withMember(data []byte, member string) ([]byte, error) {
+	if member == "" || len(data) < 2 || data[0] != '{' {
+		return data, nil
+	}
+	name, err := json.Marshal(member)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(data)+len(name)+11)
+	out = append(out, `{"member":`...)
+	out = append(out, name...)
+	if data[1] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, data[1:]...), nil
+}
+
+// NDJSONWriter writes team events as newline-delimited JSON, one
+// MarshalEvent object per line. Each member's events are stamped with that
+// member's session ID, as agent.NDJSONWriter does for a single agent. It is
+// safe for concurrent use.
+type NDJSONWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	members map[string]*agent.NDJSONWriter
+}
+
+// NewNDJSONWriter returns a writer encoding team events to w.
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{w: w, members: make(map[string]*agent.NDJSONWriter)}
+}
+
+// Write encodes e as one line.
+func (w *NDJSONWriter) Write(e *Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	mw, ok := w.members[e.MemberName]
+	if !ok {
+		mw = agent.NewNDJSONWriter(&memberLineWriter{w: w.w, member: e.MemberName})
+		w.members[e.MemberName] = mw
+	}
+	return mw.Write(e.AgentEvent)
+}
+
+// WriteStream writes every event of s until it ends and returns the first
+// write error, or else the stream's error. Like agent.NDJSONWriter, it keeps
+// draining s after a write error. The stream ends when every member has
+// stopped, so call it from its own goroutine if the team runs until
+// Shutdown.
+func (w *NDJSONWriter) WriteStream(s *Stream) error {
+	var writeErr error
+	for s.Next() {
+		if writeErr == nil {
+			writeErr = w.Write(s.Current())
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return s.Err()
+}
+
+// memberLineWriter adds the member field to each line agent.NDJSONWriter
+// writes; every Write is one complete line.
+type memberLineWriter struct {
+	w      io.Writer
+	member string
+}
+
+func (m *memberLineWriter) Write(p []byte) (int, error) {
+	line, err := withMember(p, m.member)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := m.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
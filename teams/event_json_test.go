@@ -0,0 +1,42 @@
+package teams
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+func TestMarshalEvent_AddsMember(t *testing.T) {
+	data, err := MarshalEvent(&Event{MemberName: "alice", AgentEvent: &agent.StreamEvent{Delta: "hi"}})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), `{"member":"alice","type":"stream_event"`), string(data))
+
+	e, err := UnmarshalEvent(data)
+	require.NoError(t, err)
+	assert.Equal(t, &Event{MemberName: "alice", AgentEvent: &agent.StreamEvent{Delta: "hi"}}, e)
+}
+
+func TestNDJSONWriter_StampsEachMembersSession(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+	for _, e := range []*Event{
+		{MemberName: "lead", AgentEvent: &agent.SystemEvent{SessionID: "sess_lead"}},
+		{MemberName: "alice", AgentEvent: &agent.SystemEvent{SessionID: "sess_alice"}},
+		{MemberName: "lead", AgentEvent: &agent.StreamEvent{Delta: "a"}},
+		{MemberName: "alice", AgentEvent: &agent.StreamEvent{Delta: "b"}},
+	} {
+		require.NoError(t, w.Write(e))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[2], `"member":"lead"`)
+	assert.Contains(t, lines[2], `"session_id":"sess_lead"`)
+	assert.Contains(t, lines[3], `"member":"alice"`)
+	assert.Contains(t, lines[3], `"session_id":"sess_alice"`)
+}
@@ -93,7 +93,9 @@ func (m *Member) Run(ctx context.Context, events chan<- *Event) {
 				// Send acknowledgment back
 				ack := NewMessage(MessageShutdownResponse, m.name, msg.From, "shutdown acknowledged")
 				ack.RequestID = msg.RequestID
-				_ = m.bus.Send(ack)
+				if err := m.bus.Send(ack); err != nil {
+					m.agent.Logger().Warn("shutdown acknowledgment not delivered", "to", msg.From, "error", err)
+				}
 				return
 			}
 
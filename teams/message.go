@@ -2,10 +2,12 @@ package teams
 
 import (
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
 	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
 )
 
 // MessageType identifies the kind of inter-agent message.
@@ -46,15 +48,41 @@ func NewMessage(msgType MessageType, from, to, content string) *Message {
 type MessageBus struct {
 	subscribers map[string]chan *Message
 	topology    Topology
+	metrics     metrics.Metrics
+	logger      *slog.Logger
 	mu          sync.RWMutex
 }
 
+// BusOption configures a MessageBus.
+type BusOption func(*MessageBus)
+
+// WithBusMetrics records delivery failures and inbox depth into m.
+func WithBusMetrics(m metrics.Metrics) BusOption {
+	return func(b *MessageBus) { b.metrics = metrics.OrNop(m) }
+}
+
+// WithBusLogger logs broadcast messages dropped because a member's inbox
+// was full to l at warn level.
+func WithBusLogger(l *slog.Logger) BusOption {
+	return func(b *MessageBus) {
+		if l != nil {
+			b.logger = l
+		}
+	}
+}
+
 // NewMessageBus creates a bus with the given topology for routing.
-func NewMessageBus(topology Topology) *MessageBus {
-	return &MessageBus{
+func NewMessageBus(topology Topology, opts ...BusOption) *MessageBus {
+	b := &MessageBus{
 		subscribers: make(map[string]chan *Message),
 		topology:    topology,
+		metrics:     metrics.Nop,
+		logger:      slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(b)
 	}
+	return b
 }
 
 // Subscribe registers a member to receive messages.
@@ -108,8 +136,12 @@ func (b *MessageBus) Broadcast(msg *Message) error {
 		}
 		select {
 		case ch <- msg:
+			b.recordDepth(name, len(ch))
 		default:
-			// drop if buffer full — log in production
+			// drop if buffer full
+			b.recordFailure(name, "inbox_full")
+			b.logger.Warn("broadcast dropped, inbox full",
+				agent.LogKeyMember, name, "from", msg.From, "message_id", msg.ID)
 		}
 	}
 	return nil
@@ -120,16 +152,30 @@ func (b *MessageBus) deliver(to string, msg *Message) error {
 	ch, ok := b.subscribers[to]
 	b.mu.RUnlock()
 	if !ok {
+		b.recordFailure(to, "not_found")
 		return fmt.Errorf("member %q not found", to)
 	}
 	select {
 	case ch <- msg:
+		b.recordDepth(to, len(ch))
 		return nil
 	default:
+		b.recordFailure(to, "inbox_full")
 		return fmt.Errorf("inbox full for member %q", to)
 	}
 }
 
+// recordDepth reports the number of messages waiting in a member's inbox.
+func (b *MessageBus) recordDepth(name string, depth int) {
+	b.metrics.Set(metrics.TeamInboxDepth, float64(depth), metrics.L(metrics.LabelMember, name))
+}
+
+// recordFailure counts a message that could not be delivered to name.
+func (b *MessageBus) recordFailure(name, reason string) {
+	b.metrics.Add(metrics.TeamDeliveryFailures, 1,
+		metrics.L(metrics.LabelMember, name), metrics.L(metrics.LabelReason, reason))
+}
+
 // MemberNames returns all subscribed member names.
 func (b *MessageBus) MemberNames() []string {
 	b.mu.RLock()
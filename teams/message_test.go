@@ -1,11 +1,16 @@
 package teams
 
 import (
+	"bytes"
+	"log/slog"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/armatrix/claude-agent-sdk-go/metrics/promtext"
 )
 
 func TestNewMessage(t *testing.T) {
@@ -246,6 +251,18 @@ func TestMessageBus_Broadcast_SkipsSender(t *testing.T) {
 	}
 }
 
+func TestMessageBus_Broadcast_LogsDrops(t *testing.T) {
+	var buf bytes.Buffer
+	bus := NewMessageBus(&LeaderTeammate{LeaderName: "lead"},
+		WithBusLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	bus.Subscribe("alice", 1)
+
+	require.NoError(t, bus.Broadcast(NewMessage(MessageBroadcast, "lead", "", "one")))
+	assert.Empty(t, buf.String())
+	require.NoError(t, bus.Broadcast(NewMessage(MessageBroadcast, "lead", "", "two")))
+	assert.Contains(t, buf.String(), `level=WARN msg="broadcast dropped, inbox full" member=alice from=lead`)
+}
+
 func TestMessageBus_MemberNames(t *testing.T) {
 	bus := NewMessageBus(&LeaderTeammate{LeaderName: "lead"})
 
@@ -271,3 +288,22 @@ func TestMessageBus_UnsubscribeAndResubscribe(t *testing.T) {
 	assert.NotNil(t, ch)
 	assert.Contains(t, bus.MemberNames(), "alice")
 }
+
+func TestMessageBus_RecordsMetrics(t *testing.T) {
+	reg := promtext.New()
+	bus := NewMessageBus(&LeaderTeammate{LeaderName: "lead"}, WithBusMetrics(reg))
+	bus.Subscribe("lead", 1)
+	bus.Subscribe("alice", 2)
+
+	require.NoError(t, bus.Send(NewMessage(MessageDM, "lead", "alice", "one")))
+	require.NoError(t, bus.Send(NewMessage(MessageDM, "lead", "alice", "two")))
+	assert.Error(t, bus.Send(NewMessage(MessageDM, "lead", "alice", "three")))
+	assert.Error(t, bus.Send(NewMessage(MessageDM, "lead", "nobody", "hello?")))
+
+	var out strings.Builder
+	_, err := reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `agent_team_inbox_depth{member="alice"} 2`)
+	assert.Contains(t, out.String(), `agent_team_delivery_failures_total{member="alice",reason="inbox_full"} 1`)
+	assert.Contains(t, out.String(), `agent_team_delivery_failures_total{member="nobody",reason="not_found"} 1`)
+}
@@ -3,9 +3,14 @@ package teams
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+
 	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
 )
 
 // Team is the top-level container for multi-agent collaboration.
@@ -32,6 +37,10 @@ type teamOptions struct {
 	topology   Topology
 	leadOpts   []agent.AgentOption
 	memberDefs []memberDef
+	budget     *agent.Budget
+	tracing    trace.TracerProvider
+	metrics    metrics.Metrics
+	logger     *slog.Logger
 }
 
 type memberDef struct {
@@ -56,6 +65,34 @@ func WithMember(name string, opts ...agent.AgentOption) Option {
 	}
 }
 
+// WithBudget makes the lead and every member draw from one shared budget,
+// so b caps the spend of the whole team. Per-agent WithBudget options still
+// cap individual runs within it.
+func WithBudget(b *agent.Budget) Option {
+	return func(o *teamOptions) { o.budget = b }
+}
+
+// WithTracerProvider traces the team run with tp: an "invoke_agent" span for
+// the team with the lead's and every member's runs nested under it, so the
+// whole collaboration shows up as one trace. Without it, the team span uses
+// the provider of the span in Start's context, or the global provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *teamOptions) { o.tracing = tp }
+}
+
+// WithMetrics records the team's message delivery failures and inbox depth
+// into m, and makes the lead and every member record their runs into it.
+func WithMetrics(m metrics.Metrics) Option {
+	return func(o *teamOptions) { o.metrics = m }
+}
+
+// WithLogger logs the team's dropped messages and members that failed to
+// spawn to l, and makes the lead and every member log their runs to l with
+// a member attribute.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *teamOptions) { o.logger = l }
+}
+
 // MemberOption configures a dynamically spawned member.
 type MemberOption func(*memberOptions)
 
@@ -83,7 +120,7 @@ func New(name string, opts ...Option) *Team {
 		name:     name,
 		members:  make(map[string]*Member),
 		tasks:    NewSharedTaskList(),
-		bus:      NewMessageBus(o.topology),
+		bus:      NewMessageBus(o.topology, WithBusMetrics(o.metrics), WithBusLogger(o.logger)),
 		topology: o.topology,
 		opts:     o,
 	}
@@ -94,6 +131,7 @@ func New(name string, opts ...Option) *Team {
 // run loop, sends the initial prompt, and spawns any pre-configured members.
 // Returns a Stream that aggregates events from all team members.
 func (t *Team) Start(ctx context.Context, prompt string) *Stream {
+	ctx, span := t.startSpan(ctx)
 	t.ctx, t.cancel = context.WithCancel(ctx)
 	t.events = make(chan *Event, 64)
 
@@ -104,7 +142,7 @@ func (t *Team) Start(ctx context.Context, prompt string) *Stream {
 	}
 
 	// Create the lead agent
-	leadAgent := agent.NewAgent(t.opts.leadOpts...)
+	leadAgent := agent.NewAgent(t.agentOptions(leaderName, t.opts.leadOpts)...)
 
 	// Create the lead member
 	lead := NewMember(leaderName, RoleLead, leadAgent, t.bus)
@@ -121,6 +159,7 @@ func (t *Team) Start(ctx context.Context, prompt string) *Stream {
 	go func() {
 		defer t.wg.Done()
 		for msg := range inboxCh {
+			t.bus.recordDepth(leaderName, len(inboxCh))
 			select {
 			case lead.inbox <- msg:
 			case <-t.ctx.Done():
@@ -154,6 +193,7 @@ func (t *Team) Start(ctx context.Context, prompt string) *Stream {
 	// Spawn pre-configured members
 	for _, def := range t.opts.memberDefs {
 		if err := t.SpawnMember(def.name, WithMemberAgentOptions(def.opts...)); err != nil {
+			t.logger().Warn("member not spawned", agent.LogKeyMember, def.name, "error", err)
 			// Send error as an event
 			t.events <- &Event{
 				MemberName: leaderName,
@@ -172,6 +212,12 @@ func (t *Team) Start(ctx context.Context, prompt string) *Stream {
 		close(t.events)
 	}()
 
+	// The team runs until Shutdown or ctx cancellation, which ends its span.
+	go func() {
+		<-t.ctx.Done()
+		span.End()
+	}()
+
 	return &Stream{events: t.events}
 }
 
@@ -191,7 +237,7 @@ func (t *Team) SpawnMember(name string, opts ...MemberOption) error {
 	}
 
 	// Create the member's agent
-	memberAgent := agent.NewAgent(mo.agentOpts...)
+	memberAgent := agent.NewAgent(t.agentOptions(name, mo.agentOpts)...)
 
 	// Create the member
 	member := NewMember(name, RoleTeammate, memberAgent, t.bus)
@@ -212,6 +258,7 @@ func (t *Team) SpawnMember(name string, opts ...MemberOption) error {
 	go func() {
 		defer t.wg.Done()
 		for msg := range inboxCh {
+			t.bus.recordDepth(name, len(inboxCh))
 			select {
 			case member.inbox <- msg:
 			case <-t.ctx.Done():
@@ -263,3 +310,49 @@ func (t *Team) Bus() *MessageBus { return t.bus }
 
 // TaskList returns the shared task list.
 func (t *Team) TaskList() *SharedTaskList { return t.tasks }
+
+// Budget returns the team's shared budget, or nil if none was set.
+func (t *Team) Budget() *agent.Budget {
+	return t.opts.budget
+}
+
+// agentOptions prepends the member's name and the team's shared budget,
+// tracer provider, metrics and logger to opts, so explicit options in opts still take precedence.
+func (t *Team) agentOptions(name string, opts []agent.AgentOption) []agent.AgentOption {
+	defaults := []agent.AgentOption{agent.WithName(name)}
+	if t.opts.budget != nil {
+		defaults = append(defaults, agent.WithSharedBudget(t.opts.budget))
+	}
+	if t.opts.tracing != nil {
+		defaults = append(defaults, agent.WithTracerProvider(t.opts.tracing))
+	}
+	if t.opts.metrics != nil {
+		defaults = append(defaults, agent.WithMetrics(t.opts.metrics))
+	}
+	if t.opts.logger != nil {
+		defaults = append(defaults, agent.WithLogger(t.opts.logger.With(agent.LogKeyMember, name)))
+	}
+	return append(defaults, opts...)
+}
+
+// logger returns the team's logger, or one that discards everything.
+func (t *Team) logger() *slog.Logger {
+	if t.opts.logger != nil {
+		return t.opts.logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+// startSpan starts the team's root span, named "invoke_agent {team}".
+func (t *Team) startSpan(ctx context.Context) (context.Context, trace.Span) {
+	tracer := agent.TracerFromContext(ctx)
+	if t.opts.tracing != nil {
+		tracer = t.opts.tracing.Tracer(agent.TracerName)
+	}
+	return tracer.Start(ctx, "invoke_agent "+t.name,
+		trace.WithAttributes(
+			semconv.GenAIOperationNameInvokeAgent,
+			semconv.GenAIAgentName(t.name),
+			semconv.GenAIAgentID(t.id),
+		))
+}
@@ -2,13 +2,23 @@ package teams
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/metrics/promtext"
 )
 
 func TestNew_DefaultTopology(t *testing.T) {
@@ -94,6 +104,29 @@ func TestTeam_Start_CreatesLeader(t *testing.T) {
 	team.Shutdown()
 }
 
+func TestNew_WithBudget_SharedByAllAgents(t *testing.T) {
+	shared := agent.NewBudget(decimal.NewFromFloat(5))
+	team := New("team", WithBudget(shared))
+	assert.Same(t, shared, team.Budget())
+
+	a := agent.NewAgent(team.agentOptions("m", []agent.AgentOption{agent.WithMaxTurns(1)})...)
+	assert.Same(t, shared, a.SharedBudget())
+
+	// An explicit member budget takes precedence over the team's.
+	own := shared.Child(decimal.NewFromFloat(1))
+	a = agent.NewAgent(team.agentOptions("m", []agent.AgentOption{agent.WithSharedBudget(own)})...)
+	assert.Same(t, own, a.SharedBudget())
+}
+
+func TestNew_WithMetrics_SharedByBusAndAgents(t *testing.T) {
+	reg := promtext.New()
+	team := New("team", WithMetrics(reg))
+
+	a := agent.NewAgent(team.agentOptions("m", nil)...)
+	assert.Same(t, reg, a.Metrics())
+	assert.Same(t, reg, team.Bus().metrics)
+}
+
 func TestTeam_SpawnMember_AddsToTeam(t *testing.T) {
 	team := New("test-team",
 		WithLeadAgent(agent.WithMaxTurns(1)),
@@ -158,3 +191,48 @@ func TestMemberOption_WithMemberAgentOptions(t *testing.T) {
 	opt(&mo)
 	assert.Len(t, mo.agentOpts, 1)
 }
+
+// textProvider answers every request with a single text response.
+type textProvider struct{ text string }
+
+func (p *textProvider) NewStreaming(context.Context, anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	body := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"m\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"x\",\"content\":[],\"usage\":{\"input_tokens\":1,\"output_tokens\":0}}}\n\n" +
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+		fmt.Sprintf("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":%q}}\n\n", p.text) +
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n" +
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":1}}\n\n" +
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}
+	return ssestream.NewStream[anthropic.MessageStreamEventUnion](ssestream.NewDecoder(resp), nil)
+}
+
+func TestTeam_TracesMembersUnderTeamSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	team := New("crew",
+		WithTracerProvider(tp),
+		WithLeadAgent(agent.WithProvider(&textProvider{text: "ok"})),
+	)
+	stream := team.Start(context.Background(), "hello")
+	for stream.Next() {
+		if _, ok := stream.Current().AgentEvent.(*agent.ResultEvent); ok {
+			break
+		}
+	}
+	require.NoError(t, team.Shutdown())
+
+	require.Eventually(t, func() bool { return len(exporter.GetSpans()) == 3 }, time.Second, 5*time.Millisecond,
+		"team, lead run and chat spans")
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	root, ok := spans["invoke_agent crew"]
+	require.True(t, ok, "missing team span")
+	lead, ok := spans["invoke_agent lead"]
+	require.True(t, ok, "missing lead span")
+	assert.Equal(t, root.SpanContext.SpanID(), lead.Parent.SpanID())
+	assert.Equal(t, root.SpanContext.TraceID(), lead.SpanContext.TraceID())
+}
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/packages/param"
 
 	"github.com/armatrix/claude-agent-sdk-go/internal/schema"
+	"github.com/armatrix/claude-agent-sdk-go/metrics"
 )
 
 // Tool is the generic interface for agent tools. The type parameter T defines
@@ -122,10 +124,18 @@ func (r *ToolRegistry) Execute(ctx context.Context, name string, input json.RawM
 	entry, ok := r.tools[name]
 	r.mu.RUnlock()
 
+	m := ContextMetrics(ctx)
 	if !ok {
+		m.Add(metrics.ToolCalls, 1, metrics.L(metrics.LabelTool, name), metrics.L(metrics.LabelOutcome, "not_found"))
 		return nil, fmt.Errorf("tool not found: %s", name)
 	}
-	return entry.execute(ctx, input)
+
+	start := time.Now()
+	result, err := entry.execute(ctx, input)
+	m.Observe(metrics.ToolDuration, time.Since(start).Seconds(), metrics.L(metrics.LabelTool, name))
+	failed := err != nil || (result != nil && result.IsError)
+	m.Add(metrics.ToolCalls, 1, metrics.L(metrics.LabelTool, name), metrics.L(metrics.LabelOutcome, metrics.Outcome(failed)))
+	return result, err
 }
 
 // ListForAPI returns the registered tools in the format expected by the Anthropic API.
@@ -3,9 +3,11 @@ package tools
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/creack/pty"
@@ -28,7 +30,13 @@ type BashInput struct {
 }
 
 // BashTool executes shell commands.
-type BashTool struct{}
+//
+// By default each command runs in a fresh bash. With Shells set, commands
+// run in a persistent shell from the pool instead, so that the working
+// directory, exported variables and functions carry over between calls.
+type BashTool struct {
+	Shells *ShellPool
+}
 
 var _ agent.Tool[BashInput] = (*BashTool)(nil)
 
@@ -57,6 +65,16 @@ func (t *BashTool) Execute(ctx context.Context, input BashInput) (*agent.ToolRes
 	}
 
 	timeout := time.Duration(timeoutMs) * time.Millisecond
+	if t.Shells != nil {
+		res, err := t.Shells.Shell(ctx).Run(ctx, input.Command, timeout)
+		if !errors.Is(err, ErrShellUnsupported) {
+			if err != nil {
+				return agent.ErrorResult(err.Error()), nil
+			}
+			return shellToolResult(res, timeoutMs), nil
+		}
+	}
+
 	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -135,3 +153,32 @@ func (t *BashTool) executeWithoutPTY(ctx context.Context, command string) (*agen
 
 	return result, nil
 }
+
+// shellToolResult reports a command run in a persistent shell, noting
+// where the shell's state was lost.
+func shellToolResult(res *ShellResult, timeoutMs int) *agent.ToolResult {
+	var b strings.Builder
+	if res.Restarted {
+		b.WriteString("[shell restarted: only the working directory, exported variables and functions were kept]\n")
+	}
+	b.WriteString(res.Output)
+	switch {
+	case res.TimedOut:
+		fmt.Fprintf(&b, "\ncommand timed out after %dms", timeoutMs)
+	case res.Interrupted:
+		b.WriteString("\ncommand interrupted")
+	}
+	if res.Exited {
+		fmt.Fprintf(&b, "\n[shell exited with code %d; the next command starts a new one]", res.ExitCode)
+	}
+
+	result := agent.TextResult(b.String())
+	result.Metadata = map[string]any{
+		"exit_code": res.ExitCode,
+		"cwd":       res.Cwd,
+	}
+	if res.ExitCode != 0 || res.TimedOut || res.Interrupted {
+		result.IsError = true
+	}
+	return result
+}
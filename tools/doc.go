@@ -9,4 +9,14 @@
 //	tools.RegisterConfigurable(agent.Tools(), tools.BuiltinOptions{
 //	    AskCallback: myAskHandler,
 //	})
+//
+// The Bash tool runs each command in a fresh bash. To keep the working
+// directory, exported variables and functions between calls, register it
+// with a [ShellPool], which keeps a persistent [Shell] per session, and
+// close each session's shell when the session ends:
+//
+//	shells := tools.NewShellPool(tools.SessionScope)
+//	defer shells.CloseAll()
+//	a := agent.NewAgent(agent.WithOnSessionClose(shells.CloseSession))
+//	agent.RegisterTool(a.Tools(), &tools.BashTool{Shells: shells})
 package tools
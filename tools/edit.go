@@ -66,6 +66,10 @@ func (t *EditTool) Execute(ctx context.Context, input EditInput) (*agent.ToolRes
 		newContent = strings.Replace(content, input.OldString, input.NewString, 1)
 	}
 
+	if err := recordWrite(ctx, resolved); err != nil {
+		return agent.ErrorResult(err.Error()), nil
+	}
+
 	if err := os.WriteFile(resolved, []byte(newContent), 0644); err != nil {
 		return agent.ErrorResult(fmt.Sprintf("failed to write file: %s", err.Error())), nil
 	}
@@ -8,6 +8,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/checkpoint"
 )
 
 func TestEditTool_Name(t *testing.T) {
@@ -150,3 +153,36 @@ func TestEditTool_Execute_MultilineReplacement(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "func main() {\n\tfmt.Println(\"goodbye\")\n}\n", string(data))
 }
+
+func TestEditTool_Execute_RecordsCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello world"), 0644))
+
+	tracker := checkpoint.NewTracker()
+	ctx := agent.WithContextCheckpoint(context.Background(), tracker)
+	result, err := (&EditTool{}).Execute(ctx, EditInput{FilePath: path, OldString: "hello", NewString: "goodbye"})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+
+	require.NoError(t, tracker.Rewind())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestEditTool_Execute_CheckpointFailureBlocksWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello world"), 0644))
+
+	ctx := agent.WithContextCheckpoint(context.Background(), failingRecorder{})
+	result, err := (&EditTool{}).Execute(ctx, EditInput{FilePath: path, OldString: "hello", NewString: "goodbye"})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, extractText(result), "checkpoint failed")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"encoding/json"
+	"errors"
 
 	agent "github.com/armatrix/claude-agent-sdk-go"
 )
@@ -25,3 +26,8 @@ func extractText(r *agent.ToolResult) string {
 	}
 	return ""
 }
+
+// failingRecorder is a checkpoint recorder that cannot record.
+type failingRecorder struct{}
+
+func (failingRecorder) RecordWrite(string) error { return errors.New("disk full") }
@@ -44,7 +44,7 @@ type notebookCell struct {
 	Outputs  []interface{}          `json:"outputs,omitempty"`
 }
 
-func (t *NotebookEditTool) Execute(_ context.Context, input NotebookEditInput) (*agent.ToolResult, error) {
+func (t *NotebookEditTool) Execute(ctx context.Context, input NotebookEditInput) (*agent.ToolResult, error) {
 	if input.NotebookPath == "" {
 		return agent.ErrorResult("notebook_path is required"), nil
 	}
@@ -130,6 +130,10 @@ func (t *NotebookEditTool) Execute(_ context.Context, input NotebookEditInput) (
 		return agent.ErrorResult(fmt.Sprintf("failed to marshal notebook: %s", err.Error())), nil
 	}
 
+	if err := recordWrite(ctx, input.NotebookPath); err != nil {
+		return agent.ErrorResult(err.Error()), nil
+	}
+
 	if err := os.WriteFile(input.NotebookPath, output, 0644); err != nil {
 		return agent.ErrorResult(fmt.Sprintf("failed to write notebook: %s", err.Error())), nil
 	}
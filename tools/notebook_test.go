@@ -9,6 +9,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/checkpoint"
 )
 
 func TestNotebookEditTool_Name(t *testing.T) {
@@ -354,3 +357,22 @@ func TestNotebookEditTool_Execute_ReplaceCellType(t *testing.T) {
 	nb := readNotebook(t, path)
 	assert.Equal(t, "markdown", nb.Cells[0].CellType)
 }
+
+func TestNotebookEditTool_Execute_RecordsCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := writeNotebook(t, dir, sampleNotebook())
+
+	tracker := checkpoint.NewTracker()
+	ctx := agent.WithContextCheckpoint(context.Background(), tracker)
+	cellNum := 0
+	result, err := (&NotebookEditTool{}).Execute(ctx, NotebookEditInput{
+		NotebookPath: path,
+		CellNumber:   &cellNum,
+		EditMode:     "delete",
+	})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+
+	require.NoError(t, tracker.Rewind())
+	assert.Len(t, readNotebook(t, path).Cells, 2)
+}
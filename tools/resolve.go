@@ -47,6 +47,19 @@ func checkSandboxPath(ctx context.Context, resolved string) error {
 	return fmt.Errorf("path %s is outside sandbox allowed directories", resolved)
 }
 
+// recordWrite reports path to the checkpoint recorder from context, if any,
+// before a tool changes it.
+func recordWrite(ctx context.Context, path string) error {
+	recorder := agent.ContextCheckpoint(ctx)
+	if recorder == nil {
+		return nil
+	}
+	if err := recorder.RecordWrite(path); err != nil {
+		return fmt.Errorf("checkpoint failed: %w", err)
+	}
+	return nil
+}
+
 // checkSandboxCommand validates that the command is not in the sandbox BlockedCommands list.
 // Returns nil if no sandbox is configured or the command is allowed.
 func checkSandboxCommand(ctx context.Context, command string) error {
@@ -0,0 +1,573 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+// ErrShellUnsupported is returned by Shell.Run where processes have no
+// process groups to kill a command by. BashTool then runs each command in
+// a fresh bash.
+var ErrShellUnsupported = errors.New("tools: persistent shell not supported on " + runtime.GOOS)
+
+const (
+	// shellGrace is how long a shell has to report back after the command
+	// it runs was killed, before the shell itself is killed.
+	shellGrace = 2 * time.Second
+	// shellDrain is how long output is still collected after the shell
+	// exited; jobs it left running may hold the pipe open.
+	shellDrain = 100 * time.Millisecond
+	// maxShellState caps the trailer a command's output ends with. Beyond
+	// it, a restarted shell only gets the working directory back.
+	maxShellState = 1 << 20
+)
+
+// Shell is a long-lived bash running one command at a time, so that the
+// working directory, variables, functions and activated environments one
+// command sets up are there for the next.
+//
+// Each command runs under job control in a process group of its own,
+// which is killed when the command times out while the shell lives on.
+// If the shell dies, by an exit or a command it could not recover from,
+// the next Run starts a new one in the working directory the last command
+// finished in, with the exported variables and functions it had.
+type Shell struct {
+	dir string
+	env []string
+
+	mu      sync.Mutex
+	proc    *shellProcess
+	started bool         // a shell was started before proc
+	state   string       // script restoring the state after the last command
+	jobs    map[int]bool // process groups of the jobs left after it
+	cwd     string
+}
+
+// ShellResult is the outcome of a command run in a Shell.
+type ShellResult struct {
+	// Output is what the command wrote to stdout and stderr, truncated.
+	Output string
+	// ExitCode is the command's exit status, or the shell's if it exited.
+	ExitCode int
+	// Cwd is the shell's working directory after the command.
+	Cwd string
+	// TimedOut reports the command was killed at its timeout.
+	TimedOut bool
+	// Interrupted reports the command was killed because the context was
+	// canceled.
+	Interrupted bool
+	// Restarted reports the shell had died and was started again for this
+	// command, keeping only the working directory, exported variables and
+	// functions.
+	Restarted bool
+	// Exited reports the shell is gone after the command, which exited it
+	// or could not be stopped. The next Run starts a new one.
+	Exited bool
+}
+
+// NewShell returns a shell starting in dir, or the current directory if
+// empty, with env as its environment, or the process's if nil. The bash
+// process is started by the first Run.
+func NewShell(dir string, env []string) *Shell {
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	return &Shell{dir: dir, env: env, cwd: dir}
+}
+
+// Run runs command in the shell, killing it after timeout. Its stdin is
+// /dev/null. An error means the shell could not be started or written to;
+// a failing command is reported by the result's ExitCode.
+func (s *Shell) Run(ctx context.Context, command string, timeout time.Duration) (*ShellResult, error) {
+	if !shellSupported {
+		return nil, ErrShellUnsupported
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := &ShellResult{}
+	if s.proc == nil || s.proc.hasExited() {
+		p, err := startShell(s.dir, s.env, s.state)
+		if err != nil {
+			return nil, err
+		}
+		res.Restarted = s.started
+		s.proc, s.started, s.jobs = p, true, nil
+	}
+	p := s.proc
+
+	marker := newShellMarker()
+	if _, err := io.WriteString(p.stdin, commandScript(command, marker)); err != nil {
+		s.stop()
+		return nil, fmt.Errorf("tools: write to shell: %w", err)
+	}
+
+	out := newCommandOutput(marker, maxOutputBytes)
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stop := cmdCtx.Done()
+	var grace <-chan time.Time
+	for !out.complete() {
+		select {
+		case chunk, ok := <-p.output:
+			if ok {
+				out.write(chunk)
+			} else {
+				p.output = nil // the pipe closes only after the shell exits
+			}
+		case <-p.exited:
+			p.drain(out)
+			s.proc = nil
+			res.Output, res.ExitCode, res.Exited = out.text(), p.cmd.ProcessState.ExitCode(), true
+			res.Cwd = s.cwd
+			return res, nil
+		case <-stop:
+			stop = nil
+			if ctx.Err() != nil {
+				res.Interrupted = true
+			} else {
+				res.TimedOut = true
+			}
+			// Jobs earlier commands left running in the background are
+			// spared.
+			for pgid := range childProcessGroups(p.pid) {
+				if !s.jobs[pgid] {
+					_ = killProcessGroup(pgid)
+				}
+			}
+			grace = time.After(shellGrace)
+		case <-grace:
+			// The command runs in the shell itself, or took it down with it.
+			s.stop()
+			res.Output, res.ExitCode, res.Exited = out.text(), -1, true
+			res.Cwd = s.cwd
+			return res, nil
+		}
+	}
+
+	status, cwd, jobs, state := out.trailer()
+	res.Output, res.ExitCode, res.Cwd = out.text(), status, cwd
+	s.cwd, s.jobs, s.state = cwd, jobs, state
+	return res, nil
+}
+
+// Cwd returns the working directory the last command finished in, or the
+// directory the shell started in.
+func (s *Shell) Cwd() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cwd
+}
+
+// Close kills the shell and the jobs it left running. A later Run starts
+// a fresh shell.
+func (s *Shell) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+	s.started, s.state, s.jobs, s.cwd = false, "", nil, s.dir
+	return nil
+}
+
+// stop kills the running shell, if any, with its jobs.
+func (s *Shell) stop() {
+	if s.proc == nil {
+		return
+	}
+	s.proc.kill()
+	s.proc = nil
+}
+
+// shellProcess is a running bash, fed commands on stdin and writing
+// stdout and stderr to one pipe.
+type shellProcess struct {
+	cmd    *exec.Cmd
+	pid    int
+	stdin  io.WriteCloser
+	out    *os.File
+	output chan []byte   // closed on EOF
+	exited chan struct{} // closed once the shell was waited for
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed with out, when output is abandoned
+}
+
+func startShell(dir string, env []string, state string) (*shellProcess, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("tools: start shell: %w", err)
+	}
+	cmd := exec.Command("bash", "--noprofile", "--norc")
+	cmd.Dir, cmd.Env = dir, env
+	cmd.Stdout, cmd.Stderr = w, w
+	setProcessGroup(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("tools: start shell: %w", err)
+	}
+
+	output := make(chan []byte, 64)
+	p := &shellProcess{
+		cmd:    cmd,
+		pid:    cmd.Process.Pid,
+		stdin:  stdin,
+		out:    r,
+		output: output,
+		exited: make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	go func() {
+		defer close(output)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case output <- bytes.Clone(buf[:n]):
+				case <-p.closed:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		_ = cmd.Wait()
+		close(p.exited)
+	}()
+
+	// Job control puts each command in a process group of its own.
+	init := "set -m\nshopt -s expand_aliases\n"
+	if state != "" {
+		init += "{\n" + state + "\n} >/dev/null 2>&1\n"
+	}
+	if _, err := io.WriteString(stdin, init); err != nil {
+		p.kill()
+		return nil, fmt.Errorf("tools: start shell: %w", err)
+	}
+	return p, nil
+}
+
+func (p *shellProcess) hasExited() bool {
+	select {
+	case <-p.exited:
+		p.close()
+		return true
+	default:
+		return false
+	}
+}
+
+// drain collects the output written before the shell exited and closes
+// the pipe.
+func (p *shellProcess) drain(out *commandOutput) {
+	timer := time.NewTimer(shellDrain)
+	defer timer.Stop()
+	for p.output != nil {
+		select {
+		case chunk, ok := <-p.output:
+			if !ok {
+				p.output = nil
+				break
+			}
+			out.write(chunk)
+		case <-timer.C:
+			p.output = nil
+		}
+	}
+	p.close()
+}
+
+// close closes the pipe, abandoning output not yet read.
+func (p *shellProcess) close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		p.out.Close()
+	})
+}
+
+// kill kills the shell and the process groups of its jobs, and waits for
+// it to exit.
+func (p *shellProcess) kill() {
+	select {
+	case <-p.exited:
+	default:
+		jobs := childProcessGroups(p.pid)
+		_ = killProcessGroup(p.pid)
+		for pgid := range jobs {
+			_ = killProcessGroup(pgid)
+		}
+		<-p.exited
+	}
+	p.close()
+}
+
+// shellMarker delimits what a command writes from the status the shell
+// reports after it. It is printed from two halves so that a trace of the
+// script, should set -x get past the redirection, does not contain it.
+type shellMarker struct{ head, tail string }
+
+func newShellMarker() shellMarker {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return shellMarker{head: "__SHELL_DONE_", tail: hex.EncodeToString(b) + "__"}
+}
+
+func (m shellMarker) String() string { return m.head + m.tail }
+
+// commandScript returns the script running command, then printing the
+// marker with the exit status and working directory, the process groups
+// of the jobs left running, the state to restore should the shell die, and
+// the marker again.
+func commandScript(command string, m shellMarker) string {
+	// The status is saved on a line of its own: bash fails to parse a
+	// group right after an eval of an unterminated quote.
+	return "eval " + shellQuote(command) + " </dev/null\n" +
+		"__shell_status=$?\n" +
+		`{ printf '\n%s%s %d %s\n' ` + m.head + " " + m.tail + ` "$__shell_status" "$PWD"; ` +
+		`printf '%s ' $(jobs -p); printf '\n'; ` +
+		`export -p; declare -f; printf 'cd -- %q\n' "$PWD"; printf '%s%s-end\n' ` + m.head + " " + m.tail + "; } 2>/dev/null\n"
+}
+
+// shellQuote quotes s as a single word for bash.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// commandOutput collects a command's output from the shell's, up to the
+// marker, and the trailer after it.
+type commandOutput struct {
+	marker   []byte // starts the trailer, after a newline of its own
+	end      []byte // ends the trailer
+	limit    int
+	kept     []byte // output, up to limit bytes
+	dropped  int
+	pending  []byte // output that may be the start of marker
+	rest     []byte // the trailer so far, once marker was seen
+	found    bool
+	ended    bool
+	overflow bool   // the state exceeded maxShellState and was dropped
+	tail     []byte // the end of the dropped state, which may start end
+}
+
+func newCommandOutput(m shellMarker, limit int) *commandOutput {
+	return &commandOutput{
+		marker: []byte("\n" + m.String() + " "),
+		end:    []byte(m.String() + "-end\n"),
+		limit:  limit,
+	}
+}
+
+func (o *commandOutput) write(p []byte) {
+	if o.found {
+		o.trail(p)
+		return
+	}
+	o.pending = append(o.pending, p...)
+	if i := bytes.Index(o.pending, o.marker); i >= 0 {
+		o.keep(o.pending[:i])
+		rest := o.pending[i+len(o.marker):]
+		o.pending, o.found = nil, true
+		o.trail(rest)
+		return
+	}
+	if n := len(o.pending) - len(o.marker) + 1; n > 0 {
+		o.keep(o.pending[:n])
+		o.pending = append(o.pending[:0], o.pending[n:]...)
+	}
+}
+
+// trail collects the trailer up to end. Past maxShellState the state is
+// dropped, keeping the status and jobs lines, while end is looked for in
+// what follows.
+func (o *commandOutput) trail(p []byte) {
+	if o.ended {
+		return
+	}
+	if o.overflow {
+		o.tail = append(o.tail, p...)
+		if bytes.Contains(o.tail, o.end) {
+			o.ended = true
+			return
+		}
+		o.tail = append(o.tail[:0], o.tail[max(0, len(o.tail)-len(o.end)+1):]...)
+		return
+	}
+	from := max(0, len(o.rest)-len(o.end)+1)
+	o.rest = append(o.rest, p...)
+	if i := bytes.Index(o.rest[from:], o.end); i >= 0 {
+		o.rest, o.ended = o.rest[:from+i], true
+		return
+	}
+	if len(o.rest) > maxShellState {
+		head := 0
+		for range 2 {
+			i := bytes.IndexByte(o.rest[head:], '\n')
+			if i < 0 {
+				break
+			}
+			head += i + 1
+		}
+		o.tail = bytes.Clone(o.rest[len(o.rest)-len(o.end)+1:])
+		o.rest = bytes.Clone(o.rest[:head])
+		o.overflow = true
+	}
+}
+
+func (o *commandOutput) keep(p []byte) {
+	n := min(len(p), o.limit-len(o.kept))
+	o.kept = append(o.kept, p[:n]...)
+	o.dropped += len(p) - n
+}
+
+func (o *commandOutput) complete() bool {
+	return o.ended
+}
+
+// text returns the output, with any partial marker the shell never
+// finished writing.
+func (o *commandOutput) text() string {
+	o.keep(o.pending)
+	o.pending = nil
+	if o.dropped > 0 {
+		return string(o.kept) + "\n... [output truncated]"
+	}
+	return string(o.kept)
+}
+
+// trailer parses the exit status, working directory, job process groups
+// and state script following the marker.
+func (o *commandOutput) trailer() (status int, cwd string, jobs map[int]bool, state string) {
+	line, rest, _ := strings.Cut(string(o.rest), "\n")
+	jobsLine, state, _ := strings.Cut(rest, "\n")
+	code, cwd, _ := strings.Cut(line, " ")
+	status, err := strconv.Atoi(code)
+	if err != nil {
+		status = -1
+	}
+	for _, f := range strings.Fields(jobsLine) {
+		if pgid, err := strconv.Atoi(f); err == nil {
+			if jobs == nil {
+				jobs = make(map[int]bool)
+			}
+			jobs[pgid] = true
+		}
+	}
+	if o.overflow {
+		state = "cd -- " + shellQuote(cwd)
+	}
+	return status, cwd, jobs, state
+}
+
+// ShellScope maps the context of a call to the key of the shell it runs
+// in: calls with the same key share a shell.
+type ShellScope func(ctx context.Context) string
+
+// SessionScope gives each session a shell of its own.
+func SessionScope(ctx context.Context) string {
+	return agent.ContextSessionID(ctx)
+}
+
+// AgentScope shares one shell between all calls.
+func AgentScope(context.Context) string {
+	return ""
+}
+
+// ShellPool holds the persistent shells of a BashTool, one per scope key.
+// Shells start in the working directory and with the environment of the
+// context of their first call. A shell lives until it is closed: register
+// CloseSession with agent.WithOnSessionClose to close each session's shell
+// when the session ends.
+type ShellPool struct {
+	scope ShellScope
+
+	mu     sync.Mutex
+	shells map[string]*Shell
+}
+
+// NewShellPool returns a pool keeping a shell per key of scope, or per
+// session if scope is nil.
+func NewShellPool(scope ShellScope) *ShellPool {
+	if scope == nil {
+		scope = SessionScope
+	}
+	return &ShellPool{scope: scope, shells: make(map[string]*Shell)}
+}
+
+// Shell returns the shell for ctx, creating it if needed.
+func (p *ShellPool) Shell(ctx context.Context) *Shell {
+	key := p.scope(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.shells[key]; ok {
+		return s
+	}
+	var env []string
+	if vars := agent.ContextEnv(ctx); len(vars) > 0 {
+		env = os.Environ()
+		for k, v := range vars {
+			env = append(env, k+"="+v)
+		}
+	}
+	s := NewShell(agent.ContextWorkDir(ctx), env)
+	p.shells[key] = s
+	return s
+}
+
+// Close kills the shell for key, such as the ID of a session that ended,
+// and removes it from the pool.
+func (p *ShellPool) Close(key string) error {
+	p.mu.Lock()
+	s, ok := p.shells[key]
+	delete(p.shells, key)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.Close()
+}
+
+// CloseSession closes the shell of the session sessionID's key. It has the
+// signature of an agent.WithOnSessionClose callback. The shell shared by
+// all sessions under AgentScope is left for CloseAll.
+func (p *ShellPool) CloseSession(ctx context.Context, sessionID string) error {
+	key := p.scope(agent.WithContextSessionID(ctx, sessionID))
+	if key == "" {
+		return nil
+	}
+	return p.Close(key)
+}
+
+// CloseAll kills all shells in the pool.
+func (p *ShellPool) CloseAll() error {
+	p.mu.Lock()
+	shells := p.shells
+	p.shells = make(map[string]*Shell)
+	p.mu.Unlock()
+	var errs []error
+	for _, s := range shells {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+const shellSupported = false
+
+func setProcessGroup(*exec.Cmd) {}
+
+func killProcessGroup(int) error { return ErrShellUnsupported }
+
+func childProcessGroups(int) map[int]bool { return nil }
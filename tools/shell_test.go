@@ -0,0 +1,290 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+)
+
+func newTestShell(t *testing.T) *Shell {
+	t.Helper()
+	if !shellSupported {
+		t.Skip(ErrShellUnsupported)
+	}
+	s := NewShell(t.TempDir(), nil)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func runShell(t *testing.T, s *Shell, command string) *ShellResult {
+	t.Helper()
+	res, err := s.Run(context.Background(), command, 10*time.Second)
+	require.NoError(t, err)
+	return res
+}
+
+func TestShell_StatePersists(t *testing.T) {
+	s := newTestShell(t)
+	dir := t.TempDir()
+
+	res := runShell(t, s, "mkdir -p "+dir+"/venv && printf 'export VENV=on\\ndeactivate() { unset VENV; }\\n' > "+dir+"/venv/activate")
+	require.Equal(t, 0, res.ExitCode, res.Output)
+
+	res = runShell(t, s, "cd "+dir+" && source venv/activate && export GREETING=hi && shout() { echo \"$1!\"; }")
+	assert.Equal(t, 0, res.ExitCode, res.Output)
+	assert.Equal(t, dir, res.Cwd)
+
+	res = runShell(t, s, `pwd; echo "$GREETING $VENV"; shout hey; deactivate; echo "[$VENV]"`)
+	assert.Equal(t, dir+"\nhi on\nhey!\n[]\n", res.Output)
+	assert.Equal(t, dir, s.Cwd())
+}
+
+func TestShell_ExitCodeAndOutput(t *testing.T) {
+	s := newTestShell(t)
+
+	res := runShell(t, s, "echo out; echo err >&2; false")
+	assert.Equal(t, 1, res.ExitCode)
+	assert.Equal(t, "out\nerr\n", res.Output)
+
+	res = runShell(t, s, "printf 'no newline'")
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Equal(t, "no newline", res.Output)
+
+	// A syntax error fails the command, not the shell.
+	res = runShell(t, s, "echo 'unterminated")
+	assert.Equal(t, 2, res.ExitCode)
+	assert.False(t, res.Exited)
+
+	// Commands don't read the shell's input.
+	res = runShell(t, s, "cat; echo done")
+	assert.Equal(t, "done\n", res.Output)
+
+	res = runShell(t, s, "yes | head -c 100000")
+	assert.Len(t, res.Output, maxOutputBytes+len("\n... [output truncated]"))
+	assert.True(t, strings.HasSuffix(res.Output, "... [output truncated]"))
+	assert.Equal(t, "ok\n", runShell(t, s, "echo ok").Output)
+}
+
+func TestShell_TimeoutKillsOnlyCommand(t *testing.T) {
+	s := newTestShell(t)
+
+	res := runShell(t, s, "export KEEP=1; sleep 30 & echo $!")
+	require.Equal(t, 0, res.ExitCode, res.Output)
+	job := strings.TrimSpace(res.Output)
+
+	start := time.Now()
+	res, err := s.Run(context.Background(), "sleep 30", 300*time.Millisecond)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.True(t, res.TimedOut)
+	assert.False(t, res.Exited)
+	assert.NotEqual(t, 0, res.ExitCode)
+
+	// The shell, its state and the earlier background job survive.
+	res = runShell(t, s, "echo $KEEP; kill -0 "+job+" && echo alive")
+	assert.False(t, res.Restarted)
+	assert.Equal(t, "1\nalive\n", res.Output)
+}
+
+func TestShell_TimeoutKillsJobsTheCommandStarted(t *testing.T) {
+	s := newTestShell(t)
+
+	res := runShell(t, s, "sleep 30 & echo $!")
+	kept := strings.TrimSpace(res.Output)
+	res, err := s.Run(context.Background(), "sleep 31 & echo $!; sleep 30", 300*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, res.TimedOut)
+	started, _, _ := strings.Cut(res.Output, "\n")
+
+	res = runShell(t, s, "kill -0 "+kept+" && echo kept; wait "+started+" 2>/dev/null; kill -0 "+started+" 2>/dev/null || echo killed")
+	assert.Equal(t, "kept\nkilled\n", res.Output)
+}
+
+func TestShell_LargeStateNotRestored(t *testing.T) {
+	s := newTestShell(t)
+	dir := t.TempDir()
+
+	res := runShell(t, s, "cd "+dir+" && export BIG=$(head -c 2000000 /dev/zero | tr '\\0' x) && echo ${#BIG}")
+	require.Equal(t, "2000000\n", res.Output)
+	assert.Equal(t, dir, res.Cwd)
+
+	runShell(t, s, "exit")
+	res = runShell(t, s, `pwd; echo "[${#BIG}]"`)
+	assert.True(t, res.Restarted)
+	assert.Equal(t, dir+"\n[0]\n", res.Output, "only the working directory is restored")
+}
+
+func TestCommandOutput_CapsState(t *testing.T) {
+	m := newShellMarker()
+	out := newCommandOutput(m, maxOutputBytes)
+	stream := "hello\n" + m.String() + " 0 /tmp/a b\n12 34 \n" + strings.Repeat("x", 3*maxShellState) + "\n" + m.String() + "-end\n"
+	for len(stream) > 0 && !out.complete() {
+		n := min(len(stream), 4093)
+		out.write([]byte(stream[:n]))
+		stream = stream[n:]
+	}
+	require.True(t, out.complete())
+	assert.Equal(t, "hello", out.text())
+	assert.Less(t, len(out.rest), 100, "the state is dropped")
+
+	status, cwd, jobs, state := out.trailer()
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "/tmp/a b", cwd)
+	assert.Equal(t, map[int]bool{12: true, 34: true}, jobs)
+	assert.Equal(t, "cd -- '/tmp/a b'", state)
+}
+
+func TestShell_Interrupted(t *testing.T) {
+	s := newTestShell(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	res, err := s.Run(ctx, "sleep 30", 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, res.Interrupted)
+	assert.False(t, res.TimedOut)
+	assert.Equal(t, "ok\n", runShell(t, s, "echo ok").Output)
+}
+
+func TestShell_RestartsAfterExit(t *testing.T) {
+	s := newTestShell(t)
+	dir := t.TempDir()
+
+	runShell(t, s, "cd "+dir+"; export KEEP=1; LOCAL=1; greet() { echo hello; }")
+	res := runShell(t, s, "echo bye; exit 3")
+	assert.True(t, res.Exited)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Equal(t, "bye\n", res.Output)
+
+	res = runShell(t, s, `pwd; echo "$KEEP[$LOCAL]"; greet`)
+	assert.True(t, res.Restarted)
+	assert.Equal(t, dir+"\n1[]\nhello\n", res.Output)
+
+	// A shell killed from outside is restarted too.
+	res = runShell(t, s, "kill -9 $$")
+	assert.True(t, res.Exited)
+	res = runShell(t, s, "echo $KEEP")
+	assert.True(t, res.Restarted)
+	assert.Equal(t, "1\n", res.Output)
+}
+
+func TestShell_KilledWhenCommandWontStop(t *testing.T) {
+	s := newTestShell(t)
+
+	// A loop in the shell itself has no process group of its own.
+	res, err := s.Run(context.Background(), "echo start; while :; do :; done", 200*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, res.TimedOut)
+	assert.True(t, res.Exited)
+	assert.Equal(t, "start\n", res.Output)
+
+	res = runShell(t, s, "echo ok")
+	assert.True(t, res.Restarted)
+	assert.Equal(t, "ok\n", res.Output)
+}
+
+func TestBashTool_Shells_PerSession(t *testing.T) {
+	if !shellSupported {
+		t.Skip(ErrShellUnsupported)
+	}
+	dir := t.TempDir()
+	pool := NewShellPool(nil)
+	t.Cleanup(func() { pool.CloseAll() })
+	tool := &BashTool{Shells: pool}
+
+	base := agent.WithContextWorkDir(context.Background(), dir)
+	ctxA := agent.WithContextSessionID(base, "sess_a")
+	ctxB := agent.WithContextSessionID(base, "sess_b")
+
+	result, err := tool.Execute(ctxA, BashInput{Command: "mkdir sub && cd sub && export WHO=a"})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, filepath.Join(dir, "sub"), result.Metadata["cwd"])
+
+	result, err = tool.Execute(ctxB, BashInput{Command: `pwd; echo "[$WHO]"`})
+	require.NoError(t, err)
+	assert.Equal(t, dir+"\n[]\n", extractText(result))
+
+	result, err = tool.Execute(ctxA, BashInput{Command: `pwd; echo "[$WHO]"; exit 4`})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Equal(t, 4, result.Metadata["exit_code"])
+	assert.Contains(t, extractText(result), filepath.Join(dir, "sub")+"\n[a]\n")
+	assert.Contains(t, extractText(result), "shell exited with code 4")
+
+	result, err = tool.Execute(ctxA, BashInput{Command: "echo $WHO"})
+	require.NoError(t, err)
+	assert.Equal(t, "[shell restarted: only the working directory, exported variables and functions were kept]\na\n", extractText(result))
+
+	timeoutMs := 200
+	result, err = tool.Execute(ctxB, BashInput{Command: "sleep 30", Timeout: &timeoutMs})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, extractText(result), "command timed out after 200ms")
+
+	require.NoError(t, pool.Close("sess_a"))
+	result, err = tool.Execute(ctxA, BashInput{Command: "pwd; echo \"[$WHO]\""})
+	require.NoError(t, err)
+	assert.Equal(t, dir+"\n[]\n", extractText(result), "a closed session's shell starts afresh")
+}
+
+func TestShellPool_AgentScope(t *testing.T) {
+	pool := NewShellPool(AgentScope)
+	a := pool.Shell(agent.WithContextSessionID(context.Background(), "sess_a"))
+	b := pool.Shell(agent.WithContextSessionID(context.Background(), "sess_b"))
+	assert.Same(t, a, b)
+
+	pool = NewShellPool(nil)
+	a = pool.Shell(agent.WithContextSessionID(context.Background(), "sess_a"))
+	b = pool.Shell(agent.WithContextSessionID(context.Background(), "sess_b"))
+	assert.NotSame(t, a, b)
+	assert.Same(t, a, pool.Shell(agent.WithContextSessionID(context.Background(), "sess_a")))
+}
+
+func TestShellPool_CloseSession(t *testing.T) {
+	if !shellSupported {
+		t.Skip(ErrShellUnsupported)
+	}
+	pool := NewShellPool(nil)
+	t.Cleanup(func() { pool.CloseAll() })
+	ctx := agent.WithContextSessionID(context.Background(), "sess_a")
+	a := pool.Shell(ctx)
+	runShell(t, a, "sleep 30 &")
+
+	require.NoError(t, pool.CloseSession(context.Background(), "sess_a"))
+	assert.Nil(t, a.proc, "the shell and its jobs are killed")
+	assert.NotSame(t, a, pool.Shell(ctx))
+
+	// The shell shared under AgentScope outlives any one session.
+	shared := NewShellPool(AgentScope)
+	t.Cleanup(func() { shared.CloseAll() })
+	s := shared.Shell(ctx)
+	require.NoError(t, shared.CloseSession(context.Background(), "sess_a"))
+	assert.Same(t, s, shared.Shell(ctx))
+}
+
+func TestBashTool_Shells_ClosedWithSession(t *testing.T) {
+	if !shellSupported {
+		t.Skip(ErrShellUnsupported)
+	}
+	pool := NewShellPool(nil)
+	t.Cleanup(func() { pool.CloseAll() })
+	var closed []string
+	c := agent.NewClient(agent.WithOnSessionClose(func(ctx context.Context, id string) error {
+		closed = append(closed, id)
+		return pool.CloseSession(ctx, id)
+	}))
+	ctx := agent.WithContextSessionID(context.Background(), c.Session().ID)
+	runShell(t, pool.Shell(ctx), "export KEEP=1")
+
+	require.NoError(t, c.Close())
+	assert.Equal(t, []string{c.Session().ID}, closed)
+	assert.Equal(t, "[]\n", runShell(t, pool.Shell(ctx), `echo "[$KEEP]"`).Output)
+}
@@ -0,0 +1,86 @@
+//go:build unix
+
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const shellSupported = true
+
+// setProcessGroup makes cmd the leader of a new process group, so that
+// killing the group kills the shell without touching the caller.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(pgid int) error {
+	return syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
+// childProcessGroups returns the process groups of the children of pid
+// other than its own: under job control, one per job of a shell.
+func childProcessGroups(pid int) map[int]bool {
+	groups := make(map[int]bool)
+	for _, p := range listProcesses() {
+		if p.ppid == pid && p.pgid != pid {
+			groups[p.pgid] = true
+		}
+	}
+	return groups
+}
+
+type processInfo struct{ pid, ppid, pgid int }
+
+func listProcesses() []processInfo {
+	if runtime.GOOS == "linux" {
+		return procProcesses()
+	}
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,pgid=").Output()
+	if err != nil {
+		return nil
+	}
+	var procs []processInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) == 3 {
+			procs = append(procs, processInfo{atoi(f[0]), atoi(f[1]), atoi(f[2])})
+		}
+	}
+	return procs
+}
+
+// procProcesses reads the processes from /proc/<pid>/stat, whose fields
+// after the parenthesized command name are state, ppid and pgrp.
+func procProcesses() []processInfo {
+	paths, _ := filepath.Glob("/proc/[0-9]*/stat")
+	procs := make([]processInfo, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // exited meanwhile
+		}
+		stat := string(data)
+		i := strings.LastIndexByte(stat, ')')
+		if i < 0 {
+			continue
+		}
+		f := strings.Fields(stat[i+1:])
+		if len(f) < 3 {
+			continue
+		}
+		pid, _, _ := strings.Cut(stat, " ")
+		procs = append(procs, processInfo{atoi(pid), atoi(f[1]), atoi(f[2])})
+	}
+	return procs
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -35,6 +35,10 @@ func (t *WriteTool) Execute(ctx context.Context, input WriteInput) (*agent.ToolR
 		return agent.ErrorResult(err.Error()), nil
 	}
 
+	if err := recordWrite(ctx, resolved); err != nil {
+		return agent.ErrorResult(err.Error()), nil
+	}
+
 	dir := filepath.Dir(resolved)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return agent.ErrorResult(fmt.Sprintf("failed to create directory: %s", err.Error())), nil
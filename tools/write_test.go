@@ -8,6 +8,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	agent "github.com/armatrix/claude-agent-sdk-go"
+	"github.com/armatrix/claude-agent-sdk-go/checkpoint"
 )
 
 func TestWriteTool_Name(t *testing.T) {
@@ -94,3 +97,18 @@ func TestWriteTool_Execute_EmptyFilePath(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, result.IsError)
 }
+
+func TestWriteTool_Execute_RecordsCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "new.txt")
+
+	tracker := checkpoint.NewTracker()
+	ctx := agent.WithContextCheckpoint(context.Background(), tracker)
+	result, err := (&WriteTool{}).Execute(ctx, WriteInput{FilePath: path, Content: "hi"})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, []string{path}, tracker.Paths())
+
+	require.NoError(t, tracker.Rewind())
+	assert.NoFileExists(t, path)
+}
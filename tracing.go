@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/armatrix/claude-agent-sdk-go/internal/engine"
+)
+
+// TracerName is the instrumentation scope of the spans the SDK creates.
+const TracerName = "github.com/armatrix/claude-agent-sdk-go"
+
+// Span attributes the SDK reports alongside the GenAI semantic conventions.
+const (
+	AttrRetryCount     = engine.AttrRetryCount
+	AttrToolIsError    = engine.AttrToolIsError
+	AttrPermission     = engine.AttrPermission
+	AttrHookDurationMs = engine.AttrHookDurationMs
+	AttrNumTurns       = attribute.Key("agent.num_turns")
+	AttrTotalCostUSD   = attribute.Key("agent.total_cost_usd")
+)
+
+// WithTracerProvider enables OpenTelemetry tracing with tp. Each run creates
+// an "invoke_agent" span with child "chat" spans per API call and
+// "execute_tool" spans per tool execution, following the GenAI semantic
+// conventions. Without this option, runs started inside a recording span use
+// that span's provider, and others use the global provider (a no-op unless
+// configured).
+func WithTracerProvider(tp trace.TracerProvider) AgentOption {
+	return func(o *agentOptions) { o.tracerProvider = tp }
+}
+
+// WithName sets the agent's name, reported as gen_ai.agent.name on its spans.
+// Subagents and team members are named after their definitions.
+func WithName(name string) AgentOption {
+	return func(o *agentOptions) { o.name = name }
+}
+
+// Name returns the name set with WithName, or "".
+func (a *Agent) Name() string {
+	return a.opts.name
+}
+
+// TracerFromContext returns a tracer from the provider of the span in ctx,
+// falling back to the global provider. Tools and extensions use it so their
+// spans join the run's trace.
+func TracerFromContext(ctx context.Context) trace.Tracer {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider().Tracer(TracerName)
+	}
+	return otel.GetTracerProvider().Tracer(TracerName)
+}
+
+// tracer returns the tracer for a run started with ctx.
+func (a *Agent) tracer(ctx context.Context) trace.Tracer {
+	if a.opts.tracerProvider != nil {
+		return a.opts.tracerProvider.Tracer(TracerName)
+	}
+	return TracerFromContext(ctx)
+}
+
+// providerName returns the gen_ai.provider.name of the agent's backend.
+// Providers may report theirs with a Name method.
+func (a *Agent) providerName() string {
+	if named, ok := a.opts.provider.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return engine.DefaultProviderName
+}
+
+// startRunSpan starts the root span of a run on model, named
+// "invoke_agent {name}".
+func (a *Agent) startRunSpan(ctx context.Context, tracer trace.Tracer, sessionID string, model anthropic.Model) (context.Context, trace.Span) {
+	name := "invoke_agent"
+	if a.opts.name != "" {
+		name += " " + a.opts.name
+	}
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			semconv.GenAIOperationNameInvokeAgent,
+			semconv.GenAIProviderNameKey.String(a.providerName()),
+			semconv.GenAIRequestModel(string(model)),
+			semconv.GenAIConversationID(sessionID),
+		))
+	if a.opts.name != "" {
+		span.SetAttributes(semconv.GenAIAgentName(a.opts.name))
+	}
+	return ctx, span
+}
+
+// recordRunResult sets the run's totals and outcome on its root span.
+func recordRunResult(span trace.Span, info engine.ResultInfo) {
+	cost, _ := info.TotalCost.Float64()
+	span.SetAttributes(
+		semconv.GenAIUsageInputTokens(int(info.InputTokens)),
+		semconv.GenAIUsageOutputTokens(int(info.OutputTokens)),
+		semconv.GenAIUsageCacheReadInputTokens(int(info.CacheReadInputTokens)),
+		semconv.GenAIUsageCacheCreationInputTokens(int(info.CacheCreationInputTokens)),
+		AttrNumTurns.Int(info.NumTurns),
+		AttrTotalCostUSD.Float64(cost),
+	)
+	if info.IsError {
+		desc := info.Subtype
+		if len(info.Errors) > 0 {
+			desc = info.Errors[0]
+		}
+		span.SetAttributes(semconv.ErrorTypeKey.String(info.Subtype))
+		span.SetStatus(codes.Error, desc)
+	}
+}
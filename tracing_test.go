@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// scriptedProvider replays one canned SSE response per request.
+type scriptedProvider struct {
+	mu        sync.Mutex
+	responses []string
+}
+
+func (p *scriptedProvider) NewStreaming(context.Context, anthropic.MessageNewParams) *ssestream.Stream[anthropic.MessageStreamEventUnion] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.responses) == 0 {
+		return ssestream.NewStream[anthropic.MessageStreamEventUnion](nil, fmt.Errorf("no scripted response"))
+	}
+	body := p.responses[0]
+	p.responses = p.responses[1:]
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}
+	return ssestream.NewStream[anthropic.MessageStreamEventUnion](ssestream.NewDecoder(resp), nil)
+}
+
+func sseEvents(events ...string) string {
+	var sb strings.Builder
+	for _, e := range events {
+		var head struct{ Type string }
+		_ = json.Unmarshal([]byte(e), &head)
+		fmt.Fprintf(&sb, "event: %s\ndata: %s\n\n", head.Type, e)
+	}
+	return sb.String()
+}
+
+func textResponse(text string) string {
+	return sseEvents(
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"test-model","content":[],"stop_reason":null,"usage":{"input_tokens":10,"output_tokens":0}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`, text),
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	)
+}
+
+func toolUseResponse(id, name string) string {
+	return sseEvents(
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"test-model","content":[],"stop_reason":null,"usage":{"input_tokens":10,"output_tokens":0}}}`,
+		fmt.Sprintf(`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":%q,"name":%q,"input":{}}}`, id, name),
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{}"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	)
+}
+
+// delegateTool runs a child agent with the tool call's context, as the
+// subagent Task tool does.
+type delegateTool struct{ child *Agent }
+
+type delegateInput struct{}
+
+func (d *delegateTool) Name() string        { return "Delegate" }
+func (d *delegateTool) Description() string { return "Delegate to a child agent" }
+func (d *delegateTool) Execute(ctx context.Context, _ delegateInput) (*ToolResult, error) {
+	stream := d.child.Run(ctx, "sub task")
+	for stream.Next() {
+	}
+	return TextResult("delegated"), nil
+}
+
+func TestRun_TracesWholeRunAsOneTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	child := NewAgent(WithName("helper"),
+		WithProvider(&scriptedProvider{responses: []string{textResponse("child done")}}))
+	parent := NewAgent(WithName("main"), WithTracerProvider(tp),
+		WithProvider(&scriptedProvider{responses: []string{toolUseResponse("toolu_1", "Delegate"), textResponse("done")}}))
+	RegisterTool(parent.Tools(), &delegateTool{child: child})
+
+	stream := parent.Run(context.Background(), "go")
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		byName[s.Name] = s
+	}
+	root, ok := byName["invoke_agent main"]
+	require.True(t, ok, "missing root span")
+	tool := byName["execute_tool Delegate"]
+	sub := byName["invoke_agent helper"]
+
+	traceID := root.SpanContext.TraceID()
+	for _, s := range exporter.GetSpans() {
+		assert.Equal(t, traceID, s.SpanContext.TraceID(), s.Name)
+	}
+	assert.Equal(t, root.SpanContext.SpanID(), tool.Parent.SpanID())
+	assert.Equal(t, tool.SpanContext.SpanID(), sub.Parent.SpanID())
+	assert.Len(t, exporter.GetSpans(), 6, "2 runs, 3 chat calls, 1 tool")
+
+	attrs := map[string]any{}
+	for _, kv := range root.Attributes {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, "invoke_agent", attrs["gen_ai.operation.name"])
+	assert.Equal(t, "main", attrs["gen_ai.agent.name"])
+	assert.Equal(t, stream.Session().ID, attrs["gen_ai.conversation.id"])
+	assert.Equal(t, int64(20), attrs["gen_ai.usage.input_tokens"])
+	assert.Equal(t, int64(2), attrs[string(AttrNumTurns)])
+	assert.Equal(t, codes.Unset, root.Status.Code)
+}
+
+func TestRun_TracesFailedRun(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	a := NewAgent(WithTracerProvider(tp), WithProvider(&scriptedProvider{}))
+	stream := a.Run(context.Background(), "go")
+	for stream.Next() {
+	}
+
+	var root tracetest.SpanStub
+	for _, s := range exporter.GetSpans() {
+		if s.Name == "invoke_agent" {
+			root = s
+		}
+	}
+	assert.Equal(t, codes.Error, root.Status.Code)
+	assert.Contains(t, root.Status.Description, "no scripted response")
+}